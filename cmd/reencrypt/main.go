@@ -0,0 +1,78 @@
+// Command reencrypt seals SMTP passwords and TOTP secrets still stored in
+// plaintext and moves every sealed one to the active credential key. Run it
+// after loading a new key and making it active; the previous key can be
+// dropped from the keyring once a run reports no failures.
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/config"
+	"github.com/jmechavez/email-account-tracker/infrastructure/db"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/infrastructure/mail"
+	"github.com/jmechavez/email-account-tracker/infrastructure/secrets"
+	"github.com/jmechavez/email-account-tracker/internal/ports/services"
+	"go.uber.org/zap"
+)
+
+func main() {
+	logger.Initialize()
+	defer logger.Sync()
+
+	batchSize := flag.Int("batch", 100, "number of users read per query")
+	flag.Parse()
+
+	cfg := config.Load()
+	keyring, err := secrets.LoadKeyring(cfg.CredentialKeyFile, cfg.CredentialKeys, cfg.CredentialActiveKey)
+	if err != nil {
+		logger.Fatal("Failed to load the credential keyring", zap.Error(err))
+	}
+
+	conn := db.Connect()
+	server := mail.NewSmtpServer(cfg.SmtpHost, cfg.SmtpPort, cfg.SmtpTimeout)
+	smtpCredentials := services.NewSmtpCredentialService(
+		db.NewSmtpCredentialRepositoryDb(conn), // SMTP credential repository
+		keyring,                                // Credential encryption keys
+		server,                                 // SMTP server credentials are verified against
+		cfg.SmtpCredentialConsumers,            // Components allowed to decrypt
+	)
+	totp := services.NewTOTP(cfg.MfaIssuer, services.SystemClock{})
+	mfa := services.NewMfaService(
+		db.NewMfaRepositoryDb(conn),  // TOTP secrets
+		db.NewUserRepositoryDb(conn), // User repository
+		db.NewRoleRepositoryDb(conn), // Role repository
+		totp,                         // TOTP code generator
+		keyring,                      // Credential encryption keys
+	)
+
+	runs := []struct {
+		secret    string
+		reencrypt func(int) (*services.ReencryptionReport, *errors.AppError)
+	}{
+		{"smtp_password", smtpCredentials.Reencrypt},
+		{"mfa_secret", mfa.Reencrypt},
+	}
+	failed := false
+	for _, run := range runs {
+		report, appErr := run.reencrypt(*batchSize)
+		if appErr != nil {
+			logger.Fatal("Re-encryption stopped", zap.String("secret", run.secret), zap.Error(appErr))
+		}
+
+		logger.Info("Re-encryption finished",
+			zap.String("secret", run.secret),
+			zap.String("key_id", keyring.ActiveKeyId()),
+			zap.Int("sealed", report.Sealed),
+			zap.Int("rewrapped", report.Rewrapped),
+			zap.Int("failed", report.Failed),
+		)
+		failed = failed || report.Failed > 0
+	}
+	if failed {
+		logger.Sync()
+		os.Exit(1)
+	}
+}
@@ -1,15 +1,23 @@
 package errors
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+)
 
 type AppError struct {
-	Code    int    `json:"code,omitempty"`
-	Message string `json:"message"`
+	Code    int      `json:"code,omitempty"`
+	Message string   `json:"message"`
+	Details []string `json:"details,omitempty"`
+	// RetryAfter is sent as the Retry-After header, in seconds, when not zero
+	RetryAfter int `json:"-"`
 }
 
 func (e AppError) AsMessage() *AppError {
 	return &AppError{
-		Message: e.Message,
+		Message:    e.Message,
+		Details:    e.Details,
+		RetryAfter: e.RetryAfter,
 	}
 }
 
@@ -39,6 +47,15 @@ func NewValidationError(message string) *AppError {
 	}
 }
 
+// NewValidationErrorWithDetails lists every reason a value was rejected
+func NewValidationErrorWithDetails(message string, details []string) *AppError {
+	return &AppError{
+		Message: message,
+		Code:    http.StatusUnprocessableEntity,
+		Details: details,
+	}
+}
+
 // Additional error types
 func NewBadRequestError(message string) *AppError {
 	return &AppError{
@@ -82,6 +99,19 @@ func NewTooManyRequestsError(message string) *AppError {
 	}
 }
 
+// NewTooManyRequestsErrorRetryAfter tells the client how long to wait, rounded up to whole seconds
+func NewTooManyRequestsErrorRetryAfter(message string, retryAfter time.Duration) *AppError {
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return &AppError{
+		Message:    message,
+		Code:       http.StatusTooManyRequests,
+		RetryAfter: seconds,
+	}
+}
+
 // Utility method to check if a specific error is of a certain type
 func IsNotFoundError(err *AppError) bool {
 	return err != nil && err.Code == http.StatusNotFound
@@ -94,3 +124,15 @@ func IsValidationError(err *AppError) bool {
 func IsBadRequestError(err *AppError) bool {
 	return err != nil && err.Code == http.StatusBadRequest
 }
+
+func IsConflictError(err *AppError) bool {
+	return err != nil && err.Code == http.StatusConflict
+}
+
+func IsAuthenticationError(err *AppError) bool {
+	return err != nil && err.Code == http.StatusUnauthorized
+}
+
+func IsAuthorizationError(err *AppError) bool {
+	return err != nil && err.Code == http.StatusForbidden
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the application settings read from the environment
+type Config struct {
+	// EmailStrategies is the ordered list of address strategies tried when minting an email
+	EmailStrategies []string
+	// AliasGracePeriod is how long a previous address keeps receiving mail after a surname change
+	AliasGracePeriod time.Duration
+	// RetentionPeriod is how long a deleted user is kept before being anonymized
+	RetentionPeriod time.Duration
+	// PurgePeriod is how long a deleted user is kept before being hard-deleted
+	PurgePeriod time.Duration
+	// RetentionJobInterval is how often the retention job runs; zero disables it
+	RetentionJobInterval time.Duration
+	// ReactivationInterval is how often expired suspensions are lifted; zero disables it
+	ReactivationInterval time.Duration
+	// JWTSecret is the HMAC key signing access tokens; a random key is used when unset
+	JWTSecret string
+	// JWTIssuer is the iss claim written into and required from access tokens
+	JWTIssuer string
+	// AccessTokenTTL is how long an access token is accepted after login or refresh
+	AccessTokenTTL time.Duration
+	// RefreshTokenTTL is how long a refresh token can be exchanged for a new pair
+	RefreshTokenTTL time.Duration
+	// PasswordResetTTL is how long a self-service password reset token stays usable
+	PasswordResetTTL time.Duration
+	// MfaIssuer is the name authenticator apps show for TOTP codes of this service
+	MfaIssuer string
+	// PublicRoutes are the route templates served without a bearer token
+	PublicRoutes []string
+	// PasswordMinLength is the fewest characters a new password may have
+	PasswordMinLength int
+	// PasswordClasses are the character classes (upper, lower, digit, symbol) a password must contain
+	PasswordClasses []string
+	// PasswordBannedFile is a local file of refused passwords, one per line
+	PasswordBannedFile string
+	// PasswordHistory is how many previous passwords cannot be reused
+	PasswordHistory int
+	// PasswordMaxAge is how long a password lasts before it must be changed; zero never expires
+	PasswordMaxAge time.Duration
+	// CredentialKeyFile is a local file of key-encryption keys for SMTP credentials, one id:base64 per line
+	CredentialKeyFile string
+	// CredentialKeys are further key-encryption keys given as id:base64
+	CredentialKeys []string
+	// CredentialActiveKey is the ID of the key new SMTP credentials are sealed with
+	CredentialActiveKey string
+	// SmtpCredentialConsumers are the components allowed to decrypt SMTP credentials
+	SmtpCredentialConsumers []string
+	// SmtpHost is the mail server SMTP credentials are verified against; empty disables verification
+	SmtpHost string
+	// SmtpPort is the submission port of SmtpHost
+	SmtpPort int
+	// SmtpTimeout bounds connecting to and talking with SmtpHost
+	SmtpTimeout time.Duration
+	// NotificationSender is the id_no of the user whose SMTP credentials notifications are sent with; empty only logs them
+	NotificationSender string
+	// NotificationEvents are the notifications that are sent: welcome, address_changed, password_reset
+	NotificationEvents []string
+	// NotificationTemplateDir replaces the built-in notification templates when set
+	NotificationTemplateDir string
+	// NotificationQueueSize is how many notifications can wait for delivery
+	NotificationQueueSize int
+	// NotificationMaxAttempts is how often a notification is tried before it is dropped
+	NotificationMaxAttempts int
+	// NotificationRetryDelay is the wait after a first failed delivery, doubled after each further failure
+	NotificationRetryDelay time.Duration
+	// OutboxSinks are where domain events are published: log, webhook
+	OutboxSinks []string
+	// OutboxWebhookURL receives domain events as JSON when the webhook sink is used
+	OutboxWebhookURL string
+	// OutboxWebhookSecret signs webhook bodies with HMAC-SHA256 when set
+	OutboxWebhookSecret string
+	// OutboxWebhookTimeout bounds one webhook request
+	OutboxWebhookTimeout time.Duration
+	// OutboxInterval is how often the outbox is dispatched; zero disables it
+	OutboxInterval time.Duration
+	// OutboxBatchSize is how many events are claimed at a time
+	OutboxBatchSize int
+	// OutboxRetryDelay is the wait after a first failed publish, doubled after each further failure
+	OutboxRetryDelay time.Duration
+	// OutboxRetention is how long delivered events are kept before they are deleted; zero keeps them
+	OutboxRetention time.Duration
+	// LoginAttemptStore is where failed login counters are kept: postgres or memory
+	LoginAttemptStore string
+	// LoginMaxFailures is how many failed logins lock out a user identity
+	LoginMaxFailures int
+	// LoginMaxIpFailures is how many failed logins lock out a client address
+	LoginMaxIpFailures int
+	// LoginLockout is how long a lockout lasts, and how long failures are remembered
+	LoginLockout time.Duration
+	// LoginDelay is the wait after a first failed login, doubled after each further failure
+	LoginDelay time.Duration
+}
+
+// Load reads the application configuration from environment variables
+func Load() Config {
+	return Config{
+		EmailStrategies:         getEnvList("EMAIL_STRATEGIES", nil),
+		AliasGracePeriod:        getEnvDays("ALIAS_GRACE_DAYS", 90),
+		RetentionPeriod:         getEnvDays("RETENTION_DAYS", 365),
+		PurgePeriod:             getEnvDays("PURGE_AFTER_DAYS", 730),
+		RetentionJobInterval:    time.Duration(getEnvInt("RETENTION_JOB_INTERVAL_HOURS", 24)) * time.Hour,
+		ReactivationInterval:    time.Duration(getEnvInt("REACTIVATION_INTERVAL_MINUTES", 5)) * time.Minute,
+		JWTSecret:               getEnv("JWT_SECRET", ""),
+		JWTIssuer:               getEnv("JWT_ISSUER", "email-account-tracker"),
+		AccessTokenTTL:          time.Duration(getEnvInt("ACCESS_TOKEN_TTL_MINUTES", 15)) * time.Minute,
+		RefreshTokenTTL:         getEnvDays("REFRESH_TOKEN_TTL_DAYS", 30),
+		PasswordResetTTL:        time.Duration(getEnvInt("PASSWORD_RESET_TTL_MINUTES", 60)) * time.Minute,
+		MfaIssuer:               getEnv("MFA_ISSUER", "Email Account Tracker"),
+		PublicRoutes:            getEnvList("PUBLIC_ROUTES", []string{"/health", "/auth/login", "/auth/login/mfa", "/auth/refresh", "/auth/logout", "/auth/password-reset", "/auth/password-reset/confirm"}),
+		PasswordMinLength:       getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordClasses:         getEnvList("PASSWORD_CLASSES", nil),
+		PasswordBannedFile:      getEnv("PASSWORD_BANNED_FILE", ""),
+		PasswordHistory:         getEnvInt("PASSWORD_HISTORY", 5),
+		PasswordMaxAge:          getEnvDays("PASSWORD_MAX_AGE_DAYS", 0),
+		CredentialKeyFile:       getEnv("CREDENTIAL_KEY_FILE", ""),
+		CredentialKeys:          getEnvList("CREDENTIAL_KEYS", nil),
+		CredentialActiveKey:     getEnv("CREDENTIAL_ACTIVE_KEY", ""),
+		SmtpCredentialConsumers: getEnvList("SMTP_CREDENTIAL_CONSUMERS", []string{"mailer"}),
+		SmtpHost:                getEnv("SMTP_HOST", ""),
+		SmtpPort:                getEnvInt("SMTP_PORT", 587),
+		SmtpTimeout:             time.Duration(getEnvInt("SMTP_TIMEOUT_SECONDS", 10)) * time.Second,
+		NotificationSender:      getEnv("NOTIFICATION_SENDER", ""),
+		NotificationEvents:      getEnvList("NOTIFICATION_EVENTS", []string{"welcome", "address_changed", "password_reset"}),
+		NotificationTemplateDir: getEnv("NOTIFICATION_TEMPLATE_DIR", ""),
+		NotificationQueueSize:   getEnvInt("NOTIFICATION_QUEUE_SIZE", 100),
+		NotificationMaxAttempts: getEnvInt("NOTIFICATION_MAX_ATTEMPTS", 5),
+		NotificationRetryDelay:  time.Duration(getEnvInt("NOTIFICATION_RETRY_SECONDS", 30)) * time.Second,
+		OutboxSinks:             getEnvList("OUTBOX_SINKS", []string{"log"}),
+		OutboxWebhookURL:        getEnv("OUTBOX_WEBHOOK_URL", ""),
+		OutboxWebhookSecret:     getEnv("OUTBOX_WEBHOOK_SECRET", ""),
+		OutboxWebhookTimeout:    time.Duration(getEnvInt("OUTBOX_WEBHOOK_TIMEOUT_SECONDS", 10)) * time.Second,
+		OutboxInterval:          time.Duration(getEnvInt("OUTBOX_INTERVAL_SECONDS", 5)) * time.Second,
+		OutboxBatchSize:         getEnvInt("OUTBOX_BATCH_SIZE", 100),
+		OutboxRetryDelay:        time.Duration(getEnvInt("OUTBOX_RETRY_SECONDS", 30)) * time.Second,
+		OutboxRetention:         getEnvDays("OUTBOX_RETENTION_DAYS", 7),
+		LoginAttemptStore:       getEnv("LOGIN_ATTEMPT_STORE", "postgres"),
+		LoginMaxFailures:        getEnvInt("LOGIN_MAX_FAILURES", 5),
+		LoginMaxIpFailures:      getEnvInt("LOGIN_MAX_IP_FAILURES", 50),
+		LoginLockout:            time.Duration(getEnvInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute,
+		LoginDelay:              time.Duration(getEnvInt("LOGIN_DELAY_SECONDS", 1)) * time.Second,
+	}
+}
+
+// getEnv returns the value of an environment variable or a fallback when unset
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvList returns a comma separated environment variable as a trimmed slice
+func getEnvList(key string, fallback []string) []string {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvInt returns an integer environment variable or a fallback when unset or invalid
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvDays returns an environment variable holding a number of days as a duration
+func getEnvDays(key string, fallback int) time.Duration {
+	return time.Duration(getEnvInt(key, fallback)) * 24 * time.Hour
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+type ApiKeyRepository struct {
+	emailDB *sqlx.DB
+}
+
+func (r ApiKeyRepository) ApiKeys() ([]domain.ApiKey, *errors.AppError) {
+	logger.Info("Fetching API keys")
+	var keys []domain.ApiKey
+	if err := r.emailDB.Select(&keys, "SELECT * FROM api_keys ORDER BY id"); err != nil {
+		logger.Error("Database error while fetching API keys", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	logger.Info("Successfully fetched API keys", zap.Int("count", len(keys)))
+	return keys, nil
+}
+
+func (r ApiKeyRepository) ApiKeyByHash(keyHash string) (*domain.ApiKey, *errors.AppError) {
+	var key domain.ApiKey
+	err := r.emailDB.Get(&key, "SELECT * FROM api_keys WHERE key_hash = $1", keyHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.NewNotFoundError("API key not found")
+		}
+		logger.Error("Database error while fetching API key", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return &key, nil
+}
+
+func (r ApiKeyRepository) CreateApiKey(key domain.ApiKey) (*domain.ApiKey, *errors.AppError) {
+	logger.Info("Creating API key", zap.String("name", key.Name), zap.String("prefix", key.Prefix))
+	createApiKeySql := `
+		INSERT INTO api_keys (name, prefix, key_hash, scopes, department, date_created, created_by, date_expires)
+		VALUES (:name, :prefix, :key_hash, :scopes, :department, NOW(), :created_by, :date_expires)
+		RETURNING *
+	`
+	rows, err := r.emailDB.NamedQuery(createApiKeySql, key)
+	if err != nil {
+		logger.Error("Error while creating API key", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer rows.Close()
+
+	var created domain.ApiKey
+	if !rows.Next() {
+		logger.Error("No rows returned after API key insert")
+		return nil, errors.NewUnExpectedError("API key creation failed")
+	}
+	if err := rows.StructScan(&created); err != nil {
+		logger.Error("Error scanning API key", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+
+	logger.Info("API key created successfully", zap.Int64("id", created.Id))
+	return &created, nil
+}
+
+func (r ApiKeyRepository) RevokeApiKey(id int64, revokedBy string) (*domain.ApiKey, *errors.AppError) {
+	logger.Info("Revoking API key", zap.Int64("id", id))
+	revokeSql := `
+		UPDATE api_keys SET date_revoked = CURRENT_TIMESTAMP, revoked_by = $2
+		WHERE id = $1 AND date_revoked IS NULL
+		RETURNING *
+	`
+	var revoked domain.ApiKey
+	if err := r.emailDB.Get(&revoked, revokeSql, id, revokedBy); err != nil {
+		if err == sql.ErrNoRows {
+			logger.Warn("API key not found or already revoked", zap.Int64("id", id))
+			return nil, errors.NewNotFoundError("API key not found")
+		}
+		logger.Error("Database error while revoking API key", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return &revoked, nil
+}
+
+func (r ApiKeyRepository) RecordUsage(id int64, ip string) *errors.AppError {
+	usageSql := "UPDATE api_keys SET date_last_used = CURRENT_TIMESTAMP, last_used_ip = $2 WHERE id = $1"
+	if _, err := r.emailDB.Exec(usageSql, id, sql.NullString{String: ip, Valid: ip != ""}); err != nil {
+		logger.Error("Error recording API key usage", zap.Int64("id", id), zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	return nil
+}
+
+func NewApiKeyRepositoryDb(db *sqlx.DB) ApiKeyRepository {
+	logger.Info("Initializing ApiKeyRepository")
+	return ApiKeyRepository{db}
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// createAliasSql is shared with UserEmailRepository.UpdateSurname
+const createAliasSql = `
+	INSERT INTO email_aliases (
+		id_no, alias, reason, ticket_no, date_expires, date_created, created_by
+	) VALUES (
+		:id_no, :alias, :reason, :ticket_no, :date_expires, NOW(), :created_by
+	)
+	RETURNING *
+`
+
+type EmailAliasRepository struct {
+	emailDB *sqlx.DB
+}
+
+func (r EmailAliasRepository) Aliases(idNo string) ([]domain.EmailAlias, *errors.AppError) {
+	logger.Info("Fetching email aliases", zap.String("id_no", idNo))
+	var aliases []domain.EmailAlias
+	err := r.emailDB.Select(&aliases, "SELECT * FROM email_aliases WHERE id_no = $1 ORDER BY date_created DESC", idNo)
+	if err != nil {
+		logger.Error("Database error while fetching email aliases", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	logger.Info("Successfully fetched email aliases", zap.Int("count", len(aliases)))
+	return aliases, nil
+}
+
+func (r EmailAliasRepository) CreateAlias(alias domain.EmailAlias) (*domain.EmailAlias, *errors.AppError) {
+	logger.Info("Creating email alias", zap.String("id_no", alias.IdNo), zap.String("alias", alias.Alias))
+	created, appErr := insertAlias(r.emailDB, alias)
+	if appErr != nil {
+		return nil, appErr
+	}
+	logger.Info("Email alias created successfully", zap.Int("id", created.Id))
+	return created, nil
+}
+
+func (r EmailAliasRepository) DeleteAlias(idNo string, id int) *errors.AppError {
+	logger.Info("Deleting email alias", zap.String("id_no", idNo), zap.Int("id", id))
+	result, err := r.emailDB.Exec("DELETE FROM email_aliases WHERE id = $1 AND id_no = $2", id, idNo)
+	if err != nil {
+		logger.Error("Database error while deleting email alias", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading deleted email alias count", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	if affected == 0 {
+		logger.Warn("Email alias not found", zap.Int("id", id))
+		return errors.NewNotFoundError("Email alias not found")
+	}
+	return nil
+}
+
+// insertAlias writes an alias through either the database or an open transaction
+func insertAlias(q sqlx.Ext, alias domain.EmailAlias) (*domain.EmailAlias, *errors.AppError) {
+	// An expired alias no longer reserves its address
+	_, err := q.Exec("DELETE FROM email_aliases WHERE LOWER(alias) = LOWER($1) AND date_expires <= CURRENT_TIMESTAMP", alias.Alias)
+	if err != nil {
+		logger.Error("Error clearing expired email alias", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+
+	rows, err := sqlx.NamedQuery(q, createAliasSql, alias)
+	if err != nil {
+		if isPgError(err, pgUniqueViolation) {
+			logger.Warn("Email alias already exists", zap.String("alias", alias.Alias))
+			return nil, errors.NewConflictError("Email alias already exists")
+		}
+		if isPgError(err, pgForeignKeyViolation) {
+			logger.Warn("Email alias for unknown user", zap.String("id_no", alias.IdNo))
+			return nil, errors.NewNotFoundError("User not found")
+		}
+		logger.Error("Error while creating email alias", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer rows.Close()
+
+	var created domain.EmailAlias
+	if rows.Next() {
+		err = rows.StructScan(&created)
+		if err != nil {
+			logger.Error("Error scanning email alias", zap.Error(err))
+			return nil, errors.NewUnExpectedError("Unexpected database error")
+		}
+	} else {
+		logger.Error("No rows returned after alias insert")
+		return nil, errors.NewUnExpectedError("Email alias creation failed")
+	}
+	return &created, nil
+}
+
+func NewEmailAliasRepositoryDb(db *sqlx.DB) EmailAliasRepository {
+	logger.Info("Initializing EmailAliasRepository")
+	return EmailAliasRepository{db}
+}
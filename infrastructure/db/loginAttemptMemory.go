@@ -0,0 +1,76 @@
+package db
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+)
+
+// MemoryLoginAttemptStore keeps failed login counters in process memory. The
+// counters are lost on restart and not shared between instances.
+type MemoryLoginAttemptStore struct {
+	mu        *sync.Mutex
+	attempts  map[string]domain.LoginAttempt
+	lastSweep *time.Time
+}
+
+func (s MemoryLoginAttemptStore) LoginAttempt(key string) (domain.LoginAttempt, *errors.AppError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if attempt, ok := s.attempts[key]; ok {
+		return attempt, nil
+	}
+	return domain.LoginAttempt{Key: key}, nil
+}
+
+func (s MemoryLoginAttemptStore) RecordLoginFailure(key string, window time.Duration) (domain.LoginAttempt, *errors.AppError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now, window)
+
+	attempt, ok := s.attempts[key]
+	if !ok || now.Sub(attempt.DateLastFailure) > window {
+		attempt = domain.LoginAttempt{Key: key}
+	}
+	attempt.Failures++
+	attempt.DateLastFailure = now
+	s.attempts[key] = attempt
+	return attempt, nil
+}
+
+func (s MemoryLoginAttemptStore) ResetLoginAttempts(key string) *errors.AppError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// sweep drops counters that would start over anyway, at most once per window,
+// so addresses that stop failing do not accumulate
+func (s MemoryLoginAttemptStore) sweep(now time.Time, window time.Duration) {
+	if now.Sub(*s.lastSweep) < window {
+		return
+	}
+	for key, attempt := range s.attempts {
+		if now.Sub(attempt.DateLastFailure) > window {
+			delete(s.attempts, key)
+		}
+	}
+	*s.lastSweep = now
+}
+
+func NewMemoryLoginAttemptStore() MemoryLoginAttemptStore {
+	logger.Info("Initializing MemoryLoginAttemptStore")
+	return MemoryLoginAttemptStore{
+		mu:        &sync.Mutex{},
+		attempts:  map[string]domain.LoginAttempt{},
+		lastSweep: &time.Time{},
+	}
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// LoginAttemptRepository keeps failed login counters in PostgreSQL so every
+// instance of the server sees the same lockouts
+type LoginAttemptRepository struct {
+	emailDB *sqlx.DB
+}
+
+func (r LoginAttemptRepository) LoginAttempt(key string) (domain.LoginAttempt, *errors.AppError) {
+	attempt := domain.LoginAttempt{Key: key}
+	err := r.emailDB.Get(&attempt, "SELECT * FROM login_attempts WHERE key = $1", key)
+	if err != nil && err != sql.ErrNoRows {
+		logger.Error("Database error while fetching login attempts", zap.Error(err))
+		return attempt, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return attempt, nil
+}
+
+func (r LoginAttemptRepository) RecordLoginFailure(key string, window time.Duration) (domain.LoginAttempt, *errors.AppError) {
+	recordFailureSql := `
+		INSERT INTO login_attempts (key, failures, date_last_failure)
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_attempts.date_last_failure < NOW() - make_interval(secs => $2) THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			date_last_failure = NOW()
+		RETURNING *
+	`
+	var attempt domain.LoginAttempt
+	if err := r.emailDB.Get(&attempt, recordFailureSql, key, window.Seconds()); err != nil {
+		logger.Error("Error while recording login failure", zap.Error(err))
+		return domain.LoginAttempt{Key: key}, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return attempt, nil
+}
+
+func (r LoginAttemptRepository) ResetLoginAttempts(key string) *errors.AppError {
+	if _, err := r.emailDB.Exec("DELETE FROM login_attempts WHERE key = $1", key); err != nil {
+		logger.Error("Error while resetting login attempts", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	return nil
+}
+
+func NewLoginAttemptRepositoryDb(db *sqlx.DB) LoginAttemptRepository {
+	logger.Info("Initializing LoginAttemptRepository")
+	return LoginAttemptRepository{db}
+}
@@ -0,0 +1,237 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+type MailDomainRepository struct {
+	emailDB *sqlx.DB
+}
+
+func (r MailDomainRepository) Domains() ([]domain.MailDomain, *errors.AppError) {
+	logger.Info("Fetching mail domains")
+	var domains []domain.MailDomain
+	err := r.emailDB.Select(&domains, "SELECT * FROM mail_domains ORDER BY name")
+	if err != nil {
+		logger.Error("Database error while fetching mail domains", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	logger.Info("Successfully fetched mail domains", zap.Int("count", len(domains)))
+	return domains, nil
+}
+
+func (r MailDomainRepository) Domain(name string) (*domain.MailDomain, *errors.AppError) {
+	logger.Info("Fetching mail domain", zap.String("name", name))
+	var d domain.MailDomain
+	err := r.emailDB.Get(&d, "SELECT * FROM mail_domains WHERE name = $1", name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Warn("Mail domain not found", zap.String("name", name))
+			return nil, errors.NewNotFoundError("Mail domain not found")
+		}
+		logger.Error("Database error while fetching mail domain", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return &d, nil
+}
+
+func (r MailDomainRepository) CreateDomain(d domain.MailDomain) (*domain.MailDomain, *errors.AppError) {
+	logger.Info("Creating mail domain", zap.String("name", d.Name))
+	createDomainSql := `
+		INSERT INTO mail_domains (name, description, is_default, date_created, date_updated)
+		VALUES (:name, :description, :is_default, NOW(), NOW())
+		RETURNING *
+	`
+	return r.saveDomain(d, createDomainSql)
+}
+
+func (r MailDomainRepository) UpdateDomain(d domain.MailDomain) (*domain.MailDomain, *errors.AppError) {
+	logger.Info("Updating mail domain", zap.String("name", d.Name))
+	updateDomainSql := `
+		UPDATE mail_domains
+		SET
+			description = :description,
+			is_default = :is_default,
+			date_updated = CURRENT_TIMESTAMP
+		WHERE name = :name
+		RETURNING *
+	`
+	return r.saveDomain(d, updateDomainSql)
+}
+
+// saveDomain runs an insert or update of a domain, clearing the previous
+// default in the same transaction when d becomes the default
+func (r MailDomainRepository) saveDomain(d domain.MailDomain, query string) (*domain.MailDomain, *errors.AppError) {
+	tx, err := r.emailDB.Beginx()
+	if err != nil {
+		logger.Error("Error starting mail domain transaction", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer tx.Rollback()
+
+	if d.IsDefault {
+		_, err = tx.Exec("UPDATE mail_domains SET is_default = FALSE, date_updated = CURRENT_TIMESTAMP WHERE is_default AND name != $1", d.Name)
+		if err != nil {
+			logger.Error("Error clearing default mail domain", zap.Error(err))
+			return nil, errors.NewUnExpectedError("Unexpected database error")
+		}
+	}
+
+	rows, err := tx.NamedQuery(query, d)
+	if err != nil {
+		if isPgError(err, pgUniqueViolation) {
+			logger.Warn("Mail domain already exists", zap.String("name", d.Name))
+			return nil, errors.NewConflictError("Mail domain already exists")
+		}
+		logger.Error("Error while saving mail domain", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+
+	var saved domain.MailDomain
+	if rows.Next() {
+		err = rows.StructScan(&saved)
+		rows.Close()
+		if err != nil {
+			logger.Error("Error scanning mail domain", zap.Error(err))
+			return nil, errors.NewUnExpectedError("Unexpected database error")
+		}
+	} else {
+		rows.Close()
+		logger.Warn("Mail domain not found", zap.String("name", d.Name))
+		return nil, errors.NewNotFoundError("Mail domain not found")
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Error("Error committing mail domain", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+
+	logger.Info("Mail domain saved successfully", zap.String("name", saved.Name))
+	return &saved, nil
+}
+
+func (r MailDomainRepository) DeleteDomain(name string) *errors.AppError {
+	logger.Info("Deleting mail domain", zap.String("name", name))
+	result, err := r.emailDB.Exec("DELETE FROM mail_domains WHERE name = $1 AND NOT is_default", name)
+	if err != nil {
+		if isPgError(err, pgForeignKeyViolation) {
+			logger.Warn("Mail domain still routed to a department", zap.String("name", name))
+			return errors.NewConflictError("Mail domain is still used by a department rule")
+		}
+		logger.Error("Database error while deleting mail domain", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading deleted mail domain count", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	if affected == 0 {
+		logger.Warn("Mail domain not found or is the default", zap.String("name", name))
+		return errors.NewNotFoundError("Mail domain not found or is the default domain")
+	}
+
+	logger.Info("Mail domain deleted successfully", zap.String("name", name))
+	return nil
+}
+
+func (r MailDomainRepository) DepartmentRules() ([]domain.DepartmentDomain, *errors.AppError) {
+	logger.Info("Fetching department domain rules")
+	var rules []domain.DepartmentDomain
+	err := r.emailDB.Select(&rules, "SELECT * FROM department_domains ORDER BY department")
+	if err != nil {
+		logger.Error("Database error while fetching department domain rules", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return rules, nil
+}
+
+func (r MailDomainRepository) SetDepartmentRule(rule domain.DepartmentDomain) (*domain.DepartmentDomain, *errors.AppError) {
+	logger.Info("Setting department domain rule", zap.String("department", rule.Department), zap.String("domain", rule.DomainName))
+	setRuleSql := `
+		INSERT INTO department_domains (department, domain_name, date_created, date_updated)
+		VALUES (:department, :domain_name, NOW(), NOW())
+		ON CONFLICT ((LOWER(department))) DO UPDATE
+		SET department = EXCLUDED.department, domain_name = EXCLUDED.domain_name, date_updated = CURRENT_TIMESTAMP
+		RETURNING *
+	`
+	rows, err := r.emailDB.NamedQuery(setRuleSql, rule)
+	if err != nil {
+		if isPgError(err, pgForeignKeyViolation) {
+			logger.Warn("Department rule references unknown domain", zap.String("domain", rule.DomainName))
+			return nil, errors.NewNotFoundError("Mail domain not found")
+		}
+		logger.Error("Error while setting department domain rule", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer rows.Close()
+
+	var saved domain.DepartmentDomain
+	if rows.Next() {
+		err = rows.StructScan(&saved)
+		if err != nil {
+			logger.Error("Error scanning department domain rule", zap.Error(err))
+			return nil, errors.NewUnExpectedError("Unexpected database error")
+		}
+	} else {
+		logger.Error("No rows returned after setting department domain rule")
+		return nil, errors.NewUnExpectedError("Department domain rule update failed")
+	}
+	return &saved, nil
+}
+
+func (r MailDomainRepository) DeleteDepartmentRule(department string) *errors.AppError {
+	logger.Info("Deleting department domain rule", zap.String("department", department))
+	result, err := r.emailDB.Exec("DELETE FROM department_domains WHERE LOWER(department) = LOWER($1)", department)
+	if err != nil {
+		logger.Error("Database error while deleting department domain rule", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading deleted department rule count", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	if affected == 0 {
+		logger.Warn("Department domain rule not found", zap.String("department", department))
+		return errors.NewNotFoundError("Department domain rule not found")
+	}
+	return nil
+}
+
+func (r MailDomainRepository) DomainForDepartment(department string) (*domain.MailDomain, *errors.AppError) {
+	// A matching department rule wins over the default domain
+	domainForDepartmentSql := `
+		SELECT d.* FROM mail_domains d
+		LEFT JOIN department_domains r
+			ON r.domain_name = d.name AND LOWER(r.department) = LOWER($1)
+		WHERE r.department IS NOT NULL OR d.is_default
+		ORDER BY r.department IS NOT NULL DESC
+		LIMIT 1
+	`
+	var d domain.MailDomain
+	err := r.emailDB.Get(&d, domainForDepartmentSql, department)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Warn("No mail domain for department", zap.String("department", department))
+			return nil, errors.NewNotFoundError("No mail domain configured for department")
+		}
+		logger.Error("Database error while resolving department domain", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return &d, nil
+}
+
+func NewMailDomainRepositoryDb(db *sqlx.DB) MailDomainRepository {
+	logger.Info("Initializing MailDomainRepository")
+	return MailDomainRepository{db}
+}
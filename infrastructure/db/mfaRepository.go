@@ -0,0 +1,311 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+type MfaRepository struct {
+	emailDB *sqlx.DB
+}
+
+func (r MfaRepository) Enrollment(idNo string) (*domain.MfaEnrollment, *errors.AppError) {
+	var enrollment domain.MfaEnrollment
+	err := r.emailDB.Get(&enrollment, "SELECT * FROM user_mfa WHERE id_no = $1", idNo)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.NewNotFoundError("MFA is not enrolled")
+		}
+		logger.Error("Database error while fetching MFA enrollment", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return &enrollment, nil
+}
+
+func (r MfaRepository) StartEnrollment(enrollment domain.MfaEnrollment) *errors.AppError {
+	startSql := `
+		INSERT INTO user_mfa (id_no, secret, key_id, data_key, date_created)
+		VALUES (:id_no, :secret, :key_id, :data_key, NOW())
+		ON CONFLICT (id_no) DO UPDATE SET
+			secret = EXCLUDED.secret,
+			key_id = EXCLUDED.key_id,
+			data_key = EXCLUDED.data_key,
+			date_created = EXCLUDED.date_created,
+			last_used_step = 0
+		WHERE user_mfa.date_confirmed IS NULL
+	`
+	result, err := r.emailDB.NamedExec(startSql, enrollment)
+	if err != nil {
+		if isPgError(err, pgForeignKeyViolation) {
+			return errors.NewNotFoundError("User not found")
+		}
+		logger.Error("Error while starting MFA enrollment", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading MFA enrollment count", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	if affected == 0 {
+		return errors.NewConflictError("MFA is already enabled")
+	}
+
+	logger.Info("MFA enrollment started", zap.String("id_no", enrollment.IdNo))
+	return nil
+}
+
+func (r MfaRepository) ConfirmEnrollment(idNo string, step int64, codeHashes []string, event domain.UserEvent) *errors.AppError {
+	tx, err := r.emailDB.Beginx()
+	if err != nil {
+		logger.Error("Error starting MFA transaction", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer tx.Rollback()
+
+	confirmSql := `
+		UPDATE user_mfa
+		SET date_confirmed = CURRENT_TIMESTAMP, last_used_step = $2
+		WHERE id_no = $1 AND date_confirmed IS NULL
+	`
+	result, err := tx.Exec(confirmSql, idNo, step)
+	if err != nil {
+		logger.Error("Error confirming MFA enrollment", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading confirmed MFA count", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	if affected == 0 {
+		return errors.NewConflictError("MFA is already enabled")
+	}
+
+	if appErr := replaceRecoveryCodes(tx, idNo, codeHashes); appErr != nil {
+		return appErr
+	}
+	event.Changes = domain.FieldChanges{{Field: "mfa", Before: "disabled", After: "enabled"}}
+	if appErr := insertUserEvent(tx, event); appErr != nil {
+		return appErr
+	}
+	if appErr := commit(tx); appErr != nil {
+		return appErr
+	}
+
+	logger.Info("MFA enabled", zap.String("id_no", idNo))
+	return nil
+}
+
+func (r MfaRepository) DeleteEnrollment(idNo string, event domain.UserEvent) *errors.AppError {
+	tx, err := r.emailDB.Beginx()
+	if err != nil {
+		logger.Error("Error starting MFA transaction", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM user_mfa WHERE id_no = $1", idNo)
+	if err != nil {
+		logger.Error("Error deleting MFA enrollment", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading deleted MFA count", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	if affected == 0 {
+		return errors.NewNotFoundError("MFA is not enrolled")
+	}
+	if _, err = tx.Exec("DELETE FROM mfa_recovery_codes WHERE id_no = $1", idNo); err != nil {
+		logger.Error("Error deleting recovery codes", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+
+	event.Changes = domain.FieldChanges{{Field: "mfa", Before: "enabled", After: "disabled"}}
+	if appErr := insertUserEvent(tx, event); appErr != nil {
+		return appErr
+	}
+	if appErr := commit(tx); appErr != nil {
+		return appErr
+	}
+
+	logger.Info("MFA disabled", zap.String("id_no", idNo))
+	return nil
+}
+
+func (r MfaRepository) StaleEnrollments(activeKeyId, afterIdNo string, limit int) ([]domain.MfaEnrollment, *errors.AppError) {
+	staleSql := `
+		SELECT * FROM user_mfa
+		WHERE (key_id IS NULL OR key_id <> $1) AND id_no > $2
+		ORDER BY id_no
+		LIMIT $3
+	`
+	enrollments := []domain.MfaEnrollment{}
+	if err := r.emailDB.Select(&enrollments, staleSql, activeKeyId, afterIdNo, limit); err != nil {
+		logger.Error("Database error while listing stale MFA secrets", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return enrollments, nil
+}
+
+func (r MfaRepository) ReplaceSecret(current, next domain.MfaEnrollment) *errors.AppError {
+	replaceSql := `
+		UPDATE user_mfa
+		SET secret = $2, key_id = $3, data_key = $4
+		WHERE id_no = $1 AND secret = $5 AND key_id IS NOT DISTINCT FROM $6
+	`
+	result, err := r.emailDB.Exec(replaceSql,
+		current.IdNo, next.Secret, next.KeyId, next.DataKey, current.Secret, current.KeyId)
+	if err != nil {
+		logger.Error("Error while replacing MFA secret", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading replaced MFA secret count", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	if affected == 0 {
+		logger.Warn("MFA secret changed during re-encryption", zap.String("id_no", current.IdNo))
+		return errors.NewConflictError("MFA secret changed in the meantime")
+	}
+	return nil
+}
+
+func (r MfaRepository) UseStep(idNo string, step int64) *errors.AppError {
+	result, err := r.emailDB.Exec("UPDATE user_mfa SET last_used_step = $2 WHERE id_no = $1 AND last_used_step < $2", idNo, step)
+	if err != nil {
+		logger.Error("Error recording used MFA code", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading used MFA code count", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	if affected == 0 {
+		logger.Warn("MFA code replayed", zap.String("id_no", idNo))
+		return errors.NewConflictError("MFA code already used")
+	}
+	return nil
+}
+
+func (r MfaRepository) RecoveryCodes(idNo string) ([]domain.RecoveryCode, *errors.AppError) {
+	codes := []domain.RecoveryCode{}
+	err := r.emailDB.Select(&codes, "SELECT * FROM mfa_recovery_codes WHERE id_no = $1 AND date_used IS NULL ORDER BY id", idNo)
+	if err != nil {
+		logger.Error("Database error while fetching recovery codes", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return codes, nil
+}
+
+func (r MfaRepository) UseRecoveryCode(id int64) *errors.AppError {
+	result, err := r.emailDB.Exec("UPDATE mfa_recovery_codes SET date_used = CURRENT_TIMESTAMP WHERE id = $1 AND date_used IS NULL", id)
+	if err != nil {
+		logger.Error("Error using recovery code", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading used recovery code count", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	if affected == 0 {
+		return errors.NewConflictError("Recovery code already used")
+	}
+	return nil
+}
+
+func (r MfaRepository) ReplaceRecoveryCodes(idNo string, codeHashes []string, event domain.UserEvent) *errors.AppError {
+	tx, err := r.emailDB.Beginx()
+	if err != nil {
+		logger.Error("Error starting recovery code transaction", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer tx.Rollback()
+
+	if appErr := replaceRecoveryCodes(tx, idNo, codeHashes); appErr != nil {
+		return appErr
+	}
+	if appErr := insertUserEvent(tx, event); appErr != nil {
+		return appErr
+	}
+	if appErr := commit(tx); appErr != nil {
+		return appErr
+	}
+
+	logger.Info("Recovery codes replaced", zap.String("id_no", idNo))
+	return nil
+}
+
+func (r MfaRepository) CreateChallenge(challenge domain.MfaChallenge) *errors.AppError {
+	createChallengeSql := `
+		INSERT INTO mfa_challenges (id_no, token_hash, date_created, date_expires)
+		VALUES (:id_no, :token_hash, NOW(), :date_expires)
+	`
+	if _, err := r.emailDB.NamedExec(createChallengeSql, challenge); err != nil {
+		logger.Error("Error while creating MFA challenge", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	return nil
+}
+
+func (r MfaRepository) Challenge(tokenHash string) (*domain.MfaChallenge, *errors.AppError) {
+	var challenge domain.MfaChallenge
+	err := r.emailDB.Get(&challenge, "SELECT * FROM mfa_challenges WHERE token_hash = $1", tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.NewNotFoundError("MFA challenge not found")
+		}
+		logger.Error("Database error while fetching MFA challenge", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return &challenge, nil
+}
+
+func (r MfaRepository) UseChallenge(id int64) *errors.AppError {
+	result, err := r.emailDB.Exec("UPDATE mfa_challenges SET date_used = CURRENT_TIMESTAMP WHERE id = $1 AND date_used IS NULL", id)
+	if err != nil {
+		logger.Error("Error using MFA challenge", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading used MFA challenge count", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	if affected == 0 {
+		return errors.NewConflictError("MFA challenge already used")
+	}
+	return nil
+}
+
+// replaceRecoveryCodes discards the recovery codes of a user inside tx and
+// stores codeHashes in their place
+func replaceRecoveryCodes(tx *sqlx.Tx, idNo string, codeHashes []string) *errors.AppError {
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE id_no = $1", idNo); err != nil {
+		logger.Error("Error deleting recovery codes", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec("INSERT INTO mfa_recovery_codes (id_no, code_hash, date_created) VALUES ($1, $2, NOW())", idNo, hash); err != nil {
+			logger.Error("Error storing recovery code", zap.Error(err))
+			return errors.NewUnExpectedError("Unexpected database error")
+		}
+	}
+	return nil
+}
+
+func NewMfaRepositoryDb(db *sqlx.DB) MfaRepository {
+	logger.Info("Initializing MfaRepository")
+	return MfaRepository{db}
+}
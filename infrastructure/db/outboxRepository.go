@@ -0,0 +1,108 @@
+package db
+
+import (
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+type OutboxRepository struct {
+	emailDB *sqlx.DB
+}
+
+func (r OutboxRepository) ClaimEvents(limit int, lease time.Duration) ([]domain.DomainEvent, *errors.AppError) {
+	// SKIP LOCKED lets several dispatchers claim disjoint batches; pushing the
+	// next attempt past the lease hands the events back if this one stops
+	claimSql := `
+		UPDATE outbox_events
+		SET date_next_attempt = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM outbox_events
+			WHERE date_delivered IS NULL AND date_next_attempt <= NOW()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`
+	events := []domain.DomainEvent{}
+	if err := r.emailDB.Select(&events, claimSql, limit, lease.Seconds()); err != nil {
+		logger.Error("Database error while claiming outbox events", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return events, nil
+}
+
+func (r OutboxRepository) MarkDelivered(id int64) *errors.AppError {
+	deliveredSql := `
+		UPDATE outbox_events
+		SET date_delivered = CURRENT_TIMESTAMP, attempts = attempts + 1, last_error = NULL
+		WHERE id = $1
+	`
+	if _, err := r.emailDB.Exec(deliveredSql, id); err != nil {
+		logger.Error("Error marking outbox event delivered", zap.Int64("id", id), zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	return nil
+}
+
+func (r OutboxRepository) MarkFailed(id int64, reason string, retryAt time.Time) *errors.AppError {
+	failedSql := `
+		UPDATE outbox_events
+		SET attempts = attempts + 1, last_error = $2, date_next_attempt = $3
+		WHERE id = $1
+	`
+	if _, err := r.emailDB.Exec(failedSql, id, reason, retryAt); err != nil {
+		logger.Error("Error recording failed outbox event", zap.Int64("id", id), zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	return nil
+}
+
+func (r OutboxRepository) PruneDelivered(before time.Time) (int64, *errors.AppError) {
+	pruneSql := `DELETE FROM outbox_events WHERE date_delivered < $1`
+	result, err := r.emailDB.Exec(pruneSql, before)
+	if err != nil {
+		logger.Error("Error pruning delivered outbox events", zap.Error(err))
+		return 0, errors.NewUnExpectedError("Unexpected database error")
+	}
+	pruned, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("Error counting pruned outbox events", zap.Error(err))
+		return 0, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return pruned, nil
+}
+
+// publishUserEvent writes the domain event of a user event, if it has one, to
+// the outbox inside tx
+func publishUserEvent(tx *sqlx.Tx, event domain.UserEvent) *errors.AppError {
+	outboxEvent, published, err := domain.NewDomainEvent(event)
+	if err != nil {
+		logger.Error("Error encoding domain event", zap.String("action", event.Action), zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	if !published {
+		return nil
+	}
+
+	insertSql := `
+		INSERT INTO outbox_events (event_type, id_no, payload, date_created, date_next_attempt)
+		VALUES ($1, $2, $3, NOW(), NOW())
+	`
+	if _, err := tx.Exec(insertSql, outboxEvent.Type, outboxEvent.IdNo, string(outboxEvent.Payload)); err != nil {
+		logger.Error("Error while writing outbox event", zap.String("type", outboxEvent.Type), zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	return nil
+}
+
+func NewOutboxRepositoryDb(db *sqlx.DB) OutboxRepository {
+	logger.Info("Initializing OutboxRepository")
+	return OutboxRepository{db}
+}
@@ -0,0 +1,15 @@
+package db
+
+import "github.com/lib/pq"
+
+// Postgres error codes the repositories react to
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+// isPgError reports whether err is a Postgres error with the given code
+func isPgError(err error, code string) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && string(pqErr.Code) == code
+}
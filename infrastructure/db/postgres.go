@@ -0,0 +1,26 @@
+package db
+
+import (
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// Connect establishes a connection to the PostgreSQL database
+func Connect() *sqlx.DB {
+	logger.Info("Connecting to PostgreSQL database")
+
+	// Connection string for the PostgreSQL database
+	connStr := "user=admin password=Admin123 dbname=email_dir sslmode=disable"
+
+	// Open a new database connection
+	userDb, err := sqlx.Open("postgres", connStr)
+	if err != nil {
+		// Log and terminate the application if the connection fails
+		logger.Fatal("Failed to connect to PostgreSQL database", zap.Error(err))
+	}
+
+	logger.Info("Successfully connected to PostgreSQL database")
+	return userDb
+}
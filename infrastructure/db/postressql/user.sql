@@ -27,3 +27,243 @@ CREATE TABLE users (
 -- Enums for email_status (active or deleted only)
 CREATE TYPE email_status AS ENUM ('active', 'deleted');
 ALTER TABLE users ALTER COLUMN email_status TYPE email_status USING email_status::email_status;
+
+-- Mail domains addresses can be minted under; exactly one may be the default
+CREATE TABLE mail_domains (
+    name VARCHAR(255) PRIMARY KEY,
+    description VARCHAR(255),
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    date_updated TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX mail_domains_single_default ON mail_domains (is_default) WHERE is_default;
+
+-- Department to domain routing rules used when generating addresses
+CREATE TABLE department_domains (
+    department VARCHAR(255) PRIMARY KEY,
+    domain_name VARCHAR(255) NOT NULL REFERENCES mail_domains (name),
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    date_updated TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO mail_domains (name, description, is_default) VALUES ('test.com', 'Corporate domain', TRUE);
+
+-- Previous addresses that keep receiving mail until they expire
+CREATE TABLE email_aliases (
+    id SERIAL PRIMARY KEY,
+    id_no VARCHAR(255) NOT NULL REFERENCES users (id_no) ON DELETE CASCADE,
+    alias VARCHAR(255) UNIQUE NOT NULL,
+    reason VARCHAR(255),
+    ticket_no VARCHAR(255),
+    date_expires TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(255)
+);
+CREATE INDEX email_aliases_id_no ON email_aliases (id_no);
+
+-- Append-only history of every change made to a user record
+CREATE TABLE user_events (
+    id BIGSERIAL PRIMARY KEY,
+    id_no VARCHAR(255) NOT NULL,
+    action VARCHAR(255) NOT NULL,
+    actor VARCHAR(255),
+    ticket_no VARCHAR(255),
+    changes JSONB NOT NULL DEFAULT '[]',
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    date_redacted TIMESTAMP WITH TIME ZONE DEFAULT NULL
+);
+CREATE INDEX user_events_id_no ON user_events (id_no, id DESC);
+
+-- Updates and deletes fail loudly instead of being dropped. The one sanctioned
+-- write is redacting personal data: a transaction that sets app.redact_history
+-- may rewrite changes and stamp date_redacted, and nothing else.
+CREATE FUNCTION user_events_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND current_setting('app.redact_history', true) = 'on'
+        AND NEW.id = OLD.id
+        AND NEW.id_no = OLD.id_no
+        AND NEW.action = OLD.action
+        AND NEW.actor IS NOT DISTINCT FROM OLD.actor
+        AND NEW.ticket_no IS NOT DISTINCT FROM OLD.ticket_no
+        AND NEW.date_created IS NOT DISTINCT FROM OLD.date_created
+        AND NEW.date_redacted IS NOT NULL THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'user_events is append-only; % refused', TG_OP
+        USING ERRCODE = 'insufficient_privilege';
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER user_events_append_only BEFORE UPDATE OR DELETE ON user_events
+    FOR EACH ROW EXECUTE FUNCTION user_events_append_only();
+CREATE TRIGGER user_events_no_truncate BEFORE TRUNCATE ON user_events
+    FOR EACH STATEMENT EXECUTE FUNCTION user_events_append_only();
+
+-- Set when the retention job scrubs a long-deleted user
+ALTER TABLE users ADD COLUMN date_anonymized TIMESTAMP WITH TIME ZONE DEFAULT NULL;
+CREATE INDEX users_date_deleted ON users (date_deleted) WHERE status = 'deleted';
+
+-- Lifecycle states enforced by the account and mailbox state machines
+ALTER TYPE email_status ADD VALUE IF NOT EXISTS 'provisioning';
+ALTER TYPE email_status ADD VALUE IF NOT EXISTS 'forwarding';
+ALTER TABLE users ADD CONSTRAINT users_status_check
+    CHECK (status IN ('pending', 'active', 'suspended', 'disabled', 'deleted'));
+
+-- Temporary suspensions, optionally lifted automatically at suspended_until
+ALTER TABLE users ADD COLUMN suspension_reason VARCHAR(255) DEFAULT NULL;
+ALTER TABLE users ADD COLUMN date_suspended TIMESTAMP WITH TIME ZONE DEFAULT NULL;
+ALTER TABLE users ADD COLUMN suspended_until TIMESTAMP WITH TIME ZONE DEFAULT NULL;
+CREATE INDEX users_suspended_until ON users (suspended_until) WHERE status = 'suspended';
+
+-- Server-side refresh tokens; only the SHA-256 of a token is stored.
+-- Rotated tokens stay in their family so reuse of an old token can be detected.
+CREATE TABLE refresh_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    id_no VARCHAR(255) NOT NULL REFERENCES users (id_no) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    family_id VARCHAR(64) NOT NULL,
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    date_expires TIMESTAMP WITH TIME ZONE NOT NULL,
+    date_revoked TIMESTAMP WITH TIME ZONE DEFAULT NULL
+);
+CREATE INDEX refresh_tokens_family_id ON refresh_tokens (family_id);
+
+-- Access tokens revoked before they expire, by JWT ID
+CREATE TABLE revoked_access_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    date_expires TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Operator roles; a NULL department grants the role in every department
+CREATE TABLE user_roles (
+    id BIGSERIAL PRIMARY KEY,
+    id_no VARCHAR(255) NOT NULL REFERENCES users (id_no) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('viewer', 'helpdesk', 'hr', 'admin')),
+    department VARCHAR(255) DEFAULT NULL,
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(255) NOT NULL,
+    CHECK (role <> 'admin' OR department IS NULL)
+);
+CREATE UNIQUE INDEX user_roles_assignment ON user_roles (id_no, role, LOWER(COALESCE(department, '')));
+
+-- Role changes need an admin, so the first one is granted by hand:
+-- INSERT INTO user_roles (id_no, role, created_by) VALUES ('<id_no>', 'admin', 'bootstrap');
+
+-- API keys for automation; only the SHA-256 of a key is stored
+CREATE TABLE api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(20) NOT NULL,
+    key_hash VARCHAR(64) UNIQUE NOT NULL,
+    scopes JSONB NOT NULL DEFAULT '[]',
+    department VARCHAR(255) DEFAULT NULL,
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(255) NOT NULL,
+    date_expires TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    date_revoked TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    revoked_by VARCHAR(255) DEFAULT NULL,
+    date_last_used TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    last_used_ip VARCHAR(45) DEFAULT NULL
+);
+
+-- Password changes and resets
+ALTER TABLE users ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN date_password_changed TIMESTAMP WITH TIME ZONE DEFAULT NULL;
+
+-- Single-use self-service reset tokens; only the SHA-256 of a token is stored
+CREATE TABLE password_reset_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    id_no VARCHAR(255) NOT NULL REFERENCES users (id_no) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    date_expires TIMESTAMP WITH TIME ZONE NOT NULL,
+    date_used TIMESTAMP WITH TIME ZONE DEFAULT NULL
+);
+
+-- Previous password hashes, checked to prevent reuse
+CREATE TABLE password_history (
+    id BIGSERIAL PRIMARY KEY,
+    id_no VARCHAR(255) NOT NULL REFERENCES users (id_no) ON DELETE CASCADE,
+    hashed_password VARCHAR(255) NOT NULL,
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX password_history_id_no ON password_history (id_no, id DESC);
+
+-- Recent failed logins per login identity and per client address
+CREATE TABLE login_attempts (
+    key VARCHAR(320) PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    date_last_failure TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- TOTP second factor; an enrollment is only enforced once confirmed with a code.
+-- The secret is sealed like SMTP passwords, with its own data key wrapped by
+-- the key named in key_id; rows without key_id are legacy plaintext until
+-- cmd/reencrypt seals them.
+CREATE TABLE user_mfa (
+    id_no VARCHAR(255) PRIMARY KEY REFERENCES users (id_no) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    key_id VARCHAR(64),
+    data_key TEXT,
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    date_confirmed TIMESTAMP WITH TIME ZONE,
+    -- Time step of the last accepted code, so a code cannot be replayed
+    last_used_step BIGINT NOT NULL DEFAULT 0
+);
+
+-- Single-use recovery codes, stored as bcrypt hashes
+CREATE TABLE mfa_recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    id_no VARCHAR(255) NOT NULL REFERENCES users (id_no) ON DELETE CASCADE,
+    code_hash VARCHAR(255) NOT NULL,
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    date_used TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX mfa_recovery_codes_id_no ON mfa_recovery_codes (id_no);
+
+-- Logins that passed the password check and wait for the second factor
+CREATE TABLE mfa_challenges (
+    id BIGSERIAL PRIMARY KEY,
+    id_no VARCHAR(255) NOT NULL REFERENCES users (id_no) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    date_expires TIMESTAMP WITH TIME ZONE NOT NULL,
+    date_used TIMESTAMP WITH TIME ZONE
+);
+
+-- SMTP passwords are sealed with their own data key, which is wrapped by the
+-- key-encryption key named in smtp_key_id. Rows with a password and no key ID
+-- are legacy plaintext until cmd/reencrypt migrates them.
+ALTER TABLE users ALTER COLUMN smtp_password TYPE TEXT;
+ALTER TABLE users ADD COLUMN smtp_key_id VARCHAR(64);
+ALTER TABLE users ADD COLUMN smtp_data_key TEXT;
+
+-- Outcome of the last AUTH attempted with a user's SMTP credentials; cleared
+-- whenever the credentials change
+ALTER TABLE users ADD COLUMN smtp_verify_status VARCHAR(16);
+ALTER TABLE users ADD COLUMN smtp_verify_error TEXT;
+ALTER TABLE users ADD COLUMN smtp_date_verified TIMESTAMP WITH TIME ZONE;
+
+-- The manager of a user is told when their mailbox is created or renamed
+ALTER TABLE users ADD COLUMN manager_id_no VARCHAR(255) REFERENCES users (id_no) ON DELETE SET NULL;
+
+-- Transactional outbox: domain events written with the change that caused
+-- them and published at least once by the dispatcher
+CREATE TABLE outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(64) NOT NULL,
+    id_no VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    date_next_attempt TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    date_delivered TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX outbox_events_pending ON outbox_events (date_next_attempt) WHERE date_delivered IS NULL;
+
+-- Delivered events are deleted once they are older than the outbox retention
+CREATE INDEX outbox_events_delivered ON outbox_events (date_delivered) WHERE date_delivered IS NOT NULL;
+
+-- Department rules are matched without regard to case, so they must be unique that way too
+CREATE UNIQUE INDEX department_domains_department_lower ON department_domains (LOWER(department));
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// retainedUserDataSql removes what a user leaves outside the users row. Aliases
+// carry the old name; the rest are credentials, tokens and published events
+// that must not outlive the account. Login counters are keyed by address too.
+var retainedUserDataSql = []string{
+	"DELETE FROM email_aliases WHERE id_no = $1",
+	"DELETE FROM password_history WHERE id_no = $1",
+	"DELETE FROM password_reset_tokens WHERE id_no = $1",
+	"DELETE FROM refresh_tokens WHERE id_no = $1",
+	"DELETE FROM mfa_challenges WHERE id_no = $1",
+	"DELETE FROM mfa_recovery_codes WHERE id_no = $1",
+	"DELETE FROM user_mfa WHERE id_no = $1",
+	"DELETE FROM outbox_events WHERE id_no = $1",
+	`DELETE FROM login_attempts WHERE key IN (
+		SELECT 'user:' || id_no FROM users WHERE id_no = $1
+		UNION SELECT 'id:' || id_no FROM users WHERE id_no = $1
+		UNION SELECT 'email:' || LOWER(email) FROM users WHERE id_no = $1
+	)`,
+}
+
+type RetentionRepository struct {
+	emailDB *sqlx.DB
+}
+
+func (r RetentionRepository) RetentionCandidates(anonymizeBefore, purgeBefore time.Time) ([]domain.RetentionCandidate, *errors.AppError) {
+	logger.Info("Fetching retention candidates", zap.Time("anonymize_before", anonymizeBefore), zap.Time("purge_before", purgeBefore))
+	candidatesSql := `
+		SELECT
+			id_no, department, date_deleted, date_anonymized,
+			CASE WHEN date_deleted < $2 THEN 'purge' ELSE 'anonymize' END AS action
+		FROM users
+		WHERE status = 'deleted'
+			AND (date_deleted < $2 OR (date_deleted < $1 AND date_anonymized IS NULL))
+		ORDER BY date_deleted
+	`
+	var candidates []domain.RetentionCandidate
+	err := r.emailDB.Select(&candidates, candidatesSql, anonymizeBefore, purgeBefore)
+	if err != nil {
+		logger.Error("Database error while fetching retention candidates", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	logger.Info("Successfully fetched retention candidates", zap.Int("count", len(candidates)))
+	return candidates, nil
+}
+
+func (r RetentionRepository) AnonymizeUser(idNo string, cutoff time.Time, event domain.UserEvent) *errors.AppError {
+	logger.Info("Anonymizing user", zap.String("id_no", idNo))
+	// The address is replaced too: it is derived from the name and is released for reuse
+	anonymizeUserSql := `
+		UPDATE users
+		SET
+			first_name = 'redacted',
+			last_name = 'redacted',
+			suffix = '',
+			email = 'purged-' || id_no || '@invalid',
+			profile_picture = 'n/a',
+			hashed_password = '',
+			salt = '',
+			smtp_email = NULL,
+			smtp_password = NULL,
+			smtp_key_id = NULL,
+			smtp_data_key = NULL,
+			smtp_verify_status = NULL,
+			smtp_verify_error = NULL,
+			smtp_date_verified = NULL,
+			date_anonymized = CURRENT_TIMESTAMP
+		WHERE id_no = $1 AND status = 'deleted' AND date_deleted < $2 AND date_anonymized IS NULL
+	`
+	return r.apply(idNo, cutoff, event, anonymizeUserSql)
+}
+
+func (r RetentionRepository) PurgeUser(idNo string, cutoff time.Time, event domain.UserEvent) *errors.AppError {
+	logger.Info("Purging user", zap.String("id_no", idNo))
+	purgeUserSql := `DELETE FROM users WHERE id_no = $1 AND status = 'deleted' AND date_deleted < $2`
+	return r.apply(idNo, cutoff, event, purgeUserSql)
+}
+
+// apply runs a retention statement, removes the user's data kept elsewhere and
+// records it in the history in one transaction. The statement re-checks the
+// cutoff so a user restored in the meantime is left alone.
+func (r RetentionRepository) apply(idNo string, cutoff time.Time, event domain.UserEvent, query string) *errors.AppError {
+	tx, err := r.emailDB.Beginx()
+	if err != nil {
+		logger.Error("Error starting retention transaction", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer tx.Rollback()
+
+	for _, query := range retainedUserDataSql {
+		if _, err := tx.Exec(query, idNo); err != nil {
+			logger.Error("Error deleting data of retained user", zap.Error(err))
+			return errors.NewUnExpectedError("Unexpected database error")
+		}
+	}
+	// The history itself stays, without the names and addresses in its diffs
+	if appErr := redactUserHistory(tx, idNo); appErr != nil {
+		return appErr
+	}
+
+	result, err := tx.Exec(query, idNo, cutoff)
+	if err != nil {
+		logger.Error("Error applying retention policy", zap.String("action", event.Action), zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading retained user count", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	if affected == 0 {
+		logger.Warn("User no longer due for retention", zap.String("id_no", idNo))
+		return errors.NewNotFoundError("User no longer due for retention")
+	}
+
+	// No field diff is kept, it would copy the personal data into the history
+	if appErr := insertUserEvent(tx, event); appErr != nil {
+		return appErr
+	}
+	if appErr := commit(tx); appErr != nil {
+		return appErr
+	}
+
+	logger.Info("Retention policy applied", zap.String("id_no", idNo), zap.String("action", event.Action))
+	return nil
+}
+
+func NewRetentionRepositoryDb(db *sqlx.DB) RetentionRepository {
+	logger.Info("Initializing RetentionRepository")
+	return RetentionRepository{db}
+}
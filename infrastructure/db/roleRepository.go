@@ -0,0 +1,114 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+type RoleRepository struct {
+	emailDB *sqlx.DB
+}
+
+func (r RoleRepository) Roles(idNo string) ([]domain.RoleAssignment, *errors.AppError) {
+	var roles []domain.RoleAssignment
+	err := r.emailDB.Select(&roles, "SELECT * FROM user_roles WHERE id_no = $1 ORDER BY id", idNo)
+	if err != nil {
+		logger.Error("Database error while fetching user roles", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return roles, nil
+}
+
+func (r RoleRepository) GrantRole(role domain.RoleAssignment, event domain.UserEvent) (*domain.RoleAssignment, *errors.AppError) {
+	logger.Info("Granting role", zap.String("id_no", role.IdNo), zap.String("role", role.Role))
+
+	tx, err := r.emailDB.Beginx()
+	if err != nil {
+		logger.Error("Error starting role transaction", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer tx.Rollback()
+
+	grantSql := `
+		INSERT INTO user_roles (id_no, role, department, date_created, created_by)
+		VALUES (:id_no, :role, :department, NOW(), :created_by)
+		RETURNING *
+	`
+	rows, err := tx.NamedQuery(grantSql, role)
+	if err != nil {
+		if isPgError(err, pgUniqueViolation) {
+			logger.Warn("Role already granted", zap.String("id_no", role.IdNo), zap.String("role", role.Role))
+			return nil, errors.NewConflictError("User already has this role")
+		}
+		if isPgError(err, pgForeignKeyViolation) {
+			logger.Warn("Role for unknown user", zap.String("id_no", role.IdNo))
+			return nil, errors.NewNotFoundError("User not found")
+		}
+		logger.Error("Error while granting role", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	var granted domain.RoleAssignment
+	if rows.Next() {
+		err = rows.StructScan(&granted)
+	}
+	rows.Close()
+	if err != nil || granted.Id == 0 {
+		logger.Error("Error scanning granted role", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Role grant failed")
+	}
+
+	event.Changes = domain.FieldChanges{{Field: "role", After: granted.String()}}
+	if appErr := insertUserEvent(tx, event); appErr != nil {
+		return nil, appErr
+	}
+	if appErr := commit(tx); appErr != nil {
+		return nil, appErr
+	}
+
+	logger.Info("Role granted", zap.Int64("id", granted.Id))
+	return &granted, nil
+}
+
+func (r RoleRepository) RevokeRole(idNo string, id int64, event domain.UserEvent) (*domain.RoleAssignment, *errors.AppError) {
+	logger.Info("Revoking role", zap.String("id_no", idNo), zap.Int64("id", id))
+
+	tx, err := r.emailDB.Beginx()
+	if err != nil {
+		logger.Error("Error starting role transaction", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer tx.Rollback()
+
+	var revoked domain.RoleAssignment
+	err = tx.Get(&revoked, "DELETE FROM user_roles WHERE id = $1 AND id_no = $2 RETURNING *", id, idNo)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Warn("Role assignment not found", zap.Int64("id", id))
+			return nil, errors.NewNotFoundError("Role assignment not found")
+		}
+		logger.Error("Database error while revoking role", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+
+	event.Changes = domain.FieldChanges{{Field: "role", Before: revoked.String()}}
+	if appErr := insertUserEvent(tx, event); appErr != nil {
+		return nil, appErr
+	}
+	if appErr := commit(tx); appErr != nil {
+		return nil, appErr
+	}
+
+	logger.Info("Role revoked", zap.Int64("id", id))
+	return &revoked, nil
+}
+
+func NewRoleRepositoryDb(db *sqlx.DB) RoleRepository {
+	logger.Info("Initializing RoleRepository")
+	return RoleRepository{db}
+}
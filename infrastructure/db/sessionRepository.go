@@ -0,0 +1,131 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+const createRefreshTokenSql = `
+	INSERT INTO refresh_tokens (id_no, token_hash, family_id, date_created, date_expires)
+	VALUES (:id_no, :token_hash, :family_id, NOW(), :date_expires)
+`
+
+type SessionRepository struct {
+	emailDB *sqlx.DB
+}
+
+func (r SessionRepository) CreateRefreshToken(token domain.RefreshToken) *errors.AppError {
+	if _, err := r.emailDB.NamedExec(createRefreshTokenSql, token); err != nil {
+		logger.Error("Error while creating refresh token", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	logger.Info("Refresh token created", zap.String("id_no", token.IdNo))
+	return nil
+}
+
+func (r SessionRepository) RefreshToken(tokenHash string) (*domain.RefreshToken, *errors.AppError) {
+	var token domain.RefreshToken
+	err := r.emailDB.Get(&token, "SELECT * FROM refresh_tokens WHERE token_hash = $1", tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.NewNotFoundError("Refresh token not found")
+		}
+		logger.Error("Database error while fetching refresh token", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return &token, nil
+}
+
+func (r SessionRepository) RotateRefreshToken(current domain.RefreshToken, next domain.RefreshToken) *errors.AppError {
+	tx, err := r.emailDB.Beginx()
+	if err != nil {
+		logger.Error("Error starting refresh token transaction", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE refresh_tokens SET date_revoked = CURRENT_TIMESTAMP WHERE id = $1 AND date_revoked IS NULL", current.Id)
+	if err != nil {
+		logger.Error("Error revoking rotated refresh token", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading rotated refresh token count", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	if affected == 0 {
+		logger.Warn("Refresh token already rotated", zap.String("family_id", current.FamilyId))
+		return errors.NewConflictError("Refresh token already used")
+	}
+
+	if _, err = tx.NamedExec(createRefreshTokenSql, next); err != nil {
+		logger.Error("Error while creating rotated refresh token", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	if appErr := commit(tx); appErr != nil {
+		return appErr
+	}
+
+	logger.Info("Refresh token rotated", zap.String("id_no", current.IdNo))
+	return nil
+}
+
+func (r SessionRepository) RevokeTokenFamily(familyId string) *errors.AppError {
+	_, err := r.emailDB.Exec("UPDATE refresh_tokens SET date_revoked = CURRENT_TIMESTAMP WHERE family_id = $1 AND date_revoked IS NULL", familyId)
+	if err != nil {
+		logger.Error("Error revoking refresh token family", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	logger.Info("Refresh token family revoked", zap.String("family_id", familyId))
+	return nil
+}
+
+func (r SessionRepository) RevokeUserTokens(idNo string) *errors.AppError {
+	_, err := r.emailDB.Exec("UPDATE refresh_tokens SET date_revoked = CURRENT_TIMESTAMP WHERE id_no = $1 AND date_revoked IS NULL", idNo)
+	if err != nil {
+		logger.Error("Error revoking user refresh tokens", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	logger.Info("All refresh tokens of user revoked", zap.String("id_no", idNo))
+	return nil
+}
+
+func (r SessionRepository) RevokeAccessToken(jti string, expires time.Time) *errors.AppError {
+	revokeSql := `
+		INSERT INTO revoked_access_tokens (jti, date_expires) VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING
+	`
+	if _, err := r.emailDB.Exec(revokeSql, jti, expires); err != nil {
+		logger.Error("Error revoking access token", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+
+	// Entries are only needed until the token would have expired anyway
+	if _, err := r.emailDB.Exec("DELETE FROM revoked_access_tokens WHERE date_expires < CURRENT_TIMESTAMP"); err != nil {
+		logger.Warn("Error pruning revoked access tokens", zap.Error(err))
+	}
+	return nil
+}
+
+func (r SessionRepository) IsAccessTokenRevoked(jti string) (bool, *errors.AppError) {
+	var revoked bool
+	err := r.emailDB.Get(&revoked, "SELECT EXISTS (SELECT 1 FROM revoked_access_tokens WHERE jti = $1)", jti)
+	if err != nil {
+		logger.Error("Database error while checking access token", zap.Error(err))
+		return false, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return revoked, nil
+}
+
+func NewSessionRepositoryDb(db *sqlx.DB) SessionRepository {
+	logger.Info("Initializing SessionRepository")
+	return SessionRepository{db}
+}
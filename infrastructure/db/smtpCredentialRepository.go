@@ -0,0 +1,172 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// smtpCredentialColumns reads the SMTP login of a user, treating NULL as empty
+const smtpCredentialColumns = `
+	id_no,
+	department,
+	COALESCE(smtp_email, '') AS smtp_email,
+	COALESCE(smtp_password, '') AS smtp_password,
+	smtp_key_id,
+	smtp_data_key,
+	smtp_verify_status,
+	smtp_verify_error,
+	smtp_date_verified
+`
+
+type SmtpCredentialRepository struct {
+	emailDB *sqlx.DB
+}
+
+func (r SmtpCredentialRepository) SmtpCredentials(idNo string) (*domain.SmtpCredentials, *errors.AppError) {
+	var credentials domain.SmtpCredentials
+	err := r.emailDB.Get(&credentials, "SELECT "+smtpCredentialColumns+" FROM users WHERE id_no = $1", idNo)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.NewNotFoundError("User not found")
+		}
+		logger.Error("Database error while fetching SMTP credentials", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return &credentials, nil
+}
+
+func (r SmtpCredentialRepository) StaleSmtpCredentials(activeKeyId, afterIdNo string, limit int) ([]domain.SmtpCredentials, *errors.AppError) {
+	staleSql := `
+		SELECT ` + smtpCredentialColumns + `
+		FROM users
+		WHERE COALESCE(smtp_password, '') <> ''
+			AND (smtp_key_id IS NULL OR smtp_key_id <> $1)
+			AND id_no > $2
+		ORDER BY id_no
+		LIMIT $3
+	`
+	credentials := []domain.SmtpCredentials{}
+	if err := r.emailDB.Select(&credentials, staleSql, activeKeyId, afterIdNo, limit); err != nil {
+		logger.Error("Database error while listing stale SMTP credentials", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return credentials, nil
+}
+
+func (r SmtpCredentialRepository) ReplaceSmtpPassword(current, next domain.SmtpCredentials) *errors.AppError {
+	replaceSql := `
+		UPDATE users
+		SET smtp_password = $2, smtp_key_id = $3, smtp_data_key = $4
+		WHERE id_no = $1
+			AND COALESCE(smtp_password, '') = $5
+			AND smtp_key_id IS NOT DISTINCT FROM $6
+	`
+	result, err := r.emailDB.Exec(replaceSql,
+		current.IdNo, next.Password, next.KeyId, next.DataKey, current.Password, current.KeyId)
+	if err != nil {
+		logger.Error("Error while replacing SMTP password", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading replaced SMTP password count", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	if affected == 0 {
+		logger.Warn("SMTP password changed during re-encryption", zap.String("id_no", current.IdNo))
+		return errors.NewConflictError("SMTP password changed in the meantime")
+	}
+	return nil
+}
+
+func (r SmtpCredentialRepository) SaveSmtpCredentials(next domain.SmtpCredentials, event domain.UserEvent) (*domain.SmtpCredentials, *errors.AppError) {
+	saveSql := `
+		UPDATE users
+		SET
+			smtp_email = $2,
+			smtp_password = $3,
+			smtp_key_id = $4,
+			smtp_data_key = $5,
+			smtp_verify_status = NULL,
+			smtp_verify_error = NULL,
+			smtp_date_verified = NULL,
+			updated_by = $6,
+			date_updated = CURRENT_TIMESTAMP
+		WHERE id_no = $1
+		RETURNING *
+	`
+	saved, appErr := r.update(next.IdNo, event, saveSql,
+		next.IdNo, next.Email, next.Password, next.KeyId, next.DataKey, event.Actor.String)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	logger.Info("SMTP credentials saved", zap.String("id_no", saved.IdNo), zap.String("action", event.Action))
+	return saved, nil
+}
+
+func (r SmtpCredentialRepository) RecordSmtpVerification(idNo, status, message string, event domain.UserEvent) (*domain.SmtpCredentials, *errors.AppError) {
+	verifySql := `
+		UPDATE users
+		SET
+			smtp_verify_status = $2,
+			smtp_verify_error = NULLIF($3, ''),
+			smtp_date_verified = CURRENT_TIMESTAMP
+		WHERE id_no = $1
+		RETURNING *
+	`
+	verified, appErr := r.update(idNo, event, verifySql, idNo, status, message)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	logger.Info("SMTP credentials verified", zap.String("id_no", idNo), zap.String("status", status))
+	return verified, nil
+}
+
+// update runs query, which returns the updated user, in a transaction that
+// records event
+func (r SmtpCredentialRepository) update(idNo string, event domain.UserEvent, query string, args ...interface{}) (*domain.SmtpCredentials, *errors.AppError) {
+	tx, err := r.emailDB.Beginx()
+	if err != nil {
+		logger.Error("Error starting SMTP credential transaction", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer tx.Rollback()
+
+	before, appErr := lockUser(tx, idNo)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	rows, err := tx.Queryx(query, args...)
+	if err != nil {
+		logger.Error("Error while updating SMTP credentials", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	updated, appErr := scanUser(rows, "SMTP credential update failed")
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if appErr = recordUserEvent(tx, event, *before, *updated); appErr != nil {
+		return nil, appErr
+	}
+	if appErr = commit(tx); appErr != nil {
+		return nil, appErr
+	}
+
+	credentials := updated.SmtpCredentials()
+	return &credentials, nil
+}
+
+func NewSmtpCredentialRepositoryDb(db *sqlx.DB) SmtpCredentialRepository {
+	logger.Info("Initializing SmtpCredentialRepository")
+	return SmtpCredentialRepository{db}
+}
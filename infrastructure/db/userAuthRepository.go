@@ -1,6 +1,8 @@
 package db
 
 import (
+	"database/sql"
+
 	"github.com/jmechavez/email-account-tracker/errors"
 	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
 	"github.com/jmechavez/email-account-tracker/internal/domain"
@@ -9,40 +11,187 @@ import (
 	"go.uber.org/zap"
 )
 
+// setPasswordSql is shared by SetPassword and ResetPassword
+const setPasswordSql = `
+	UPDATE users
+	SET
+		hashed_password = :hashed_password,
+		salt = :salt,
+		must_change_password = :must_change_password,
+		date_password_changed = CURRENT_TIMESTAMP,
+		updated_by = :updated_by,
+		date_updated = CURRENT_TIMESTAMP
+	WHERE id_no = :id_no
+	RETURNING *
+`
+
 type UserAuthRepository struct {
 	emailDB *sqlx.DB
 }
 
-func (r UserAuthRepository) CreatePassword(user domain.User) (*domain.User, *errors.AppError) {
+func (r UserAuthRepository) CreatePassword(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
 	passwordUserSql := `
 		UPDATE users
 		SET
 			hashed_password = :hashed_password,
-			salt = :salt
+			salt = :salt,
+			date_password_changed = CURRENT_TIMESTAMP,
+			updated_by = :updated_by,
+			date_updated = CURRENT_TIMESTAMP
 		WHERE id_no = :id_no
 		RETURNING *
 	`
-	rows, err := r.emailDB.NamedQuery(passwordUserSql, user)
+	tx, err := r.emailDB.Beginx()
 	if err != nil {
-		logger.Error("Error while creating password", zap.Error(err))
+		logger.Error("Error starting password transaction", zap.Error(err))
 		return nil, errors.NewUnExpectedError("Unexpected database error")
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var updatedPassword domain.User
-	if rows.Next() {
-		err = rows.StructScan(&updatedPassword)
-		if err != nil {
-			logger.Error("Error scanning updated user", zap.Error(err))
-			return nil, errors.NewUnExpectedError("Unexpected database error")
-		}
-	} else {
-		logger.Error("No rows returned after password update")
-		return nil, errors.NewUnExpectedError("Password creation failed")
+	updatedPassword, appErr := updatePassword(tx, passwordUserSql, user, event)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if appErr = commit(tx); appErr != nil {
+		return nil, appErr
 	}
 
 	logger.Info("User password success", zap.String("id_no", updatedPassword.IdNo))
-	return &updatedPassword, nil
+	return updatedPassword, nil
+}
+
+func (r UserAuthRepository) SetPassword(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	tx, err := r.emailDB.Beginx()
+	if err != nil {
+		logger.Error("Error starting password transaction", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer tx.Rollback()
+
+	updated, appErr := updatePassword(tx, setPasswordSql, user, event)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if appErr = commit(tx); appErr != nil {
+		return nil, appErr
+	}
+
+	logger.Info("User password set", zap.String("id_no", updated.IdNo), zap.String("action", event.Action))
+	return updated, nil
+}
+
+func (r UserAuthRepository) CreateResetToken(token domain.PasswordResetToken) *errors.AppError {
+	createTokenSql := `
+		INSERT INTO password_reset_tokens (id_no, token_hash, date_created, date_expires)
+		VALUES (:id_no, :token_hash, NOW(), :date_expires)
+	`
+	if _, err := r.emailDB.NamedExec(createTokenSql, token); err != nil {
+		logger.Error("Error while creating password reset token", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	logger.Info("Password reset token created", zap.String("id_no", token.IdNo))
+	return nil
+}
+
+func (r UserAuthRepository) ResetToken(tokenHash string) (*domain.PasswordResetToken, *errors.AppError) {
+	var token domain.PasswordResetToken
+	err := r.emailDB.Get(&token, "SELECT * FROM password_reset_tokens WHERE token_hash = $1", tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.NewNotFoundError("Reset token not found")
+		}
+		logger.Error("Database error while fetching password reset token", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return &token, nil
+}
+
+func (r UserAuthRepository) ResetPassword(token domain.PasswordResetToken, user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	tx, err := r.emailDB.Beginx()
+	if err != nil {
+		logger.Error("Error starting password reset transaction", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE password_reset_tokens SET date_used = CURRENT_TIMESTAMP WHERE id = $1 AND date_used IS NULL", token.Id)
+	if err != nil {
+		logger.Error("Error using password reset token", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading used reset token count", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	if affected == 0 {
+		logger.Warn("Password reset token already used", zap.String("id_no", token.IdNo))
+		return nil, errors.NewConflictError("Reset token already used")
+	}
+
+	updated, appErr := updatePassword(tx, setPasswordSql, user, event)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if appErr = commit(tx); appErr != nil {
+		return nil, appErr
+	}
+
+	logger.Info("User password reset", zap.String("id_no", updated.IdNo))
+	return updated, nil
+}
+
+func (r UserAuthRepository) PasswordHistory(idNo string, limit int) ([]string, *errors.AppError) {
+	historySql := `
+		SELECT hashed_password FROM password_history
+		WHERE id_no = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`
+	hashes := []string{}
+	if err := r.emailDB.Select(&hashes, historySql, idNo, limit); err != nil {
+		logger.Error("Database error while fetching password history", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return hashes, nil
+}
+
+// updatePassword writes a password change with query inside tx, keeps the new
+// hash in the password history, uses up the user's outstanding reset tokens and
+// records event
+func updatePassword(tx *sqlx.Tx, query string, user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	before, appErr := lockUser(tx, user.IdNo)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	rows, err := tx.NamedQuery(query, user)
+	if err != nil {
+		logger.Error("Error while updating password", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	updated, appErr := scanUser(rows, "Password update failed")
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	historySql := "INSERT INTO password_history (id_no, hashed_password, date_created) VALUES ($1, $2, NOW())"
+	if _, err = tx.Exec(historySql, updated.IdNo, updated.HashedPassword); err != nil {
+		logger.Error("Error while recording password history", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+
+	// A reset link sent before the password changed must not undo the change
+	resetTokensSql := "UPDATE password_reset_tokens SET date_used = CURRENT_TIMESTAMP WHERE id_no = $1 AND date_used IS NULL"
+	if _, err = tx.Exec(resetTokensSql, updated.IdNo); err != nil {
+		logger.Error("Error invalidating password reset tokens", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+
+	if appErr = recordUserEvent(tx, event, *before, *updated); appErr != nil {
+		return nil, appErr
+	}
+	return updated, nil
 }
 
 func NewUserAuthRepositoryDb(db *sqlx.DB) UserAuthRepository {
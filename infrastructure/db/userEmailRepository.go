@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/jmechavez/email-account-tracker/errors"
 	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
@@ -15,18 +16,44 @@ type UserEmailRepository struct {
 	emailDB *sqlx.DB
 }
 
-func (r UserEmailRepository) Users(limit, offset int) ([]domain.User, *errors.AppError) {
-	logger.Info("Fetching users from the database with pagination", zap.Int("limit", limit), zap.Int("offset", offset))
+func (r UserEmailRepository) Users(filter domain.UserFilter) (*domain.UserPage, *errors.AppError) {
+	logger.Info("Fetching users from the database with pagination",
+		zap.Int("limit", filter.Limit), zap.Int("offset", filter.Offset), zap.Bool("cursor", filter.Cursor != nil))
 
+	if column := filter.SortColumn(); !domain.UserSortFields[column] {
+		return nil, errors.NewValidationError("Unknown sort field " + column)
+	}
+
+	// The total ignores the page position
+	countSql, countArgs := countUsersQuery(filter)
+	var total int
+	err := r.emailDB.Get(&total, countSql, countArgs...)
+	if err != nil {
+		logger.Error("Database error while counting users", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+
+	query, args, backward := usersPageQuery(filter)
 	var users []domain.User
-	query := "SELECT * FROM users LIMIT $1 OFFSET $2"
-	err := r.emailDB.Select(&users, query, limit, offset)
+	err = r.emailDB.Select(&users, query, args...)
 	if err != nil {
 		logger.Error("Database error while fetching users", zap.Error(err))
 		return nil, errors.NewUnExpectedError("Unexpected database error")
 	}
-	logger.Info("Successfully fetched users", zap.Int("count", len(users)))
-	return users, nil
+
+	page := &domain.UserPage{Total: total, HasMore: len(users) > filter.Limit}
+	if page.HasMore {
+		users = users[:filter.Limit]
+	}
+	if backward {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+	page.Users = users
+
+	logger.Info("Successfully fetched users", zap.Int("count", len(users)), zap.Int("total", total))
+	return page, nil
 }
 
 func (r UserEmailRepository) IdNo(idNo string) (*domain.User, *errors.AppError) {
@@ -45,46 +72,77 @@ func (r UserEmailRepository) IdNo(idNo string) (*domain.User, *errors.AppError)
 	return &user, nil
 }
 
-func (r UserEmailRepository) CreateUser(user domain.User) (*domain.UserCreateReturn, *errors.AppError) {
+func (r UserEmailRepository) Email(email string) (*domain.User, *errors.AppError) {
+	logger.Info("Fetching user by email", zap.String("email", email))
+	var user domain.User
+	err := r.emailDB.Get(&user, "SELECT * FROM users WHERE LOWER(email) = LOWER($1)", email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Warn("User not found", zap.String("email", email))
+			return nil, errors.NewNotFoundError("User not found")
+		}
+		logger.Error("Database error while fetching user by email", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	logger.Info("Successfully fetched user", zap.String("id_no", user.IdNo))
+	return &user, nil
+}
+
+func (r UserEmailRepository) CreateUser(user domain.User, event domain.UserEvent) (*domain.UserCreateReturn, *errors.AppError) {
 	logger.Info("Creating a new user", zap.String("id_no", user.IdNo))
 	createUserSql := `
             INSERT INTO users (
                     id_no, department, first_name, last_name, suffix, email,
                     email_status, status, ticket_no, profile_picture, hashed_password,
-                    salt, smtp_email, smtp_password, date_created, date_updated, created_by, updated_by
+                    salt, smtp_email, smtp_password, date_created, date_updated, created_by, updated_by,
+                    manager_id_no
             ) VALUES (
                     :id_no, :department, :first_name, :last_name, :suffix, :email,
                     :email_status, :status, :ticket_no, :profile_picture, :hashed_password,
                     :salt, :smtp_email, :smtp_password,
-                    NOW(), NOW(), :created_by, :updated_by
+                    NOW(), NOW(), :created_by, :updated_by,
+                    :manager_id_no
             )
-            RETURNING id_no, first_name, last_name, suffix, email
+            RETURNING *
     `
+	tx, err := r.emailDB.Beginx()
+	if err != nil {
+		logger.Error("Error starting create user transaction", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer tx.Rollback()
 
-	rows, err := r.emailDB.NamedQuery(createUserSql, user)
+	rows, err := tx.NamedQuery(createUserSql, user)
 	if err != nil {
+		if isPgError(err, pgUniqueViolation) {
+			logger.Warn("User or email already exists", zap.String("id_no", user.IdNo))
+			return nil, errors.NewConflictError("User or email already exists")
+		}
+		if isPgError(err, pgForeignKeyViolation) {
+			logger.Warn("Manager of new user not found", zap.String("id_no", user.IdNo))
+			return nil, errors.NewValidationError("Manager not found")
+		}
 		logger.Error("Error while creating user", zap.Error(err))
 		return nil, errors.NewUnExpectedError("Unexpected database error")
 	}
-	defer rows.Close()
+	createdUser, appErr := scanUser(rows, "User creation failed")
+	if appErr != nil {
+		return nil, appErr
+	}
 
-	var userReturn domain.UserCreateReturn
-	if rows.Next() {
-		err = rows.StructScan(&userReturn)
-		if err != nil {
-			logger.Error("Error scanning user return", zap.Error(err))
-			return nil, errors.NewUnExpectedError("Unexpected database error")
-		}
-	} else {
-		logger.Error("No rows returned after insert")
-		return nil, errors.NewUnExpectedError("User creation failed")
+	if appErr = recordUserEvent(tx, event, domain.User{}, *createdUser); appErr != nil {
+		return nil, appErr
+	}
+	if appErr = commit(tx); appErr != nil {
+		return nil, appErr
 	}
 
+	userReturn := createdUser.ToUserCreateReturn()
 	logger.Info("User created successfully", zap.String("id_no", userReturn.IdNo))
 	return &userReturn, nil
 }
 
-func (r UserEmailRepository) DeleteUser(user domain.User) (*domain.UserDeleteReturn, *errors.AppError) {
+func (r UserEmailRepository) DeleteUser(user domain.User, event domain.UserEvent) (*domain.UserDeleteReturn, *errors.AppError) {
 	logger.Info("Deleting user", zap.String("id_no", user.IdNo))
 	deleteUserSql := `
 		UPDATE users
@@ -95,15 +153,30 @@ func (r UserEmailRepository) DeleteUser(user domain.User) (*domain.UserDeleteRet
 			deleted_by = $3,
 			date_deleted = CURRENT_TIMESTAMP
 		WHERE id_no = $1 AND status != 'deleted'
-		RETURNING id_no, status, email_status
+		RETURNING *
 	`
-	var u domain.UserDeleteReturn
-	err := r.emailDB.QueryRow(
+	tx, err := r.emailDB.Beginx()
+	if err != nil {
+		logger.Error("Error starting delete user transaction", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer tx.Rollback()
+
+	before, appErr := lockUser(tx, user.IdNo)
+	if appErr != nil {
+		if errors.IsNotFoundError(appErr) {
+			return nil, errors.NewNotFoundError("User not found or already deleted")
+		}
+		return nil, appErr
+	}
+
+	var deletedUser domain.User
+	err = tx.QueryRowx(
 		deleteUserSql,
 		user.IdNo,
 		user.DeletedTicketNo.String,
 		user.DeletedBy.String,
-	).Scan(&u.IdNo, &u.Status, &u.EmailStatus)
+	).StructScan(&deletedUser)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -114,11 +187,23 @@ func (r UserEmailRepository) DeleteUser(user domain.User) (*domain.UserDeleteRet
 		return nil, errors.NewUnExpectedError("Database error during user deletion")
 	}
 
+	if appErr = recordUserEvent(tx, event, *before, deletedUser); appErr != nil {
+		return nil, appErr
+	}
+	if appErr = commit(tx); appErr != nil {
+		return nil, appErr
+	}
+
+	u := domain.UserDeleteReturn{
+		IdNo:        deletedUser.IdNo,
+		EmailStatus: deletedUser.EmailStatus,
+		Status:      deletedUser.Status,
+	}
 	logger.Info("User deleted successfully", zap.String("id_no", u.IdNo))
 	return &u, nil
 }
 
-func (r UserEmailRepository) UpdateUser(user domain.User) (*domain.User, *errors.AppError) {
+func (r UserEmailRepository) UpdateUser(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
 	logger.Info("Updating user", zap.String("id_no", user.IdNo))
 	updateUserSql := `
         UPDATE users
@@ -132,35 +217,51 @@ func (r UserEmailRepository) UpdateUser(user domain.User) (*domain.User, *errors
             status = CASE WHEN :status = '' THEN status ELSE :status END,
             ticket_no = CASE WHEN :ticket_no = '' THEN ticket_no ELSE :ticket_no END,
             profile_picture = CASE WHEN :profile_picture = '' THEN profile_picture ELSE :profile_picture END,
+            manager_id_no = :manager_id_no,
+            updated_ticket_no = :updated_ticket_no,
             updated_by = :updated_by,
             date_updated = CURRENT_TIMESTAMP
         WHERE id_no = :id_no
         RETURNING *
     `
-	rows, err := r.emailDB.NamedQuery(updateUserSql, user)
+	tx, err := r.emailDB.Beginx()
 	if err != nil {
-		logger.Error("Error while updating user", zap.Error(err))
+		logger.Error("Error starting update user transaction", zap.Error(err))
 		return nil, errors.NewUnExpectedError("Unexpected database error")
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var updatedUser domain.User
-	if rows.Next() {
-		err = rows.StructScan(&updatedUser)
-		if err != nil {
-			logger.Error("Error scanning updated user", zap.Error(err))
-			return nil, errors.NewUnExpectedError("Unexpected database error")
+	before, appErr := lockUser(tx, user.IdNo)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	rows, err := tx.NamedQuery(updateUserSql, user)
+	if err != nil {
+		if isPgError(err, pgForeignKeyViolation) {
+			logger.Warn("Manager of user not found", zap.String("id_no", user.IdNo))
+			return nil, errors.NewValidationError("Manager not found")
 		}
-	} else {
-		logger.Error("No rows returned after update")
-		return nil, errors.NewUnExpectedError("User update failed")
+		logger.Error("Error while updating user", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	updatedUser, appErr := scanUser(rows, "User update failed")
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if appErr = recordUserEvent(tx, event, *before, *updatedUser); appErr != nil {
+		return nil, appErr
+	}
+	if appErr = commit(tx); appErr != nil {
+		return nil, appErr
 	}
 
 	logger.Info("User updated successfully", zap.String("id_no", updatedUser.IdNo))
-	return &updatedUser, nil
+	return updatedUser, nil
 }
 
-func (r UserEmailRepository) UpdateSurname(user domain.User) (*domain.User, *errors.AppError) {
+func (r UserEmailRepository) UpdateSurname(user domain.User, alias *domain.EmailAlias, event domain.UserEvent) (*domain.User, *errors.AppError) {
 	logger.Info("Updating user surname", zap.String("id_no", user.IdNo))
 	updateSurnameSql := `
 		UPDATE users
@@ -173,29 +274,243 @@ func (r UserEmailRepository) UpdateSurname(user domain.User) (*domain.User, *err
 		WHERE id_no = :id_no
 		RETURNING *
 	`
-	rows, err := r.emailDB.NamedQuery(updateSurnameSql, user)
+	tx, err := r.emailDB.Beginx()
 	if err != nil {
+		logger.Error("Error starting surname transaction", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer tx.Rollback()
+
+	before, appErr := lockUser(tx, user.IdNo)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	// A user taking back a previous address no longer needs it as an alias
+	_, err = tx.Exec("DELETE FROM email_aliases WHERE id_no = $1 AND LOWER(alias) = LOWER($2)", user.IdNo, user.Email)
+	if err != nil {
+		logger.Error("Error clearing reclaimed alias", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+
+	rows, err := tx.NamedQuery(updateSurnameSql, user)
+	if err != nil {
+		// Another user may have taken the address since it was generated
+		if isPgError(err, pgUniqueViolation) {
+			logger.Warn("Email already exists", zap.String("id_no", user.IdNo))
+			return nil, errors.NewConflictError("Email already exists")
+		}
 		logger.Error("Error while updating surname", zap.Error(err))
 		return nil, errors.NewUnExpectedError("Unexpected database error")
 	}
-	defer rows.Close()
+	updatedUser, appErr := scanUser(rows, "Surname update failed")
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	// Keep the previous address delivering mail for its grace period
+	if alias != nil {
+		if _, appErr = insertAlias(tx, *alias); appErr != nil {
+			return nil, appErr
+		}
+	}
+
+	if appErr = recordUserEvent(tx, event, *before, *updatedUser); appErr != nil {
+		return nil, appErr
+	}
+	if appErr = commit(tx); appErr != nil {
+		return nil, appErr
+	}
+
+	logger.Info("User surname updated successfully", zap.String("id_no", updatedUser.IdNo))
+	return updatedUser, nil
+}
+
+func (r UserEmailRepository) RestoreUser(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	logger.Info("Restoring user", zap.String("id_no", user.IdNo))
+	restoreUserSql := `
+		UPDATE users
+		SET
+			status = 'active',
+			email_status = 'active',
+			updated_ticket_no = :updated_ticket_no,
+			updated_by = :updated_by,
+			deleted_ticket_no = NULL,
+			deleted_by = NULL,
+			date_deleted = NULL,
+			date_updated = CURRENT_TIMESTAMP
+		WHERE id_no = :id_no AND status = 'deleted'
+		RETURNING *
+	`
+	tx, err := r.emailDB.Beginx()
+	if err != nil {
+		logger.Error("Error starting restore user transaction", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer tx.Rollback()
+
+	before, appErr := lockUser(tx, user.IdNo)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if before.Status != "deleted" {
+		logger.Warn("User is not deleted", zap.String("id_no", user.IdNo))
+		return nil, errors.NewConflictError("User is not deleted")
+	}
+	if before.DateAnonymized.Valid {
+		logger.Warn("User has been anonymized", zap.String("id_no", user.IdNo))
+		return nil, errors.NewConflictError("User has been anonymized by the retention policy and cannot be restored")
+	}
+
+	// The address may have been handed to someone else while the user was deleted
+	taken, appErr := emailTaken(tx, before.Email, before.IdNo)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if taken {
+		logger.Warn("Email address of deleted user is in use", zap.String("id_no", user.IdNo))
+		return nil, errors.NewConflictError("Email address is now used by another account")
+	}
+
+	rows, err := tx.NamedQuery(restoreUserSql, user)
+	if err != nil {
+		logger.Error("Error while restoring user", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	restoredUser, appErr := scanUser(rows, "User restore failed")
+	if appErr != nil {
+		return nil, appErr
+	}
 
+	if appErr = recordUserEvent(tx, event, *before, *restoredUser); appErr != nil {
+		return nil, appErr
+	}
+	if appErr = commit(tx); appErr != nil {
+		return nil, appErr
+	}
+
+	logger.Info("User restored successfully", zap.String("id_no", restoredUser.IdNo))
+	return restoredUser, nil
+}
+
+func (r UserEmailRepository) SuspendUser(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	logger.Info("Suspending user", zap.String("id_no", user.IdNo))
+	suspendUserSql := `
+		UPDATE users
+		SET
+			status = 'suspended',
+			suspension_reason = :suspension_reason,
+			date_suspended = CURRENT_TIMESTAMP,
+			suspended_until = :suspended_until,
+			updated_ticket_no = :updated_ticket_no,
+			updated_by = :updated_by,
+			date_updated = CURRENT_TIMESTAMP
+		WHERE id_no = :id_no AND status = 'active'
+		RETURNING *
+	`
+	return r.changeUserStatus(user, event, suspendUserSql, "User is not active")
+}
+
+func (r UserEmailRepository) ReactivateUser(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	logger.Info("Reactivating user", zap.String("id_no", user.IdNo))
+	reactivateUserSql := `
+		UPDATE users
+		SET
+			status = 'active',
+			suspension_reason = NULL,
+			date_suspended = NULL,
+			suspended_until = NULL,
+			updated_ticket_no = :updated_ticket_no,
+			updated_by = :updated_by,
+			date_updated = CURRENT_TIMESTAMP
+		WHERE id_no = :id_no AND status = 'suspended'
+		RETURNING *
+	`
+	return r.changeUserStatus(user, event, reactivateUserSql, "User is not suspended")
+}
+
+// changeUserStatus runs a status update guarded by its WHERE clause and records
+// event in the same transaction; a user in the wrong state is a conflict
+func (r UserEmailRepository) changeUserStatus(user domain.User, event domain.UserEvent, query, conflict string) (*domain.User, *errors.AppError) {
+	tx, err := r.emailDB.Beginx()
+	if err != nil {
+		logger.Error("Error starting status transaction", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	defer tx.Rollback()
+
+	before, appErr := lockUser(tx, user.IdNo)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	rows, err := tx.NamedQuery(query, user)
+	if err != nil {
+		logger.Error("Error while changing user status", zap.String("action", event.Action), zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
 	var updatedUser domain.User
 	if rows.Next() {
 		err = rows.StructScan(&updatedUser)
+		rows.Close()
 		if err != nil {
 			logger.Error("Error scanning updated user", zap.Error(err))
 			return nil, errors.NewUnExpectedError("Unexpected database error")
 		}
 	} else {
-		logger.Error("No rows returned after surname update")
-		return nil, errors.NewUnExpectedError("Surname update failed")
+		rows.Close()
+		logger.Warn("User not in the expected status", zap.String("id_no", user.IdNo), zap.String("status", before.Status))
+		return nil, errors.NewConflictError(conflict)
 	}
 
-	logger.Info("User surname updated successfully", zap.String("id_no", updatedUser.IdNo))
+	if appErr = recordUserEvent(tx, event, *before, updatedUser); appErr != nil {
+		return nil, appErr
+	}
+	if appErr = commit(tx); appErr != nil {
+		return nil, appErr
+	}
+
+	logger.Info("User status changed successfully", zap.String("id_no", updatedUser.IdNo), zap.String("status", updatedUser.Status))
 	return &updatedUser, nil
 }
 
+func (r UserEmailRepository) ExpiredSuspensions(now time.Time) ([]domain.User, *errors.AppError) {
+	var users []domain.User
+	expiredSql := "SELECT * FROM users WHERE status = 'suspended' AND suspended_until <= $1 ORDER BY suspended_until"
+	err := r.emailDB.Select(&users, expiredSql, now)
+	if err != nil {
+		logger.Error("Database error while fetching expired suspensions", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return users, nil
+}
+
+func (r UserEmailRepository) EmailExists(email, excludeIdNo string) (bool, *errors.AppError) {
+	return emailTaken(r.emailDB, email, excludeIdNo)
+}
+
+// emailTaken checks an address through either the database or an open transaction
+func emailTaken(q sqlx.Queryer, email, excludeIdNo string) (bool, *errors.AppError) {
+	// Soft-deleted rows keep their address, so no status filter is applied;
+	// aliases hold their address until they expire
+	emailExistsSql := `
+		SELECT EXISTS (
+			SELECT 1 FROM users
+			WHERE LOWER(email) = LOWER($1) AND id_no != $2
+		) OR EXISTS (
+			SELECT 1 FROM email_aliases
+			WHERE LOWER(alias) = LOWER($1) AND id_no != $2
+				AND (date_expires IS NULL OR date_expires > CURRENT_TIMESTAMP)
+		)
+	`
+	var exists bool
+	err := sqlx.Get(q, &exists, emailExistsSql, email, excludeIdNo)
+	if err != nil {
+		logger.Error("Database error while checking email", zap.Error(err))
+		return false, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return exists, nil
+}
 
 func NewUserRepositoryDb(db *sqlx.DB) UserEmailRepository {
 	logger.Info("Initializing UserEmailRepository")
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+type UserEventRepository struct {
+	emailDB *sqlx.DB
+}
+
+func (r UserEventRepository) History(idNo string, limit, offset int) ([]domain.UserEvent, int, *errors.AppError) {
+	logger.Info("Fetching user history", zap.String("id_no", idNo), zap.Int("limit", limit), zap.Int("offset", offset))
+
+	var total int
+	err := r.emailDB.Get(&total, "SELECT COUNT(*) FROM user_events WHERE id_no = $1", idNo)
+	if err != nil {
+		logger.Error("Database error while counting user history", zap.Error(err))
+		return nil, 0, errors.NewUnExpectedError("Unexpected database error")
+	}
+
+	var events []domain.UserEvent
+	historySql := "SELECT * FROM user_events WHERE id_no = $1 ORDER BY id DESC LIMIT $2 OFFSET $3"
+	err = r.emailDB.Select(&events, historySql, idNo, limit, offset)
+	if err != nil {
+		logger.Error("Database error while fetching user history", zap.Error(err))
+		return nil, 0, errors.NewUnExpectedError("Unexpected database error")
+	}
+
+	logger.Info("Successfully fetched user history", zap.Int("count", len(events)), zap.Int("total", total))
+	return events, total, nil
+}
+
+// lockUser reads the current version of a user inside tx, holding a row lock
+// until the transaction ends so the recorded diff matches what was written
+func lockUser(tx *sqlx.Tx, idNo string) (*domain.User, *errors.AppError) {
+	var user domain.User
+	err := tx.Get(&user, "SELECT * FROM users WHERE id_no = $1 FOR UPDATE", idNo)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Warn("User not found", zap.String("id_no", idNo))
+			return nil, errors.NewNotFoundError("User not found")
+		}
+		logger.Error("Database error while locking user", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return &user, nil
+}
+
+// recordUserEvent appends event to the history inside tx with the field-level
+// diff between the before and after versions of the user, and writes its
+// domain event, if it has one, to the outbox
+func recordUserEvent(tx *sqlx.Tx, event domain.UserEvent, before, after domain.User) *errors.AppError {
+	event.Changes = domain.DiffUsers(before, after)
+	if appErr := insertUserEvent(tx, event); appErr != nil {
+		return appErr
+	}
+	return publishUserEvent(tx, event)
+}
+
+// insertUserEvent appends event to the history inside tx as given
+func insertUserEvent(tx *sqlx.Tx, event domain.UserEvent) *errors.AppError {
+	insertEventSql := `
+		INSERT INTO user_events (id_no, action, actor, ticket_no, changes, date_created)
+		VALUES (:id_no, :action, :actor, :ticket_no, :changes, NOW())
+	`
+	if _, err := tx.NamedExec(insertEventSql, event); err != nil {
+		logger.Error("Error while recording user event", zap.String("action", event.Action), zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	return nil
+}
+
+// redactUserHistory scrubs the personal values out of every recorded change of
+// a user inside tx. The append-only trigger on user_events refuses any other
+// update, and this one too unless app.redact_history is set for the transaction.
+func redactUserHistory(tx *sqlx.Tx, idNo string) *errors.AppError {
+	var events []domain.UserEvent
+	err := tx.Select(&events, "SELECT * FROM user_events WHERE id_no = $1 AND date_redacted IS NULL", idNo)
+	if err != nil {
+		logger.Error("Database error while reading user history to redact", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec("SET LOCAL app.redact_history = 'on'"); err != nil {
+		logger.Error("Error enabling history redaction", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	for _, event := range events {
+		redacted := event.WithoutPersonalData()
+		_, err := tx.Exec("UPDATE user_events SET changes = $1, date_redacted = NOW() WHERE id = $2", redacted.Changes, event.Id)
+		if err != nil {
+			logger.Error("Error redacting user event", zap.Int64("id", event.Id), zap.Error(err))
+			return errors.NewUnExpectedError("Unexpected database error")
+		}
+	}
+	if _, err := tx.Exec("SET LOCAL app.redact_history = 'off'"); err != nil {
+		logger.Error("Error disabling history redaction", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+
+	logger.Info("Redacted user history", zap.String("id_no", idNo), zap.Int("count", len(events)))
+	return nil
+}
+
+// scanUser reads the single user returned by a RETURNING * statement
+func scanUser(rows *sqlx.Rows, failure string) (*domain.User, *errors.AppError) {
+	defer rows.Close()
+
+	var user domain.User
+	if !rows.Next() {
+		logger.Error("No rows returned", zap.String("operation", failure))
+		return nil, errors.NewUnExpectedError(failure)
+	}
+	if err := rows.StructScan(&user); err != nil {
+		logger.Error("Error scanning user", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Unexpected database error")
+	}
+	return &user, nil
+}
+
+// commit finishes tx, logging and mapping a failure
+func commit(tx *sqlx.Tx) *errors.AppError {
+	if err := tx.Commit(); err != nil {
+		logger.Error("Error committing transaction", zap.Error(err))
+		return errors.NewUnExpectedError("Unexpected database error")
+	}
+	return nil
+}
+
+func NewUserEventRepositoryDb(db *sqlx.DB) UserEventRepository {
+	logger.Info("Initializing UserEventRepository")
+	return UserEventRepository{db}
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/lib/pq"
+)
+
+// userQuery accumulates WHERE conditions with positional parameters
+type userQuery struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg registers a parameter and returns its placeholder
+func (q *userQuery) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (q *userQuery) equals(column, value string) {
+	if value != "" {
+		q.conditions = append(q.conditions, fmt.Sprintf("%s = %s", column, q.arg(value)))
+	}
+}
+
+func (q *userQuery) between(column string, from, to *time.Time) {
+	if from != nil {
+		q.conditions = append(q.conditions, fmt.Sprintf("%s >= %s", column, q.arg(*from)))
+	}
+	if to != nil {
+		q.conditions = append(q.conditions, fmt.Sprintf("%s < %s", column, q.arg(*to)))
+	}
+}
+
+// where renders the accumulated conditions, or nothing when there are none
+func (q *userQuery) where() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// newUserQuery translates a filter into conditions. Column names only ever
+// come from this function, values always travel as parameters.
+func newUserQuery(f domain.UserFilter) *userQuery {
+	q := &userQuery{}
+	q.equals("department", f.Department)
+	if f.Departments != nil {
+		q.conditions = append(q.conditions, fmt.Sprintf("LOWER(department) = ANY(%s)", q.arg(pq.Array(lowerAll(f.Departments)))))
+	}
+	q.equals("status", f.Status)
+	q.equals("email_status::text", f.EmailStatus)
+
+	if f.TicketNo != "" {
+		p := q.arg(f.TicketNo)
+		q.conditions = append(q.conditions,
+			fmt.Sprintf("(ticket_no = %s OR updated_ticket_no = %s OR deleted_ticket_no = %s)", p, p, p))
+	}
+
+	if f.Search != "" {
+		p := q.arg("%" + escapeLike(f.Search) + "%")
+		q.conditions = append(q.conditions, fmt.Sprintf(
+			"(first_name ILIKE %s OR last_name ILIKE %s OR email ILIKE %s OR first_name || ' ' || last_name ILIKE %s)",
+			p, p, p, p))
+	}
+
+	q.between("date_created", f.CreatedFrom, f.CreatedTo)
+	q.between("date_updated", f.UpdatedFrom, f.UpdatedTo)
+	q.between("date_deleted", f.DeletedFrom, f.DeletedTo)
+	return q
+}
+
+// countUsersQuery returns the query counting the users filter matches across
+// all pages
+func countUsersQuery(filter domain.UserFilter) (string, []interface{}) {
+	q := newUserQuery(filter)
+	return "SELECT COUNT(*) FROM users" + q.where(), q.args
+}
+
+// usersPageQuery returns the query reading one page of users, with one extra
+// row that tells whether another page follows. A backward page is read in
+// reverse order from the cursor, and must be flipped by the caller.
+func usersPageQuery(filter domain.UserFilter) (query string, args []interface{}, backward bool) {
+	column := filter.SortColumn()
+	desc := filter.SortDesc
+	backward = filter.Cursor != nil && filter.Cursor.Backward
+	if backward {
+		desc = !desc
+	}
+
+	q := newUserQuery(filter)
+	if filter.Cursor != nil {
+		q.keyset(column, *filter.Cursor, desc)
+	}
+	query = "SELECT * FROM users" + q.where() + orderBy(column, desc) + " LIMIT " + q.arg(filter.Limit+1)
+	if filter.Cursor == nil {
+		query += " OFFSET " + q.arg(filter.Offset)
+	}
+	return query, q.args, backward
+}
+
+// keyset adds the condition that starts the page after (or before) the cursor row
+func (q *userQuery) keyset(column string, cursor domain.UserCursor, desc bool) {
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	if column == "id_no" {
+		q.conditions = append(q.conditions, fmt.Sprintf("id_no %s %s", op, q.arg(cursor.IdNo)))
+		return
+	}
+	q.conditions = append(q.conditions,
+		fmt.Sprintf("(%s, id_no) %s (%s, %s)", column, op, q.arg(cursor.Key), q.arg(cursor.IdNo)))
+}
+
+// orderBy renders the ORDER BY clause, with id_no as tie breaker for a stable
+// order. column must come from domain.UserSortFields.
+func orderBy(column string, desc bool) string {
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+	if column == "id_no" {
+		return fmt.Sprintf(" ORDER BY id_no %s", direction)
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, id_no %s", column, direction, direction)
+}
+
+// escapeLike makes LIKE wildcards in user input match literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// lowerAll returns values in lower case for case-insensitive matching
+func lowerAll(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, value := range values {
+		lowered[i] = strings.ToLower(value)
+	}
+	return lowered
+}
@@ -0,0 +1,186 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/lib/pq"
+)
+
+func TestUsersPageQueryKeyset(t *testing.T) {
+	// Two users created in the same second are told apart by id_no
+	const created = "2026-03-01T09:00:00Z"
+	tests := []struct {
+		name     string
+		filter   domain.UserFilter
+		query    string
+		args     []interface{}
+		backward bool
+	}{
+		{
+			name:   "offset page",
+			filter: domain.UserFilter{Limit: 10, Offset: 20},
+			query:  "SELECT * FROM users ORDER BY id_no ASC LIMIT $1 OFFSET $2",
+			args:   []interface{}{11, 20},
+		},
+		{
+			name:   "next page by id_no",
+			filter: domain.UserFilter{Limit: 10, Cursor: &domain.UserCursor{Key: "E200", IdNo: "E200"}},
+			query:  "SELECT * FROM users WHERE id_no > $1 ORDER BY id_no ASC LIMIT $2",
+			args:   []interface{}{"E200", 11},
+		},
+		{
+			name:   "next page by id_no descending",
+			filter: domain.UserFilter{Limit: 10, SortDesc: true, Cursor: &domain.UserCursor{Key: "E200", IdNo: "E200"}},
+			query:  "SELECT * FROM users WHERE id_no < $1 ORDER BY id_no DESC LIMIT $2",
+			args:   []interface{}{"E200", 11},
+		},
+		{
+			name:     "previous page by id_no",
+			filter:   domain.UserFilter{Limit: 10, Cursor: &domain.UserCursor{Key: "E200", IdNo: "E200", Backward: true}},
+			query:    "SELECT * FROM users WHERE id_no < $1 ORDER BY id_no DESC LIMIT $2",
+			args:     []interface{}{"E200", 11},
+			backward: true,
+		},
+		{
+			name:   "next page by date_created",
+			filter: domain.UserFilter{Limit: 5, SortBy: "date_created", Cursor: &domain.UserCursor{Key: created, IdNo: "E200"}},
+			query:  "SELECT * FROM users WHERE (date_created, id_no) > ($1, $2) ORDER BY date_created ASC, id_no ASC LIMIT $3",
+			args:   []interface{}{created, "E200", 6},
+		},
+		{
+			name: "previous page by date_created descending",
+			filter: domain.UserFilter{Limit: 5, SortBy: "date_created", SortDesc: true,
+				Cursor: &domain.UserCursor{Key: created, IdNo: "E200", Backward: true}},
+			query:    "SELECT * FROM users WHERE (date_created, id_no) > ($1, $2) ORDER BY date_created ASC, id_no ASC LIMIT $3",
+			args:     []interface{}{created, "E200", 6},
+			backward: true,
+		},
+		{
+			name: "filtered page by date_created",
+			filter: domain.UserFilter{Limit: 5, Status: "active", SortBy: "date_created", SortDesc: true,
+				Cursor: &domain.UserCursor{Key: created, IdNo: "E200"}},
+			query: "SELECT * FROM users WHERE status = $1 AND (date_created, id_no) < ($2, $3) " +
+				"ORDER BY date_created DESC, id_no DESC LIMIT $4",
+			args: []interface{}{"active", created, "E200", 6},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args, backward := usersPageQuery(tt.filter)
+			if query != tt.query {
+				t.Errorf("query =\n  %s\nwant\n  %s", query, tt.query)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %#v, want %#v", args, tt.args)
+			}
+			if backward != tt.backward {
+				t.Errorf("backward = %v, want %v", backward, tt.backward)
+			}
+		})
+	}
+}
+
+func TestCountUsersQueryIgnoresThePagePosition(t *testing.T) {
+	filter := domain.UserFilter{Status: "active", Limit: 10, SortBy: "date_created",
+		Cursor: &domain.UserCursor{Key: "2026-03-01T09:00:00Z", IdNo: "E200"}}
+
+	query, args := countUsersQuery(filter)
+	if want := "SELECT COUNT(*) FROM users WHERE status = $1"; query != want {
+		t.Errorf("query = %s, want %s", query, want)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"active"}) {
+		t.Errorf("args = %#v", args)
+	}
+}
+
+func TestNewUserQuery(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		filter domain.UserFilter
+		where  string
+		args   []interface{}
+	}{
+		{name: "no filter", filter: domain.UserFilter{}, where: "", args: nil},
+		{
+			name:   "equality filters",
+			filter: domain.UserFilter{Department: "IT", Status: "active", EmailStatus: "forwarding"},
+			where:  " WHERE department = $1 AND status = $2 AND email_status::text = $3",
+			args:   []interface{}{"IT", "active", "forwarding"},
+		},
+		{
+			name:   "department scope",
+			filter: domain.UserFilter{Departments: []string{"IT", "Sales"}},
+			where:  " WHERE LOWER(department) = ANY($1)",
+			args:   []interface{}{pq.Array([]string{"it", "sales"})},
+		},
+		{
+			name:   "empty department scope matches nothing",
+			filter: domain.UserFilter{Departments: []string{}},
+			where:  " WHERE LOWER(department) = ANY($1)",
+			args:   []interface{}{pq.Array([]string{})},
+		},
+		{
+			name:   "ticket on any of the three ticket columns",
+			filter: domain.UserFilter{Status: "deleted", TicketNo: "T-9"},
+			where:  " WHERE status = $1 AND (ticket_no = $2 OR updated_ticket_no = $2 OR deleted_ticket_no = $2)",
+			args:   []interface{}{"deleted", "T-9"},
+		},
+		{
+			name:   "search escapes wildcards",
+			filter: domain.UserFilter{Search: `50%_a\b`},
+			where: " WHERE (first_name ILIKE $1 OR last_name ILIKE $1 OR email ILIKE $1 OR " +
+				"first_name || ' ' || last_name ILIKE $1)",
+			args: []interface{}{`%50\%\_a\\b%`},
+		},
+		{
+			name:   "date ranges",
+			filter: domain.UserFilter{CreatedFrom: &from, CreatedTo: &to, UpdatedFrom: &from, DeletedTo: &to},
+			where:  " WHERE date_created >= $1 AND date_created < $2 AND date_updated >= $3 AND date_deleted < $4",
+			args:   []interface{}{from, to, from, to},
+		},
+		{
+			name: "every filter numbers its placeholders in order",
+			filter: domain.UserFilter{Department: "IT", Departments: []string{"IT"}, Status: "active",
+				EmailStatus: "active", TicketNo: "T-1", Search: "ana", CreatedFrom: &from, DeletedTo: &to},
+			where: " WHERE department = $1 AND LOWER(department) = ANY($2) AND status = $3 AND email_status::text = $4" +
+				" AND (ticket_no = $5 OR updated_ticket_no = $5 OR deleted_ticket_no = $5)" +
+				" AND (first_name ILIKE $6 OR last_name ILIKE $6 OR email ILIKE $6 OR first_name || ' ' || last_name ILIKE $6)" +
+				" AND date_created >= $7 AND date_deleted < $8",
+			args: []interface{}{"IT", pq.Array([]string{"it"}), "active", "active", "T-1", "%ana%", from, to},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newUserQuery(tt.filter)
+			if where := q.where(); where != tt.where {
+				t.Errorf("where =\n  %q\nwant\n  %q", where, tt.where)
+			}
+			if !reflect.DeepEqual(q.args, tt.args) {
+				t.Errorf("args = %#v, want %#v", q.args, tt.args)
+			}
+		})
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	tests := []struct {
+		column string
+		desc   bool
+		want   string
+	}{
+		{"id_no", false, " ORDER BY id_no ASC"},
+		{"id_no", true, " ORDER BY id_no DESC"},
+		{"last_name", false, " ORDER BY last_name ASC, id_no ASC"},
+		{"date_deleted", true, " ORDER BY date_deleted DESC, id_no DESC"},
+	}
+	for _, tt := range tests {
+		if got := orderBy(tt.column, tt.desc); got != tt.want {
+			t.Errorf("orderBy(%q, %v) = %q, want %q", tt.column, tt.desc, got, tt.want)
+		}
+	}
+}
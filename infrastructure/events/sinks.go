@@ -0,0 +1,94 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"go.uber.org/zap"
+)
+
+// LogSink writes domain events to the application log
+type LogSink struct{}
+
+func (LogSink) Name() string {
+	return "log"
+}
+
+func (LogSink) Publish(event domain.DomainEvent) *errors.AppError {
+	logger.Info("Domain event",
+		zap.Int64("id", event.Id),
+		zap.String("type", event.Type),
+		zap.String("id_no", event.IdNo),
+		zap.Time("date_created", event.DateCreated),
+	)
+	return nil
+}
+
+// WebhookSink POSTs each domain event as JSON to a URL. When a secret is set
+// the body is signed with HMAC-SHA256 in the X-Signature header, so receivers
+// can tell the event came from this service.
+type WebhookSink struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func (s WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (s WebhookSink) Publish(event domain.DomainEvent) *errors.AppError {
+	body, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("Error encoding domain event", zap.Int64("id", event.Id), zap.Error(err))
+		return errors.NewUnExpectedError("Error encoding domain event")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		logger.Error("Invalid webhook request", zap.Error(err))
+		return errors.NewUnExpectedError("Invalid webhook URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Id", strconv.FormatInt(event.Id, 10))
+	req.Header.Set("X-Event-Type", event.Type)
+	if len(s.secret) > 0 {
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		logger.Warn("Webhook delivery failed", zap.Int64("id", event.Id), zap.Error(err))
+		return errors.NewUnExpectedError("Webhook could not be reached")
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		logger.Warn("Webhook refused event", zap.Int64("id", event.Id), zap.Int("status", resp.StatusCode))
+		return errors.NewUnExpectedError(fmt.Sprintf("Webhook answered %d", resp.StatusCode))
+	}
+	return nil
+}
+
+// NewWebhookSink creates a new instance of WebhookSink
+func NewWebhookSink(url, secret string, timeout time.Duration) WebhookSink {
+	return WebhookSink{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: timeout},
+	}
+}
@@ -0,0 +1,47 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+	"github.com/jmechavez/email-account-tracker/internal/ports/services"
+)
+
+type ApiKeyHandler struct {
+	service services.ApiKeyService
+}
+
+func (h ApiKeyHandler) ApiKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.service.ApiKeys(r.Context())
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, keys)
+}
+
+func (h ApiKeyHandler) CreateApiKey(w http.ResponseWriter, r *http.Request) {
+	var req dto.ApiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	key, err := h.service.CreateApiKey(r.Context(), req)
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusCreated, key)
+}
+
+func (h ApiKeyHandler) RevokeApiKey(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.RevokeApiKey(r.Context(), mux.Vars(r)["key_id"]); err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusNoContent, nil)
+}
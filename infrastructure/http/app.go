@@ -1,13 +1,19 @@
 package http
 
 import (
+	"crypto/rand"
 	"log"
 	"net/http"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/jmechavez/email-account-tracker/infrastructure/config"
 	"github.com/jmechavez/email-account-tracker/infrastructure/db"
+	"github.com/jmechavez/email-account-tracker/infrastructure/events"
 	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/infrastructure/mail"
+	"github.com/jmechavez/email-account-tracker/infrastructure/secrets"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
 	"github.com/jmechavez/email-account-tracker/internal/ports/services"
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
@@ -20,35 +26,222 @@ func Start() {
 	// Create a new router using Gorilla Mux
 	router := mux.NewRouter()
 
+	// Load the application configuration from the environment
+	cfg := config.Load()
+
 	// Initialize the PostgreSQL database connection
-	dbUser := getPostgresDB()
+	dbUser := db.Connect()
+
+	// Resolve the configured email strategies
+	strategies, appErr := services.EmailStrategiesByName(cfg.EmailStrategies)
+	if appErr != nil {
+		logger.Fatal("Invalid email strategy configuration", zap.Error(appErr))
+	}
+
+	// Initialize the repositories shared by the services
+	userRepo := db.NewUserRepositoryDb(dbUser)
+	domainRepo := db.NewMailDomainRepositoryDb(dbUser)
+	roleRepo := db.NewRoleRepositoryDb(dbUser)
+	mfaRepo := db.NewMfaRepositoryDb(dbUser)
+
+	// TOTP codes of the second factor, checked against the wall clock
+	totp := services.NewTOTP(cfg.MfaIssuer, services.SystemClock{})
+
+	// Load the rules for new passwords
+	bannedPasswords, err := services.LoadBannedPasswords(cfg.PasswordBannedFile)
+	if err != nil {
+		logger.Fatal("Failed to load the banned password list", zap.Error(err))
+	}
+	passwordPolicy, appErr := services.NewPasswordPolicy(
+		cfg.PasswordMinLength, // Minimum password length
+		cfg.PasswordClasses,   // Required character classes
+		bannedPasswords,       // Refused passwords
+		cfg.PasswordHistory,   // Previous passwords that cannot be reused
+		cfg.PasswordMaxAge,    // Age after which a password must be changed
+	)
+	if appErr != nil {
+		logger.Fatal("Invalid password policy configuration", zap.Error(appErr))
+	}
+
+	// Initialize the throttling of failed logins
+	throttle := services.NewLoginThrottle(
+		loginAttemptStore(cfg, dbUser), // Failed login counters
+		cfg.LoginMaxFailures,           // Failures before a user identity is locked out
+		cfg.LoginMaxIpFailures,         // Failures before a client address is locked out
+		cfg.LoginLockout,               // Length of a lockout
+		cfg.LoginDelay,                 // Wait after the first failure
+	)
+
+	// Load the keys SMTP credentials and TOTP secrets are encrypted with
+	keyring, err := secrets.LoadKeyring(cfg.CredentialKeyFile, cfg.CredentialKeys, cfg.CredentialActiveKey)
+	if err != nil {
+		logger.Fatal("Failed to load the credential keyring", zap.Error(err))
+	}
+	if keyring.ActiveKeyId() == "" {
+		logger.Warn("No credential key is configured; SMTP credentials and MFA enrollments cannot be stored")
+	}
+
+	// Initialize the guard of users' SMTP credentials
+	smtpServer := mail.NewSmtpServer(cfg.SmtpHost, cfg.SmtpPort, cfg.SmtpTimeout)
+	smtpCredentials := services.NewSmtpCredentialService(
+		db.NewSmtpCredentialRepositoryDb(dbUser), // SMTP credential repository
+		keyring,                                  // Credential encryption keys
+		smtpServer,                               // SMTP server credentials are verified against
+		cfg.SmtpCredentialConsumers,              // Components allowed to decrypt
+	)
+
+	// Initialize the notifications, sent in the background with the SMTP
+	// credentials of the configured sender
+	notificationTemplates, err := mail.LoadTemplates(cfg.NotificationTemplateDir)
+	if err != nil {
+		logger.Fatal("Failed to load the notification templates", zap.Error(err))
+	}
+	notificationEvents := cfg.NotificationEvents
+	if cfg.NotificationSender == "" {
+		logger.Warn("NOTIFICATION_SENDER is not set; notifications are not sent")
+		notificationEvents = nil
+	}
+	notificationQueue := mail.NewDeliveryQueue(
+		mail.NewSmtpSender(smtpServer, smtpCredentials, cfg.NotificationSender), // SMTP delivery
+		cfg.NotificationQueueSize,   // Notifications waiting for delivery
+		cfg.NotificationMaxAttempts, // Attempts before a notification is dropped
+		cfg.NotificationRetryDelay,  // Wait after the first failure
+	)
+	notificationQueue.Start()
+	notifier, appErr := services.NewNotificationService(
+		userRepo,              // User repository
+		notificationTemplates, // Message templates
+		notificationQueue,     // Retrying delivery
+		notificationEvents,    // Events that are sent
+	)
+	if appErr != nil {
+		logger.Fatal("Invalid notification configuration", zap.Error(appErr))
+	}
+
+	// Initialize the signer for session access tokens
+	tokens := services.NewTokenSigner(jwtKey(cfg), cfg.JWTIssuer, cfg.AccessTokenTTL)
 
 	// Initialize the UserAuthHandler with its dependencies
 	uah := UserAuthHandler{
 		services.NewUserAuthService(
 			db.NewUserAuthRepositoryDb(dbUser), // User authentication repository
-			db.NewUserRepositoryDb(dbUser),     // User repository
+			userRepo,                           // User repository
+			db.NewSessionRepositoryDb(dbUser),  // Refresh token repository
+			roleRepo,                           // Operator role repository
+			tokens,                             // Access token signer
+			cfg.RefreshTokenTTL,                // Lifetime of refresh tokens
+			cfg.PasswordResetTTL,               // Lifetime of password reset tokens
+			notifier,                           // Delivery of password reset tokens
+			passwordPolicy,                     // Rules for new passwords
+			throttle,                           // Delays and lockouts after failed logins
+			mfaRepo,                            // Second factor enrollments and challenges
+			totp,                               // TOTP code generator
+			keyring,                            // Encryption of TOTP secrets
 		),
 	}
 
+	// Initialize the MfaHandler with its dependencies
+	mh := MfaHandler{
+		services.NewMfaService(mfaRepo, userRepo, roleRepo, totp, keyring), // Second factor management
+	}
+
+	// Initialize the SmtpCredentialHandler with its dependencies
+	sch := SmtpCredentialHandler{smtpCredentials}
+
 	// Initialize the UserHandler with its dependencies
-	uh := UserHandler{
-		services.NewUserService(db.NewUserRepositoryDb(dbUser)), // User service
+	userService := services.NewUserService(
+		userRepo,             // User repository
+		domainRepo,           // Mail domain repository
+		strategies,           // Email generation strategies
+		cfg.AliasGracePeriod, // How long replaced addresses are kept as aliases
+		notifier,             // Welcome and address change notifications
+	)
+	if cfg.ReactivationInterval > 0 {
+		userService.StartAutoReactivation(cfg.ReactivationInterval)
 	}
+	uh := UserHandler{userService}
 
-	// Define HTTP routes and their corresponding handlers
-	router.HandleFunc("/users", uh.IdNo).Methods(http.MethodGet)                              // Get user by ID
-	router.HandleFunc("/users/{id_no}", uh.CreateUser).Methods(http.MethodPost)               // Create a new user
-	router.HandleFunc("/users/{id_no}", uh.DeleteUser).Methods(http.MethodDelete)             // Delete a user
-	router.HandleFunc("/users/{id_no}", uh.UpdateUser).Methods(http.MethodPatch)              // Update user details
-	router.HandleFunc("/users/{id_no}/surname", uh.UpdateSurname).Methods(http.MethodPatch)   // Update user surname
-	router.HandleFunc("/users/{id_no}/password", uah.CreatePassword).Methods(http.MethodPost) // Create or update user password
+	// Initialize the MailDomainHandler with its dependencies
+	mdh := MailDomainHandler{
+		services.NewMailDomainService(domainRepo), // Mail domain service
+	}
+
+	// Initialize the EmailAliasHandler with its dependencies
+	eah := EmailAliasHandler{
+		services.NewEmailAliasService(
+			db.NewEmailAliasRepositoryDb(dbUser), // Email alias repository
+			userRepo,                             // User repository
+			domainRepo,                           // Mail domain repository
+		),
+	}
+
+	// Initialize the UserHistoryHandler with its dependencies
+	uhh := UserHistoryHandler{
+		services.NewUserHistoryService(
+			db.NewUserEventRepositoryDb(dbUser), // User event repository
+			userRepo,                            // User repository
+		),
+	}
+
+	// Initialize the ApiKeyHandler with its dependencies
+	akh := ApiKeyHandler{
+		services.NewApiKeyService(db.NewApiKeyRepositoryDb(dbUser)), // API key service
+	}
+
+	// Initialize the RoleHandler with its dependencies
+	roh := RoleHandler{
+		services.NewRoleService(roleRepo, userRepo), // Operator role service
+	}
+
+	// Initialize the retention policy and its background job
+	retention := services.NewRetentionService(
+		db.NewRetentionRepositoryDb(dbUser), // Retention repository
+		cfg.RetentionPeriod,                 // Time before deleted users are anonymized
+		cfg.PurgePeriod,                     // Time before deleted users are hard-deleted
+	)
+	if cfg.RetentionJobInterval > 0 {
+		retention.Start(cfg.RetentionJobInterval)
+	}
+	rh := RetentionHandler{retention}
+
+	// Publish the domain events written to the outbox
+	if cfg.OutboxInterval > 0 {
+		services.NewOutboxDispatcher(
+			db.NewOutboxRepositoryDb(dbUser), // Outbox of domain events
+			eventSinks(cfg),                  // Where events are published
+			cfg.OutboxBatchSize,              // Events claimed at a time
+			cfg.OutboxRetryDelay,             // Wait after the first failure
+			cfg.OutboxRetention,              // Time delivered events are kept
+		).Start(cfg.OutboxInterval)
+	}
+
+	// Every route requires a bearer token or API key unless it is configured as public
+	uam := NewAuthMiddleware(uah.service, akh.service, cfg.PublicRoutes)
+	router.Use(uam.Middleware)
+
+	// Liveness of the server and its database
+	hh := HealthHandler{dbUser}
+
+	registerRoutes(router, routeHandlers{
+		health:    hh,
+		users:     uh,
+		userAuth:  uah,
+		mfa:       mh,
+		smtp:      sch,
+		roles:     roh,
+		aliases:   eah,
+		history:   uhh,
+		apiKeys:   akh,
+		domains:   mdh,
+		retention: rh,
+	})
 
 	// Configure CORS to allow cross-origin requests
 	corsHandler := handlers.CORS(
 		handlers.AllowedOrigins([]string{"*"}), // Allow all origins
 		handlers.AllowedMethods([]string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions}), // Allowed HTTP methods
 		handlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),                                                        // Allowed headers
+		handlers.ExposedHeaders([]string{"Retry-After"}),                                                                          // Headers readable by the client
 	)
 
 	logger.Info("HTTP server is ready to accept requests")
@@ -57,20 +250,133 @@ func Start() {
 	log.Fatal(http.ListenAndServe("localhost:8000", corsHandler(router)))
 }
 
-// getPostgresDB establishes a connection to the PostgreSQL database
-func getPostgresDB() *sqlx.DB {
-	logger.Info("Connecting to PostgreSQL database")
+// routeHandlers holds the handlers every route is served by
+type routeHandlers struct {
+	health    HealthHandler
+	users     UserHandler
+	userAuth  UserAuthHandler
+	mfa       MfaHandler
+	smtp      SmtpCredentialHandler
+	roles     RoleHandler
+	aliases   EmailAliasHandler
+	history   UserHistoryHandler
+	apiKeys   ApiKeyHandler
+	domains   MailDomainHandler
+	retention RetentionHandler
+}
 
-	// Connection string for the PostgreSQL database
-	connStr := "user=admin password=Admin123 dbname=email_dir sslmode=disable"
+// registerRoutes maps every route of the API to its handler
+func registerRoutes(router *mux.Router, h routeHandlers) {
+	router.HandleFunc("/health", h.health.Health).Methods(http.MethodGet) // Health check
 
-	// Open a new database connection
-	userDb, err := sqlx.Open("postgres", connStr)
-	if err != nil {
-		// Log and terminate the application if the connection fails
-		logger.Fatal("Failed to connect to PostgreSQL database", zap.Error(err))
+	// Define HTTP routes and their corresponding handlers
+	router.HandleFunc("/users", h.users.IdNo).Methods(http.MethodGet)                                     // Get user by ID
+	router.HandleFunc("/users/{id_no}", h.users.CreateUser).Methods(http.MethodPost)                      // Create a new user
+	router.HandleFunc("/users/{id_no}", h.users.DeleteUser).Methods(http.MethodDelete)                    // Delete a user
+	router.HandleFunc("/users/{id_no}", h.users.UpdateUser).Methods(http.MethodPatch)                     // Update user details
+	router.HandleFunc("/users/{id_no}/surname", h.users.UpdateSurname).Methods(http.MethodPatch)          // Update user surname
+	router.HandleFunc("/users/{id_no}/password", h.userAuth.CreatePassword).Methods(http.MethodPost)      // Create or update user password
+	router.HandleFunc("/users/{id_no}/password/reset", h.userAuth.ResetPassword).Methods(http.MethodPost) // Set a temporary password
+	router.HandleFunc("/users/{id_no}/unlock", h.userAuth.UnlockUser).Methods(http.MethodPost)            // Lift a login lockout
+	router.HandleFunc("/users/{id_no}/mfa/reset", h.mfa.ResetMfa).Methods(http.MethodPost)                // Turn off a lost second factor
+	router.HandleFunc("/users/{id_no}/restore", h.users.RestoreUser).Methods(http.MethodPost)             // Restore a deleted user
+	router.HandleFunc("/users/{id_no}/suspend", h.users.SuspendUser).Methods(http.MethodPost)             // Suspend a user
+	router.HandleFunc("/users/{id_no}/reactivate", h.users.ReactivateUser).Methods(http.MethodPost)       // Lift a suspension
+	router.HandleFunc("/users/{id_no}/history", h.history.History).Methods(http.MethodGet)                // Audit trail of a user
+
+	// SMTP credentials of a user
+	router.HandleFunc("/users/{id_no}/smtp", h.smtp.SmtpCredentials).Methods(http.MethodGet)               // Describe SMTP credentials
+	router.HandleFunc("/users/{id_no}/smtp", h.smtp.SetSmtpCredentials).Methods(http.MethodPut)            // Set SMTP credentials
+	router.HandleFunc("/users/{id_no}/smtp", h.smtp.ClearSmtpCredentials).Methods(http.MethodDelete)       // Clear SMTP credentials
+	router.HandleFunc("/users/{id_no}/smtp/rotate", h.smtp.RotateSmtpPassword).Methods(http.MethodPost)    // Replace the SMTP password
+	router.HandleFunc("/users/{id_no}/smtp/verify", h.smtp.VerifySmtpCredentials).Methods(http.MethodPost) // Try the login on the SMTP server
+
+	// Operator roles
+	router.HandleFunc("/users/{id_no}/roles", h.roles.Roles).Methods(http.MethodGet)                          // List user roles
+	router.HandleFunc("/users/{id_no}/roles", h.roles.GrantRole).Methods(http.MethodPost)                     // Grant a role
+	router.HandleFunc("/users/{id_no}/roles/{role_id:[0-9]+}", h.roles.RevokeRole).Methods(http.MethodDelete) // Revoke a role
+
+	// Sessions
+	router.HandleFunc("/auth/login", h.userAuth.Login).Methods(http.MethodPost)                                 // Exchange credentials for tokens
+	router.HandleFunc("/auth/login/mfa", h.userAuth.VerifyMfa).Methods(http.MethodPost)                         // Give the second factor of a login
+	router.HandleFunc("/auth/refresh", h.userAuth.Refresh).Methods(http.MethodPost)                             // Rotate a refresh token
+	router.HandleFunc("/auth/logout", h.userAuth.Logout).Methods(http.MethodPost)                               // Revoke the session
+	router.HandleFunc("/auth/password", h.userAuth.ChangePassword).Methods(http.MethodPost)                     // Change own password
+	router.HandleFunc("/auth/password-reset", h.userAuth.RequestPasswordReset).Methods(http.MethodPost)         // Send a reset token
+	router.HandleFunc("/auth/password-reset/confirm", h.userAuth.ConfirmPasswordReset).Methods(http.MethodPost) // Set a password with a reset token
+
+	// TOTP second factor of the signed-in user
+	router.HandleFunc("/auth/mfa", h.mfa.Enroll).Methods(http.MethodPost)                                 // Start enrollment
+	router.HandleFunc("/auth/mfa/confirm", h.mfa.ConfirmEnrollment).Methods(http.MethodPost)              // Enable with a first code
+	router.HandleFunc("/auth/mfa/disable", h.mfa.Disable).Methods(http.MethodPost)                        // Turn off
+	router.HandleFunc("/auth/mfa/recovery-codes", h.mfa.RegenerateRecoveryCodes).Methods(http.MethodPost) // Replace recovery codes
+
+	// Email aliases kept for previous addresses
+	router.HandleFunc("/users/{id_no}/aliases", h.aliases.Aliases).Methods(http.MethodGet)                          // List user aliases
+	router.HandleFunc("/users/{id_no}/aliases", h.aliases.CreateAlias).Methods(http.MethodPost)                     // Add an alias
+	router.HandleFunc("/users/{id_no}/aliases/{alias_id:[0-9]+}", h.aliases.DeleteAlias).Methods(http.MethodDelete) // Remove an alias
+
+	// API keys for automation
+	router.HandleFunc("/api-keys", h.apiKeys.ApiKeys).Methods(http.MethodGet)                         // List API keys
+	router.HandleFunc("/api-keys", h.apiKeys.CreateApiKey).Methods(http.MethodPost)                   // Create an API key
+	router.HandleFunc("/api-keys/{key_id:[0-9]+}", h.apiKeys.RevokeApiKey).Methods(http.MethodDelete) // Revoke an API key
+
+	// Mail domain registry and department routing rules
+	router.HandleFunc("/domains", h.domains.Domains).Methods(http.MethodGet)                                         // List mail domains
+	router.HandleFunc("/domains", h.domains.CreateDomain).Methods(http.MethodPost)                                   // Create a mail domain
+	router.HandleFunc("/domains/{name}", h.domains.Domain).Methods(http.MethodGet)                                   // Get a mail domain
+	router.HandleFunc("/domains/{name}", h.domains.UpdateDomain).Methods(http.MethodPatch)                           // Update a mail domain
+	router.HandleFunc("/domains/{name}", h.domains.DeleteDomain).Methods(http.MethodDelete)                          // Delete a mail domain
+	router.HandleFunc("/department-domains", h.domains.DepartmentRules).Methods(http.MethodGet)                      // List department rules
+	router.HandleFunc("/department-domains/{department}", h.domains.SetDepartmentRule).Methods(http.MethodPut)       // Route a department to a domain
+	router.HandleFunc("/department-domains/{department}", h.domains.DeleteDepartmentRule).Methods(http.MethodDelete) // Remove a department rule
+
+	// Retention policy for deleted users
+	router.HandleFunc("/retention/report", h.retention.Report).Methods(http.MethodGet) // Dry-run of the purge job
+}
+
+// loginAttemptStore returns the configured store of failed login counters
+func loginAttemptStore(cfg config.Config, dbUser *sqlx.DB) domain.LoginAttemptStore {
+	switch cfg.LoginAttemptStore {
+	case "postgres":
+		return db.NewLoginAttemptRepositoryDb(dbUser)
+	case "memory":
+		return db.NewMemoryLoginAttemptStore()
+	}
+	logger.Fatal("Invalid login attempt store", zap.String("store", cfg.LoginAttemptStore))
+	return nil
+}
+
+// eventSinks returns the configured destinations of domain events
+func eventSinks(cfg config.Config) []domain.EventSink {
+	sinks := make([]domain.EventSink, 0, len(cfg.OutboxSinks))
+	for _, name := range cfg.OutboxSinks {
+		switch name {
+		case "log":
+			sinks = append(sinks, events.LogSink{})
+		case "webhook":
+			if cfg.OutboxWebhookURL == "" {
+				logger.Fatal("OUTBOX_WEBHOOK_URL is required by the webhook sink")
+			}
+			sinks = append(sinks, events.NewWebhookSink(cfg.OutboxWebhookURL, cfg.OutboxWebhookSecret, cfg.OutboxWebhookTimeout))
+		default:
+			logger.Fatal("Invalid outbox sink", zap.String("sink", name))
+		}
+	}
+	return sinks
+}
+
+// jwtKey returns the configured access token key, falling back to a random key
+// that invalidates every session when the process restarts
+func jwtKey(cfg config.Config) []byte {
+	if cfg.JWTSecret != "" {
+		return []byte(cfg.JWTSecret)
 	}
 
-	logger.Info("Successfully connected to PostgreSQL database")
-	return userDb
+	logger.Warn("JWT_SECRET is not set, using a random key; sessions will not survive a restart")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		logger.Fatal("Failed to generate a JWT key", zap.Error(err))
+	}
+	return key
 }
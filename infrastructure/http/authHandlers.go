@@ -0,0 +1,155 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+func (h UserAuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req dto.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	req.IpAddress = clientIp(r)
+	tokens, err := h.service.Login(req)
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, tokens)
+}
+
+func (h UserAuthHandler) VerifyMfa(w http.ResponseWriter, r *http.Request) {
+	var req dto.MfaLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	req.IpAddress = clientIp(r)
+	tokens, err := h.service.VerifyMfa(req)
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, tokens)
+}
+
+func (h UserAuthHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.UnlockUser(r.Context(), mux.Vars(r)["id_no"]); err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusNoContent, nil)
+}
+
+func (h UserAuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req dto.RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	tokens, err := h.service.Refresh(req)
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, tokens)
+}
+
+func (h UserAuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req dto.LogoutRequest
+	// The body is optional when only the access token is being revoked
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+			return
+		}
+	}
+	req.AccessToken = bearerToken(r)
+
+	if err := h.service.Logout(req); err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusNoContent, nil)
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header, if any
+func bearerToken(r *http.Request) string {
+	scheme, token := authorization(r)
+	if !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return token
+}
+
+// authorization splits the Authorization header into its scheme and credentials
+func authorization(r *http.Request) (string, string) {
+	scheme, credentials, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found {
+		return "", ""
+	}
+	return scheme, strings.TrimSpace(credentials)
+}
+
+func (h UserAuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req dto.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	if err := h.service.ChangePassword(r.Context(), req); err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusNoContent, nil)
+}
+
+func (h UserAuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	response, err := h.service.ResetPassword(r.Context(), mux.Vars(r)["id_no"])
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, response)
+}
+
+func (h UserAuthHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req dto.PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	req.IpAddress = clientIp(r)
+	if err := h.service.RequestPasswordReset(req); err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	// Accepted whether or not the user exists
+	writeResponse(w, http.StatusAccepted, nil)
+}
+
+func (h UserAuthHandler) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req dto.PasswordResetConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	if err := h.service.ConfirmPasswordReset(req); err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusNoContent, nil)
+}
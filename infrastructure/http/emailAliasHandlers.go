@@ -0,0 +1,52 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+	"github.com/jmechavez/email-account-tracker/internal/ports/services"
+)
+
+type EmailAliasHandler struct {
+	service services.EmailAliasService
+}
+
+func (h EmailAliasHandler) Aliases(w http.ResponseWriter, r *http.Request) {
+	idNo := mux.Vars(r)["id_no"]
+	aliases, err := h.service.Aliases(r.Context(), idNo)
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, aliases)
+}
+
+func (h EmailAliasHandler) CreateAlias(w http.ResponseWriter, r *http.Request) {
+	var req dto.EmailAliasRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	// Assign the extracted IdNo to the request object
+	req.IdNo = mux.Vars(r)["id_no"]
+
+	alias, err := h.service.CreateAlias(r.Context(), req)
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusCreated, alias)
+}
+
+func (h EmailAliasHandler) DeleteAlias(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := h.service.DeleteAlias(r.Context(), vars["id_no"], vars["alias_id"]); err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,613 @@
+package http
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+)
+
+// The fakes below stand in for the database so that routes can be served end
+// to end. Like the real repositories they return whole rows, credentials
+// included, and leave it to the services to shape what reaches the client.
+
+// fakeSealer "encrypts" with base64 and keeps the associated data as the data
+// key, so opening with the wrong owner fails like the real keyring does
+type fakeSealer struct {
+	keyId string
+}
+
+func (s fakeSealer) ActiveKeyId() string { return s.keyId }
+
+func (s fakeSealer) Seal(plaintext []byte, associated string) (*domain.SealedSecret, *errors.AppError) {
+	if s.keyId == "" {
+		return nil, errors.NewUnExpectedError("No credential encryption key is configured")
+	}
+	return &domain.SealedSecret{
+		KeyId:      s.keyId,
+		DataKey:    "wrapped:" + associated,
+		Ciphertext: base64.StdEncoding.EncodeToString(plaintext),
+	}, nil
+}
+
+func (s fakeSealer) Open(secret domain.SealedSecret, associated string) ([]byte, *errors.AppError) {
+	plaintext, err := base64.StdEncoding.DecodeString(secret.Ciphertext)
+	if err != nil || secret.DataKey != "wrapped:"+associated {
+		return nil, errors.NewUnExpectedError("Error decrypting credentials")
+	}
+	return plaintext, nil
+}
+
+func (s fakeSealer) Rewrap(secret domain.SealedSecret) (*domain.SealedSecret, *errors.AppError) {
+	secret.KeyId = s.keyId
+	return &secret, nil
+}
+
+// fakeSmtpServer accepts every login
+type fakeSmtpServer struct{}
+
+func (fakeSmtpServer) Authenticate(domain.SmtpLogin) *errors.AppError { return nil }
+
+// fakeUserRepository keeps users in memory; it backs the user, password and
+// SMTP credential repositories, which share the users table
+type fakeUserRepository struct {
+	users  map[string]domain.User
+	events []domain.UserEvent
+}
+
+func newFakeUserRepository(users ...domain.User) *fakeUserRepository {
+	repo := &fakeUserRepository{users: map[string]domain.User{}}
+	for _, user := range users {
+		repo.users[user.IdNo] = user
+	}
+	return repo
+}
+
+// save stores user and returns the whole row, recording the diff in event like
+// the audit trail does. Password writes only carry the password columns; other
+// writes carry the full row but never touch the SMTP credentials.
+func (r *fakeUserRepository) save(user domain.User, event domain.UserEvent) *domain.User {
+	before := r.users[user.IdNo]
+	after := before
+	if user.Department == "" {
+		after.HashedPassword, after.Salt = user.HashedPassword, user.Salt
+		after.MustChangePassword = user.MustChangePassword
+		after.DatePasswordChanged = sql.NullTime{Time: time.Now(), Valid: true}
+		after.UpdatedBy = user.UpdatedBy
+	} else {
+		after = user
+		after.HashedPassword, after.Salt = before.HashedPassword, before.Salt
+		after.SMTPPassword, after.SMTPKeyId, after.SMTPDataKey = before.SMTPPassword, before.SMTPKeyId, before.SMTPDataKey
+	}
+
+	event.Changes = domain.DiffUsers(before, after)
+	r.users[after.IdNo] = after
+	r.events = append(r.events, event)
+	return &after
+}
+
+func (r *fakeUserRepository) Users(filter domain.UserFilter) (*domain.UserPage, *errors.AppError) {
+	page := &domain.UserPage{}
+	for _, user := range r.users {
+		page.Users = append(page.Users, user)
+	}
+	sort.Slice(page.Users, func(i, j int) bool { return page.Users[i].IdNo < page.Users[j].IdNo })
+	page.Total = len(page.Users)
+	return page, nil
+}
+
+func (r *fakeUserRepository) IdNo(idNo string) (*domain.User, *errors.AppError) {
+	user, ok := r.users[idNo]
+	if !ok {
+		return nil, errors.NewNotFoundError("User not found")
+	}
+	return &user, nil
+}
+
+func (r *fakeUserRepository) Email(email string) (*domain.User, *errors.AppError) {
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, email) {
+			return &user, nil
+		}
+	}
+	return nil, errors.NewNotFoundError("User not found")
+}
+
+func (r *fakeUserRepository) CreateUser(user domain.User, event domain.UserEvent) (*domain.UserCreateReturn, *errors.AppError) {
+	event.Changes = domain.DiffUsers(domain.User{}, user)
+	r.users[user.IdNo] = user
+	r.events = append(r.events, event)
+	return &domain.UserCreateReturn{
+		IdNo:      user.IdNo,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Suffix:    user.Suffix,
+		Email:     user.Email,
+	}, nil
+}
+
+func (r *fakeUserRepository) DeleteUser(user domain.User, event domain.UserEvent) (*domain.UserDeleteReturn, *errors.AppError) {
+	saved := r.save(user, event)
+	return &domain.UserDeleteReturn{IdNo: saved.IdNo, EmailStatus: saved.EmailStatus, Status: saved.Status}, nil
+}
+
+func (r *fakeUserRepository) UpdateUser(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	return r.save(user, event), nil
+}
+
+func (r *fakeUserRepository) UpdateSurname(user domain.User, alias *domain.EmailAlias, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	return r.save(user, event), nil
+}
+
+func (r *fakeUserRepository) RestoreUser(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	return r.save(user, event), nil
+}
+
+func (r *fakeUserRepository) SuspendUser(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	return r.save(user, event), nil
+}
+
+func (r *fakeUserRepository) ReactivateUser(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	return r.save(user, event), nil
+}
+
+func (r *fakeUserRepository) ExpiredSuspensions(now time.Time) ([]domain.User, *errors.AppError) {
+	return nil, nil
+}
+
+func (r *fakeUserRepository) EmailExists(email, excludeIdNo string) (bool, *errors.AppError) {
+	for _, user := range r.users {
+		if user.IdNo != excludeIdNo && strings.EqualFold(user.Email, email) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// History returns every recorded event of a user
+func (r *fakeUserRepository) History(idNo string, limit, offset int) ([]domain.UserEvent, int, *errors.AppError) {
+	history := []domain.UserEvent{}
+	for _, event := range r.events {
+		if event.IdNo == idNo {
+			history = append(history, event)
+		}
+	}
+	return history, len(history), nil
+}
+
+// fakeUserAuthRepository writes passwords into the shared users
+type fakeUserAuthRepository struct {
+	users  *fakeUserRepository
+	tokens map[string]domain.PasswordResetToken
+}
+
+func (r *fakeUserAuthRepository) CreatePassword(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	return r.users.save(user, event), nil
+}
+
+func (r *fakeUserAuthRepository) SetPassword(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	return r.users.save(user, event), nil
+}
+
+func (r *fakeUserAuthRepository) CreateResetToken(token domain.PasswordResetToken) *errors.AppError {
+	token.Id = int64(len(r.tokens) + 1)
+	r.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (r *fakeUserAuthRepository) ResetToken(tokenHash string) (*domain.PasswordResetToken, *errors.AppError) {
+	token, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, errors.NewNotFoundError("Reset token not found")
+	}
+	return &token, nil
+}
+
+func (r *fakeUserAuthRepository) ResetPassword(token domain.PasswordResetToken, user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	delete(r.tokens, token.TokenHash)
+	return r.users.save(user, event), nil
+}
+
+func (r *fakeUserAuthRepository) PasswordHistory(idNo string, limit int) ([]string, *errors.AppError) {
+	return []string{r.users.users[idNo].HashedPassword}, nil
+}
+
+// fakeSmtpCredentialRepository reads and writes the SMTP columns of the shared users
+type fakeSmtpCredentialRepository struct {
+	users *fakeUserRepository
+}
+
+func (r fakeSmtpCredentialRepository) SmtpCredentials(idNo string) (*domain.SmtpCredentials, *errors.AppError) {
+	user, err := r.users.IdNo(idNo)
+	if err != nil {
+		return nil, err
+	}
+	credentials := user.SmtpCredentials()
+	return &credentials, nil
+}
+
+func (r fakeSmtpCredentialRepository) SaveSmtpCredentials(next domain.SmtpCredentials, event domain.UserEvent) (*domain.SmtpCredentials, *errors.AppError) {
+	user := r.users.users[next.IdNo]
+	user.SMTPEmail, user.SMTPPassword, user.SMTPKeyId, user.SMTPDataKey = next.Email, next.Password, next.KeyId, next.DataKey
+	user.SMTPVerifyStatus, user.SMTPVerifyError, user.SMTPDateVerified = sql.NullString{}, sql.NullString{}, sql.NullTime{}
+	r.users.users[next.IdNo] = user
+	r.users.events = append(r.users.events, event)
+	credentials := user.SmtpCredentials()
+	return &credentials, nil
+}
+
+func (r fakeSmtpCredentialRepository) RecordSmtpVerification(idNo, status, message string, event domain.UserEvent) (*domain.SmtpCredentials, *errors.AppError) {
+	user := r.users.users[idNo]
+	user.SMTPVerifyStatus = sql.NullString{String: status, Valid: true}
+	user.SMTPVerifyError = sql.NullString{String: message, Valid: message != ""}
+	user.SMTPDateVerified = sql.NullTime{Time: time.Now(), Valid: true}
+	r.users.users[idNo] = user
+	r.users.events = append(r.users.events, event)
+	credentials := user.SmtpCredentials()
+	return &credentials, nil
+}
+
+func (r fakeSmtpCredentialRepository) StaleSmtpCredentials(activeKeyId, afterIdNo string, limit int) ([]domain.SmtpCredentials, *errors.AppError) {
+	return nil, nil
+}
+
+func (r fakeSmtpCredentialRepository) ReplaceSmtpPassword(current, next domain.SmtpCredentials) *errors.AppError {
+	return nil
+}
+
+// fakeSessionRepository keeps refresh tokens by hash
+type fakeSessionRepository struct {
+	tokens map[string]domain.RefreshToken
+}
+
+func (r *fakeSessionRepository) CreateRefreshToken(token domain.RefreshToken) *errors.AppError {
+	token.Id = int64(len(r.tokens) + 1)
+	r.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (r *fakeSessionRepository) RefreshToken(tokenHash string) (*domain.RefreshToken, *errors.AppError) {
+	token, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, errors.NewNotFoundError("Refresh token not found")
+	}
+	return &token, nil
+}
+
+func (r *fakeSessionRepository) RotateRefreshToken(current, next domain.RefreshToken) *errors.AppError {
+	current.DateRevoked = sql.NullTime{Time: time.Now(), Valid: true}
+	r.tokens[current.TokenHash] = current
+	return r.CreateRefreshToken(next)
+}
+
+func (r *fakeSessionRepository) RevokeTokenFamily(familyId string) *errors.AppError {
+	for hash, token := range r.tokens {
+		if token.FamilyId == familyId {
+			token.DateRevoked = sql.NullTime{Time: time.Now(), Valid: true}
+			r.tokens[hash] = token
+		}
+	}
+	return nil
+}
+
+func (r *fakeSessionRepository) RevokeUserTokens(idNo string) *errors.AppError {
+	for hash, token := range r.tokens {
+		if token.IdNo == idNo {
+			token.DateRevoked = sql.NullTime{Time: time.Now(), Valid: true}
+			r.tokens[hash] = token
+		}
+	}
+	return nil
+}
+
+func (r *fakeSessionRepository) RevokeAccessToken(jti string, expires time.Time) *errors.AppError {
+	return nil
+}
+
+func (r *fakeSessionRepository) IsAccessTokenRevoked(jti string) (bool, *errors.AppError) {
+	return false, nil
+}
+
+// fakeRoleRepository keeps role assignments in memory
+type fakeRoleRepository struct {
+	roles []domain.RoleAssignment
+}
+
+func (r *fakeRoleRepository) Roles(idNo string) ([]domain.RoleAssignment, *errors.AppError) {
+	roles := []domain.RoleAssignment{}
+	for _, role := range r.roles {
+		if role.IdNo == idNo {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+func (r *fakeRoleRepository) GrantRole(role domain.RoleAssignment, event domain.UserEvent) (*domain.RoleAssignment, *errors.AppError) {
+	role.Id = int64(len(r.roles) + 1)
+	r.roles = append(r.roles, role)
+	return &role, nil
+}
+
+func (r *fakeRoleRepository) RevokeRole(idNo string, id int64, event domain.UserEvent) (*domain.RoleAssignment, *errors.AppError) {
+	for i, role := range r.roles {
+		if role.IdNo == idNo && role.Id == id {
+			r.roles = append(r.roles[:i], r.roles[i+1:]...)
+			return &role, nil
+		}
+	}
+	return nil, errors.NewNotFoundError("Role not found")
+}
+
+// fakeMfaRepository keeps enrollments, recovery codes and challenges in memory
+type fakeMfaRepository struct {
+	enrollments map[string]domain.MfaEnrollment
+	codes       []domain.RecoveryCode
+	challenges  map[string]domain.MfaChallenge
+}
+
+func (r *fakeMfaRepository) Enrollment(idNo string) (*domain.MfaEnrollment, *errors.AppError) {
+	enrollment, ok := r.enrollments[idNo]
+	if !ok {
+		return nil, errors.NewNotFoundError("MFA is not enrolled")
+	}
+	return &enrollment, nil
+}
+
+func (r *fakeMfaRepository) StartEnrollment(enrollment domain.MfaEnrollment) *errors.AppError {
+	r.enrollments[enrollment.IdNo] = enrollment
+	return nil
+}
+
+func (r *fakeMfaRepository) ConfirmEnrollment(idNo string, step int64, codeHashes []string, event domain.UserEvent) *errors.AppError {
+	enrollment := r.enrollments[idNo]
+	enrollment.DateConfirmed = sql.NullTime{Time: time.Now(), Valid: true}
+	enrollment.LastUsedStep = step
+	r.enrollments[idNo] = enrollment
+	return r.ReplaceRecoveryCodes(idNo, codeHashes, event)
+}
+
+func (r *fakeMfaRepository) DeleteEnrollment(idNo string, event domain.UserEvent) *errors.AppError {
+	delete(r.enrollments, idNo)
+	return nil
+}
+
+func (r *fakeMfaRepository) StaleEnrollments(activeKeyId, afterIdNo string, limit int) ([]domain.MfaEnrollment, *errors.AppError) {
+	return nil, nil
+}
+
+func (r *fakeMfaRepository) ReplaceSecret(current, next domain.MfaEnrollment) *errors.AppError {
+	r.enrollments[next.IdNo] = next
+	return nil
+}
+
+func (r *fakeMfaRepository) UseStep(idNo string, step int64) *errors.AppError {
+	enrollment := r.enrollments[idNo]
+	if step <= enrollment.LastUsedStep {
+		return errors.NewConflictError("MFA code already used")
+	}
+	enrollment.LastUsedStep = step
+	r.enrollments[idNo] = enrollment
+	return nil
+}
+
+func (r *fakeMfaRepository) RecoveryCodes(idNo string) ([]domain.RecoveryCode, *errors.AppError) {
+	codes := []domain.RecoveryCode{}
+	for _, code := range r.codes {
+		if code.IdNo == idNo && !code.DateUsed.Valid {
+			codes = append(codes, code)
+		}
+	}
+	return codes, nil
+}
+
+func (r *fakeMfaRepository) UseRecoveryCode(id int64) *errors.AppError {
+	for i, code := range r.codes {
+		if code.Id == id {
+			r.codes[i].DateUsed = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+func (r *fakeMfaRepository) ReplaceRecoveryCodes(idNo string, codeHashes []string, event domain.UserEvent) *errors.AppError {
+	for _, hash := range codeHashes {
+		r.codes = append(r.codes, domain.RecoveryCode{Id: int64(len(r.codes) + 1), IdNo: idNo, CodeHash: hash})
+	}
+	return nil
+}
+
+func (r *fakeMfaRepository) CreateChallenge(challenge domain.MfaChallenge) *errors.AppError {
+	challenge.Id = int64(len(r.challenges) + 1)
+	r.challenges[challenge.TokenHash] = challenge
+	return nil
+}
+
+func (r *fakeMfaRepository) Challenge(tokenHash string) (*domain.MfaChallenge, *errors.AppError) {
+	challenge, ok := r.challenges[tokenHash]
+	if !ok {
+		return nil, errors.NewNotFoundError("MFA challenge not found")
+	}
+	return &challenge, nil
+}
+
+func (r *fakeMfaRepository) UseChallenge(id int64) *errors.AppError {
+	for hash, challenge := range r.challenges {
+		if challenge.Id == id {
+			challenge.DateUsed = sql.NullTime{Time: time.Now(), Valid: true}
+			r.challenges[hash] = challenge
+		}
+	}
+	return nil
+}
+
+// fakeEmailAliasRepository keeps aliases in memory
+type fakeEmailAliasRepository struct {
+	aliases []domain.EmailAlias
+}
+
+func (r *fakeEmailAliasRepository) Aliases(idNo string) ([]domain.EmailAlias, *errors.AppError) {
+	aliases := []domain.EmailAlias{}
+	for _, alias := range r.aliases {
+		if alias.IdNo == idNo {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases, nil
+}
+
+func (r *fakeEmailAliasRepository) CreateAlias(alias domain.EmailAlias) (*domain.EmailAlias, *errors.AppError) {
+	alias.Id = len(r.aliases) + 1
+	r.aliases = append(r.aliases, alias)
+	return &alias, nil
+}
+
+func (r *fakeEmailAliasRepository) DeleteAlias(idNo string, id int) *errors.AppError {
+	for i, alias := range r.aliases {
+		if alias.IdNo == idNo && alias.Id == id {
+			r.aliases = append(r.aliases[:i], r.aliases[i+1:]...)
+			return nil
+		}
+	}
+	return errors.NewNotFoundError("Alias not found")
+}
+
+// fakeApiKeyRepository keeps API keys in memory
+type fakeApiKeyRepository struct {
+	keys []domain.ApiKey
+}
+
+func (r *fakeApiKeyRepository) ApiKeys() ([]domain.ApiKey, *errors.AppError) {
+	return r.keys, nil
+}
+
+func (r *fakeApiKeyRepository) ApiKeyByHash(keyHash string) (*domain.ApiKey, *errors.AppError) {
+	for _, key := range r.keys {
+		if key.KeyHash == keyHash {
+			return &key, nil
+		}
+	}
+	return nil, errors.NewNotFoundError("API key not found")
+}
+
+func (r *fakeApiKeyRepository) CreateApiKey(key domain.ApiKey) (*domain.ApiKey, *errors.AppError) {
+	key.Id = int64(len(r.keys) + 1)
+	r.keys = append(r.keys, key)
+	return &key, nil
+}
+
+func (r *fakeApiKeyRepository) RevokeApiKey(id int64, revokedBy string) (*domain.ApiKey, *errors.AppError) {
+	for i, key := range r.keys {
+		if key.Id == id {
+			r.keys[i].DateRevoked = sql.NullString{String: time.Now().Format(time.RFC3339), Valid: true}
+			r.keys[i].RevokedBy = sql.NullString{String: revokedBy, Valid: true}
+			return &r.keys[i], nil
+		}
+	}
+	return nil, errors.NewNotFoundError("API key not found")
+}
+
+func (r *fakeApiKeyRepository) RecordUsage(id int64, ip string) *errors.AppError {
+	return nil
+}
+
+// fakeMailDomainRepository serves example.com as the only, default domain
+type fakeMailDomainRepository struct {
+	domains map[string]domain.MailDomain
+	rules   map[string]domain.DepartmentDomain
+}
+
+func newFakeMailDomainRepository() *fakeMailDomainRepository {
+	return &fakeMailDomainRepository{
+		domains: map[string]domain.MailDomain{"example.com": {Name: "example.com", IsDefault: true}},
+		rules:   map[string]domain.DepartmentDomain{},
+	}
+}
+
+func (r *fakeMailDomainRepository) Domains() ([]domain.MailDomain, *errors.AppError) {
+	domains := []domain.MailDomain{}
+	for _, d := range r.domains {
+		domains = append(domains, d)
+	}
+	return domains, nil
+}
+
+func (r *fakeMailDomainRepository) Domain(name string) (*domain.MailDomain, *errors.AppError) {
+	d, ok := r.domains[name]
+	if !ok {
+		return nil, errors.NewNotFoundError("Mail domain not found")
+	}
+	return &d, nil
+}
+
+func (r *fakeMailDomainRepository) CreateDomain(d domain.MailDomain) (*domain.MailDomain, *errors.AppError) {
+	r.domains[d.Name] = d
+	return &d, nil
+}
+
+func (r *fakeMailDomainRepository) UpdateDomain(d domain.MailDomain) (*domain.MailDomain, *errors.AppError) {
+	r.domains[d.Name] = d
+	return &d, nil
+}
+
+func (r *fakeMailDomainRepository) DeleteDomain(name string) *errors.AppError {
+	delete(r.domains, name)
+	return nil
+}
+
+func (r *fakeMailDomainRepository) DepartmentRules() ([]domain.DepartmentDomain, *errors.AppError) {
+	rules := []domain.DepartmentDomain{}
+	for _, rule := range r.rules {
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r *fakeMailDomainRepository) SetDepartmentRule(rule domain.DepartmentDomain) (*domain.DepartmentDomain, *errors.AppError) {
+	r.rules[strings.ToLower(rule.Department)] = rule
+	return &rule, nil
+}
+
+func (r *fakeMailDomainRepository) DeleteDepartmentRule(department string) *errors.AppError {
+	delete(r.rules, strings.ToLower(department))
+	return nil
+}
+
+func (r *fakeMailDomainRepository) DomainForDepartment(department string) (*domain.MailDomain, *errors.AppError) {
+	if rule, ok := r.rules[strings.ToLower(department)]; ok {
+		return r.Domain(rule.DomainName)
+	}
+	return r.Domain("example.com")
+}
+
+// fakeRetentionRepository reports every deleted user as due for anonymization
+type fakeRetentionRepository struct {
+	users *fakeUserRepository
+}
+
+func (r fakeRetentionRepository) RetentionCandidates(anonymizeBefore, purgeBefore time.Time) ([]domain.RetentionCandidate, *errors.AppError) {
+	candidates := []domain.RetentionCandidate{}
+	for _, user := range r.users.users {
+		if user.Status == domain.StatusDeleted {
+			candidates = append(candidates, domain.RetentionCandidate{
+				IdNo:        user.IdNo,
+				Department:  user.Department,
+				DateDeleted: user.DateDeleted,
+				Action:      "anonymize",
+			})
+		}
+	}
+	return candidates, nil
+}
+
+func (r fakeRetentionRepository) AnonymizeUser(idNo string, cutoff time.Time, event domain.UserEvent) *errors.AppError {
+	return nil
+}
+
+func (r fakeRetentionRepository) PurgeUser(idNo string, cutoff time.Time, event domain.UserEvent) *errors.AppError {
+	return nil
+}
@@ -18,6 +18,7 @@ type UserHandler struct {
 type UserAuthHandler struct {
 	service services.UserAuthService
 }
+
 // func (h UserHandler) Users(w http.ResponseWriter, r *http.Request) {
 // 	users, err := h.service.Users()
 // 	if err != nil {
@@ -54,7 +55,7 @@ func (h UserAuthHandler) CreatePassword(w http.ResponseWriter, r *http.Request)
 	request.IdNo = idNo
 
 	// Call the service to create password
-	response, appError := h.service.CreatePassword(request)
+	response, appError := h.service.CreatePassword(r.Context(), request)
 	if appError != nil {
 		writeResponse(w, appError.Code, appError)
 		return
@@ -64,7 +65,6 @@ func (h UserAuthHandler) CreatePassword(w http.ResponseWriter, r *http.Request)
 	writeResponse(w, http.StatusOK, response)
 }
 
-
 func (h UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	// Only allow PATCH method for updates
@@ -93,7 +93,7 @@ func (h UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	request.IdNo = idNo
 
 	// Call the service to update the user
-	response, appError := h.service.UpdateUser(request)
+	response, appError := h.service.UpdateUser(r.Context(), request)
 	if appError != nil {
 		writeResponse(w, appError.Code, appError)
 		return
@@ -130,7 +130,7 @@ func (h UserHandler) UpdateSurname(w http.ResponseWriter, r *http.Request) {
 	request.IdNo = idNo
 
 	// Call the service to update the user
-	response, appError := h.service.UpdateSurname(request)
+	response, appError := h.service.UpdateSurname(r.Context(), request)
 	if appError != nil {
 		writeResponse(w, appError.Code, appError)
 		return
@@ -147,7 +147,7 @@ func (h UserHandler) IdNo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if idNo != "" {
-		user, err := h.service.IdNo(idNo)
+		user, err := h.service.IdNo(r.Context(), idNo)
 		if err != nil {
 			writeResponse(w, err.Code, err.AsMessage())
 			return
@@ -156,30 +156,31 @@ func (h UserHandler) IdNo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Default values for pagination
-	limit := 10
-	offset := 0
-
-	// Parse limit from query parameter if provided
-	limitStr := r.URL.Query().Get("limit")
-	if limitStr != "" {
-		parsedLimit, err := strconv.Atoi(limitStr)
-		if err == nil && parsedLimit > 0 {
-			limit = parsedLimit
-		}
+	limit, offset := paginationParams(r)
+
+	// Collect the listing filters from the query string
+	query := r.URL.Query()
+	req := dto.UserListRequest{
+		Department:  query.Get("department"),
+		Status:      query.Get("status"),
+		EmailStatus: query.Get("email_status"),
+		TicketNo:    query.Get("ticket_no"),
+		Search:      query.Get("q"),
+		CreatedFrom: query.Get("created_from"),
+		CreatedTo:   query.Get("created_to"),
+		UpdatedFrom: query.Get("updated_from"),
+		UpdatedTo:   query.Get("updated_to"),
+		DeletedFrom: query.Get("deleted_from"),
+		DeletedTo:   query.Get("deleted_to"),
+		Sort:        query.Get("sort"),
+		Order:       query.Get("order"),
+		Cursor:      query.Get("cursor"),
+		Limit:       limit,
+		Offset:      offset,
 	}
 
-	// Parse offset from query parameter if provided
-	offsetStr := r.URL.Query().Get("offset")
-	if offsetStr != "" {
-		parsedOffset, err := strconv.Atoi(offsetStr)
-		if err == nil && parsedOffset >= 0 {
-			offset = parsedOffset
-		}
-	}
-
-	// Call the service method with pagination parameters
-	users, err := h.service.Users(limit, offset)
+	// Call the service method with the filters and pagination parameters
+	users, err := h.service.Users(r.Context(), req)
 	if err != nil {
 		writeResponse(w, err.Code, err.AsMessage())
 		return
@@ -197,7 +198,7 @@ func (h UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	} else {
 		req.IdNo = idNo
-		user, err := h.service.CreateUser(req)
+		user, err := h.service.CreateUser(r.Context(), req)
 		if err != nil {
 			writeResponse(w, err.Code, err.AsMessage())
 			return
@@ -216,7 +217,7 @@ func (h UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	} else {
 		req.IdNo = idNo
-		user, err := h.service.DeleteUser(req)
+		user, err := h.service.DeleteUser(r.Context(), req)
 		if err != nil {
 			writeResponse(w, err.Code, err.AsMessage())
 			return
@@ -225,11 +226,91 @@ func (h UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (h UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idNo := vars["id_no"]
+	var req dto.UserRestoreRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	req.IdNo = idNo
+	user, appError := h.service.RestoreUser(r.Context(), req)
+	if appError != nil {
+		writeResponse(w, appError.Code, appError.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, user)
+}
+
+func (h UserHandler) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	var req dto.UserSuspendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	req.IdNo = mux.Vars(r)["id_no"]
+	user, appError := h.service.SuspendUser(r.Context(), req)
+	if appError != nil {
+		writeResponse(w, appError.Code, appError.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, user)
+}
+
+func (h UserHandler) ReactivateUser(w http.ResponseWriter, r *http.Request) {
+	var req dto.UserReactivateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	req.IdNo = mux.Vars(r)["id_no"]
+	user, appError := h.service.ReactivateUser(r.Context(), req)
+	if appError != nil {
+		writeResponse(w, appError.Code, appError.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, user)
+}
+
+// paginationParams reads limit and offset from the query string, defaulting to the first 10 rows
+func paginationParams(r *http.Request) (int, int) {
+	// Default values for pagination
+	limit := 10
+	offset := 0
+
+	// Parse limit from query parameter if provided
+	limitStr := r.URL.Query().Get("limit")
+	if limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	// Parse offset from query parameter if provided
+	offsetStr := r.URL.Query().Get("offset")
+	if offsetStr != "" {
+		parsedOffset, err := strconv.Atoi(offsetStr)
+		if err == nil && parsedOffset >= 0 {
+			offset = parsedOffset
+		}
+	}
+	return limit, offset
+}
+
 func writeResponse(w http.ResponseWriter, code int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*") // Allow frontend
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if appErr, ok := data.(*errors.AppError); ok && appErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(appErr.RetryAfter))
+	}
 	w.WriteHeader(code)
 	if data != nil {
 		json.NewEncoder(w).Encode(data)
@@ -0,0 +1,23 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+type HealthHandler struct {
+	db *sqlx.DB
+}
+
+// Health reports whether the server is up and can reach its database
+func (h HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
+	if err := h.db.PingContext(r.Context()); err != nil {
+		logger.Error("Health check failed to reach the database", zap.Error(err))
+		writeResponse(w, http.StatusServiceUnavailable, map[string]string{"status": "unavailable"})
+		return
+	}
+	writeResponse(w, http.StatusOK, map[string]string{"status": "ok"})
+}
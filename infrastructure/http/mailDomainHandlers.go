@@ -0,0 +1,112 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+	"github.com/jmechavez/email-account-tracker/internal/ports/services"
+)
+
+type MailDomainHandler struct {
+	service services.MailDomainService
+}
+
+func (h MailDomainHandler) Domains(w http.ResponseWriter, r *http.Request) {
+	domains, err := h.service.Domains(r.Context())
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, domains)
+}
+
+func (h MailDomainHandler) Domain(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	mailDomain, err := h.service.Domain(r.Context(), name)
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, mailDomain)
+}
+
+func (h MailDomainHandler) CreateDomain(w http.ResponseWriter, r *http.Request) {
+	var req dto.MailDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	mailDomain, err := h.service.CreateDomain(r.Context(), req)
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusCreated, mailDomain)
+}
+
+func (h MailDomainHandler) UpdateDomain(w http.ResponseWriter, r *http.Request) {
+	var req dto.MailDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	// The domain name always comes from the URL
+	req.Name = mux.Vars(r)["name"]
+
+	mailDomain, err := h.service.UpdateDomain(r.Context(), req)
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, mailDomain)
+}
+
+func (h MailDomainHandler) DeleteDomain(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if err := h.service.DeleteDomain(r.Context(), name); err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusNoContent, nil)
+}
+
+func (h MailDomainHandler) DepartmentRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.service.DepartmentRules(r.Context())
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, rules)
+}
+
+func (h MailDomainHandler) SetDepartmentRule(w http.ResponseWriter, r *http.Request) {
+	var req dto.DepartmentDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	// The department always comes from the URL
+	req.Department = mux.Vars(r)["department"]
+
+	rule, err := h.service.SetDepartmentRule(r.Context(), req)
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, rule)
+}
+
+func (h MailDomainHandler) DeleteDepartmentRule(w http.ResponseWriter, r *http.Request) {
+	department := mux.Vars(r)["department"]
+	if err := h.service.DeleteDepartmentRule(r.Context(), department); err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusNoContent, nil)
+}
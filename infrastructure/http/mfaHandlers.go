@@ -0,0 +1,76 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+	"github.com/jmechavez/email-account-tracker/internal/ports/services"
+)
+
+type MfaHandler struct {
+	service services.MfaService
+}
+
+func (h MfaHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	enrollment, err := h.service.Enroll(r.Context())
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusCreated, enrollment)
+}
+
+func (h MfaHandler) ConfirmEnrollment(w http.ResponseWriter, r *http.Request) {
+	var req dto.MfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	codes, err := h.service.ConfirmEnrollment(r.Context(), req)
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, codes)
+}
+
+func (h MfaHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	var req dto.MfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	if err := h.service.Disable(r.Context(), req); err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusNoContent, nil)
+}
+
+func (h MfaHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req dto.MfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(r.Context(), req)
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, codes)
+}
+
+func (h MfaHandler) ResetMfa(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.ResetMfa(r.Context(), mux.Vars(r)["id_no"]); err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusNoContent, nil)
+}
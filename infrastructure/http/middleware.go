@@ -0,0 +1,105 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/ports/services"
+	"go.uber.org/zap"
+)
+
+// passwordChangeRoutes are all a user with a temporary password may call
+var passwordChangeRoutes = map[string]bool{
+	"/auth/password": true,
+	"/auth/logout":   true,
+}
+
+// AuthMiddleware requires a valid bearer token or API key on every route
+// except the public ones, and attaches the authenticated principal to the
+// request context
+type AuthMiddleware struct {
+	service services.UserAuthService
+	apiKeys services.ApiKeyService
+	public  map[string]bool // Route path templates served without authentication
+}
+
+func (m AuthMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		template := routeTemplate(r)
+		if m.public[template] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, err := m.authenticate(r)
+		if err != nil {
+			logger.Warn("Rejected unauthenticated request",
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.String("reason", err.Message),
+			)
+			w.Header().Add("WWW-Authenticate", `Bearer realm="email-account-tracker"`)
+			w.Header().Add("WWW-Authenticate", `ApiKey realm="email-account-tracker"`)
+			writeResponse(w, err.Code, err.AsMessage())
+			return
+		}
+
+		if principal.MustChangePassword && !passwordChangeRoutes[template] {
+			err := errors.NewAuthorizationError("Password change required")
+			writeResponse(w, err.Code, err.AsMessage())
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(domain.WithPrincipal(r.Context(), *principal)))
+	})
+}
+
+// authenticate accepts "Authorization: Bearer <access token>" from users and
+// "Authorization: ApiKey <key>" from automation
+func (m AuthMiddleware) authenticate(r *http.Request) (*domain.Principal, *errors.AppError) {
+	scheme, credentials := authorization(r)
+	switch {
+	case strings.EqualFold(scheme, "Bearer"):
+		return m.service.Authenticate(credentials)
+	case strings.EqualFold(scheme, "ApiKey"):
+		return m.apiKeys.Authenticate(credentials, clientIp(r))
+	}
+	return nil, errors.NewAuthenticationError("Missing bearer token or API key")
+}
+
+// clientIp returns the address of the connecting client
+func clientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// routeTemplate returns the path template of the matched route, so that
+// "/users/{id_no}" stands for every user
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return template
+}
+
+// NewAuthMiddleware creates an AuthMiddleware with the given public route templates
+func NewAuthMiddleware(service services.UserAuthService, apiKeys services.ApiKeyService, publicRoutes []string) AuthMiddleware {
+	public := make(map[string]bool, len(publicRoutes))
+	for _, route := range publicRoutes {
+		public[route] = true
+	}
+	return AuthMiddleware{service: service, apiKeys: apiKeys, public: public}
+}
@@ -0,0 +1,530 @@
+package http
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/db"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+	"github.com/jmechavez/email-account-tracker/internal/ports/services"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Passwords the fixture users have and the requests send; no response may echo them
+const (
+	userPassword = "Right-Passw0rd!"
+	newPassword  = "Brand-New-Passw0rd!"
+	smtpPassword = "Smtp-Passw0rd!"
+)
+
+// credentialFields name stored credentials; no response may carry a field
+// called like one of them
+var credentialFields = []string{
+	"hashed_password", "salt", "password", "smtp_password", "smtp_data_key", "data_key",
+	"secret", "token_hash", "key_hash", "code_hash",
+}
+
+// silentNotifier drops welcome and address change notifications
+type silentNotifier struct{}
+
+func (silentNotifier) UserCreated(domain.User)                    {}
+func (silentNotifier) AddressChanged(domain.User, string, string) {}
+
+// resetMailbox keeps the password reset tokens that would have been mailed
+type resetMailbox struct {
+	tokens *[]string
+}
+
+func (m resetMailbox) SendPasswordReset(user domain.User, token string, expires time.Time) *errors.AppError {
+	*m.tokens = append(*m.tokens, token)
+	return nil
+}
+
+// fixture serves the real routes, handlers and services over in-memory repositories
+type fixture struct {
+	users       *fakeUserRepository
+	auth        *fakeUserAuthRepository
+	sessions    *fakeSessionRepository
+	roles       *fakeRoleRepository
+	mfa         *fakeMfaRepository
+	aliases     *fakeEmailAliasRepository
+	apiKeys     *fakeApiKeyRepository
+	userAuth    services.DefaultUserAuthService
+	mfaService  services.DefaultMfaService
+	totp        services.TOTP
+	totpSecrets []string // Plaintext TOTP secrets of the enrollments set up
+	resetTokens []string // Password reset tokens handed to the notifier
+	router      *mux.Router
+}
+
+// fixtureUser is a user whose row carries every kind of stored credential
+func fixtureUser(t *testing.T, idNo, firstName, lastName, status string) domain.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(userPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smtp, appErr := fakeSealer{keyId: "k1"}.Seal([]byte(smtpPassword), idNo)
+	if appErr != nil {
+		t.Fatal(appErr.Message)
+	}
+	email := strings.ToLower(firstName + "." + lastName + "@example.com")
+	emailStatus := domain.EmailStatusActive
+	if status == domain.StatusDeleted {
+		emailStatus = domain.EmailStatusDeleted
+	}
+	return domain.User{
+		IdNo:             idNo,
+		Department:       "IT",
+		FirstName:        firstName,
+		LastName:         lastName,
+		Email:            email,
+		Status:           status,
+		EmailStatus:      emailStatus,
+		TicketNo:         sql.NullString{String: "T-0", Valid: true},
+		HashedPassword:   string(hash),
+		Salt:             "c2FsdC1vZi0" + idNo,
+		SMTPEmail:        email,
+		SMTPPassword:     smtp.Ciphertext,
+		SMTPKeyId:        sql.NullString{String: smtp.KeyId, Valid: true},
+		SMTPDataKey:      sql.NullString{String: smtp.DataKey, Valid: true},
+		SMTPVerifyStatus: sql.NullString{String: "rejected", Valid: true},
+		SMTPVerifyError:  sql.NullString{String: "535 authentication failed for " + email, Valid: true},
+		CreatedBy:        "OP-0",
+		UpdatedBy:        "OP-0",
+	}
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	pending := fixtureUser(t, "E500", "Eva", "Lim", domain.StatusPending)
+	pending.HashedPassword, pending.Salt = "", ""
+	pending.EmailStatus = domain.EmailStatusProvisioning
+	suspended := fixtureUser(t, "E400", "Dan", "Ong", domain.StatusSuspended)
+	suspended.SuspensionReason = sql.NullString{String: "Investigation", Valid: true}
+
+	users := newFakeUserRepository(
+		fixtureUser(t, "E100", "Ana", "Reyes", domain.StatusActive),
+		fixtureUser(t, "E200", "Ben", "Cruz", domain.StatusActive),
+		fixtureUser(t, "E300", "Cy", "Tan", domain.StatusDeleted),
+		suspended,
+		pending,
+	)
+	// The trail of E100 holds its names and, redacted, its credentials
+	created := domain.NewUserEvent("E100", domain.UserEventCreated, "OP-0", "T-0")
+	created.Changes = domain.DiffUsers(domain.User{}, users.users["E100"])
+	users.events = append(users.events, created)
+
+	f := &fixture{
+		users:    users,
+		auth:     &fakeUserAuthRepository{users: users, tokens: map[string]domain.PasswordResetToken{}},
+		sessions: &fakeSessionRepository{tokens: map[string]domain.RefreshToken{}},
+		roles:    &fakeRoleRepository{roles: []domain.RoleAssignment{{Id: 1, IdNo: "E100", Role: domain.RoleViewer}}},
+		mfa: &fakeMfaRepository{
+			enrollments: map[string]domain.MfaEnrollment{},
+			challenges:  map[string]domain.MfaChallenge{},
+		},
+		aliases: &fakeEmailAliasRepository{aliases: []domain.EmailAlias{{Id: 1, IdNo: "E100", Alias: "ana.r@example.com"}}},
+		apiKeys: &fakeApiKeyRepository{keys: []domain.ApiKey{{
+			Id:      1,
+			Name:    "provisioning",
+			Prefix:  "eat_abcd",
+			KeyHash: "0f1e2d3c4b5a69788796a5b4c3d2e1f00f1e2d3c4b5a69788796a5b4c3d2e1f0",
+			Scopes:  domain.ApiKeyScopes{domain.PermissionReadUsers},
+		}}},
+		totp: services.NewTOTP("Tracker", services.SystemClock{}),
+	}
+	domains := newFakeMailDomainRepository()
+	domains.domains["old.example.com"] = domain.MailDomain{Name: "old.example.com"}
+	domains.rules["HR"] = domain.DepartmentDomain{Department: "HR", DomainName: "example.com"}
+
+	sealer := fakeSealer{keyId: "k1"}
+	policy, appErr := services.NewPasswordPolicy(8, nil, nil, 0, 0)
+	if appErr != nil {
+		t.Fatal(appErr.Message)
+	}
+	throttle := services.NewLoginThrottle(db.NewMemoryLoginAttemptStore(), 5, 50, time.Minute, time.Millisecond)
+	f.userAuth = services.NewUserAuthService(f.auth, users, f.sessions, f.roles,
+		services.NewTokenSigner([]byte("test-signing-key"), "tracker", time.Minute), time.Hour, time.Hour,
+		resetMailbox{&f.resetTokens}, policy, throttle, f.mfa, f.totp, sealer)
+	f.mfaService = services.NewMfaService(f.mfa, users, f.roles, f.totp, sealer)
+
+	f.router = mux.NewRouter()
+	registerRoutes(f.router, routeHandlers{
+		users:     UserHandler{services.NewUserService(users, domains, nil, 24*time.Hour, silentNotifier{})},
+		userAuth:  UserAuthHandler{f.userAuth},
+		mfa:       MfaHandler{f.mfaService},
+		smtp:      SmtpCredentialHandler{services.NewSmtpCredentialService(fakeSmtpCredentialRepository{users}, sealer, fakeSmtpServer{}, nil)},
+		roles:     RoleHandler{services.NewRoleService(f.roles, users)},
+		aliases:   EmailAliasHandler{services.NewEmailAliasService(f.aliases, users, domains)},
+		history:   UserHistoryHandler{services.NewUserHistoryService(users, users)},
+		apiKeys:   ApiKeyHandler{services.NewApiKeyService(f.apiKeys)},
+		domains:   MailDomainHandler{services.NewMailDomainService(domains)},
+		retention: RetentionHandler{services.NewRetentionService(fakeRetentionRepository{users}, time.Hour, time.Hour)},
+	})
+	return f
+}
+
+// serve sends a request as principal, the way the auth middleware would hand it on
+func (f *fixture) serve(principal domain.Principal, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req = req.WithContext(domain.WithPrincipal(req.Context(), principal))
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// enrollMfa turns MFA on for idNo and returns its plaintext secret
+func (f *fixture) enrollMfa(t *testing.T, idNo string) string {
+	t.Helper()
+	enrolled, err := f.mfaService.Enroll(signedIn(idNo))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	enrollment := f.mfa.enrollments[idNo]
+	enrollment.DateConfirmed = sql.NullTime{Time: time.Now(), Valid: true}
+	f.mfa.enrollments[idNo] = enrollment
+	f.totpSecrets = append(f.totpSecrets, enrolled.Secret)
+	return enrolled.Secret
+}
+
+// mfaCode is the current TOTP code of secret
+func (f *fixture) mfaCode(t *testing.T, secret string) string {
+	t.Helper()
+	code, err := f.totp.Code(secret, f.totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	return code
+}
+
+// login signs idNo in and returns the tokens
+func (f *fixture) login(t *testing.T, idNo string) *dto.TokenResponse {
+	t.Helper()
+	tokens, err := f.userAuth.Login(dto.LoginRequest{IdNo: idNo, Password: userPassword, IpAddress: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	return tokens
+}
+
+// storedCredentials lists every stored credential, and every plaintext one the
+// fixture knows, at the time of the call
+func (f *fixture) storedCredentials() []string {
+	stored := []string{userPassword, newPassword, smtpPassword}
+	for _, user := range f.users.users {
+		stored = append(stored, user.HashedPassword, user.Salt, user.SMTPPassword, user.SMTPDataKey.String)
+	}
+	for _, enrollment := range f.mfa.enrollments {
+		stored = append(stored, enrollment.Secret, enrollment.DataKey.String)
+	}
+	for _, code := range f.mfa.codes {
+		stored = append(stored, code.CodeHash)
+	}
+	for hash := range f.mfa.challenges {
+		stored = append(stored, hash)
+	}
+	for hash := range f.sessions.tokens {
+		stored = append(stored, hash)
+	}
+	for hash := range f.auth.tokens {
+		stored = append(stored, hash)
+	}
+	for _, key := range f.apiKeys.keys {
+		stored = append(stored, key.KeyHash)
+	}
+	stored = append(stored, f.totpSecrets...)
+	stored = append(stored, f.resetTokens...)
+
+	nonEmpty := stored[:0]
+	for _, value := range stored {
+		if value != "" {
+			nonEmpty = append(nonEmpty, value)
+		}
+	}
+	return nonEmpty
+}
+
+func signedIn(idNo string) context.Context {
+	return domain.WithPrincipal(context.Background(), domain.Principal{IdNo: idNo})
+}
+
+func principalWith(idNo, role string) domain.Principal {
+	grant := domain.RoleAssignment{IdNo: idNo, Role: role}.Grant()
+	return domain.Principal{IdNo: idNo, Grants: []domain.Grant{grant}}
+}
+
+// routeCase is one successful call of a route
+type routeCase struct {
+	route  string            // Method and path template the case covers
+	path   string            // Path requested, query included
+	as     *domain.Principal // Caller; an admin when nil
+	body   string
+	setup  func(t *testing.T, f *fixture) string // Prepares the fixture and returns the body when set
+	status int
+	reveal string // Response field holding a secret shown once by design
+}
+
+// routeCases call every route but the health check, which only reports on the database
+func routeCases() []routeCase {
+	self := func(idNo string) *domain.Principal {
+		return &domain.Principal{IdNo: idNo}
+	}
+	withMfa := func(idNo string) func(t *testing.T, f *fixture) string {
+		return func(t *testing.T, f *fixture) string {
+			return `{"code": "` + f.mfaCode(t, f.enrollMfa(t, idNo)) + `"}`
+		}
+	}
+
+	return []routeCase{
+		// Users
+		{route: "GET /users", path: "/users?id_no=E100", status: http.StatusOK},
+		{route: "GET /users", path: "/users", status: http.StatusOK},
+		{route: "POST /users/{id_no}", path: "/users/E900", status: http.StatusCreated,
+			body: `{"department": "IT", "first_name": "José", "last_name": "Núñez", "ticket_no": "T-1"}`},
+		{route: "DELETE /users/{id_no}", path: "/users/E100", status: http.StatusCreated,
+			body: `{"deleted_ticket_no": "T-2"}`},
+		{route: "PATCH /users/{id_no}", path: "/users/E100", status: http.StatusOK,
+			body: `{"profile_picture": "ana.png", "updated_ticket_no": "T-3"}`},
+		{route: "PATCH /users/{id_no}/surname", path: "/users/E100/surname", status: http.StatusOK,
+			body: `{"last_name": "Santos", "updated_ticket_no": "T-4"}`},
+		{route: "POST /users/{id_no}/restore", path: "/users/E300/restore", status: http.StatusOK,
+			body: `{"restored_ticket_no": "T-5"}`},
+		{route: "POST /users/{id_no}/suspend", path: "/users/E100/suspend", status: http.StatusOK,
+			body: `{"reason": "Investigation", "ticket_no": "T-6"}`},
+		{route: "POST /users/{id_no}/reactivate", path: "/users/E400/reactivate", status: http.StatusOK,
+			body: `{"ticket_no": "T-7"}`},
+		{route: "GET /users/{id_no}/history", path: "/users/E100/history", status: http.StatusOK},
+
+		// Passwords and lockouts
+		{route: "POST /users/{id_no}/password", path: "/users/E500/password", status: http.StatusOK,
+			body: `{"password": "` + newPassword + `"}`},
+		{route: "POST /users/{id_no}/password/reset", path: "/users/E100/password/reset", status: http.StatusOK,
+			reveal: "temporary_password"},
+		{route: "POST /users/{id_no}/unlock", path: "/users/E100/unlock", status: http.StatusNoContent},
+		{route: "POST /users/{id_no}/mfa/reset", path: "/users/E200/mfa/reset", status: http.StatusNoContent,
+			setup: func(t *testing.T, f *fixture) string { f.enrollMfa(t, "E200"); return "" }},
+
+		// SMTP credentials
+		{route: "GET /users/{id_no}/smtp", path: "/users/E100/smtp", status: http.StatusOK},
+		{route: "PUT /users/{id_no}/smtp", path: "/users/E100/smtp", status: http.StatusOK,
+			body: `{"smtp_email": "ana.reyes@example.com", "smtp_password": "` + smtpPassword + `", "ticket_no": "T-8"}`},
+		{route: "DELETE /users/{id_no}/smtp", path: "/users/E100/smtp?ticket_no=T-9", status: http.StatusNoContent},
+		{route: "POST /users/{id_no}/smtp/rotate", path: "/users/E100/smtp/rotate", status: http.StatusOK,
+			body: `{"smtp_password": "` + smtpPassword + `", "ticket_no": "T-10"}`},
+		{route: "POST /users/{id_no}/smtp/verify", path: "/users/E100/smtp/verify", status: http.StatusOK},
+
+		// Operator roles
+		{route: "GET /users/{id_no}/roles", path: "/users/E100/roles", status: http.StatusOK},
+		{route: "POST /users/{id_no}/roles", path: "/users/E100/roles", status: http.StatusCreated,
+			body: `{"role": "helpdesk"}`},
+		{route: "DELETE /users/{id_no}/roles/{role_id:[0-9]+}", path: "/users/E100/roles/1", status: http.StatusNoContent},
+
+		// Sessions
+		{route: "POST /auth/login", path: "/auth/login", status: http.StatusOK,
+			body: `{"id_no": "E100", "password": "` + userPassword + `"}`},
+		{route: "POST /auth/login/mfa", path: "/auth/login/mfa", status: http.StatusOK,
+			setup: func(t *testing.T, f *fixture) string {
+				secret := f.enrollMfa(t, "E200")
+				challenge := f.login(t, "E200")
+				return `{"mfa_token": "` + challenge.MfaToken + `", "code": "` + f.mfaCode(t, secret) + `"}`
+			}},
+		{route: "POST /auth/refresh", path: "/auth/refresh", status: http.StatusOK,
+			setup: func(t *testing.T, f *fixture) string {
+				return `{"refresh_token": "` + f.login(t, "E100").RefreshToken + `"}`
+			}},
+		{route: "POST /auth/logout", path: "/auth/logout", status: http.StatusNoContent,
+			setup: func(t *testing.T, f *fixture) string {
+				return `{"refresh_token": "` + f.login(t, "E100").RefreshToken + `"}`
+			}},
+		{route: "POST /auth/password", path: "/auth/password", as: self("E100"), status: http.StatusNoContent,
+			body: `{"current_password": "` + userPassword + `", "new_password": "` + newPassword + `"}`},
+		{route: "POST /auth/password-reset", path: "/auth/password-reset", status: http.StatusAccepted,
+			body: `{"email": "ana.reyes@example.com"}`},
+		{route: "POST /auth/password-reset/confirm", path: "/auth/password-reset/confirm", status: http.StatusNoContent,
+			setup: func(t *testing.T, f *fixture) string {
+				if err := f.userAuth.RequestPasswordReset(dto.PasswordResetRequest{IdNo: "E100"}); err != nil {
+					t.Fatal(err.Message)
+				}
+				return `{"token": "` + f.resetTokens[0] + `", "new_password": "` + newPassword + `"}`
+			}},
+
+		// Second factor of the signed-in user
+		{route: "POST /auth/mfa", path: "/auth/mfa", as: self("E100"), status: http.StatusCreated, reveal: "secret"},
+		{route: "POST /auth/mfa/confirm", path: "/auth/mfa/confirm", as: self("E100"), status: http.StatusOK,
+			reveal: "recovery_codes",
+			setup: func(t *testing.T, f *fixture) string {
+				enrolled, err := f.mfaService.Enroll(signedIn("E100"))
+				if err != nil {
+					t.Fatal(err.Message)
+				}
+				f.totpSecrets = append(f.totpSecrets, enrolled.Secret)
+				return `{"code": "` + f.mfaCode(t, enrolled.Secret) + `"}`
+			}},
+		{route: "POST /auth/mfa/disable", path: "/auth/mfa/disable", as: self("E200"), status: http.StatusNoContent,
+			setup: withMfa("E200")},
+		{route: "POST /auth/mfa/recovery-codes", path: "/auth/mfa/recovery-codes", as: self("E200"), status: http.StatusOK,
+			reveal: "recovery_codes", setup: withMfa("E200")},
+
+		// Email aliases
+		{route: "GET /users/{id_no}/aliases", path: "/users/E100/aliases", status: http.StatusOK},
+		{route: "POST /users/{id_no}/aliases", path: "/users/E100/aliases", status: http.StatusCreated,
+			body: `{"alias": "a.reyes@example.com", "reason": "Nickname", "ticket_no": "T-11"}`},
+		{route: "DELETE /users/{id_no}/aliases/{alias_id:[0-9]+}", path: "/users/E100/aliases/1", status: http.StatusNoContent},
+
+		// API keys
+		{route: "GET /api-keys", path: "/api-keys", status: http.StatusOK},
+		{route: "POST /api-keys", path: "/api-keys", status: http.StatusCreated, reveal: "key",
+			body: `{"name": "hr-sync", "scopes": ["users:read"]}`},
+		{route: "DELETE /api-keys/{key_id:[0-9]+}", path: "/api-keys/1", status: http.StatusNoContent},
+
+		// Mail domains
+		{route: "GET /domains", path: "/domains", status: http.StatusOK},
+		{route: "POST /domains", path: "/domains", status: http.StatusCreated, body: `{"name": "new.example.com"}`},
+		{route: "GET /domains/{name}", path: "/domains/example.com", status: http.StatusOK},
+		{route: "PATCH /domains/{name}", path: "/domains/example.com", status: http.StatusOK,
+			body: `{"description": "Main domain"}`},
+		{route: "DELETE /domains/{name}", path: "/domains/old.example.com", status: http.StatusNoContent},
+		{route: "GET /department-domains", path: "/department-domains", status: http.StatusOK},
+		{route: "PUT /department-domains/{department}", path: "/department-domains/IT", status: http.StatusOK,
+			body: `{"domain_name": "example.com"}`},
+		{route: "DELETE /department-domains/{department}", path: "/department-domains/HR", status: http.StatusNoContent},
+
+		// Retention
+		{route: "GET /retention/report", path: "/retention/report", status: http.StatusOK},
+	}
+}
+
+// checkNoCredentials fails when body names a credential field, other than the
+// one the route reveals, or holds any stored credential value
+func checkNoCredentials(t *testing.T, body string, reveal string, stored []string) {
+	t.Helper()
+	if body == "" {
+		return
+	}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(body), &decoded); err != nil {
+		t.Fatalf("response is not JSON: %v\n%s", err, body)
+	}
+	walkFields(decoded, func(field string) {
+		for _, credential := range credentialFields {
+			if field == credential && field != reveal {
+				t.Errorf("response has a %q field: %s", field, body)
+			}
+		}
+	})
+	for _, value := range stored {
+		if strings.Contains(body, value) {
+			t.Errorf("response holds the stored credential %q: %s", value, body)
+		}
+	}
+}
+
+// walkFields calls visit with the name of every object field in a decoded JSON value
+func walkFields(value interface{}, visit func(field string)) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for field, nested := range v {
+			visit(field)
+			walkFields(nested, visit)
+		}
+	case []interface{}:
+		for _, nested := range v {
+			walkFields(nested, visit)
+		}
+	}
+}
+
+func TestRoutesNeverSerializeCredentials(t *testing.T) {
+	admin := principalWith("OP-1", domain.RoleAdmin)
+
+	for _, tc := range routeCases() {
+		t.Run(tc.route+" "+tc.path, func(t *testing.T) {
+			f := newFixture(t)
+			body := tc.body
+			if tc.setup != nil {
+				body = tc.setup(t, f)
+			}
+			as := admin
+			if tc.as != nil {
+				as = *tc.as
+			}
+
+			method, _, _ := strings.Cut(tc.route, " ")
+			rec := f.serve(as, method, tc.path, body)
+			if rec.Code != tc.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.status, rec.Body.String())
+			}
+			checkNoCredentials(t, strings.TrimSpace(rec.Body.String()), tc.reveal, f.storedCredentials())
+		})
+	}
+}
+
+// Every route is listed in routeCases, so a new route cannot skip the check above
+func TestRouteCasesCoverEveryRoute(t *testing.T) {
+	covered := map[string]bool{"GET /health": true}
+	for _, tc := range routeCases() {
+		covered[tc.route] = true
+	}
+
+	router := mux.NewRouter()
+	registerRoutes(router, routeHandlers{})
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			if !covered[method+" "+template] {
+				t.Errorf("no response check for %s %s", method, template)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestViewersGetPersonalDataRedacted(t *testing.T) {
+	viewer := principalWith("OP-2", domain.RoleViewer)
+	admin := principalWith("OP-1", domain.RoleAdmin)
+
+	for _, path := range []string{"/users?id_no=E100", "/users", "/users/E100/history"} {
+		t.Run(path, func(t *testing.T) {
+			f := newFixture(t)
+
+			rec := f.serve(viewer, http.MethodGet, path, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+			}
+			body := rec.Body.String()
+			for _, personal := range []string{"Ana", "Reyes", "ana.reyes@example.com"} {
+				if strings.Contains(body, personal) {
+					t.Errorf("viewer response holds %q: %s", personal, body)
+				}
+			}
+			if !strings.Contains(body, dto.RedactedValue) {
+				t.Errorf("viewer response has nothing redacted: %s", body)
+			}
+
+			// The same call shows the names to a caller allowed to see them
+			if rec := f.serve(admin, http.MethodGet, path, ""); !strings.Contains(rec.Body.String(), "Reyes") {
+				t.Errorf("admin response lacks the surname: %s", rec.Body.String())
+			}
+		})
+	}
+}
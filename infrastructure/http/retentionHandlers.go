@@ -0,0 +1,21 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/jmechavez/email-account-tracker/internal/ports/services"
+)
+
+type RetentionHandler struct {
+	service services.RetentionService
+}
+
+// Report shows what the retention job would anonymize and purge, without changing anything
+func (h RetentionHandler) Report(w http.ResponseWriter, r *http.Request) {
+	report, err := h.service.Report(r.Context())
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, report)
+}
@@ -0,0 +1,49 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+	"github.com/jmechavez/email-account-tracker/internal/ports/services"
+)
+
+type RoleHandler struct {
+	service services.RoleService
+}
+
+func (h RoleHandler) Roles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.service.Roles(r.Context(), mux.Vars(r)["id_no"])
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, roles)
+}
+
+func (h RoleHandler) GrantRole(w http.ResponseWriter, r *http.Request) {
+	var req dto.RoleAssignmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+
+	req.IdNo = mux.Vars(r)["id_no"]
+	role, err := h.service.GrantRole(r.Context(), req)
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusCreated, role)
+}
+
+func (h RoleHandler) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := h.service.RevokeRole(r.Context(), vars["id_no"], vars["role_id"]); err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+	"github.com/jmechavez/email-account-tracker/internal/ports/services"
+)
+
+type SmtpCredentialHandler struct {
+	service services.SmtpCredentialService
+}
+
+func (h SmtpCredentialHandler) SmtpCredentials(w http.ResponseWriter, r *http.Request) {
+	credentials, err := h.service.SmtpCredentials(r.Context(), mux.Vars(r)["id_no"])
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, credentials)
+}
+
+func (h SmtpCredentialHandler) SetSmtpCredentials(w http.ResponseWriter, r *http.Request) {
+	var req dto.SmtpCredentialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+	req.IdNo = mux.Vars(r)["id_no"]
+
+	credentials, err := h.service.SetSmtpCredentials(r.Context(), req)
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, credentials)
+}
+
+func (h SmtpCredentialHandler) RotateSmtpPassword(w http.ResponseWriter, r *http.Request) {
+	var req dto.SmtpPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, errors.NewBadRequestError("Invalid request body"))
+		return
+	}
+	req.IdNo = mux.Vars(r)["id_no"]
+
+	credentials, err := h.service.RotateSmtpPassword(r.Context(), req)
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, credentials)
+}
+
+func (h SmtpCredentialHandler) ClearSmtpCredentials(w http.ResponseWriter, r *http.Request) {
+	ticketNo := r.URL.Query().Get("ticket_no")
+	if err := h.service.ClearSmtpCredentials(r.Context(), mux.Vars(r)["id_no"], ticketNo); err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusNoContent, nil)
+}
+
+func (h SmtpCredentialHandler) VerifySmtpCredentials(w http.ResponseWriter, r *http.Request) {
+	credentials, err := h.service.VerifySmtpCredentials(r.Context(), mux.Vars(r)["id_no"])
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, credentials)
+}
@@ -0,0 +1,24 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jmechavez/email-account-tracker/internal/ports/services"
+)
+
+type UserHistoryHandler struct {
+	service services.UserHistoryService
+}
+
+func (h UserHistoryHandler) History(w http.ResponseWriter, r *http.Request) {
+	idNo := mux.Vars(r)["id_no"]
+	limit, offset := paginationParams(r)
+
+	history, err := h.service.History(r.Context(), idNo, limit, offset)
+	if err != nil {
+		writeResponse(w, err.Code, err.AsMessage())
+		return
+	}
+	writeResponse(w, http.StatusOK, history)
+}
@@ -0,0 +1,92 @@
+package mail
+
+import (
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"go.uber.org/zap"
+)
+
+// DeliveryQueue hands messages to a sender in the background so callers never
+// wait on the mail server. A failed delivery is retried after retryDelay,
+// doubled after every further failure, until maxAttempts is reached. Messages
+// are held in memory and do not survive a restart.
+type DeliveryQueue struct {
+	sender      domain.MessageSender
+	messages    chan delivery
+	maxAttempts int
+	retryDelay  time.Duration
+}
+
+// delivery is a queued message and the number of times it was tried
+type delivery struct {
+	message  domain.Message
+	attempts int
+}
+
+// Send queues message and returns at once; it fails only when the queue is full
+func (q DeliveryQueue) Send(message domain.Message) *errors.AppError {
+	if !q.enqueue(delivery{message: message}) {
+		logger.Error("Notification queue is full", zap.String("event", message.Event))
+		return errors.NewUnExpectedError("Notification queue is full")
+	}
+	return nil
+}
+
+// Start delivers queued messages until the process exits
+func (q DeliveryQueue) Start() {
+	go func() {
+		for d := range q.messages {
+			q.deliver(d)
+		}
+	}()
+}
+
+// deliver tries d once and schedules the next attempt when it fails
+func (q DeliveryQueue) deliver(d delivery) {
+	err := q.sender.Send(d.message)
+	if err == nil {
+		return
+	}
+
+	d.attempts++
+	if d.attempts >= q.maxAttempts {
+		logger.Error("Notification dropped after repeated failures",
+			zap.String("event", d.message.Event), zap.Int("attempts", d.attempts), zap.String("error", err.Message))
+		return
+	}
+
+	delay := q.retryDelay << (d.attempts - 1)
+	logger.Warn("Notification delivery failed, retrying",
+		zap.String("event", d.message.Event), zap.Int("attempts", d.attempts), zap.Duration("retry_in", delay))
+	time.AfterFunc(delay, func() {
+		if !q.enqueue(d) {
+			logger.Error("Notification dropped, queue is full", zap.String("event", d.message.Event))
+		}
+	})
+}
+
+// enqueue adds d to the queue without blocking
+func (q DeliveryQueue) enqueue(d delivery) bool {
+	select {
+	case q.messages <- d:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewDeliveryQueue creates a new instance of DeliveryQueue holding up to size messages
+func NewDeliveryQueue(sender domain.MessageSender, size, maxAttempts int, retryDelay time.Duration) DeliveryQueue {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return DeliveryQueue{
+		sender:      sender,
+		messages:    make(chan delivery, size),
+		maxAttempts: maxAttempts,
+		retryDelay:  retryDelay,
+	}
+}
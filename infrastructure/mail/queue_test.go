@@ -0,0 +1,105 @@
+package mail
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+)
+
+// flakySender fails the first failures attempts, then delivers; every attempt
+// is reported on attempts
+type flakySender struct {
+	mu       sync.Mutex
+	failures int
+	tries    int
+	attempts chan time.Time
+}
+
+func newFlakySender(failures int) *flakySender {
+	return &flakySender{failures: failures, attempts: make(chan time.Time, 10)}
+}
+
+func (s *flakySender) Send(message domain.Message) *errors.AppError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tries++
+	s.attempts <- time.Now()
+	if s.tries <= s.failures {
+		return errors.NewUnExpectedError("Could not send notification")
+	}
+	return nil
+}
+
+// nextAttempt waits for the sender to be tried again
+func (s *flakySender) nextAttempt(t *testing.T) time.Time {
+	t.Helper()
+	select {
+	case at := <-s.attempts:
+		return at
+	case <-time.After(2 * time.Second):
+		t.Fatal("no delivery attempt")
+	}
+	return time.Time{}
+}
+
+func TestDeliveryQueueRetriesWithBackoff(t *testing.T) {
+	const retryDelay = 40 * time.Millisecond
+	sender := newFlakySender(2)
+	queue := NewDeliveryQueue(sender, 10, 3, retryDelay)
+	queue.Start()
+
+	if err := queue.Send(domain.Message{Event: domain.NotificationWelcome}); err != nil {
+		t.Fatal(err.Message)
+	}
+	first := sender.nextAttempt(t)
+	second := sender.nextAttempt(t)
+	third := sender.nextAttempt(t)
+
+	// The wait doubles after every failure
+	if gap := second.Sub(first); gap < retryDelay {
+		t.Errorf("first retry after %v, want at least %v", gap, retryDelay)
+	}
+	if gap := third.Sub(second); gap < 2*retryDelay {
+		t.Errorf("second retry after %v, want at least %v", gap, 2*retryDelay)
+	}
+
+	// The third attempt delivered, so nothing more is tried
+	select {
+	case <-sender.attempts:
+		t.Error("delivered message was sent again")
+	case <-time.After(8 * retryDelay):
+	}
+}
+
+func TestDeliveryQueueDropsAfterMaxAttempts(t *testing.T) {
+	const retryDelay = 10 * time.Millisecond
+	sender := newFlakySender(100)
+	queue := NewDeliveryQueue(sender, 10, 2, retryDelay)
+	queue.Start()
+
+	if err := queue.Send(domain.Message{Event: domain.NotificationWelcome}); err != nil {
+		t.Fatal(err.Message)
+	}
+	sender.nextAttempt(t)
+	sender.nextAttempt(t)
+	select {
+	case <-sender.attempts:
+		t.Error("message tried more than the maximum of 2 attempts")
+	case <-time.After(20 * retryDelay):
+	}
+}
+
+func TestDeliveryQueueRefusesWhenFull(t *testing.T) {
+	// Not started, so nothing drains the queue
+	queue := NewDeliveryQueue(newFlakySender(0), 1, 3, time.Millisecond)
+
+	if err := queue.Send(domain.Message{Event: domain.NotificationWelcome}); err != nil {
+		t.Fatalf("first message: %s", err.Message)
+	}
+	if err := queue.Send(domain.Message{Event: domain.NotificationWelcome}); err == nil {
+		t.Error("message accepted by a full queue")
+	}
+}
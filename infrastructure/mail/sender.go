@@ -0,0 +1,148 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"go.uber.org/zap"
+)
+
+// Component is the name the sender asks for SMTP credentials under; it must be
+// one of the configured SMTP credential consumers
+const Component = "mailer"
+
+// SmtpSender delivers messages through the SMTP server, logged in with the
+// SMTP credentials of one account
+type SmtpSender struct {
+	server  SmtpServer
+	logins  domain.SmtpLoginProvider
+	account string // id_no of the user messages are sent as
+}
+
+func (s SmtpSender) Send(message domain.Message) *errors.AppError {
+	login, appErr := s.logins.Login(Component, s.account)
+	if appErr != nil {
+		return appErr
+	}
+	body, err := compose(login.Email, message)
+	if err != nil {
+		return s.failed(message, "compose", err)
+	}
+
+	client, appErr := s.server.dial()
+	if appErr != nil {
+		return appErr
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("AUTH"); ok {
+		if err := client.Auth(smtp.PlainAuth("", login.Email, login.Password, s.server.Host)); err != nil {
+			return s.failed(message, "auth", err)
+		}
+	}
+	if err := client.Mail(login.Email); err != nil {
+		return s.failed(message, "mail", err)
+	}
+	for _, to := range message.To {
+		if err := client.Rcpt(to); err != nil {
+			return s.failed(message, "rcpt", err)
+		}
+	}
+	data, err := client.Data()
+	if err != nil {
+		return s.failed(message, "data", err)
+	}
+	if _, err := data.Write(body); err != nil {
+		return s.failed(message, "data", err)
+	}
+	if err := data.Close(); err != nil {
+		return s.failed(message, "data", err)
+	}
+
+	_ = client.Quit()
+	logger.Info("Notification sent", zap.String("event", message.Event), zap.Int("recipients", len(message.To)))
+	return nil
+}
+
+// failed logs an SMTP error at step of a delivery
+func (s SmtpSender) failed(message domain.Message, step string, err error) *errors.AppError {
+	logger.Error("Error sending notification",
+		zap.String("event", message.Event), zap.String("step", step), zap.Error(err))
+	return errors.NewUnExpectedError("Could not send notification")
+}
+
+// compose renders message as a MIME email from the given address, with an
+// HTML alternative when the message has one
+func compose(from string, message domain.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domainName := from[strings.LastIndex(from, "@")+1:]
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(message.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domainName)
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+
+	if message.Html == "" {
+		fmt.Fprintf(&buf, "Content-Type: text/plain; charset=utf-8\r\n")
+		fmt.Fprintf(&buf, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, message.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.Html},
+	} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(writer, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeQuotedPrintable writes body to w as quoted-printable
+func writeQuotedPrintable(w io.Writer, body string) error {
+	encoder := quotedprintable.NewWriter(w)
+	if _, err := encoder.Write([]byte(body)); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// NewSmtpSender creates a new instance of SmtpSender sending as the user account
+func NewSmtpSender(server SmtpServer, logins domain.SmtpLoginProvider, account string) SmtpSender {
+	return SmtpSender{server: server, logins: logins, account: account}
+}
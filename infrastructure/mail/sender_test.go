@@ -0,0 +1,205 @@
+package mail
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+)
+
+// A long line with characters quoted-printable has to escape
+const notificationText = "Hola José, your new address is jose.nunez@example.com. " +
+	"It replaces ana=reyes@example.com, which keeps receiving mail for thirty days after the change."
+
+func parseComposed(t *testing.T, message domain.Message) *mail.Message {
+	t.Helper()
+	body, err := compose("mailer@example.com", message)
+	if err != nil {
+		t.Fatalf("compose: %v", err)
+	}
+	for _, line := range strings.Split(string(body), "\r\n") {
+		if len(line) > 998 {
+			t.Errorf("line of %d bytes exceeds the SMTP limit", len(line))
+		}
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("composed message does not parse: %v\n%s", err, body)
+	}
+	return parsed
+}
+
+func TestComposeHeaders(t *testing.T) {
+	parsed := parseComposed(t, domain.Message{
+		To:      []string{"jose.nunez@example.com", "boss@example.com"},
+		Subject: "Bienvenido, José Núñez",
+		Text:    "Hello",
+	})
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != "Bienvenido, José Núñez" {
+		t.Errorf("Subject decodes to %q, %v", subject, err)
+	}
+	if got := parsed.Header.Get("From"); got != "mailer@example.com" {
+		t.Errorf("From = %q", got)
+	}
+	to, err := parsed.Header.AddressList("To")
+	if err != nil || len(to) != 2 || to[1].Address != "boss@example.com" {
+		t.Errorf("To = %v, %v, want both recipients", to, err)
+	}
+	if _, err := parsed.Header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+	if id := parsed.Header.Get("Message-Id"); !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID = %q, want one in the sender's domain", id)
+	}
+	if got := parsed.Header.Get("MIME-Version"); got != "1.0" {
+		t.Errorf("MIME-Version = %q", got)
+	}
+}
+
+func TestComposePlainText(t *testing.T) {
+	parsed := parseComposed(t, domain.Message{To: []string{"jose.nunez@example.com"}, Subject: "Hi", Text: notificationText})
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "text/plain" || params["charset"] != "utf-8" {
+		t.Fatalf("Content-Type = %q, %v", parsed.Header.Get("Content-Type"), err)
+	}
+	if got := parsed.Header.Get("Content-Transfer-Encoding"); got != "quoted-printable" {
+		t.Fatalf("Content-Transfer-Encoding = %q", got)
+	}
+	text, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if err != nil || string(text) != notificationText {
+		t.Errorf("body decodes to %q, %v", text, err)
+	}
+}
+
+func TestComposeHtmlAlternative(t *testing.T) {
+	html := "<p>Hola <b>José</b>, " + strings.Repeat("your new address is ready. ", 5) + "</p>"
+	parsed := parseComposed(t, domain.Message{To: []string{"jose.nunez@example.com"}, Subject: "Hi", Text: notificationText, Html: html})
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, %v", parsed.Header.Get("Content-Type"), err)
+	}
+
+	// Readers prefer the last alternative, so the HTML part comes after the text
+	want := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", notificationText},
+		{"text/html; charset=utf-8", html},
+	}
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	for i, w := range want {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		if got := part.Header.Get("Content-Type"); got != w.contentType {
+			t.Errorf("part %d Content-Type = %q, want %q", i, got, w.contentType)
+		}
+		// The reader undoes the quoted-printable encoding it announces
+		body, err := io.ReadAll(part)
+		if err != nil || string(body) != w.body {
+			t.Errorf("part %d decodes to %q, %v", i, body, err)
+		}
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Errorf("more than two parts: %v", err)
+	}
+}
+
+// fixedLogin hands out one SMTP login to the mailer and refuses everyone else
+type fixedLogin struct {
+	account string
+	login   domain.SmtpLogin
+}
+
+func (l fixedLogin) Login(component, idNo string) (*domain.SmtpLogin, *errors.AppError) {
+	if component != Component || idNo != l.account {
+		return nil, errors.NewAuthorizationError("Not allowed to use these SMTP credentials")
+	}
+	login := l.login
+	return &login, nil
+}
+
+func newTestSender(port int) SmtpSender {
+	logins := fixedLogin{account: "M001", login: domain.SmtpLogin{Email: "mailer@example.com", Password: "Mailer-Passw0rd!"}}
+	return NewSmtpSender(NewSmtpServer("127.0.0.1", port, 2*time.Second), logins, "M001")
+}
+
+func TestSendDeliversThroughSmtp(t *testing.T) {
+	server := startFakeSmtpListener(t, "235 2.7.0 Authentication successful")
+	// A line starting with a dot has to survive the SMTP dot-stuffing
+	text := notificationText + "\n.\nRegards"
+	message := domain.Message{
+		Event:   "welcome",
+		To:      []string{"jose.nunez@example.com", "boss@example.com"},
+		Subject: "Bienvenido",
+		Text:    text,
+		Html:    "<p>Hola José</p>",
+	}
+
+	if err := newTestSender(server.port()).Send(message); err != nil {
+		t.Fatalf("Send: %s", err.Message)
+	}
+	if got := <-server.logins; got != "mailer@example.com:Mailer-Passw0rd!" {
+		t.Errorf("server was sent the login %q, want the mailer's", got)
+	}
+
+	delivery := <-server.deliveries
+	if delivery.from != "mailer@example.com" {
+		t.Errorf("envelope sender = %q, want the mailer's address", delivery.from)
+	}
+	if strings.Join(delivery.to, ",") != "jose.nunez@example.com,boss@example.com" {
+		t.Errorf("envelope recipients = %q, want every recipient of the message", delivery.to)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(delivery.data))
+	if err != nil {
+		t.Fatalf("delivered message does not parse: %v\n%s", err, delivery.data)
+	}
+	if got := parsed.Header.Get("From"); got != "mailer@example.com" {
+		t.Errorf("From = %q", got)
+	}
+	if got := parsed.Header.Get("To"); got != "jose.nunez@example.com, boss@example.com" {
+		t.Errorf("To = %q", got)
+	}
+	if got := parsed.Header.Get("Subject"); got != "Bienvenido" {
+		t.Errorf("Subject = %q", got)
+	}
+	_, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	for i, want := range []string{text, message.Html} {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil || strings.ReplaceAll(string(body), "\r\n", "\n") != want {
+			t.Errorf("part %d delivered as %q, %v, want %q", i, body, err, want)
+		}
+	}
+}
+
+func TestSendStopsWhenTheLoginIsRefused(t *testing.T) {
+	server := startFakeSmtpListener(t, "535 5.7.8 Authentication credentials invalid")
+
+	if err := newTestSender(server.port()).Send(domain.Message{To: []string{"jose.nunez@example.com"}, Text: "Hi"}); err == nil {
+		t.Fatal("Send succeeded with a refused login")
+	}
+	select {
+	case delivery := <-server.deliveries:
+		t.Errorf("server accepted mail from %q after refusing the login", delivery.from)
+	default:
+	}
+}
@@ -0,0 +1,91 @@
+package mail
+
+import (
+	"crypto/tls"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"go.uber.org/zap"
+)
+
+// SmtpServer is the mail server users log in to with their SMTP credentials.
+// STARTTLS is used whenever the server offers it; the standard library refuses
+// to send a password over plaintext to anything but localhost.
+type SmtpServer struct {
+	Host    string
+	Port    int
+	Timeout time.Duration // Limit on connecting and on the whole conversation
+}
+
+func (s SmtpServer) Authenticate(login domain.SmtpLogin) *errors.AppError {
+	client, appErr := s.dial()
+	if appErr != nil {
+		return appErr
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("AUTH"); !ok {
+		logger.Error("SMTP server does not offer AUTH", zap.String("host", s.Host))
+		return errors.NewUnExpectedError("SMTP server does not support authentication")
+	}
+
+	if err := client.Auth(smtp.PlainAuth("", login.Email, login.Password, s.Host)); err != nil {
+		// A permanent reply is the server refusing the login; anything else
+		// says nothing about the credentials
+		var reply *textproto.Error
+		if stderrors.As(err, &reply) && reply.Code >= 500 {
+			return errors.NewAuthenticationError(fmt.Sprintf("SMTP server refused the login: %d %s", reply.Code, reply.Msg))
+		}
+		logger.Error("Error authenticating with SMTP server", zap.String("host", s.Host), zap.Error(err))
+		return errors.NewUnExpectedError("Could not authenticate with the SMTP server")
+	}
+
+	_ = client.Quit()
+	return nil
+}
+
+// dial connects to the server and upgrades the connection to TLS when offered
+func (s SmtpServer) dial() (*smtp.Client, *errors.AppError) {
+	if s.Host == "" {
+		return nil, errors.NewUnExpectedError("No SMTP server is configured")
+	}
+
+	address := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	conn, err := net.DialTimeout("tcp", address, s.Timeout)
+	if err != nil {
+		logger.Error("Error connecting to SMTP server", zap.String("address", address), zap.Error(err))
+		return nil, errors.NewUnExpectedError("Could not reach the SMTP server")
+	}
+	if s.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.Timeout))
+	}
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		logger.Error("Error greeting SMTP server", zap.String("address", address), zap.Error(err))
+		return nil, errors.NewUnExpectedError("Could not reach the SMTP server")
+	}
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+			client.Close()
+			logger.Error("Error starting TLS with SMTP server", zap.String("address", address), zap.Error(err))
+			return nil, errors.NewUnExpectedError("Could not secure the SMTP connection")
+		}
+	}
+	return client, nil
+}
+
+// NewSmtpServer creates a new instance of SmtpServer
+func NewSmtpServer(host string, port int, timeout time.Duration) SmtpServer {
+	return SmtpServer{Host: host, Port: port, Timeout: timeout}
+}
@@ -0,0 +1,247 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/secrets"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/ports/services"
+)
+
+// fakeSmtpListener speaks just enough SMTP for AUTH PLAIN and one mail
+// transaction per connection. It answers every login with reply; the logins
+// it was sent are kept as "email:password" and the mail it accepted as
+// deliveries.
+type fakeSmtpListener struct {
+	listener   net.Listener
+	reply      string
+	logins     chan string
+	deliveries chan fakeDelivery
+}
+
+// fakeDelivery is one mail transaction accepted by fakeSmtpListener
+type fakeDelivery struct {
+	from string
+	to   []string
+	data string // Message as sent, with dot-stuffing undone
+}
+
+func startFakeSmtpListener(t *testing.T, reply string) *fakeSmtpListener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeSmtpListener{
+		listener:   listener,
+		reply:      reply,
+		logins:     make(chan string, 1),
+		deliveries: make(chan fakeDelivery, 1),
+	}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+func (s *fakeSmtpListener) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSmtpListener) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.converse(conn)
+	}
+}
+
+func (s *fakeSmtpListener) converse(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	write := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	write("220 fake.example.com ESMTP")
+	var delivery fakeDelivery
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.TrimSpace(line)
+		switch verb, arg, _ := strings.Cut(command, " "); strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			write("250-fake.example.com")
+			write("250 AUTH PLAIN")
+		case "AUTH":
+			_, encoded, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(encoded)
+			parts := strings.Split(string(decoded), "\x00")
+			if len(parts) == 3 {
+				s.logins <- parts[1] + ":" + parts[2]
+			}
+			write(s.reply)
+		case "*":
+			write("501 5.7.0 Authentication cancelled")
+		case "MAIL":
+			delivery = fakeDelivery{from: envelopeAddress(arg, "FROM:")}
+			write("250 2.1.0 Ok")
+		case "RCPT":
+			delivery.to = append(delivery.to, envelopeAddress(arg, "TO:"))
+			write("250 2.1.5 Ok")
+		case "DATA":
+			write("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			delivery.data = data.String()
+			s.deliveries <- delivery
+			write("250 2.0.0 Queued")
+		case "QUIT":
+			write("221 2.0.0 Bye")
+			return
+		default:
+			write("502 5.5.2 Command not recognized")
+		}
+	}
+}
+
+// envelopeAddress returns the address of a MAIL FROM or RCPT TO argument
+func envelopeAddress(arg, prefix string) string {
+	if len(arg) >= len(prefix) && strings.EqualFold(arg[:len(prefix)], prefix) {
+		arg = arg[len(prefix):]
+	}
+	return strings.Trim(strings.TrimSpace(arg), "<>")
+}
+
+// fakeSmtpCredentialRepository holds the credentials of one user and counts
+// the verifications recorded
+type fakeSmtpCredentialRepository struct {
+	credentials   domain.SmtpCredentials
+	verifications []string
+}
+
+func (r *fakeSmtpCredentialRepository) SmtpCredentials(idNo string) (*domain.SmtpCredentials, *errors.AppError) {
+	credentials := r.credentials
+	return &credentials, nil
+}
+
+func (r *fakeSmtpCredentialRepository) SaveSmtpCredentials(next domain.SmtpCredentials, event domain.UserEvent) (*domain.SmtpCredentials, *errors.AppError) {
+	r.credentials = next
+	return &next, nil
+}
+
+func (r *fakeSmtpCredentialRepository) RecordSmtpVerification(idNo, status, message string, event domain.UserEvent) (*domain.SmtpCredentials, *errors.AppError) {
+	r.verifications = append(r.verifications, status+": "+message)
+	r.credentials.VerifyStatus.String, r.credentials.VerifyStatus.Valid = status, true
+	r.credentials.VerifyError.String, r.credentials.VerifyError.Valid = message, message != ""
+	credentials := r.credentials
+	return &credentials, nil
+}
+
+func (r *fakeSmtpCredentialRepository) StaleSmtpCredentials(activeKeyId, afterIdNo string, limit int) ([]domain.SmtpCredentials, *errors.AppError) {
+	return nil, nil
+}
+
+func (r *fakeSmtpCredentialRepository) ReplaceSmtpPassword(current, next domain.SmtpCredentials) *errors.AppError {
+	return nil
+}
+
+// newVerifyingService returns a credential service for user E100, whose
+// password is sealed with a real keyring, checking logins against port
+func newVerifyingService(t *testing.T, port int) (services.DefaultSmtpCredentialService, *fakeSmtpCredentialRepository) {
+	t.Helper()
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	keyring, err := secrets.LoadKeyring("", []string{"k1:" + key}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, appErr := keyring.Seal([]byte("Smtp-Passw0rd!"), "E100")
+	if appErr != nil {
+		t.Fatal(appErr.Message)
+	}
+
+	repo := &fakeSmtpCredentialRepository{
+		credentials: domain.SmtpCredentials{IdNo: "E100", Department: "IT", Email: "ana.reyes@example.com"}.WithSecret(*sealed),
+	}
+	server := NewSmtpServer("127.0.0.1", port, 2*time.Second)
+	return services.NewSmtpCredentialService(repo, keyring, server, nil), repo
+}
+
+func adminCtx() context.Context {
+	grant := domain.RoleAssignment{IdNo: "OP-1", Role: domain.RoleAdmin}.Grant()
+	return domain.WithPrincipal(context.Background(), domain.Principal{IdNo: "OP-1", Grants: []domain.Grant{grant}})
+}
+
+func TestVerifySmtpCredentialsAccepted(t *testing.T) {
+	server := startFakeSmtpListener(t, "235 2.7.0 Authentication successful")
+	service, repo := newVerifyingService(t, server.port())
+
+	response, err := service.VerifySmtpCredentials(adminCtx(), "E100")
+	if err != nil {
+		t.Fatalf("VerifySmtpCredentials: %s", err.Message)
+	}
+	if response.VerificationStatus != domain.SmtpVerified || response.VerificationError != "" {
+		t.Errorf("response = %+v, want verified without an error", response)
+	}
+	if got := <-server.logins; got != "ana.reyes@example.com:Smtp-Passw0rd!" {
+		t.Errorf("server was sent the login %q, want the decrypted credentials", got)
+	}
+	if len(repo.verifications) != 1 || repo.verifications[0] != domain.SmtpVerified+": " {
+		t.Errorf("recorded %q, want one verified result", repo.verifications)
+	}
+}
+
+func TestVerifySmtpCredentialsRejected(t *testing.T) {
+	server := startFakeSmtpListener(t, "535 5.7.8 Authentication credentials invalid")
+	service, repo := newVerifyingService(t, server.port())
+
+	response, err := service.VerifySmtpCredentials(adminCtx(), "E100")
+	if err != nil {
+		t.Fatalf("VerifySmtpCredentials: %s, want the refusal recorded", err.Message)
+	}
+	if response.VerificationStatus != domain.SmtpRejected {
+		t.Errorf("status = %q, want %q", response.VerificationStatus, domain.SmtpRejected)
+	}
+	if !strings.Contains(response.VerificationError, "535") || !strings.Contains(response.VerificationError, "credentials invalid") {
+		t.Errorf("error = %q, want the server reply", response.VerificationError)
+	}
+	if len(repo.verifications) != 1 || !strings.HasPrefix(repo.verifications[0], domain.SmtpRejected+": ") ||
+		!strings.Contains(repo.verifications[0], "535") {
+		t.Errorf("recorded %q, want one rejection with the server reply", repo.verifications)
+	}
+}
+
+func TestVerifySmtpCredentialsUnreachable(t *testing.T) {
+	// A port that was just freed refuses connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	service, repo := newVerifyingService(t, port)
+
+	if _, err := service.VerifySmtpCredentials(adminCtx(), "E100"); err == nil || errors.IsAuthenticationError(err) {
+		t.Fatalf("VerifySmtpCredentials = %v, want an error that says nothing about the credentials", err)
+	}
+	if len(repo.verifications) != 0 {
+		t.Errorf("recorded %q for an unreachable server, want nothing", repo.verifications)
+	}
+}
@@ -0,0 +1,114 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"go.uber.org/zap"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+const (
+	textSuffix = ".txt.tmpl"
+	htmlSuffix = ".html.tmpl"
+)
+
+// Templates renders notification messages. Every event has a text template
+// <event>.txt.tmpl, which defines the "subject" template, and may have an HTML
+// alternative <event>.html.tmpl.
+type Templates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+func (t Templates) Render(event string, data domain.NotificationData) (*domain.Message, *errors.AppError) {
+	text, ok := t.text[event]
+	if !ok {
+		logger.Error("No template for notification", zap.String("event", event))
+		return nil, errors.NewUnExpectedError("Notification template not found")
+	}
+
+	var subject, body bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		logger.Error("Error rendering notification subject", zap.String("event", event), zap.Error(err))
+		return nil, errors.NewUnExpectedError("Error rendering notification")
+	}
+	if err := text.Execute(&body, data); err != nil {
+		logger.Error("Error rendering notification", zap.String("event", event), zap.Error(err))
+		return nil, errors.NewUnExpectedError("Error rendering notification")
+	}
+	message := &domain.Message{
+		Event:   event,
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    body.String(),
+	}
+
+	if html, ok := t.html[event]; ok {
+		var htmlBody bytes.Buffer
+		if err := html.Execute(&htmlBody, data); err != nil {
+			logger.Error("Error rendering HTML notification", zap.String("event", event), zap.Error(err))
+			return nil, errors.NewUnExpectedError("Error rendering notification")
+		}
+		message.Html = htmlBody.String()
+	}
+	return message, nil
+}
+
+// LoadTemplates parses the templates in dir, or the built-in ones when dir is
+// empty, and checks that every notification event has a text template with a
+// subject
+func LoadTemplates(dir string) (*Templates, error) {
+	var files fs.FS
+	if dir == "" {
+		files, _ = fs.Sub(defaultTemplates, "templates")
+	} else {
+		files = os.DirFS(dir)
+	}
+
+	templates := &Templates{
+		text: map[string]*texttemplate.Template{},
+		html: map[string]*htmltemplate.Template{},
+	}
+	names, err := fs.Glob(files, "*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		switch {
+		case strings.HasSuffix(name, textSuffix):
+			parsed, err := texttemplate.New(name).Option("missingkey=error").ParseFS(files, name)
+			if err != nil {
+				return nil, err
+			}
+			templates.text[strings.TrimSuffix(name, textSuffix)] = parsed
+		case strings.HasSuffix(name, htmlSuffix):
+			parsed, err := htmltemplate.New(name).Option("missingkey=error").ParseFS(files, name)
+			if err != nil {
+				return nil, err
+			}
+			templates.html[strings.TrimSuffix(name, htmlSuffix)] = parsed
+		}
+	}
+
+	for _, event := range domain.NotificationEvents {
+		text, ok := templates.text[event]
+		if !ok {
+			return nil, fmt.Errorf("notification template %s%s is missing", event, textSuffix)
+		}
+		if text.Lookup("subject") == nil {
+			return nil, fmt.Errorf("notification template %s%s does not define a subject", event, textSuffix)
+		}
+	}
+	return templates, nil
+}
@@ -0,0 +1,216 @@
+package secrets
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/infrastructure/logger"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"go.uber.org/zap"
+)
+
+// keySize selects AES-256 for both key-encryption keys and data keys
+const keySize = 32
+
+// Keyring seals secrets with AES-256-GCM envelope encryption. Every secret gets
+// a random data key; the data key is encrypted with the active key-encryption
+// key and stored next to the ciphertext along with that key's ID. Older keys
+// stay in the ring so existing secrets can still be opened and rewrapped.
+type Keyring struct {
+	keys   map[string][]byte
+	active string
+}
+
+func (k Keyring) ActiveKeyId() string {
+	return k.active
+}
+
+func (k Keyring) Seal(plaintext []byte, associated string) (*domain.SealedSecret, *errors.AppError) {
+	if k.active == "" {
+		return nil, errors.NewUnExpectedError("No credential encryption key is configured")
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		logger.Error("Error generating data key", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Error encrypting credentials")
+	}
+
+	ciphertext, appErr := seal(dataKey, plaintext, associated)
+	if appErr != nil {
+		return nil, appErr
+	}
+	wrapped, appErr := seal(k.keys[k.active], dataKey, k.active)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	return &domain.SealedSecret{KeyId: k.active, DataKey: wrapped, Ciphertext: ciphertext}, nil
+}
+
+func (k Keyring) Open(secret domain.SealedSecret, associated string) ([]byte, *errors.AppError) {
+	dataKey, appErr := k.unwrap(secret)
+	if appErr != nil {
+		return nil, appErr
+	}
+	return open(dataKey, secret.Ciphertext, associated)
+}
+
+func (k Keyring) Rewrap(secret domain.SealedSecret) (*domain.SealedSecret, *errors.AppError) {
+	if k.active == "" {
+		return nil, errors.NewUnExpectedError("No credential encryption key is configured")
+	}
+	dataKey, appErr := k.unwrap(secret)
+	if appErr != nil {
+		return nil, appErr
+	}
+	wrapped, appErr := seal(k.keys[k.active], dataKey, k.active)
+	if appErr != nil {
+		return nil, appErr
+	}
+	return &domain.SealedSecret{KeyId: k.active, DataKey: wrapped, Ciphertext: secret.Ciphertext}, nil
+}
+
+// unwrap decrypts the data key of secret with the key it names
+func (k Keyring) unwrap(secret domain.SealedSecret) ([]byte, *errors.AppError) {
+	kek, ok := k.keys[secret.KeyId]
+	if !ok {
+		logger.Error("Credential sealed with an unknown key", zap.String("key_id", secret.KeyId))
+		return nil, errors.NewUnExpectedError("Credential encryption key is not available")
+	}
+	return open(kek, secret.DataKey, secret.KeyId)
+}
+
+// seal encrypts plaintext with key, binding it to associated, and returns the
+// nonce followed by the ciphertext in base64
+func seal(key, plaintext []byte, associated string) (string, *errors.AppError) {
+	aead, appErr := newGCM(key)
+	if appErr != nil {
+		return "", appErr
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		logger.Error("Error generating nonce", zap.Error(err))
+		return "", errors.NewUnExpectedError("Error encrypting credentials")
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(associated))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open reverses seal
+func open(key []byte, encoded, associated string) ([]byte, *errors.AppError) {
+	aead, appErr := newGCM(key)
+	if appErr != nil {
+		return nil, appErr
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, errors.NewUnExpectedError("Malformed encrypted credential")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(associated))
+	if err != nil {
+		logger.Error("Error decrypting credential", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Error decrypting credentials")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, *errors.AppError) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		logger.Error("Invalid encryption key", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Invalid credential encryption key")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		logger.Error("Error initializing AES-GCM", zap.Error(err))
+		return nil, errors.NewUnExpectedError("Invalid credential encryption key")
+	}
+	return aead, nil
+}
+
+// LoadKeyring reads key-encryption keys from keyFile, when set, and from keys,
+// each written as id:base64 of 32 random bytes. The keyfile holds one key per
+// line; blank lines and lines starting with # are skipped. active names the key
+// new secrets are sealed with and may be empty only when there is one key.
+func LoadKeyring(keyFile string, keys []string, active string) (*Keyring, error) {
+	entries := append([]string{}, keys...)
+	if keyFile != "" {
+		fileEntries, err := readKeyFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fileEntries...)
+	}
+
+	ring := &Keyring{keys: map[string][]byte{}}
+	for _, entry := range entries {
+		id, encoded, found := strings.Cut(entry, ":")
+		id = strings.TrimSpace(id)
+		if !found || id == "" {
+			return nil, fmt.Errorf("credential key %q must be written as id:base64", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("credential key %q must be %d bytes of base64", id, keySize)
+		}
+		if _, duplicate := ring.keys[id]; duplicate {
+			return nil, fmt.Errorf("credential key %q is defined twice", id)
+		}
+		ring.keys[id] = key
+	}
+
+	switch {
+	case active != "":
+		if _, ok := ring.keys[active]; !ok {
+			return nil, fmt.Errorf("active credential key %q is not loaded", active)
+		}
+		ring.active = active
+	case len(ring.keys) == 1:
+		for id := range ring.keys {
+			ring.active = id
+		}
+	case len(ring.keys) > 1:
+		return nil, fmt.Errorf("several credential keys are loaded; choose the active one")
+	}
+
+	ids := make([]string, 0, len(ring.keys))
+	for id := range ring.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	logger.Info("Credential keyring loaded", zap.Strings("key_ids", ids), zap.String("active", ring.active))
+	return ring, nil
+}
+
+// readKeyFile returns the key entries of a keyfile
+func readKeyFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
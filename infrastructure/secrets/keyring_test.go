@@ -0,0 +1,189 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+)
+
+// testKey returns an id:base64 entry of a key made of one repeated byte
+func testKey(id string, b byte) string {
+	return id + ":" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, keySize))
+}
+
+func loadTestKeyring(t *testing.T, active string, keys ...string) *Keyring {
+	t.Helper()
+	ring, err := LoadKeyring("", keys, active)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	return ring
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	ring := loadTestKeyring(t, "", testKey("k1", 1))
+
+	sealed, err := ring.Seal([]byte("Smtp-Passw0rd!"), "E100")
+	if err != nil {
+		t.Fatalf("Seal: %s", err.Message)
+	}
+	if sealed.KeyId != "k1" || sealed.DataKey == "" || strings.Contains(sealed.Ciphertext, "Smtp") {
+		t.Errorf("sealed = %+v, want a wrapped data key and ciphertext under k1", sealed)
+	}
+	again, _ := ring.Seal([]byte("Smtp-Passw0rd!"), "E100")
+	if again.DataKey == sealed.DataKey || again.Ciphertext == sealed.Ciphertext {
+		t.Error("sealing twice gave the same data key or ciphertext, want a fresh data key and nonce")
+	}
+
+	plaintext, err := ring.Open(*sealed, "E100")
+	if err != nil || string(plaintext) != "Smtp-Passw0rd!" {
+		t.Errorf("Open = %q, %v", plaintext, err)
+	}
+}
+
+func TestOpenNeedsTheSameAssociatedData(t *testing.T) {
+	ring := loadTestKeyring(t, "", testKey("k1", 1))
+	sealed, _ := ring.Seal([]byte("JBSWY3DPEHPK3PXP"), "mfa:E100")
+
+	// An MFA secret cannot be opened as the SMTP password of the same user, or as another user's
+	for _, associated := range []string{"E100", "mfa:E200"} {
+		if _, err := ring.Open(*sealed, associated); err == nil {
+			t.Errorf("Open with %q succeeded, want it refused", associated)
+		}
+	}
+}
+
+func TestOpenRefusesTamperedSecrets(t *testing.T) {
+	ring := loadTestKeyring(t, "", testKey("k1", 1))
+	sealed, _ := ring.Seal([]byte("Smtp-Passw0rd!"), "E100")
+
+	flipLast := func(encoded string) string {
+		raw, _ := base64.StdEncoding.DecodeString(encoded)
+		raw[len(raw)-1] ^= 1
+		return base64.StdEncoding.EncodeToString(raw)
+	}
+	tests := map[string]func(s *domain.SealedSecret){
+		"ciphertext":            func(s *domain.SealedSecret) { s.Ciphertext = flipLast(s.Ciphertext) },
+		"data key":              func(s *domain.SealedSecret) { s.DataKey = flipLast(s.DataKey) },
+		"truncated ciphertext":  func(s *domain.SealedSecret) { s.Ciphertext = "AAAA" },
+		"ciphertext not base64": func(s *domain.SealedSecret) { s.Ciphertext = "%%%" },
+	}
+	for name, tamper := range tests {
+		tampered := *sealed
+		tamper(&tampered)
+		if plaintext, err := ring.Open(tampered, "E100"); err == nil {
+			t.Errorf("Open with a tampered %s = %q, want it refused", name, plaintext)
+		}
+	}
+}
+
+func TestRewrapMovesToTheActiveKey(t *testing.T) {
+	old := loadTestKeyring(t, "", testKey("k1", 1))
+	sealed, _ := old.Seal([]byte("Smtp-Passw0rd!"), "E100")
+
+	rotated := loadTestKeyring(t, "k2", testKey("k1", 1), testKey("k2", 2))
+	rewrapped, err := rotated.Rewrap(*sealed)
+	if err != nil {
+		t.Fatalf("Rewrap: %s", err.Message)
+	}
+	if rewrapped.KeyId != "k2" || rewrapped.Ciphertext != sealed.Ciphertext {
+		t.Errorf("rewrapped = %+v, want the same ciphertext with its data key under k2", rewrapped)
+	}
+
+	// Once k1 is retired only the rewrapped secret still opens
+	retired := loadTestKeyring(t, "", testKey("k2", 2))
+	if plaintext, err := retired.Open(*rewrapped, "E100"); err != nil || string(plaintext) != "Smtp-Passw0rd!" {
+		t.Errorf("Open after rewrap = %q, %v", plaintext, err)
+	}
+	if _, err := retired.Open(*sealed, "E100"); err == nil {
+		t.Error("a secret under a retired key opened")
+	}
+}
+
+func TestOpenWithAnUnknownKeyId(t *testing.T) {
+	ring := loadTestKeyring(t, "", testKey("k1", 1))
+	sealed, _ := ring.Seal([]byte("Smtp-Passw0rd!"), "E100")
+	sealed.KeyId = "k9"
+
+	if _, err := ring.Open(*sealed, "E100"); err == nil || !strings.Contains(err.Message, "not available") {
+		t.Errorf("Open = %v, want the key reported unavailable", err)
+	}
+	if _, err := ring.Rewrap(*sealed); err == nil {
+		t.Error("Rewrap of a secret under an unknown key succeeded")
+	}
+}
+
+func TestSealWithoutKeys(t *testing.T) {
+	ring := loadTestKeyring(t, "")
+	if _, err := ring.Seal([]byte("secret"), "E100"); err == nil {
+		t.Error("Seal without a key succeeded")
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	short := "k1:" + base64.StdEncoding.EncodeToString([]byte("too short"))
+	tests := []struct {
+		name    string
+		keys    []string
+		active  string
+		want    string // Active key, or part of the error
+		invalid bool
+	}{
+		{name: "single key is active", keys: []string{testKey("k1", 1)}, want: "k1"},
+		{name: "chosen active key", keys: []string{testKey("k1", 1), testKey("k2", 2)}, active: "k2", want: "k2"},
+		{name: "no keys", want: ""},
+		{name: "several keys without active", keys: []string{testKey("k1", 1), testKey("k2", 2)}, want: "choose the active one", invalid: true},
+		{name: "active key not loaded", keys: []string{testKey("k1", 1)}, active: "k2", want: "not loaded", invalid: true},
+		{name: "duplicate key", keys: []string{testKey("k1", 1), testKey("k1", 2)}, active: "k1", want: "defined twice", invalid: true},
+		{name: "short key", keys: []string{short}, want: "32 bytes", invalid: true},
+		{name: "not base64", keys: []string{"k1:%%%"}, want: "32 bytes", invalid: true},
+		{name: "missing id", keys: []string{testKey("", 1)}, want: "id:base64", invalid: true},
+		{name: "missing separator", keys: []string{"k1"}, want: "id:base64", invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring, err := LoadKeyring("", tt.keys, tt.active)
+			if tt.invalid {
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("LoadKeyring = %v, want an error about %q", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadKeyring: %v", err)
+			}
+			if ring.ActiveKeyId() != tt.want {
+				t.Errorf("active key = %q, want %q", ring.ActiveKeyId(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadKeyringFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	contents := "# retired after the 2026 rotation\n" + testKey("k1", 1) + "\n\n  " + testKey("k2", 2) + "  \n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys from the environment and the file form one ring
+	ring, err := LoadKeyring(path, []string{testKey("k3", 3)}, "k2")
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	if len(ring.keys) != 3 || ring.ActiveKeyId() != "k2" {
+		t.Errorf("loaded %d keys with %q active, want 3 with k2", len(ring.keys), ring.ActiveKeyId())
+	}
+
+	if _, err := LoadKeyring(path, []string{testKey("k1", 9)}, "k1"); err == nil {
+		t.Error("a key defined in the environment and the file was accepted")
+	}
+	if _, err := LoadKeyring(filepath.Join(t.TempDir(), "missing"), nil, ""); err == nil {
+		t.Error("a missing keyfile was accepted")
+	}
+}
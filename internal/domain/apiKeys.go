@@ -0,0 +1,136 @@
+package domain
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+// ApiKeyPrefix starts every API key so leaked keys are easy to recognise
+const ApiKeyPrefix = "eat_"
+
+// unkeyablePermissions can only be exercised by a signed-in user, so a leaked
+// key can never be used to mint more keys or hand out roles
+var unkeyablePermissions = map[Permission]bool{
+	PermissionManageRoles:   true,
+	PermissionManageApiKeys: true,
+}
+
+// ApiKeyScopes is stored as a JSONB array of permissions
+type ApiKeyScopes []Permission
+
+func (s ApiKeyScopes) Value() (driver.Value, error) {
+	if s == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(s)
+}
+
+func (s *ApiKeyScopes) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	case nil:
+		*s = nil
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into ApiKeyScopes", src)
+}
+
+type ApiKey struct {
+	Id           int64          `json:"id" db:"id"`
+	Name         string         `json:"name" db:"name"`
+	Prefix       string         `json:"prefix" db:"prefix"` // Leading characters of the key, shown to tell keys apart
+	KeyHash      string         `json:"-" db:"key_hash"`
+	Scopes       ApiKeyScopes   `json:"scopes" db:"scopes"`
+	Department   sql.NullString `json:"department" db:"department"`
+	DateCreated  sql.NullString `json:"date_created" db:"date_created"`
+	CreatedBy    string         `json:"created_by" db:"created_by"`
+	DateExpires  sql.NullTime   `json:"date_expires" db:"date_expires"`
+	DateRevoked  sql.NullString `json:"date_revoked" db:"date_revoked"`
+	RevokedBy    sql.NullString `json:"revoked_by" db:"revoked_by"`
+	DateLastUsed sql.NullString `json:"date_last_used" db:"date_last_used"`
+	LastUsedIp   sql.NullString `json:"last_used_ip" db:"last_used_ip"`
+}
+
+// Validate rejects unknown scopes and scopes reserved to users
+func (k ApiKey) Validate() *errors.AppError {
+	if len(k.Scopes) == 0 {
+		return errors.NewValidationError("At least one scope is required")
+	}
+	for _, scope := range k.Scopes {
+		if !RolePermissions[RoleAdmin][scope] {
+			return errors.NewValidationError(fmt.Sprintf("Unknown scope %q", scope))
+		}
+		if unkeyablePermissions[scope] {
+			return errors.NewValidationError(fmt.Sprintf("Scope %q cannot be given to an API key", scope))
+		}
+	}
+	return nil
+}
+
+// Usable refuses revoked and expired keys
+func (k ApiKey) Usable(now time.Time) *errors.AppError {
+	if k.DateRevoked.Valid {
+		return errors.NewAuthenticationError("API key has been revoked")
+	}
+	if k.DateExpires.Valid && !now.Before(k.DateExpires.Time) {
+		return errors.NewAuthenticationError("API key has expired")
+	}
+	return nil
+}
+
+// Actor is the name recorded in the *_by columns and history for the key
+func (k ApiKey) Actor() string {
+	return "api-key:" + k.Prefix
+}
+
+// Grant returns the permissions of the key's scopes
+func (k ApiKey) Grant() Grant {
+	permissions := make(map[Permission]bool, len(k.Scopes))
+	for _, scope := range k.Scopes {
+		permissions[scope] = true
+	}
+	return Grant{Permissions: permissions, Department: k.Department}
+}
+
+func (k ApiKey) ToDto() dto.ApiKeyResponse {
+	scopes := make([]string, 0, len(k.Scopes))
+	for _, scope := range k.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+	response := dto.ApiKeyResponse{
+		Id:           k.Id,
+		Name:         k.Name,
+		Prefix:       k.Prefix,
+		Scopes:       scopes,
+		Department:   k.Department.String,
+		DateCreated:  k.DateCreated.String,
+		CreatedBy:    k.CreatedBy,
+		DateRevoked:  k.DateRevoked.String,
+		RevokedBy:    k.RevokedBy.String,
+		DateLastUsed: k.DateLastUsed.String,
+		LastUsedIp:   k.LastUsedIp.String,
+	}
+	if k.DateExpires.Valid {
+		response.DateExpires = k.DateExpires.Time.Format(time.RFC3339)
+	}
+	return response
+}
+
+type ApiKeyRepository interface {
+	ApiKeys() ([]ApiKey, *errors.AppError)
+	// ApiKeyByHash looks a key up by the hash of its value
+	ApiKeyByHash(keyHash string) (*ApiKey, *errors.AppError)
+	CreateApiKey(ApiKey) (*ApiKey, *errors.AppError)
+	RevokeApiKey(id int64, revokedBy string) (*ApiKey, *errors.AppError)
+	// RecordUsage stamps the time and caller address of the latest use
+	RecordUsage(id int64, ip string) *errors.AppError
+}
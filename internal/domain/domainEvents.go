@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+)
+
+// Domain events published to other systems
+const (
+	DomainEventUserCreated     = "UserCreated"
+	DomainEventUserUpdated     = "UserUpdated"
+	DomainEventSurnameChanged  = "SurnameChanged"
+	DomainEventUserDeleted     = "UserDeleted"
+	DomainEventPasswordCreated = "PasswordCreated"
+)
+
+// publishedUserEvents maps the history actions that are also published to
+// the domain event they become
+var publishedUserEvents = map[string]string{
+	UserEventCreated:         DomainEventUserCreated,
+	UserEventUpdated:         DomainEventUserUpdated,
+	UserEventSurnameChanged:  DomainEventSurnameChanged,
+	UserEventDeleted:         DomainEventUserDeleted,
+	UserEventPasswordCreated: DomainEventPasswordCreated,
+}
+
+// DomainEvent is a change other systems may act on. It is written to the
+// outbox in the transaction that makes the change and published at least
+// once, so consumers must ignore an Id they have already seen.
+type DomainEvent struct {
+	Id          int64           `json:"id" db:"id"`
+	Type        string          `json:"type" db:"event_type"`
+	IdNo        string          `json:"id_no" db:"id_no"`
+	Payload     json.RawMessage `json:"payload" db:"payload"`
+	DateCreated time.Time       `json:"date_created" db:"date_created"`
+	// Delivery bookkeeping of the outbox
+	Attempts        int            `json:"-" db:"attempts"`
+	LastError       sql.NullString `json:"-" db:"last_error"`
+	DateNextAttempt time.Time      `json:"-" db:"date_next_attempt"`
+	DateDelivered   sql.NullTime   `json:"-" db:"date_delivered"`
+}
+
+// UserEventPayload is the payload of a published user event. It carries
+// identifiers and the names of the changed fields but no values, so personal
+// data never leaves through the outbox; consumers read the user if they need it.
+type UserEventPayload struct {
+	IdNo     string   `json:"id_no"`
+	Actor    string   `json:"actor,omitempty"`
+	TicketNo string   `json:"ticket_no,omitempty"`
+	Fields   []string `json:"fields"`
+}
+
+// NewDomainEvent returns the domain event published for event, or false when
+// the action is not published
+func NewDomainEvent(event UserEvent) (*DomainEvent, bool, error) {
+	eventType, published := publishedUserEvents[event.Action]
+	if !published {
+		return nil, false, nil
+	}
+
+	fields := make([]string, 0, len(event.Changes))
+	for _, change := range event.Changes {
+		fields = append(fields, change.Field)
+	}
+	payload, err := json.Marshal(UserEventPayload{
+		IdNo:     event.IdNo,
+		Actor:    event.Actor.String,
+		TicketNo: event.TicketNo.String,
+		Fields:   fields,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &DomainEvent{Type: eventType, IdNo: event.IdNo, Payload: payload}, true, nil
+}
+
+// EventSink publishes domain events to one destination
+type EventSink interface {
+	// Name identifies the sink in logs
+	Name() string
+	Publish(event DomainEvent) *errors.AppError
+}
+
+type OutboxRepository interface {
+	// ClaimEvents returns up to limit undelivered events that are due, oldest
+	// first, and holds them back from other dispatchers for lease
+	ClaimEvents(limit int, lease time.Duration) ([]DomainEvent, *errors.AppError)
+	// MarkDelivered records that every sink accepted the event
+	MarkDelivered(id int64) *errors.AppError
+	// MarkFailed records a failed attempt and when to try again
+	MarkFailed(id int64, reason string, retryAt time.Time) *errors.AppError
+	// PruneDelivered deletes the events delivered before the given time and
+	// returns how many were deleted
+	PruneDelivered(before time.Time) (int64, *errors.AppError)
+}
@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"database/sql"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+type EmailAlias struct {
+	Id          int            `json:"id" db:"id"`
+	IdNo        string         `json:"id_no" db:"id_no"`
+	Alias       string         `json:"alias" db:"alias"`
+	Reason      sql.NullString `json:"reason" db:"reason"`
+	TicketNo    sql.NullString `json:"ticket_no" db:"ticket_no"`
+	DateExpires sql.NullString `json:"date_expires" db:"date_expires"`
+	DateCreated sql.NullString `json:"date_created" db:"date_created"`
+	CreatedBy   string         `json:"created_by" db:"created_by"`
+}
+
+func (a EmailAlias) ToDto() dto.EmailAliasResponse {
+	return dto.EmailAliasResponse{
+		Id:          a.Id,
+		IdNo:        a.IdNo,
+		Alias:       a.Alias,
+		Reason:      a.Reason.String,
+		TicketNo:    a.TicketNo.String,
+		DateExpires: a.DateExpires.String,
+		DateCreated: a.DateCreated.String,
+		CreatedBy:   a.CreatedBy,
+	}
+}
+
+type EmailAliasRepository interface {
+	Aliases(idNo string) ([]EmailAlias, *errors.AppError)
+	CreateAlias(EmailAlias) (*EmailAlias, *errors.AppError)
+	DeleteAlias(idNo string, id int) *errors.AppError
+}
@@ -0,0 +1,213 @@
+package domain
+
+import (
+	"fmt"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+)
+
+// Account states held in users.status
+const (
+	StatusPending   = "pending"
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+	StatusDisabled  = "disabled"
+	StatusDeleted   = "deleted"
+)
+
+// Mailbox states held in users.email_status
+const (
+	EmailStatusProvisioning = "provisioning"
+	EmailStatusActive       = "active"
+	EmailStatusForwarding   = "forwarding"
+	EmailStatusDeleted      = "deleted"
+)
+
+// Guard decides whether a user may take an otherwise allowed transition
+type Guard func(user User) *errors.AppError
+
+// StateMachine lists the allowed transitions of one lifecycle field
+type StateMachine struct {
+	field       string
+	initial     map[string]bool
+	transitions map[string]map[string]Guard
+}
+
+// AccountLifecycle governs users.status
+var AccountLifecycle = StateMachine{
+	field:   "status",
+	initial: map[string]bool{StatusPending: true, StatusActive: true},
+	transitions: map[string]map[string]Guard{
+		StatusPending: {
+			StatusActive:  requireEmailStatus(EmailStatusActive, EmailStatusForwarding),
+			StatusDeleted: nil,
+		},
+		StatusActive: {
+			StatusSuspended: nil,
+			StatusDisabled:  nil,
+			StatusDeleted:   nil,
+		},
+		StatusSuspended: {
+			StatusActive:   nil,
+			StatusDisabled: nil,
+			StatusDeleted:  nil,
+		},
+		StatusDisabled: {
+			StatusActive:  nil,
+			StatusDeleted: nil,
+		},
+		StatusDeleted: {
+			StatusActive: requireNotAnonymized,
+		},
+	},
+}
+
+// EmailLifecycle governs users.email_status
+var EmailLifecycle = StateMachine{
+	field:   "email_status",
+	initial: map[string]bool{EmailStatusProvisioning: true, EmailStatusActive: true},
+	transitions: map[string]map[string]Guard{
+		EmailStatusProvisioning: {
+			EmailStatusActive:  requireAccountNotDeleted,
+			EmailStatusDeleted: nil,
+		},
+		EmailStatusActive: {
+			// Mail is only forwarded away from accounts nobody is using
+			EmailStatusForwarding: requireStatus(StatusSuspended, StatusDisabled),
+			EmailStatusDeleted:    nil,
+		},
+		EmailStatusForwarding: {
+			EmailStatusActive:  requireAccountNotDeleted,
+			EmailStatusDeleted: nil,
+		},
+		EmailStatusDeleted: {
+			EmailStatusActive: allOf(requireAccountNotDeleted, requireNotAnonymized),
+		},
+	},
+}
+
+// ValidateInitial checks the state a new user starts in
+func (m StateMachine) ValidateInitial(state string) *errors.AppError {
+	if !m.initial[state] {
+		return errors.NewValidationError(fmt.Sprintf("A new user cannot start with %s %q", m.field, state))
+	}
+	return nil
+}
+
+// ValidateTransition checks that a user may move from one state to another.
+// Guards see user as it will be after the change, and every transition must be
+// traceable to a ticket.
+func (m StateMachine) ValidateTransition(user User, from, to, ticketNo string) *errors.AppError {
+	if from == to {
+		return nil
+	}
+	if _, known := m.transitions[to]; !known {
+		return errors.NewValidationError(fmt.Sprintf("Unknown %s %q", m.field, to))
+	}
+
+	guard, allowed := m.transitions[from][to]
+	if !allowed {
+		return errors.NewConflictError(fmt.Sprintf("Cannot change %s from %q to %q", m.field, from, to))
+	}
+	if ticketNo == "" {
+		return errors.NewValidationError(fmt.Sprintf("A ticket number is required to change %s to %q", m.field, to))
+	}
+	if guard != nil {
+		return guard(user)
+	}
+	return nil
+}
+
+// ValidateInitialStates checks the account and mailbox states a new user
+// starts in together: an account is only active once its mailbox is, which is
+// what the pending to active transition requires too
+func ValidateInitialStates(status, emailStatus string) *errors.AppError {
+	if err := AccountLifecycle.ValidateInitial(status); err != nil {
+		return err
+	}
+	if err := EmailLifecycle.ValidateInitial(emailStatus); err != nil {
+		return err
+	}
+	if status == StatusActive && emailStatus != EmailStatusActive {
+		return errors.NewValidationError("A new active account needs an active mailbox; create it as pending instead")
+	}
+	return nil
+}
+
+// CanAuthenticate refuses every authentication flow for accounts that are not
+// active, including ones still waiting to be activated
+func (u User) CanAuthenticate() *errors.AppError {
+	switch u.Status {
+	case StatusPending:
+		return errors.NewAuthorizationError("Account is not activated yet")
+	case StatusSuspended:
+		return errors.NewAuthorizationError("Account is suspended")
+	case StatusDisabled, StatusDeleted:
+		return errors.NewAuthorizationError("Account is not active")
+	}
+	return nil
+}
+
+// CanChangeAddress refuses a new generated address, and the alias kept for
+// the old one, unless the account is active and its mailbox not deleted
+func (u User) CanChangeAddress() *errors.AppError {
+	if err := requireStatus(StatusActive)(u); err != nil {
+		return err
+	}
+	if u.EmailStatus == EmailStatusDeleted {
+		return errors.NewConflictError("Not allowed while the mailbox is \"deleted\"")
+	}
+	return nil
+}
+
+// requireStatus only allows the transition while the account is in one of states
+func requireStatus(states ...string) Guard {
+	return func(user User) *errors.AppError {
+		for _, state := range states {
+			if user.Status == state {
+				return nil
+			}
+		}
+		return errors.NewConflictError(fmt.Sprintf("Not allowed while the account is %q", user.Status))
+	}
+}
+
+// requireEmailStatus only allows the transition while the mailbox is in one of states
+func requireEmailStatus(states ...string) Guard {
+	return func(user User) *errors.AppError {
+		for _, state := range states {
+			if user.EmailStatus == state {
+				return nil
+			}
+		}
+		return errors.NewConflictError(fmt.Sprintf("Not allowed while the mailbox is %q", user.EmailStatus))
+	}
+}
+
+// requireAccountNotDeleted keeps a mailbox from coming back on its own for a deleted account
+func requireAccountNotDeleted(user User) *errors.AppError {
+	if user.Status == StatusDeleted {
+		return errors.NewConflictError("Restore the account before reactivating its mailbox")
+	}
+	return nil
+}
+
+// allOf combines guards, failing on the first one that fails
+func allOf(guards ...Guard) Guard {
+	return func(user User) *errors.AppError {
+		for _, guard := range guards {
+			if err := guard(user); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// requireNotAnonymized blocks bringing back a user scrubbed by the retention policy
+func requireNotAnonymized(user User) *errors.AppError {
+	if user.DateAnonymized.Valid {
+		return errors.NewConflictError("User has been anonymized by the retention policy")
+	}
+	return nil
+}
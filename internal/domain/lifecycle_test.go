@@ -0,0 +1,141 @@
+package domain
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+)
+
+func TestAccountLifecycleTransitions(t *testing.T) {
+	anonymized := sql.NullString{String: "2026-01-01", Valid: true}
+	tests := []struct {
+		from, to    string
+		emailStatus string
+		anonymized  sql.NullString
+		want        func(*errors.AppError) bool
+	}{
+		{from: StatusPending, to: StatusActive, emailStatus: EmailStatusActive},
+		{from: StatusPending, to: StatusActive, emailStatus: EmailStatusForwarding},
+		{from: StatusPending, to: StatusActive, emailStatus: EmailStatusProvisioning, want: errors.IsConflictError},
+		{from: StatusPending, to: StatusDeleted},
+		{from: StatusPending, to: StatusSuspended, want: errors.IsConflictError},
+		{from: StatusPending, to: StatusDisabled, want: errors.IsConflictError},
+		{from: StatusActive, to: StatusSuspended},
+		{from: StatusActive, to: StatusDisabled},
+		{from: StatusActive, to: StatusDeleted},
+		{from: StatusActive, to: StatusPending, want: errors.IsConflictError},
+		{from: StatusSuspended, to: StatusActive},
+		{from: StatusSuspended, to: StatusDisabled},
+		{from: StatusSuspended, to: StatusDeleted},
+		{from: StatusSuspended, to: StatusPending, want: errors.IsConflictError},
+		{from: StatusDisabled, to: StatusActive},
+		{from: StatusDisabled, to: StatusDeleted},
+		{from: StatusDisabled, to: StatusSuspended, want: errors.IsConflictError},
+		{from: StatusDeleted, to: StatusActive},
+		{from: StatusDeleted, to: StatusActive, anonymized: anonymized, want: errors.IsConflictError},
+		{from: StatusDeleted, to: StatusSuspended, want: errors.IsConflictError},
+		{from: StatusDeleted, to: StatusPending, want: errors.IsConflictError},
+		{from: StatusActive, to: "archived", want: errors.IsValidationError},
+	}
+	for _, tt := range tests {
+		user := User{Status: tt.to, EmailStatus: tt.emailStatus, DateAnonymized: tt.anonymized}
+		checkTransition(t, AccountLifecycle, user, tt.from, tt.to, tt.want)
+	}
+}
+
+func TestEmailLifecycleTransitions(t *testing.T) {
+	anonymized := sql.NullString{String: "2026-01-01", Valid: true}
+	tests := []struct {
+		from, to   string
+		status     string
+		anonymized sql.NullString
+		want       func(*errors.AppError) bool
+	}{
+		{from: EmailStatusProvisioning, to: EmailStatusActive, status: StatusPending},
+		{from: EmailStatusProvisioning, to: EmailStatusActive, status: StatusDeleted, want: errors.IsConflictError},
+		{from: EmailStatusProvisioning, to: EmailStatusDeleted},
+		{from: EmailStatusProvisioning, to: EmailStatusForwarding, want: errors.IsConflictError},
+		{from: EmailStatusActive, to: EmailStatusForwarding, status: StatusSuspended},
+		{from: EmailStatusActive, to: EmailStatusForwarding, status: StatusDisabled},
+		{from: EmailStatusActive, to: EmailStatusForwarding, status: StatusActive, want: errors.IsConflictError},
+		{from: EmailStatusActive, to: EmailStatusDeleted},
+		{from: EmailStatusActive, to: EmailStatusProvisioning, want: errors.IsConflictError},
+		{from: EmailStatusForwarding, to: EmailStatusActive, status: StatusActive},
+		{from: EmailStatusForwarding, to: EmailStatusActive, status: StatusDeleted, want: errors.IsConflictError},
+		{from: EmailStatusForwarding, to: EmailStatusDeleted},
+		{from: EmailStatusDeleted, to: EmailStatusActive, status: StatusActive},
+		{from: EmailStatusDeleted, to: EmailStatusActive, status: StatusDeleted, want: errors.IsConflictError},
+		{from: EmailStatusDeleted, to: EmailStatusActive, status: StatusActive, anonymized: anonymized, want: errors.IsConflictError},
+		{from: EmailStatusDeleted, to: EmailStatusForwarding, want: errors.IsConflictError},
+		{from: EmailStatusActive, to: "bounced", want: errors.IsValidationError},
+	}
+	for _, tt := range tests {
+		user := User{Status: tt.status, EmailStatus: tt.to, DateAnonymized: tt.anonymized}
+		checkTransition(t, EmailLifecycle, user, tt.from, tt.to, tt.want)
+	}
+}
+
+// checkTransition expects the transition to be allowed when want is nil, and
+// refused with an error want recognizes otherwise
+func checkTransition(t *testing.T, machine StateMachine, user User, from, to string, want func(*errors.AppError) bool) {
+	t.Helper()
+	err := machine.ValidateTransition(user, from, to, "T-1")
+	switch {
+	case want == nil && err != nil:
+		t.Errorf("%s %q -> %q (%+v) refused: %s", machine.field, from, to, user, err.Message)
+	case want != nil && !want(err):
+		t.Errorf("%s %q -> %q (%+v) = %v, want it refused", machine.field, from, to, user, err)
+	}
+}
+
+func TestLifecycleTransitionsNeedATicket(t *testing.T) {
+	if err := AccountLifecycle.ValidateTransition(User{Status: StatusSuspended}, StatusActive, StatusSuspended, ""); !errors.IsValidationError(err) {
+		t.Errorf("transition without a ticket = %v, want a validation error", err)
+	}
+	if err := AccountLifecycle.ValidateTransition(User{Status: StatusActive}, StatusActive, StatusActive, ""); err != nil {
+		t.Errorf("unchanged status = %s, want no ticket needed", err.Message)
+	}
+}
+
+func TestInitialStates(t *testing.T) {
+	tests := []struct {
+		status, emailStatus string
+		allowed             bool
+	}{
+		{StatusPending, EmailStatusProvisioning, true},
+		{StatusPending, EmailStatusActive, true},
+		{StatusActive, EmailStatusActive, true},
+		{StatusActive, EmailStatusProvisioning, false},
+		{StatusSuspended, EmailStatusActive, false},
+		{StatusDeleted, EmailStatusActive, false},
+		{StatusPending, EmailStatusForwarding, false},
+	}
+	for _, tt := range tests {
+		err := ValidateInitialStates(tt.status, tt.emailStatus)
+		if tt.allowed != (err == nil) {
+			t.Errorf("ValidateInitialStates(%q, %q) = %v, want allowed %v", tt.status, tt.emailStatus, err, tt.allowed)
+		}
+	}
+}
+
+func TestCanChangeAddress(t *testing.T) {
+	tests := []struct {
+		status, emailStatus string
+		allowed             bool
+	}{
+		{StatusActive, EmailStatusActive, true},
+		{StatusActive, EmailStatusForwarding, true},
+		{StatusActive, EmailStatusDeleted, false},
+		{StatusPending, EmailStatusProvisioning, false},
+		{StatusSuspended, EmailStatusActive, false},
+		{StatusDisabled, EmailStatusActive, false},
+		{StatusDeleted, EmailStatusDeleted, false},
+	}
+	for _, tt := range tests {
+		err := User{Status: tt.status, EmailStatus: tt.emailStatus}.CanChangeAddress()
+		if tt.allowed && err != nil || !tt.allowed && !errors.IsConflictError(err) {
+			t.Errorf("CanChangeAddress(%q, %q) = %v, want allowed %v", tt.status, tt.emailStatus, err, tt.allowed)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+)
+
+// LoginAttempt counts the recent failed logins of one login identity or client address
+type LoginAttempt struct {
+	Key             string    `json:"key" db:"key"`
+	Failures        int       `json:"failures" db:"failures"`
+	DateLastFailure time.Time `json:"date_last_failure" db:"date_last_failure"`
+}
+
+// LoginAttemptStore keeps failed login counters. Failures older than the window
+// given when recording are forgotten rather than added to.
+type LoginAttemptStore interface {
+	// LoginAttempt returns the failures of key, with no failures when there are none
+	LoginAttempt(key string) (LoginAttempt, *errors.AppError)
+	// RecordLoginFailure adds a failure to key and returns the updated count
+	RecordLoginFailure(key string, window time.Duration) (LoginAttempt, *errors.AppError)
+	// ResetLoginAttempts forgets the failures of key
+	ResetLoginAttempts(key string) *errors.AppError
+}
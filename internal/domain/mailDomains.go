@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"database/sql"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+type MailDomain struct {
+	Name        string         `json:"name" db:"name"`
+	Description sql.NullString `json:"description" db:"description"`
+	IsDefault   bool           `json:"is_default" db:"is_default"`
+	DateCreated sql.NullString `json:"date_created" db:"date_created"`
+	DateUpdated sql.NullString `json:"date_updated" db:"date_updated"`
+}
+
+type DepartmentDomain struct {
+	Department  string         `json:"department" db:"department"`
+	DomainName  string         `json:"domain_name" db:"domain_name"`
+	DateCreated sql.NullString `json:"date_created" db:"date_created"`
+	DateUpdated sql.NullString `json:"date_updated" db:"date_updated"`
+}
+
+func (d MailDomain) ToDto() dto.MailDomainResponse {
+	return dto.MailDomainResponse{
+		Name:        d.Name,
+		Description: d.Description.String,
+		IsDefault:   d.IsDefault,
+		DateCreated: d.DateCreated.String,
+		DateUpdated: d.DateUpdated.String,
+	}
+}
+
+func (r DepartmentDomain) ToDto() dto.DepartmentDomainResponse {
+	return dto.DepartmentDomainResponse{
+		Department:  r.Department,
+		DomainName:  r.DomainName,
+		DateCreated: r.DateCreated.String,
+		DateUpdated: r.DateUpdated.String,
+	}
+}
+
+type MailDomainRepository interface {
+	Domains() ([]MailDomain, *errors.AppError)
+	Domain(name string) (*MailDomain, *errors.AppError)
+	CreateDomain(MailDomain) (*MailDomain, *errors.AppError)
+	UpdateDomain(MailDomain) (*MailDomain, *errors.AppError)
+	DeleteDomain(name string) *errors.AppError
+	DepartmentRules() ([]DepartmentDomain, *errors.AppError)
+	// SetDepartmentRule creates or replaces the rule of a department; departments
+	// that differ only in case share one rule
+	SetDepartmentRule(DepartmentDomain) (*DepartmentDomain, *errors.AppError)
+	DeleteDepartmentRule(department string) *errors.AppError
+	// DomainForDepartment returns the domain routed to a department, or the
+	// default domain when the department has no rule
+	DomainForDepartment(department string) (*MailDomain, *errors.AppError)
+}
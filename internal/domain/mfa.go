@@ -0,0 +1,107 @@
+package domain
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+)
+
+// MfaEnrollment is the TOTP secret of a user. Until it is confirmed with a
+// valid code it does not change how the user logs in. Secret is sealed like an
+// SMTP password, or legacy plaintext when KeyId is not set.
+type MfaEnrollment struct {
+	IdNo          string         `json:"id_no" db:"id_no"`
+	Secret        string         `json:"-" db:"secret"`
+	KeyId         sql.NullString `json:"-" db:"key_id"`
+	DataKey       sql.NullString `json:"-" db:"data_key"`
+	DateCreated   sql.NullString `json:"date_created" db:"date_created"`
+	DateConfirmed sql.NullTime   `json:"date_confirmed" db:"date_confirmed"`
+	LastUsedStep  int64          `json:"-" db:"last_used_step"`
+}
+
+// Active reports whether logins require the second factor
+func (e MfaEnrollment) Active() bool {
+	return e.DateConfirmed.Valid
+}
+
+// Sealed reports whether the secret is encrypted
+func (e MfaEnrollment) Sealed() bool {
+	return e.KeyId.Valid
+}
+
+// SealedSecret returns the sealed form of the secret
+func (e MfaEnrollment) SealedSecret() SealedSecret {
+	return SealedSecret{KeyId: e.KeyId.String, DataKey: e.DataKey.String, Ciphertext: e.Secret}
+}
+
+// WithSecret returns e holding secret as its TOTP secret
+func (e MfaEnrollment) WithSecret(secret SealedSecret) MfaEnrollment {
+	e.Secret = secret.Ciphertext
+	e.KeyId = sql.NullString{String: secret.KeyId, Valid: true}
+	e.DataKey = sql.NullString{String: secret.DataKey, Valid: true}
+	return e
+}
+
+// RecoveryCode replaces a TOTP code once, when the authenticator is lost
+type RecoveryCode struct {
+	Id          int64          `json:"id" db:"id"`
+	IdNo        string         `json:"id_no" db:"id_no"`
+	CodeHash    string         `json:"-" db:"code_hash"`
+	DateCreated sql.NullString `json:"date_created" db:"date_created"`
+	DateUsed    sql.NullTime   `json:"date_used" db:"date_used"`
+}
+
+// MfaChallenge is a login that passed the password check and waits for the
+// second factor
+type MfaChallenge struct {
+	Id          int64          `json:"id" db:"id"`
+	IdNo        string         `json:"id_no" db:"id_no"`
+	TokenHash   string         `json:"-" db:"token_hash"`
+	DateCreated sql.NullString `json:"date_created" db:"date_created"`
+	DateExpires time.Time      `json:"date_expires" db:"date_expires"`
+	DateUsed    sql.NullTime   `json:"date_used" db:"date_used"`
+}
+
+// Usable refuses used and expired challenges
+func (c MfaChallenge) Usable(now time.Time) *errors.AppError {
+	if c.DateUsed.Valid || !now.Before(c.DateExpires) {
+		return errors.NewAuthenticationError("Invalid or expired MFA token")
+	}
+	return nil
+}
+
+// Mutating methods that change whether a user has MFA append the given event
+// to the user history in the same transaction
+type MfaRepository interface {
+	// Enrollment fails with not found when the user never started enrolling
+	Enrollment(idNo string) (*MfaEnrollment, *errors.AppError)
+	// StartEnrollment stores a new unconfirmed secret, replacing a pending one;
+	// it fails with a conflict when MFA is already active
+	StartEnrollment(MfaEnrollment) *errors.AppError
+	// ConfirmEnrollment activates the enrollment, accepting the code of step,
+	// and stores the hashes of the first recovery codes
+	ConfirmEnrollment(idNo string, step int64, codeHashes []string, event UserEvent) *errors.AppError
+	// DeleteEnrollment removes the secret and recovery codes of a user
+	DeleteEnrollment(idNo string, event UserEvent) *errors.AppError
+	// StaleEnrollments lists up to limit enrollments, ordered by id_no after
+	// afterIdNo, whose secret is plaintext or sealed under another key than activeKeyId
+	StaleEnrollments(activeKeyId, afterIdNo string, limit int) ([]MfaEnrollment, *errors.AppError)
+	// ReplaceSecret swaps the stored secret of current for the one in next; it
+	// fails with a conflict when the secret changed in the meantime
+	ReplaceSecret(current, next MfaEnrollment) *errors.AppError
+	// UseStep records an accepted code; it fails with a conflict when step is
+	// not newer than the last accepted one
+	UseStep(idNo string, step int64) *errors.AppError
+	// RecoveryCodes lists the unused recovery codes of a user
+	RecoveryCodes(idNo string) ([]RecoveryCode, *errors.AppError)
+	// UseRecoveryCode fails with a conflict when the code was already used
+	UseRecoveryCode(id int64) *errors.AppError
+	// ReplaceRecoveryCodes discards every recovery code of a user for new ones
+	ReplaceRecoveryCodes(idNo string, codeHashes []string, event UserEvent) *errors.AppError
+	CreateChallenge(MfaChallenge) *errors.AppError
+	// Challenge looks a challenge up by the hash of its token
+	Challenge(tokenHash string) (*MfaChallenge, *errors.AppError)
+	// UseChallenge fails with a conflict when the challenge was already used
+	UseChallenge(id int64) *errors.AppError
+}
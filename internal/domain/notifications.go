@@ -0,0 +1,58 @@
+package domain
+
+import "github.com/jmechavez/email-account-tracker/errors"
+
+// Notification events; each one can be switched off on its own
+const (
+	NotificationWelcome        = "welcome"
+	NotificationAddressChanged = "address_changed"
+	NotificationPasswordReset  = "password_reset"
+)
+
+// NotificationEvents lists every notification event
+var NotificationEvents = []string{NotificationWelcome, NotificationAddressChanged, NotificationPasswordReset}
+
+// NotificationData is what message templates are rendered with
+type NotificationData struct {
+	IdNo       string
+	FirstName  string
+	LastName   string
+	Department string
+	Email      string
+	// Manager is set when the message goes to the user's manager rather than the user
+	Manager       *User
+	PreviousEmail string
+	AliasExpires  string
+	ResetToken    string
+	ResetExpires  string
+}
+
+// NewNotificationData describes user for a message template
+func NewNotificationData(user User) NotificationData {
+	return NotificationData{
+		IdNo:       user.IdNo,
+		FirstName:  user.FirstName,
+		LastName:   user.LastName,
+		Department: user.Department,
+		Email:      user.Email,
+	}
+}
+
+// Message is an email ready to be delivered
+type Message struct {
+	Event   string
+	To      []string
+	Subject string
+	Text    string
+	Html    string // Optional alternative to Text
+}
+
+// MessageRenderer turns a notification event into a message
+type MessageRenderer interface {
+	Render(event string, data NotificationData) (*Message, *errors.AppError)
+}
+
+// MessageSender delivers messages; implementations may queue them
+type MessageSender interface {
+	Send(message Message) *errors.AppError
+}
@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Principal is the authenticated caller of a request, either a user or an API key
+type Principal struct {
+	IdNo      string    // User id_no, or the API key actor name
+	TokenId   string    // jti of the access token the caller presented
+	ApiKeyId  int64     // Set when the caller authenticated with an API key
+	ExpiresAt time.Time // When the presented credential stops being accepted
+	Grants    []Grant   // What the caller may do, from its roles or key scopes
+	// MustChangePassword confines the caller to changing its password
+	MustChangePassword bool
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated caller
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the authenticated caller stored in ctx, if any
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
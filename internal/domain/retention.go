@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+// Actions the retention job takes on a long-deleted user
+const (
+	RetentionAnonymize = "anonymize"
+	RetentionPurge     = "purge"
+)
+
+type RetentionCandidate struct {
+	IdNo           string         `json:"id_no" db:"id_no"`
+	Department     string         `json:"department" db:"department"`
+	DateDeleted    sql.NullString `json:"date_deleted" db:"date_deleted"`
+	DateAnonymized sql.NullString `json:"date_anonymized" db:"date_anonymized"`
+	Action         string         `json:"action" db:"action"`
+}
+
+func (c RetentionCandidate) ToDto() dto.RetentionCandidateResponse {
+	return dto.RetentionCandidateResponse{
+		IdNo:           c.IdNo,
+		Department:     c.Department,
+		DateDeleted:    c.DateDeleted.String,
+		DateAnonymized: c.DateAnonymized.String,
+		Action:         c.Action,
+	}
+}
+
+type RetentionRepository interface {
+	// RetentionCandidates lists deleted users due for anonymization (deleted before
+	// anonymizeBefore and not yet scrubbed) or hard deletion (deleted before purgeBefore)
+	RetentionCandidates(anonymizeBefore, purgeBefore time.Time) ([]RetentionCandidate, *errors.AppError)
+	// AnonymizeUser scrubs secrets and personal fields of a user deleted before cutoff
+	AnonymizeUser(idNo string, cutoff time.Time, event UserEvent) *errors.AppError
+	// PurgeUser hard-deletes a user deleted before cutoff
+	PurgeUser(idNo string, cutoff time.Time, event UserEvent) *errors.AppError
+}
@@ -0,0 +1,208 @@
+package domain
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+// Operator roles
+const (
+	RoleViewer   = "viewer"
+	RoleHelpdesk = "helpdesk"
+	RoleHR       = "hr"
+	RoleAdmin    = "admin"
+)
+
+// Permission names one operation an operator may be allowed to perform
+type Permission string
+
+const (
+	PermissionReadUsers     Permission = "users:read"
+	PermissionReadPersonal  Permission = "users:pii" // Names and addresses in responses
+	PermissionCreateUsers   Permission = "users:create"
+	PermissionUpdateUsers   Permission = "users:update"
+	PermissionChangeSurname Permission = "users:surname"
+	PermissionDeleteUsers   Permission = "users:delete"
+	PermissionRestoreUsers  Permission = "users:restore"
+	PermissionSuspendUsers  Permission = "users:suspend" // Suspend and reactivate
+	PermissionSetPasswords  Permission = "users:password"
+	PermissionManageSmtp    Permission = "users:smtp" // Set, rotate, clear and verify SMTP credentials
+	PermissionReadHistory   Permission = "users:history"
+	PermissionManageAliases Permission = "aliases:manage"
+	PermissionReadDomains   Permission = "domains:read"
+	PermissionManageDomains Permission = "domains:manage"
+	PermissionReadRetention Permission = "retention:read"
+	PermissionManageRoles   Permission = "roles:manage"
+	PermissionManageApiKeys Permission = "api_keys:manage"
+)
+
+// RolePermissions is the permission matrix; a role not listed grants nothing
+var RolePermissions = map[string]map[Permission]bool{
+	RoleViewer: {
+		PermissionReadUsers:   true,
+		PermissionReadHistory: true,
+		PermissionReadDomains: true,
+	},
+	RoleHelpdesk: {
+		PermissionReadUsers:     true,
+		PermissionReadPersonal:  true,
+		PermissionReadHistory:   true,
+		PermissionReadDomains:   true,
+		PermissionSuspendUsers:  true,
+		PermissionSetPasswords:  true,
+		PermissionManageSmtp:    true,
+		PermissionManageAliases: true,
+	},
+	RoleHR: {
+		PermissionReadUsers:     true,
+		PermissionReadPersonal:  true,
+		PermissionReadHistory:   true,
+		PermissionReadDomains:   true,
+		PermissionCreateUsers:   true,
+		PermissionUpdateUsers:   true,
+		PermissionChangeSurname: true,
+		PermissionDeleteUsers:   true,
+		PermissionRestoreUsers:  true,
+		PermissionSuspendUsers:  true,
+	},
+	RoleAdmin: {
+		PermissionReadUsers:     true,
+		PermissionReadPersonal:  true,
+		PermissionReadHistory:   true,
+		PermissionReadDomains:   true,
+		PermissionCreateUsers:   true,
+		PermissionUpdateUsers:   true,
+		PermissionChangeSurname: true,
+		PermissionDeleteUsers:   true,
+		PermissionRestoreUsers:  true,
+		PermissionSuspendUsers:  true,
+		PermissionSetPasswords:  true,
+		PermissionManageSmtp:    true,
+		PermissionManageAliases: true,
+		PermissionManageDomains: true,
+		PermissionReadRetention: true,
+		PermissionManageRoles:   true,
+		PermissionManageApiKeys: true,
+	},
+}
+
+// RoleAssignment grants a role to a user, limited to one department when
+// Department is set
+type RoleAssignment struct {
+	Id          int64          `json:"id" db:"id"`
+	IdNo        string         `json:"id_no" db:"id_no"`
+	Role        string         `json:"role" db:"role"`
+	Department  sql.NullString `json:"department" db:"department"`
+	DateCreated sql.NullString `json:"date_created" db:"date_created"`
+	CreatedBy   string         `json:"created_by" db:"created_by"`
+}
+
+// Validate rejects unknown roles and department-scoped admins
+func (a RoleAssignment) Validate() *errors.AppError {
+	if _, known := RolePermissions[a.Role]; !known {
+		return errors.NewValidationError(fmt.Sprintf("Unknown role %q", a.Role))
+	}
+	if a.Role == RoleAdmin && a.Department.Valid {
+		return errors.NewValidationError("The admin role cannot be limited to a department")
+	}
+	return nil
+}
+
+// Grant returns the permissions the assignment gives its holder
+func (a RoleAssignment) Grant() Grant {
+	return Grant{Permissions: RolePermissions[a.Role], Department: a.Department}
+}
+
+// String renders the assignment for the user history
+func (a RoleAssignment) String() string {
+	if a.Department.Valid {
+		return a.Role + "@" + a.Department.String
+	}
+	return a.Role
+}
+
+func (a RoleAssignment) ToDto() dto.RoleAssignmentResponse {
+	return dto.RoleAssignmentResponse{
+		Id:          a.Id,
+		IdNo:        a.IdNo,
+		Role:        a.Role,
+		Department:  a.Department.String,
+		DateCreated: a.DateCreated.String,
+		CreatedBy:   a.CreatedBy,
+	}
+}
+
+// Grant is a set of permissions held over one department, or over every
+// department when Department is not set
+type Grant struct {
+	Permissions map[Permission]bool
+	Department  sql.NullString
+}
+
+// Allows reports whether the grant covers permission over department. A
+// department-scoped grant never covers the empty department, which stands for
+// operations that are not tied to one department.
+func (g Grant) Allows(permission Permission, department string) bool {
+	if !g.Permissions[permission] {
+		return false
+	}
+	return !g.Department.Valid || (department != "" && strings.EqualFold(g.Department.String, department))
+}
+
+// Authorize checks that one of the principal's grants covers permission over department
+func (p Principal) Authorize(permission Permission, department string) *errors.AppError {
+	for _, grant := range p.Grants {
+		if grant.Allows(permission, department) {
+			return nil
+		}
+	}
+	if department != "" {
+		return errors.NewAuthorizationError(fmt.Sprintf("Not allowed to %s in department %s", permission, department))
+	}
+	return errors.NewAuthorizationError(fmt.Sprintf("Not allowed to %s", permission))
+}
+
+// Covers reports whether the principal holds every permission of grant over
+// the departments grant covers, so that acting as its holder gains nothing
+func (p Principal) Covers(grant Grant) bool {
+	for permission, granted := range grant.Permissions {
+		if !granted {
+			continue
+		}
+		if grant.Department.Valid {
+			if p.Authorize(permission, grant.Department.String) != nil {
+				return false
+			}
+		} else if _, all := p.Departments(permission); !all {
+			return false
+		}
+	}
+	return true
+}
+
+// Departments returns the departments the principal holds permission in, or
+// all as true when one of its grants is not limited to a department
+func (p Principal) Departments(permission Permission) (departments []string, all bool) {
+	for _, grant := range p.Grants {
+		if !grant.Permissions[permission] {
+			continue
+		}
+		if !grant.Department.Valid {
+			return nil, true
+		}
+		departments = append(departments, grant.Department.String)
+	}
+	return departments, false
+}
+
+type RoleRepository interface {
+	Roles(idNo string) ([]RoleAssignment, *errors.AppError)
+	// GrantRole stores the assignment and records event in the user history
+	GrantRole(RoleAssignment, UserEvent) (*RoleAssignment, *errors.AppError)
+	// RevokeRole deletes one of a user's assignments and records event
+	RevokeRole(idNo string, id int64, event UserEvent) (*RoleAssignment, *errors.AppError)
+}
@@ -0,0 +1,136 @@
+package domain
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+// Outcomes of an SMTP credential verification
+const (
+	SmtpVerified = "verified"
+	SmtpRejected = "rejected"
+)
+
+// SealedSecret is a value encrypted with its own data key, which is itself
+// encrypted with the key-encryption key KeyId. Rotating keys only rewraps DataKey.
+type SealedSecret struct {
+	KeyId      string
+	DataKey    string
+	Ciphertext string
+}
+
+// SecretSealer encrypts credentials at rest. Associated data, such as the
+// owner's id_no, must match between Seal and Open so a sealed value cannot be
+// moved to another row.
+type SecretSealer interface {
+	// ActiveKeyId names the key new secrets are sealed with
+	ActiveKeyId() string
+	Seal(plaintext []byte, associated string) (*SealedSecret, *errors.AppError)
+	Open(secret SealedSecret, associated string) ([]byte, *errors.AppError)
+	// Rewrap moves secret to the active key without touching the ciphertext
+	Rewrap(secret SealedSecret) (*SealedSecret, *errors.AppError)
+}
+
+// SmtpCredentials are the stored SMTP login of a user. Password is the sealed
+// ciphertext, or legacy plaintext when KeyId is not set.
+type SmtpCredentials struct {
+	IdNo         string         `json:"id_no" db:"id_no"`
+	Department   string         `json:"department" db:"department"`
+	Email        string         `json:"smtp_email" db:"smtp_email"`
+	Password     string         `json:"-" db:"smtp_password"`
+	KeyId        sql.NullString `json:"smtp_key_id" db:"smtp_key_id"`
+	DataKey      sql.NullString `json:"-" db:"smtp_data_key"`
+	VerifyStatus sql.NullString `json:"smtp_verify_status" db:"smtp_verify_status"`
+	VerifyError  sql.NullString `json:"smtp_verify_error" db:"smtp_verify_error"`
+	DateVerified sql.NullTime   `json:"smtp_date_verified" db:"smtp_date_verified"`
+}
+
+// Configured reports whether the user has an SMTP password
+func (c SmtpCredentials) Configured() bool {
+	return c.Password != ""
+}
+
+// Sealed reports whether the password is encrypted
+func (c SmtpCredentials) Sealed() bool {
+	return c.KeyId.Valid
+}
+
+// Secret returns the sealed form of the password
+func (c SmtpCredentials) Secret() SealedSecret {
+	return SealedSecret{KeyId: c.KeyId.String, DataKey: c.DataKey.String, Ciphertext: c.Password}
+}
+
+// WithSecret returns c holding secret as its password
+func (c SmtpCredentials) WithSecret(secret SealedSecret) SmtpCredentials {
+	c.Password = secret.Ciphertext
+	c.KeyId = sql.NullString{String: secret.KeyId, Valid: true}
+	c.DataKey = sql.NullString{String: secret.DataKey, Valid: true}
+	return c
+}
+
+func (c SmtpCredentials) ToDto() dto.SmtpCredentialResponse {
+	response := dto.SmtpCredentialResponse{
+		IdNo:               c.IdNo,
+		SmtpEmail:          c.Email,
+		Configured:         c.Configured(),
+		Encrypted:          c.Sealed(),
+		VerificationStatus: c.VerifyStatus.String,
+		VerificationError:  c.VerifyError.String,
+	}
+	if c.DateVerified.Valid {
+		response.DateVerified = c.DateVerified.Time.Format(time.RFC3339)
+	}
+	return response
+}
+
+// SmtpCredentials returns the SMTP login stored on u
+func (u User) SmtpCredentials() SmtpCredentials {
+	return SmtpCredentials{
+		IdNo:         u.IdNo,
+		Department:   u.Department,
+		Email:        u.SMTPEmail,
+		Password:     u.SMTPPassword,
+		KeyId:        u.SMTPKeyId,
+		DataKey:      u.SMTPDataKey,
+		VerifyStatus: u.SMTPVerifyStatus,
+		VerifyError:  u.SMTPVerifyError,
+		DateVerified: u.SMTPDateVerified,
+	}
+}
+
+// SmtpLogin is a decrypted SMTP login; it is handed to mail senders and never serialized
+type SmtpLogin struct {
+	Email    string `json:"-"`
+	Password string `json:"-"`
+}
+
+// SmtpLoginProvider decrypts the SMTP login of a user for a component that sends mail
+type SmtpLoginProvider interface {
+	Login(component, idNo string) (*SmtpLogin, *errors.AppError)
+}
+
+// SmtpAuthenticator tries an SMTP login against the configured mail server
+type SmtpAuthenticator interface {
+	// Authenticate fails with an authentication error when the server refuses
+	// login, and with an unexpected error when the server cannot be reached
+	Authenticate(login SmtpLogin) *errors.AppError
+}
+
+type SmtpCredentialRepository interface {
+	// SmtpCredentials fails with not found when the user does not exist
+	SmtpCredentials(idNo string) (*SmtpCredentials, *errors.AppError)
+	// SaveSmtpCredentials replaces the SMTP login of a user with next, which
+	// holds empty values to clear it, and forgets the last verification
+	SaveSmtpCredentials(next SmtpCredentials, event UserEvent) (*SmtpCredentials, *errors.AppError)
+	// RecordSmtpVerification stores the outcome of an AUTH attempt
+	RecordSmtpVerification(idNo, status, message string, event UserEvent) (*SmtpCredentials, *errors.AppError)
+	// StaleSmtpCredentials lists up to limit passwords, after id_no afterIdNo,
+	// that are plaintext or sealed with a key other than activeKeyId
+	StaleSmtpCredentials(activeKeyId, afterIdNo string, limit int) ([]SmtpCredentials, *errors.AppError)
+	// ReplaceSmtpPassword stores next only if the row still holds current; it
+	// fails with a conflict when the password changed in between
+	ReplaceSmtpPassword(current, next SmtpCredentials) *errors.AppError
+}
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+)
+
+type RefreshToken struct {
+	Id          int64          `json:"id" db:"id"`
+	IdNo        string         `json:"id_no" db:"id_no"`
+	TokenHash   string         `json:"-" db:"token_hash"`
+	FamilyId    string         `json:"family_id" db:"family_id"`
+	DateCreated sql.NullString `json:"date_created" db:"date_created"`
+	DateExpires time.Time      `json:"date_expires" db:"date_expires"`
+	DateRevoked sql.NullTime   `json:"date_revoked" db:"date_revoked"`
+}
+
+type SessionRepository interface {
+	CreateRefreshToken(RefreshToken) *errors.AppError
+	// RefreshToken looks a token up by the hash of its value
+	RefreshToken(tokenHash string) (*RefreshToken, *errors.AppError)
+	// RotateRefreshToken revokes current and stores next in one transaction; it
+	// fails with a conflict when current was already revoked concurrently
+	RotateRefreshToken(current RefreshToken, next RefreshToken) *errors.AppError
+	// RevokeTokenFamily revokes every refresh token descending from the same login
+	RevokeTokenFamily(familyId string) *errors.AppError
+	// RevokeUserTokens revokes every refresh token of a user, ending all its sessions
+	RevokeUserTokens(idNo string) *errors.AppError
+	RevokeAccessToken(jti string, expires time.Time) *errors.AppError
+	IsAccessTokenRevoked(jti string) (bool, *errors.AppError)
+}
@@ -0,0 +1,204 @@
+package domain
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+// Actions recorded in the user history
+const (
+	UserEventCreated         = "created"
+	UserEventUpdated         = "updated"
+	UserEventSurnameChanged  = "surname_changed"
+	UserEventDeleted         = "deleted"
+	UserEventRestored        = "restored"
+	UserEventSuspended       = "suspended"
+	UserEventReactivated     = "reactivated"
+	UserEventAnonymized      = "anonymized"
+	UserEventPurged          = "purged"
+	UserEventPasswordCreated = "password_created"
+	UserEventPasswordChanged = "password_changed"
+	UserEventPasswordReset   = "password_reset"
+	UserEventRoleGranted     = "role_granted"
+	UserEventRoleRevoked     = "role_revoked"
+	UserEventMfaEnabled      = "mfa_enabled"
+	UserEventMfaDisabled     = "mfa_disabled"
+	UserEventRecoveryCodes   = "recovery_codes_regenerated"
+	UserEventSmtpSet         = "smtp_credentials_set"
+	UserEventSmtpRotated     = "smtp_password_rotated"
+	UserEventSmtpCleared     = "smtp_credentials_cleared"
+	UserEventSmtpVerified    = "smtp_credentials_verified"
+)
+
+// redactedValue replaces secrets in the history so they are never stored twice
+const redactedValue = "[redacted]"
+
+// secretUserFields are diffed but never recorded in clear
+var secretUserFields = map[string]bool{
+	"hashed_password": true,
+	"salt":            true,
+	"smtp_password":   true,
+	"smtp_data_key":   true,
+}
+
+// personalUserFields are shown only to callers allowed to see personal data
+var personalUserFields = map[string]bool{
+	"first_name":        true,
+	"last_name":         true,
+	"suffix":            true,
+	"email":             true,
+	"profile_picture":   true,
+	"smtp_email":        true,
+	"smtp_verify_error": true,
+}
+
+// ignoredUserFields change on every write and carry no information
+var ignoredUserFields = map[string]bool{
+	"date_updated": true,
+}
+
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// FieldChanges is stored as a JSONB array
+type FieldChanges []FieldChange
+
+func (c FieldChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(c)
+}
+
+func (c *FieldChanges) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case nil:
+		*c = nil
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into FieldChanges", src)
+}
+
+type UserEvent struct {
+	Id           int64          `json:"id" db:"id"`
+	IdNo         string         `json:"id_no" db:"id_no"`
+	Action       string         `json:"action" db:"action"`
+	Actor        sql.NullString `json:"actor" db:"actor"`
+	TicketNo     sql.NullString `json:"ticket_no" db:"ticket_no"`
+	Changes      FieldChanges   `json:"changes" db:"changes"`
+	DateCreated  sql.NullString `json:"date_created" db:"date_created"`
+	DateRedacted sql.NullString `json:"date_redacted" db:"date_redacted"` // Set once personal data was scrubbed from changes
+}
+
+// NewUserEvent describes a change about to be made to a user; the field-level
+// changes are filled in by the repository once the row has been written
+func NewUserEvent(idNo, action, actor, ticketNo string) UserEvent {
+	return UserEvent{
+		IdNo:     idNo,
+		Action:   action,
+		Actor:    sql.NullString{String: actor, Valid: actor != ""},
+		TicketNo: sql.NullString{String: ticketNo, Valid: ticketNo != ""},
+	}
+}
+
+// DiffUsers lists the columns that differ between two versions of a user
+func DiffUsers(before, after User) FieldChanges {
+	changes := FieldChanges{}
+	beforeValue := reflect.ValueOf(before)
+	afterValue := reflect.ValueOf(after)
+	userType := beforeValue.Type()
+
+	for i := 0; i < userType.NumField(); i++ {
+		field := userType.Field(i).Tag.Get("db")
+		if field == "" || ignoredUserFields[field] {
+			continue
+		}
+
+		oldValue := fieldString(beforeValue.Field(i))
+		newValue := fieldString(afterValue.Field(i))
+		if oldValue == newValue {
+			continue
+		}
+
+		if secretUserFields[field] {
+			oldValue, newValue = redact(oldValue), redact(newValue)
+		}
+		changes = append(changes, FieldChange{Field: field, Before: oldValue, After: newValue})
+	}
+	return changes
+}
+
+// fieldString renders a user column for the history
+func fieldString(v reflect.Value) string {
+	switch value := v.Interface().(type) {
+	case string:
+		return value
+	case sql.NullString:
+		return value.String
+	case sql.NullTime:
+		if !value.Valid {
+			return ""
+		}
+		return value.Time.String()
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+func (e UserEvent) ToDto() dto.UserEventResponse {
+	changes := make([]dto.FieldChangeResponse, 0, len(e.Changes))
+	for _, change := range e.Changes {
+		changes = append(changes, dto.FieldChangeResponse{
+			Field:  change.Field,
+			Before: change.Before,
+			After:  change.After,
+		})
+	}
+	return dto.UserEventResponse{
+		Id:           e.Id,
+		IdNo:         e.IdNo,
+		Action:       e.Action,
+		Actor:        e.Actor.String,
+		TicketNo:     e.TicketNo.String,
+		Changes:      changes,
+		DateCreated:  e.DateCreated.String,
+		DateRedacted: e.DateRedacted.String,
+	}
+}
+
+// WithoutPersonalData returns e with the values of personal fields redacted
+func (e UserEvent) WithoutPersonalData() UserEvent {
+	changes := make(FieldChanges, 0, len(e.Changes))
+	for _, change := range e.Changes {
+		if personalUserFields[change.Field] {
+			change.Before, change.After = redact(change.Before), redact(change.After)
+		}
+		changes = append(changes, change)
+	}
+	e.Changes = changes
+	return e
+}
+
+type UserEventRepository interface {
+	// History returns a page of a user's events, newest first, and the total count
+	History(idNo string, limit, offset int) ([]UserEvent, int, *errors.AppError)
+}
@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+)
+
+// UserSortFields are the columns the user listing may be sorted by
+var UserSortFields = map[string]bool{
+	"id_no":        true,
+	"first_name":   true,
+	"last_name":    true,
+	"email":        true,
+	"department":   true,
+	"status":       true,
+	"email_status": true,
+	"date_created": true,
+	"date_updated": true,
+	"date_deleted": true,
+}
+
+// KeysetSortFields are the sort fields that support cursor pagination; they are
+// never NULL and, with id_no as tie breaker, give every row a unique position
+var KeysetSortFields = map[string]bool{
+	"id_no":        true,
+	"date_created": true,
+}
+
+// UserCursor marks the row a keyset page starts after, or before when Backward
+type UserCursor struct {
+	Key      string // Sort column value of the boundary row
+	IdNo     string // id_no of the boundary row
+	Backward bool
+}
+
+// UserPage is one page of the user listing
+type UserPage struct {
+	Users   []User
+	Total   int  // Users matching the filter across all pages
+	HasMore bool // More users follow in the direction the page was read
+}
+
+// UserFilter selects and orders users for the listing; zero values do not filter.
+// Date ranges include From and exclude To.
+type UserFilter struct {
+	Department  string
+	Departments []string // Restricts the listing to these departments when not nil
+	Status      string
+	EmailStatus string
+	TicketNo    string // Matches the create, update or delete ticket
+	Search      string // Free text over names and email
+
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	UpdatedFrom *time.Time
+	UpdatedTo   *time.Time
+	DeletedFrom *time.Time
+	DeletedTo   *time.Time
+
+	SortBy   string
+	SortDesc bool
+
+	Limit  int
+	Offset int         // Used when Cursor is nil
+	Cursor *UserCursor // Keyset position; replaces Offset
+}
+
+// SortColumn returns the sort field, defaulting to id_no
+func (f UserFilter) SortColumn() string {
+	if f.SortBy == "" {
+		return "id_no"
+	}
+	return f.SortBy
+}
+
+// Validate rejects sort fields outside UserSortFields and inverted date ranges
+func (f UserFilter) Validate() *errors.AppError {
+	if f.SortBy != "" && !UserSortFields[f.SortBy] {
+		return errors.NewValidationError("Unknown sort field " + f.SortBy)
+	}
+	ranges := [][2]*time.Time{
+		{f.CreatedFrom, f.CreatedTo},
+		{f.UpdatedFrom, f.UpdatedTo},
+		{f.DeletedFrom, f.DeletedTo},
+	}
+	for _, r := range ranges {
+		if r[0] != nil && r[1] != nil && !r[0].Before(*r[1]) {
+			return errors.NewValidationError("Date range start must be before its end")
+		}
+	}
+	if f.Limit <= 0 || f.Offset < 0 {
+		return errors.NewValidationError("Invalid pagination")
+	}
+	if f.Cursor != nil {
+		if !KeysetSortFields[f.SortColumn()] {
+			return errors.NewValidationError("Cursor pagination only supports sorting by id_no or date_created")
+		}
+		if f.Offset != 0 {
+			return errors.NewValidationError("Use either a cursor or an offset, not both")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserFilterValidate(t *testing.T) {
+	day := func(d int) *time.Time {
+		value := time.Date(2026, 1, d, 0, 0, 0, 0, time.UTC)
+		return &value
+	}
+	cursor := &UserCursor{Key: "E100", IdNo: "E100"}
+	tests := []struct {
+		name   string
+		filter UserFilter
+		valid  bool
+	}{
+		{"defaults", UserFilter{Limit: 10}, true},
+		{"every sort field", UserFilter{Limit: 10, SortBy: "email_status", SortDesc: true}, true},
+		{"sort field outside the whitelist", UserFilter{Limit: 10, SortBy: "hashed_password"}, false},
+		{"sort field with SQL", UserFilter{Limit: 10, SortBy: "id_no; DROP TABLE users"}, false},
+		{"created range", UserFilter{Limit: 10, CreatedFrom: day(1), CreatedTo: day(2)}, true},
+		{"open-ended ranges", UserFilter{Limit: 10, UpdatedFrom: day(5), DeletedTo: day(1)}, true},
+		{"inverted created range", UserFilter{Limit: 10, CreatedFrom: day(2), CreatedTo: day(1)}, false},
+		{"empty updated range", UserFilter{Limit: 10, UpdatedFrom: day(3), UpdatedTo: day(3)}, false},
+		{"inverted deleted range", UserFilter{Limit: 10, DeletedFrom: day(9), DeletedTo: day(8)}, false},
+		{"zero limit", UserFilter{}, false},
+		{"negative offset", UserFilter{Limit: 10, Offset: -1}, false},
+		{"cursor by id_no", UserFilter{Limit: 10, Cursor: cursor}, true},
+		{"cursor by date_created", UserFilter{Limit: 10, SortBy: "date_created", Cursor: cursor}, true},
+		{"cursor by a sort without keyset support", UserFilter{Limit: 10, SortBy: "last_name", Cursor: cursor}, false},
+		{"cursor and offset", UserFilter{Limit: 10, Offset: 10, Cursor: cursor}, false},
+	}
+	for _, tt := range tests {
+		err := tt.filter.Validate()
+		if tt.valid && err != nil {
+			t.Errorf("%s: %s, want it valid", tt.name, err.Message)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: valid, want it refused", tt.name)
+		}
+	}
+}
+
+func TestSortFieldsAreColumns(t *testing.T) {
+	// Keyset sorts must be plain sort fields too, and every sort field is
+	// interpolated into ORDER BY, so none may contain anything but a name
+	for field := range KeysetSortFields {
+		if !UserSortFields[field] {
+			t.Errorf("keyset sort field %q is not a sort field", field)
+		}
+	}
+	for field := range UserSortFields {
+		for _, r := range field {
+			if (r < 'a' || r > 'z') && r != '_' {
+				t.Errorf("sort field %q is not a plain column name", field)
+				break
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/jmechavez/email-account-tracker/errors"
 	"github.com/jmechavez/email-account-tracker/internal/dto"
@@ -13,28 +14,44 @@ type NullString struct {
 }
 
 type User struct {
-	IdNo            string         `json:"id_no" db:"id_no"`
-	Department      string         `json:"department" db:"department"`
-	FirstName       string         `json:"first_name" db:"first_name"`
-	LastName        string         `json:"last_name" db:"last_name"`
-	Suffix          string         `json:"suffix" db:"suffix"`
-	Email           string         `json:"email" db:"email"`
-	EmailStatus     string         `json:"email_status" db:"email_status"`
-	Status          string         `json:"status" db:"status"`
-	TicketNo        sql.NullString `json:"ticket_no" db:"ticket_no"`
-	UpdatedTicketNo sql.NullString `json:"updated_ticket_no" db:"updated_ticket_no"`
-	DeletedTicketNo sql.NullString `json:"deleted_ticket_no" db:"deleted_ticket_no"`
-	ProfilePicture  string         `json:"profile_picture" db:"profile_picture"`
-	HashedPassword  string         `json:"hashed_password" db:"hashed_password"`
-	Salt            string         `json:"salt" db:"salt"`
-	SMTPEmail       string         `json:"smtp_email" db:"smtp_email"`
-	SMTPPassword    string         `json:"smtp_password" db:"smtp_password"`
-	DateCreated     sql.NullString `json:"date_created" db:"date_created"`
-	DateUpdated     sql.NullString `json:"date_updated" db:"date_updated"`
-	DateDeleted     sql.NullString `json:"date_deleted" db:"date_deleted"`
-	CreatedBy       string         `json:"created_by" db:"created_by"`
-	UpdatedBy       string         `json:"updated_by" db:"updated_by"`
-	DeletedBy       sql.NullString `json:"deleted_by" db:"deleted_by"`
+	IdNo             string         `json:"id_no" db:"id_no"`
+	Department       string         `json:"department" db:"department"`
+	FirstName        string         `json:"first_name" db:"first_name"`
+	LastName         string         `json:"last_name" db:"last_name"`
+	Suffix           string         `json:"suffix" db:"suffix"`
+	Email            string         `json:"email" db:"email"`
+	EmailStatus      string         `json:"email_status" db:"email_status"`
+	Status           string         `json:"status" db:"status"`
+	TicketNo         sql.NullString `json:"ticket_no" db:"ticket_no"`
+	UpdatedTicketNo  sql.NullString `json:"updated_ticket_no" db:"updated_ticket_no"`
+	DeletedTicketNo  sql.NullString `json:"deleted_ticket_no" db:"deleted_ticket_no"`
+	ProfilePicture   string         `json:"profile_picture" db:"profile_picture"`
+	HashedPassword   string         `json:"-" db:"hashed_password"`
+	Salt             string         `json:"-" db:"salt"`
+	SMTPEmail        string         `json:"smtp_email" db:"smtp_email"`
+	SMTPPassword     string         `json:"-" db:"smtp_password"`
+	DateCreated      sql.NullString `json:"date_created" db:"date_created"`
+	DateUpdated      sql.NullString `json:"date_updated" db:"date_updated"`
+	DateDeleted      sql.NullString `json:"date_deleted" db:"date_deleted"`
+	CreatedBy        string         `json:"created_by" db:"created_by"`
+	UpdatedBy        string         `json:"updated_by" db:"updated_by"`
+	DeletedBy        sql.NullString `json:"deleted_by" db:"deleted_by"`
+	DateAnonymized   sql.NullString `json:"date_anonymized" db:"date_anonymized"`
+	SuspensionReason sql.NullString `json:"suspension_reason" db:"suspension_reason"`
+	DateSuspended    sql.NullString `json:"date_suspended" db:"date_suspended"`
+	SuspendedUntil   sql.NullString `json:"suspended_until" db:"suspended_until"`
+	// MustChangePassword is set by an operator reset; the user can do nothing but change it
+	MustChangePassword  bool         `json:"must_change_password" db:"must_change_password"`
+	DatePasswordChanged sql.NullTime `json:"date_password_changed" db:"date_password_changed"`
+	// SMTPPassword is sealed with a data key wrapped by the key SMTPKeyId
+	SMTPKeyId   sql.NullString `json:"smtp_key_id" db:"smtp_key_id"`
+	SMTPDataKey sql.NullString `json:"-" db:"smtp_data_key"`
+	// SMTPVerifyStatus is the outcome of the last AUTH tried with the SMTP credentials
+	SMTPVerifyStatus sql.NullString `json:"smtp_verify_status" db:"smtp_verify_status"`
+	SMTPVerifyError  sql.NullString `json:"smtp_verify_error" db:"smtp_verify_error"`
+	SMTPDateVerified sql.NullTime   `json:"smtp_date_verified" db:"smtp_date_verified"`
+	// ManagerIdNo is told about changes to the user's mailbox
+	ManagerIdNo sql.NullString `json:"manager_id_no" db:"manager_id_no"`
 }
 
 type UserCreateReturn struct {
@@ -77,16 +94,14 @@ func (u User) ToIdDto() dto.UserIdNoEmailResponse {
 		UpdatedTicketNo: u.UpdatedTicketNo.String,
 		DeletedTicketNo: u.DeletedTicketNo.String,
 		ProfilePicture:  u.ProfilePicture,
-		HashedPassword:  u.HashedPassword,
-		Salt:            u.Salt,
 		SMTPEmail:       u.SMTPEmail,
-		SMTPPassword:    u.SMTPPassword,
 		DateCreated:     u.DateCreated.String,
 		DateUpdated:     u.DateUpdated.String,
 		DateDeleted:     u.DateDeleted.String,
 		CreatedBy:       u.CreatedBy,
 		UpdatedBy:       u.UpdatedBy,
 		DeletedBy:       u.DeletedBy.String,
+		ManagerIdNo:     u.ManagerIdNo.String,
 	}
 }
 
@@ -128,6 +143,21 @@ func (u User) ToUpdateDto() dto.UserUpdateResponse {
 		ProfilePicture:  u.ProfilePicture,
 		DateUpdated:     u.DateUpdated.String,
 		UpdatedBy:       u.UpdatedBy,
+		ManagerIdNo:     u.ManagerIdNo.String,
+	}
+}
+
+func (u User) ToSuspensionDto() dto.UserSuspensionResponse {
+	return dto.UserSuspensionResponse{
+		IdNo:             u.IdNo,
+		Status:           u.Status,
+		EmailStatus:      u.EmailStatus,
+		SuspensionReason: u.SuspensionReason.String,
+		DateSuspended:    u.DateSuspended.String,
+		SuspendedUntil:   u.SuspendedUntil.String,
+		UpdatedTicketNo:  u.UpdatedTicketNo.String,
+		DateUpdated:      u.DateUpdated.String,
+		UpdatedBy:        u.UpdatedBy,
 	}
 }
 
@@ -136,19 +166,66 @@ func (u User) ToUserCreateReturn() UserCreateReturn {
 		IdNo:      u.IdNo,
 		FirstName: u.FirstName,
 		LastName:  u.LastName,
+		Suffix:    u.Suffix,
 		Email:     u.Email,
 	}
 }
 
+// Mutating repository methods append the given event to the user history in
+// the same transaction as the change itself
 type UserRepository interface {
-	Users(limit, offset int) ([]User, *errors.AppError)
+	Users(UserFilter) (*UserPage, *errors.AppError)
 	IdNo(string) (*User, *errors.AppError)
-	CreateUser(User) (*UserCreateReturn, *errors.AppError)
-	DeleteUser(User) (*UserDeleteReturn, *errors.AppError)
-	UpdateUser(User) (*User, *errors.AppError)
-	UpdateSurname(User) (*User, *errors.AppError)
+	// Email looks a user up by primary address, ignoring case
+	Email(string) (*User, *errors.AppError)
+	CreateUser(User, UserEvent) (*UserCreateReturn, *errors.AppError)
+	DeleteUser(User, UserEvent) (*UserDeleteReturn, *errors.AppError)
+	UpdateUser(User, UserEvent) (*User, *errors.AppError)
+	// UpdateSurname saves the new surname and address, recording alias for the
+	// previous address in the same transaction when it is not nil
+	UpdateSurname(user User, alias *EmailAlias, event UserEvent) (*User, *errors.AppError)
+	// RestoreUser reactivates a soft-deleted user whose address is still free
+	RestoreUser(User, UserEvent) (*User, *errors.AppError)
+	// SuspendUser locks an active user with the suspension fields set on user
+	SuspendUser(User, UserEvent) (*User, *errors.AppError)
+	// ReactivateUser lifts the suspension of a suspended user
+	ReactivateUser(User, UserEvent) (*User, *errors.AppError)
+	// ExpiredSuspensions lists suspended users whose suspended_until has passed
+	ExpiredSuspensions(now time.Time) ([]User, *errors.AppError)
+	// EmailExists reports whether an address is used by any user other than
+	// excludeIdNo, soft-deleted users and unexpired aliases included
+	EmailExists(email, excludeIdNo string) (bool, *errors.AppError)
 }
 
 type UserAuthRepository interface {
-	CreatePassword(User) (*User, *errors.AppError)
+	CreatePassword(User, UserEvent) (*User, *errors.AppError)
+	// SetPassword replaces the hash and salt, and must_change_password, from user.
+	// Every password write uses up the user's outstanding reset tokens.
+	SetPassword(User, UserEvent) (*User, *errors.AppError)
+	CreateResetToken(PasswordResetToken) *errors.AppError
+	// ResetToken looks a reset token up by the hash of its value
+	ResetToken(tokenHash string) (*PasswordResetToken, *errors.AppError)
+	// ResetPassword uses up token and sets the password from user in one
+	// transaction; it fails with a conflict when the token was already used
+	ResetPassword(token PasswordResetToken, user User, event UserEvent) (*User, *errors.AppError)
+	// PasswordHistory returns up to limit of the user's latest password hashes, newest first
+	PasswordHistory(idNo string, limit int) ([]string, *errors.AppError)
+}
+
+// PasswordResetToken lets a user set a new password without the current one
+type PasswordResetToken struct {
+	Id          int64          `json:"id" db:"id"`
+	IdNo        string         `json:"id_no" db:"id_no"`
+	TokenHash   string         `json:"-" db:"token_hash"`
+	DateCreated sql.NullString `json:"date_created" db:"date_created"`
+	DateExpires time.Time      `json:"date_expires" db:"date_expires"`
+	DateUsed    sql.NullTime   `json:"date_used" db:"date_used"`
+}
+
+// Usable refuses used and expired reset tokens
+func (t PasswordResetToken) Usable(now time.Time) *errors.AppError {
+	if t.DateUsed.Valid || !now.Before(t.DateExpires) {
+		return errors.NewAuthenticationError("Invalid or expired reset token")
+	}
+	return nil
 }
@@ -0,0 +1,8 @@
+package dto
+
+type ApiKeyRequest struct {
+	Name        string   `json:"name"`
+	Scopes      []string `json:"scopes"`
+	Department  string   `json:"department"`   // Empty allows the scopes in every department
+	DateExpires string   `json:"date_expires"` // RFC 3339; empty never expires
+}
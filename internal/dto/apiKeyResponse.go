@@ -0,0 +1,22 @@
+package dto
+
+type ApiKeyResponse struct {
+	Id           int64    `json:"id"`
+	Name         string   `json:"name"`
+	Prefix       string   `json:"prefix"`
+	Scopes       []string `json:"scopes"`
+	Department   string   `json:"department,omitempty"`
+	DateCreated  string   `json:"date_created"`
+	CreatedBy    string   `json:"created_by"`
+	DateExpires  string   `json:"date_expires,omitempty"`
+	DateRevoked  string   `json:"date_revoked,omitempty"`
+	RevokedBy    string   `json:"revoked_by,omitempty"`
+	DateLastUsed string   `json:"date_last_used,omitempty"`
+	LastUsedIp   string   `json:"last_used_ip,omitempty"`
+}
+
+// ApiKeyCreateResponse is the only response that ever carries the key itself
+type ApiKeyCreateResponse struct {
+	ApiKeyResponse
+	Key string `json:"key"`
+}
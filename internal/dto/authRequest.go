@@ -0,0 +1,39 @@
+package dto
+
+// LoginRequest identifies the user by either id_no or email; the client
+// address is taken from the connection
+type LoginRequest struct {
+	IdNo      string `json:"id_no"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	IpAddress string `json:"-"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// LogoutRequest carries the refresh token to revoke; the access token, when
+// present, is taken from the Authorization header
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	AccessToken  string `json:"-"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// PasswordResetRequest starts a self-service reset for the user named by
+// either id_no or email
+type PasswordResetRequest struct {
+	IdNo      string `json:"id_no"`
+	Email     string `json:"email"`
+	IpAddress string `json:"-"`
+}
+
+type PasswordResetConfirmRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
@@ -0,0 +1,24 @@
+package dto
+
+// TokenResponse carries a session, or only an MFA token when the login still
+// needs the second factor
+type TokenResponse struct {
+	AccessToken      string `json:"access_token,omitempty"`
+	TokenType        string `json:"token_type,omitempty"`
+	ExpiresIn        int    `json:"expires_in,omitempty"` // Seconds until the access token expires
+	RefreshToken     string `json:"refresh_token,omitempty"`
+	RefreshExpiresIn int    `json:"refresh_expires_in,omitempty"`
+	// PasswordChangeRequired means the tokens only allow changing the password
+	PasswordChangeRequired bool `json:"password_change_required,omitempty"`
+	// MfaRequired means mfa_token must be sent to /auth/login/mfa with a code
+	MfaRequired  bool   `json:"mfa_required,omitempty"`
+	MfaToken     string `json:"mfa_token,omitempty"`
+	MfaExpiresIn int    `json:"mfa_expires_in,omitempty"`
+}
+
+// TemporaryPasswordResponse carries a password set by an operator; it is
+// shown once and must be changed at the next login
+type TemporaryPasswordResponse struct {
+	IdNo              string `json:"id_no"`
+	TemporaryPassword string `json:"temporary_password"`
+}
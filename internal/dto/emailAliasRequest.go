@@ -0,0 +1,9 @@
+package dto
+
+type EmailAliasRequest struct {
+	IdNo        string `json:"id_no"`
+	Alias       string `json:"alias"`
+	Reason      string `json:"reason"`
+	TicketNo    string `json:"ticket_no"`
+	DateExpires string `json:"date_expires"`
+}
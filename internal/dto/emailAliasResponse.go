@@ -0,0 +1,12 @@
+package dto
+
+type EmailAliasResponse struct {
+	Id          int    `json:"id"`
+	IdNo        string `json:"id_no"`
+	Alias       string `json:"alias" visibility:"pii"`
+	Reason      string `json:"reason,omitempty"`
+	TicketNo    string `json:"ticket_no,omitempty"`
+	DateExpires string `json:"date_expires,omitempty"`
+	DateCreated string `json:"date_created"`
+	CreatedBy   string `json:"created_by"`
+}
@@ -0,0 +1,12 @@
+package dto
+
+type MailDomainRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	IsDefault   *bool  `json:"is_default"`
+}
+
+type DepartmentDomainRequest struct {
+	Department string `json:"department"`
+	DomainName string `json:"domain_name"`
+}
@@ -0,0 +1,16 @@
+package dto
+
+type MailDomainResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	IsDefault   bool   `json:"is_default"`
+	DateCreated string `json:"date_created"`
+	DateUpdated string `json:"date_updated"`
+}
+
+type DepartmentDomainResponse struct {
+	Department  string `json:"department"`
+	DomainName  string `json:"domain_name"`
+	DateCreated string `json:"date_created"`
+	DateUpdated string `json:"date_updated"`
+}
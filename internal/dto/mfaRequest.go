@@ -0,0 +1,16 @@
+package dto
+
+// MfaCodeRequest proves possession of the second factor with either a TOTP
+// code or an unused recovery code
+type MfaCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// MfaLoginRequest completes a login that answered with mfa_required
+type MfaLoginRequest struct {
+	MfaToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	IpAddress    string `json:"-"`
+}
@@ -0,0 +1,18 @@
+package dto
+
+// MfaEnrollmentResponse holds everything an authenticator app needs; otpauth_uri
+// is the payload to render as a QR code, secret is for typing in by hand
+type MfaEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthUri string `json:"otpauth_uri"`
+	Issuer     string `json:"issuer"`
+	Account    string `json:"account"`
+	Algorithm  string `json:"algorithm"`
+	Digits     int    `json:"digits"`
+	Period     int    `json:"period"` // Seconds each code is valid for
+}
+
+// RecoveryCodesResponse is the only time recovery codes are shown
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
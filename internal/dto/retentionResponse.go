@@ -0,0 +1,20 @@
+package dto
+
+type RetentionCandidateResponse struct {
+	IdNo           string `json:"id_no"`
+	Department     string `json:"department"`
+	DateDeleted    string `json:"date_deleted"`
+	DateAnonymized string `json:"date_anonymized,omitempty"`
+	Action         string `json:"action"`
+}
+
+type RetentionReportResponse struct {
+	DryRun          bool                         `json:"dry_run"`
+	GeneratedAt     string                       `json:"generated_at"`
+	AnonymizeBefore string                       `json:"anonymize_before"`
+	PurgeBefore     string                       `json:"purge_before"`
+	Anonymized      int                          `json:"anonymized"`
+	Purged          int                          `json:"purged"`
+	Failed          int                          `json:"failed,omitempty"`
+	Candidates      []RetentionCandidateResponse `json:"candidates"`
+}
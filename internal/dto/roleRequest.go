@@ -0,0 +1,7 @@
+package dto
+
+type RoleAssignmentRequest struct {
+	IdNo       string `json:"id_no"`
+	Role       string `json:"role"`
+	Department string `json:"department"` // Empty grants the role in every department
+}
@@ -0,0 +1,10 @@
+package dto
+
+type RoleAssignmentResponse struct {
+	Id          int64  `json:"id"`
+	IdNo        string `json:"id_no"`
+	Role        string `json:"role"`
+	Department  string `json:"department,omitempty"`
+	DateCreated string `json:"date_created"`
+	CreatedBy   string `json:"created_by"`
+}
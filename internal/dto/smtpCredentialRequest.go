@@ -0,0 +1,16 @@
+package dto
+
+// SmtpCredentialRequest sets the SMTP login of a user
+type SmtpCredentialRequest struct {
+	IdNo         string `json:"id_no"`
+	SmtpEmail    string `json:"smtp_email"`
+	SmtpPassword string `json:"smtp_password"`
+	TicketNo     string `json:"ticket_no"`
+}
+
+// SmtpPasswordRequest rotates the SMTP password of a user and keeps the login
+type SmtpPasswordRequest struct {
+	IdNo         string `json:"id_no"`
+	SmtpPassword string `json:"smtp_password"`
+	TicketNo     string `json:"ticket_no"`
+}
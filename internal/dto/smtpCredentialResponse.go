@@ -0,0 +1,13 @@
+package dto
+
+// SmtpCredentialResponse describes the SMTP login of a user; the password is
+// never returned
+type SmtpCredentialResponse struct {
+	IdNo               string `json:"id_no"`
+	SmtpEmail          string `json:"smtp_email,omitempty" visibility:"pii"`
+	Configured         bool   `json:"configured"`
+	Encrypted          bool   `json:"encrypted"`
+	VerificationStatus string `json:"verification_status,omitempty"`
+	VerificationError  string `json:"verification_error,omitempty"`
+	DateVerified       string `json:"date_verified,omitempty"`
+}
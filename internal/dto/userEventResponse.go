@@ -0,0 +1,26 @@
+package dto
+
+type FieldChangeResponse struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+type UserEventResponse struct {
+	Id           int64                 `json:"id"`
+	IdNo         string                `json:"id_no"`
+	Action       string                `json:"action"`
+	Actor        string                `json:"actor,omitempty"`
+	TicketNo     string                `json:"ticket_no,omitempty"`
+	Changes      []FieldChangeResponse `json:"changes"`
+	DateCreated  string                `json:"date_created"`
+	DateRedacted string                `json:"date_redacted,omitempty"`
+}
+
+type UserHistoryResponse struct {
+	IdNo   string              `json:"id_no"`
+	Total  int                 `json:"total"`
+	Limit  int                 `json:"limit"`
+	Offset int                 `json:"offset"`
+	Events []UserEventResponse `json:"events"`
+}
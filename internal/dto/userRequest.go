@@ -11,13 +11,50 @@ type UserEmailRequest struct {
 	Status         string `json:"status" db:"status"`
 	TicketNo       string `json:"ticket_no" db:"ticket_no"`
 	ProfilePicture string `json:"profile_picture" db:"profile_picture"`
-	CreatedBy      string `json:"created_by" db:"created_by"`
+	ManagerIdNo    string `json:"manager_id_no" db:"manager_id_no"`
+}
+
+// UserListRequest holds the raw listing filters from the query string.
+// Dates are RFC 3339 timestamps or YYYY-MM-DD days; a day in a *To field is inclusive.
+type UserListRequest struct {
+	Department  string
+	Status      string
+	EmailStatus string
+	TicketNo    string
+	Search      string
+	CreatedFrom string
+	CreatedTo   string
+	UpdatedFrom string
+	UpdatedTo   string
+	DeletedFrom string
+	DeletedTo   string
+	Sort        string
+	Order       string
+	Cursor      string // Opaque next_cursor or prev_cursor from a previous page
+	Limit       int
+	Offset      int
 }
 
 type UserEmailDeleteRequest struct {
 	IdNo            string `json:"id_no" db:"id_no"`
 	DeletedTicketNo string `json:"deleted_ticket_no" db:"deleted_ticket_no"`
-	DeletedBy       string `json:"deleted_by" db:"deleted_by"`
+}
+
+type UserRestoreRequest struct {
+	IdNo             string `json:"id_no" db:"id_no"`
+	RestoredTicketNo string `json:"restored_ticket_no" db:"updated_ticket_no"`
+}
+
+type UserSuspendRequest struct {
+	IdNo           string `json:"id_no"`
+	Reason         string `json:"reason"`
+	TicketNo       string `json:"ticket_no"`
+	SuspendedUntil string `json:"suspended_until"`
+}
+
+type UserReactivateRequest struct {
+	IdNo     string `json:"id_no"`
+	TicketNo string `json:"ticket_no"`
 }
 
 type UserUpdateSurnameRequest struct {
@@ -26,7 +63,6 @@ type UserUpdateSurnameRequest struct {
 	LastName        string `json:"last_name" db:"last_name"`
 	Suffix          string `json:"suffix" db:"suffix"`
 	UpdatedTicketNo string `json:"updated_ticket_no" db:"updated_ticket_no"`
-	UpdatedBy       string `json:"updated_by" db:"updated_by"`
 }
 
 type UserUpdateRequest struct {
@@ -40,14 +76,12 @@ type UserUpdateRequest struct {
 	Status          string `json:"status" db:"status"`
 	UpdatedTicketNo string `json:"updated_ticket_no" db:"updated_ticket_no"`
 	ProfilePicture  string `json:"profile_picture" db:"profile_picture"`
-	UpdatedBy       string `json:"updated_by" db:"updated_by"`
+	ManagerIdNo     string `json:"manager_id_no" db:"manager_id_no"`
 }
 
 type UserPassCreateRequest struct {
-	IdNo           string `json:"id_no" db:"id_no"`
-	Password       string `json:"password"`
-	HashedPassword string `json:"hashed_password" db:"hashed_password"`
-	Salt           string `json:"salt" db:"salt"`
+	IdNo     string `json:"id_no" db:"id_no"`
+	Password string `json:"password"`
 }
 
 // func (r UserEmailRequest) Validate() *errors.AppError {
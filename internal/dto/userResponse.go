@@ -3,16 +3,15 @@ package dto
 type UserEmailResponse struct {
 	IdNo           string `json:"id_no"`
 	Department     string `json:"department"`
-	FirstName      string `json:"first_name"`
-	LastName       string `json:"last_name"`
-	Suffix         string `json:"suffix"`
-	Email          string `json:"email"`
+	FirstName      string `json:"first_name" visibility:"pii"`
+	LastName       string `json:"last_name" visibility:"pii"`
+	Suffix         string `json:"suffix" visibility:"pii"`
+	Email          string `json:"email" visibility:"pii"`
 	EmailStatus    string `json:"email_status"`
 	Status         string `json:"status"`
 	TicketNo       string `json:"ticket_no,omitempty"`
-	ProfilePicture string `json:"profile_picture,omitempty"`
-	SMTPEmail      string `json:"smtp_email,omitempty"`
-	SMTPPassword   string `json:"smtp_password,omitempty"`
+	ProfilePicture string `json:"profile_picture,omitempty" visibility:"pii"`
+	SMTPEmail      string `json:"smtp_email,omitempty" visibility:"pii"`
 	DateCreated    string `json:"date_created,omitempty"`
 	DateUpdated    string `json:"date_updated,omitempty"`
 	DateDeleted    string `json:"date_deleted,omitempty"`
@@ -24,40 +23,43 @@ type UserEmailResponse struct {
 type UserIdNoEmailResponse struct {
 	IdNo            string `json:"id_no"`
 	Department      string `json:"department"`
-	FirstName       string `json:"first_name"`
-	LastName        string `json:"last_name"`
-	Suffix          string `json:"suffix"`
-	Email           string `json:"email"`
+	FirstName       string `json:"first_name" visibility:"pii"`
+	LastName        string `json:"last_name" visibility:"pii"`
+	Suffix          string `json:"suffix" visibility:"pii"`
+	Email           string `json:"email" visibility:"pii"`
 	EmailStatus     string `json:"email_status"`
 	Status          string `json:"status"`
 	TicketNo        string `json:"ticket_no"`
 	UpdatedTicketNo string `json:"updated_ticket_no"`
 	DeletedTicketNo string `json:"deleted_ticket_no"`
-	ProfilePicture  string `json:"profile_picture,omitempty"`
-	HashedPassword  string `json:"hashed_password,omitempty"`
-	Salt            string `json:"salt,omitempty"`
-	SMTPEmail       string `json:"smtp_email,omitempty"`
-	SMTPPassword    string `json:"smtp_password,omitempty"`
+	ProfilePicture  string `json:"profile_picture,omitempty" visibility:"pii"`
+	SMTPEmail       string `json:"smtp_email,omitempty" visibility:"pii"`
 	DateCreated     string `json:"date_created"`
 	DateUpdated     string `json:"date_updated"`
 	DateDeleted     string `json:"date_deleted"`
 	CreatedBy       string `json:"created_by"`
 	UpdatedBy       string `json:"updated_by"`
 	DeletedBy       string `json:"deleted_by"`
+	ManagerIdNo     string `json:"manager_id_no,omitempty"`
 }
 
 type UserCreateResponse struct {
 	IdNo        string `json:"id_no"`
 	Department  string `json:"department"`
-	FirstName   string `json:"first_name"`
-	LastName    string `json:"last_name"`
-	Suffix      string `json:"suffix"`
-	Email       string `json:"email"`
+	FirstName   string `json:"first_name" visibility:"pii"`
+	LastName    string `json:"last_name" visibility:"pii"`
+	Suffix      string `json:"suffix" visibility:"pii"`
+	Email       string `json:"email" visibility:"pii"`
 	EmailStatus string `json:"email_status"`
 	Status      string `json:"status"`
 	TicketNo    string `json:"ticket_no"`
 	DateCreated string `json:"date_created"`
 	CreatedBy   string `json:"created_by"`
+	ManagerIdNo string `json:"manager_id_no,omitempty"`
+	// EmailStrategy names the strategy that produced Email
+	EmailStrategy string `json:"email_strategy,omitempty"`
+	// SkippedEmails lists the candidate addresses that were already taken
+	SkippedEmails []string `json:"skipped_emails,omitempty" visibility:"pii"`
 }
 
 type UserEmailDeleteResponse struct {
@@ -69,28 +71,54 @@ type UserEmailDeleteResponse struct {
 type UserUpdateResponse struct {
 	IdNo            string `json:"id_no"`
 	Department      string `json:"department"`
-	FirstName       string `json:"first_name"`
-	LastName        string `json:"last_name"`
-	Suffix          string `json:"suffix,omitempty"`
-	Email           string `json:"email"`
+	FirstName       string `json:"first_name" visibility:"pii"`
+	LastName        string `json:"last_name" visibility:"pii"`
+	Suffix          string `json:"suffix,omitempty" visibility:"pii"`
+	Email           string `json:"email" visibility:"pii"`
 	EmailStatus     string `json:"email_status"`
 	Status          string `json:"status"`
 	UpdatedTicketNo string `json:"updated_ticket_no,omitempty"`
-	ProfilePicture  string `json:"profile_picture,omitempty"`
+	ProfilePicture  string `json:"profile_picture,omitempty" visibility:"pii"`
 	DateUpdated     string `json:"date_updated"`
 	UpdatedBy       string `json:"updated_by"`
+	ManagerIdNo     string `json:"manager_id_no,omitempty"`
 }
 
 type UserUpdateSurnameResponse struct {
-	IdNo            string `json:"id_no"`
-	FirstName       string `json:"first_name"`
-	LastName        string `json:"last_name"`
-	Suffix          string `json:"suffix,omitempty"`
-	Email           string `json:"email"`
+	IdNo      string `json:"id_no"`
+	FirstName string `json:"first_name" visibility:"pii"`
+	LastName  string `json:"last_name" visibility:"pii"`
+	Suffix    string `json:"suffix,omitempty" visibility:"pii"`
+	Email     string `json:"email" visibility:"pii"`
+	// PreviousEmail is kept as an alias until AliasExpires
+	PreviousEmail string `json:"previous_email,omitempty" visibility:"pii"`
+	AliasExpires  string `json:"alias_expires,omitempty"`
 }
 
+// UserPassCreateResponse confirms a password was set; the password and its
+// hash never leave the server
 type UserPassCreateResponse struct {
-	IdNo		   string `json:"id_no"`
-	HashedPassword string `json:"hashed_password"`
-	Salt           string `json:"salt"`
+	IdNo                string `json:"id_no"`
+	DatePasswordChanged string `json:"date_password_changed"`
+}
+
+type UserSuspensionResponse struct {
+	IdNo             string `json:"id_no"`
+	Status           string `json:"status"`
+	EmailStatus      string `json:"email_status"`
+	SuspensionReason string `json:"suspension_reason,omitempty"`
+	DateSuspended    string `json:"date_suspended,omitempty"`
+	SuspendedUntil   string `json:"suspended_until,omitempty"`
+	UpdatedTicketNo  string `json:"updated_ticket_no"`
+	DateUpdated      string `json:"date_updated"`
+	UpdatedBy        string `json:"updated_by"`
+}
+
+type UserPageResponse struct {
+	Items      []UserEmailResponse `json:"items"`
+	Total      int                 `json:"total"`
+	Limit      int                 `json:"limit"`
+	Offset     int                 `json:"offset,omitempty"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+	PrevCursor string              `json:"prev_cursor,omitempty"`
 }
@@ -0,0 +1,47 @@
+package dto
+
+import "reflect"
+
+// Response fields tagged visibility:"pii" hold personal data. Callers without
+// access to the personal data of a user get RedactedValue in their place.
+// Credentials such as password hashes, salts and SMTP passwords have no
+// response field at all, so they can never be serialized.
+const (
+	visibilityTag = "visibility"
+	VisibilityPII = "pii"
+)
+
+// RedactedValue replaces personal data the caller may not see
+const RedactedValue = "[redacted]"
+
+// RedactPersonalData replaces every non-empty field tagged visibility:"pii" in
+// response, following nested structs, slices and pointers. response must be a
+// pointer so the fields can be set.
+func RedactPersonalData(response interface{}) {
+	redactValue(reflect.ValueOf(response), false)
+}
+
+func redactValue(v reflect.Value, personal bool) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			redactValue(v.Elem(), personal)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			redactValue(v.Field(i), t.Field(i).Tag.Get(visibilityTag) == VisibilityPII)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			redactValue(v.Index(i), personal)
+		}
+	case reflect.String:
+		if personal && v.CanSet() && v.String() != "" {
+			v.SetString(RedactedValue)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	operatorIdNo = "OP-1"
+	spoofedActor = "mallory"
+)
+
+// spoofedFields are sent with every request body; none of them is part of a
+// request DTO, so they must never reach the repository
+const spoofedFields = `"created_by": "mallory", "updated_by": "mallory", "deleted_by": "mallory", "actor": "mallory"`
+
+// decodeSpoofed decodes body, with the spoofed fields added, the way the
+// handlers decode request bodies
+func decodeSpoofed(t *testing.T, body string, req interface{}) {
+	t.Helper()
+	if body != "" {
+		body += ", "
+	}
+	if err := json.Unmarshal([]byte("{"+body+spoofedFields+"}"), req); err != nil {
+		t.Fatalf("decoding request: %v", err)
+	}
+}
+
+func activeUser(idNo string) domain.User {
+	return domain.User{
+		IdNo:        idNo,
+		Department:  "IT",
+		FirstName:   "Ana",
+		LastName:    "Reyes",
+		Email:       "ana.reyes@example.com",
+		Status:      domain.StatusActive,
+		EmailStatus: domain.EmailStatusActive,
+		CreatedBy:   "someone-else",
+		UpdatedBy:   "someone-else",
+	}
+}
+
+// storedActors lists every actor column of a written user that was filled in
+func storedActors(user domain.User) map[string]string {
+	actors := map[string]string{}
+	if user.CreatedBy != "" {
+		actors["created_by"] = user.CreatedBy
+	}
+	if user.UpdatedBy != "" {
+		actors["updated_by"] = user.UpdatedBy
+	}
+	if user.DeletedBy.Valid {
+		actors["deleted_by"] = user.DeletedBy.String
+	}
+	return actors
+}
+
+// checkActor asserts that the only write was made, and recorded, by want
+func checkActor(t *testing.T, writes []domain.User, events []domain.UserEvent, column, want string) {
+	t.Helper()
+	if len(writes) != 1 || len(events) != 1 {
+		t.Fatalf("got %d writes and %d events, want 1 of each", len(writes), len(events))
+	}
+	actors := storedActors(writes[0])
+	if _, ok := actors[column]; !ok {
+		t.Errorf("%s was not set, want %q", column, want)
+	}
+	for column, got := range actors {
+		if got == spoofedActor {
+			t.Errorf("%s = %q, taken from the request body", column, got)
+		}
+	}
+	if got := actors[column]; got != want {
+		t.Errorf("%s = %q, want %q", column, got, want)
+	}
+	if got := events[0].Actor.String; got != want {
+		t.Errorf("event actor = %q, want %q", got, want)
+	}
+}
+
+func TestUserServiceRecordsPrincipalAsActor(t *testing.T) {
+	deleted := activeUser("E200")
+	deleted.Status = domain.StatusDeleted
+	deleted.EmailStatus = domain.EmailStatusDeleted
+	suspended := activeUser("E300")
+	suspended.Status = domain.StatusSuspended
+	suspended.Email = "ana.reyes2@example.com"
+
+	tests := []struct {
+		name   string
+		column string
+		call   func(ctx context.Context, s DefaultUserService) *errors.AppError
+	}{
+		{
+			name:   "CreateUser",
+			column: "created_by",
+			call: func(ctx context.Context, s DefaultUserService) *errors.AppError {
+				var req dto.UserEmailRequest
+				decodeSpoofed(t, `"id_no": "E900", "department": "IT", "first_name": "José", "last_name": "Núñez", "ticket_no": "T-1"`, &req)
+				_, err := s.CreateUser(ctx, req)
+				return err
+			},
+		},
+		{
+			name:   "UpdateUser",
+			column: "updated_by",
+			call: func(ctx context.Context, s DefaultUserService) *errors.AppError {
+				var req dto.UserUpdateRequest
+				decodeSpoofed(t, `"id_no": "E100", "profile_picture": "me.png", "updated_ticket_no": "T-2"`, &req)
+				_, err := s.UpdateUser(ctx, req)
+				return err
+			},
+		},
+		{
+			name:   "UpdateSurname",
+			column: "updated_by",
+			call: func(ctx context.Context, s DefaultUserService) *errors.AppError {
+				var req dto.UserUpdateSurnameRequest
+				decodeSpoofed(t, `"id_no": "E100", "last_name": "Cruz", "updated_ticket_no": "T-3"`, &req)
+				_, err := s.UpdateSurname(ctx, req)
+				return err
+			},
+		},
+		{
+			name:   "DeleteUser",
+			column: "deleted_by",
+			call: func(ctx context.Context, s DefaultUserService) *errors.AppError {
+				var req dto.UserEmailDeleteRequest
+				decodeSpoofed(t, `"id_no": "E100", "deleted_ticket_no": "T-4"`, &req)
+				_, err := s.DeleteUser(ctx, req)
+				return err
+			},
+		},
+		{
+			name:   "RestoreUser",
+			column: "updated_by",
+			call: func(ctx context.Context, s DefaultUserService) *errors.AppError {
+				var req dto.UserRestoreRequest
+				decodeSpoofed(t, `"id_no": "E200", "restored_ticket_no": "T-5"`, &req)
+				_, err := s.RestoreUser(ctx, req)
+				return err
+			},
+		},
+		{
+			name:   "SuspendUser",
+			column: "updated_by",
+			call: func(ctx context.Context, s DefaultUserService) *errors.AppError {
+				var req dto.UserSuspendRequest
+				decodeSpoofed(t, `"id_no": "E100", "reason": "Investigation", "ticket_no": "T-6"`, &req)
+				_, err := s.SuspendUser(ctx, req)
+				return err
+			},
+		},
+		{
+			name:   "ReactivateUser",
+			column: "updated_by",
+			call: func(ctx context.Context, s DefaultUserService) *errors.AppError {
+				var req dto.UserReactivateRequest
+				decodeSpoofed(t, `"id_no": "E300", "ticket_no": "T-7"`, &req)
+				_, err := s.ReactivateUser(ctx, req)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeUserRepository(activeUser("E100"), deleted, suspended)
+			service := NewUserService(repo, fakeMailDomains{}, nil, 30*24*time.Hour, silentNotifier{})
+
+			if err := tt.call(adminCtx(operatorIdNo), service); err != nil {
+				t.Fatalf("call failed: %s", err.Message)
+			}
+			checkActor(t, repo.writes, repo.events, tt.column, operatorIdNo)
+		})
+	}
+}
+
+func TestUserAuthServiceRecordsPrincipalAsActor(t *testing.T) {
+	const currentPassword = "Current-Passw0rd!"
+	hash, err := bcrypt.GenerateFromPassword([]byte(currentPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withPassword := activeUser("E100")
+	withPassword.HashedPassword = string(hash)
+	withPassword.Salt = "salt"
+	withoutPassword := activeUser("E200")
+	withoutPassword.Email = "ana.reyes2@example.com"
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string // Actor expected in updated_by and the history
+		call func(ctx context.Context, s DefaultUserAuthService, repo *fakeUserAuthRepository) *errors.AppError
+	}{
+		{
+			name: "CreatePassword",
+			ctx:  adminCtx(operatorIdNo),
+			want: operatorIdNo,
+			call: func(ctx context.Context, s DefaultUserAuthService, _ *fakeUserAuthRepository) *errors.AppError {
+				var req dto.UserPassCreateRequest
+				decodeSpoofed(t, `"id_no": "E200", "password": "New-Passw0rd!"`, &req)
+				_, err := s.CreatePassword(ctx, req)
+				return err
+			},
+		},
+		{
+			name: "ChangePassword",
+			ctx:  domain.WithPrincipal(context.Background(), domain.Principal{IdNo: "E100"}),
+			want: "E100",
+			call: func(ctx context.Context, s DefaultUserAuthService, _ *fakeUserAuthRepository) *errors.AppError {
+				var req dto.ChangePasswordRequest
+				decodeSpoofed(t, `"id_no": "E200", "current_password": "`+currentPassword+`", "new_password": "New-Passw0rd!"`, &req)
+				return s.ChangePassword(ctx, req)
+			},
+		},
+		{
+			name: "ResetPassword",
+			ctx:  adminCtx(operatorIdNo),
+			want: operatorIdNo,
+			call: func(ctx context.Context, s DefaultUserAuthService, _ *fakeUserAuthRepository) *errors.AppError {
+				_, err := s.ResetPassword(ctx, "E100")
+				return err
+			},
+		},
+		{
+			// Nobody is signed in; the token names the user acting
+			name: "ConfirmPasswordReset",
+			ctx:  context.Background(),
+			want: "E100",
+			call: func(_ context.Context, s DefaultUserAuthService, repo *fakeUserAuthRepository) *errors.AppError {
+				repo.CreateResetToken(domain.PasswordResetToken{
+					IdNo:        "E100",
+					TokenHash:   hashToken("reset-token"),
+					DateExpires: time.Now().Add(time.Hour),
+				})
+				var req dto.PasswordResetConfirmRequest
+				decodeSpoofed(t, `"id_no": "E200", "token": "reset-token", "new_password": "New-Passw0rd!"`, &req)
+				return s.ConfirmPasswordReset(req)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeUserAuthRepository()
+			users := newFakeUserRepository(withPassword, withoutPassword)
+			throttle := NewLoginThrottle(newFakeLoginAttempts(), 5, 50, 15*time.Minute, time.Second)
+			service := NewUserAuthService(repo, users, &fakeSessions{}, fakeRoles{}, TokenSigner{}, time.Hour, time.Hour,
+				LogPasswordResetNotifier{}, PasswordPolicy{}, throttle, nil, TOTP{}, nil)
+
+			if err := tt.call(tt.ctx, service, repo); err != nil {
+				t.Fatalf("call failed: %s", err.Message)
+			}
+			checkActor(t, repo.writes, repo.events, "updated_by", tt.want)
+		})
+	}
+}
+
+// The spoofed fields are not silently accepted by any request either
+func TestRequestsHaveNoActorFields(t *testing.T) {
+	requests := []interface{}{
+		dto.UserEmailRequest{}, dto.UserUpdateRequest{}, dto.UserUpdateSurnameRequest{},
+		dto.UserEmailDeleteRequest{}, dto.UserRestoreRequest{}, dto.UserSuspendRequest{},
+		dto.UserReactivateRequest{}, dto.UserPassCreateRequest{}, dto.ChangePasswordRequest{},
+		dto.PasswordResetConfirmRequest{},
+	}
+	for _, req := range requests {
+		encoded, err := json.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(encoded, &fields); err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range []string{"created_by", "updated_by", "deleted_by", "actor"} {
+			if _, ok := fields[field]; ok {
+				t.Errorf("%T accepts %s from the client", req, field)
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+// apiKeyPrefixLength is how much of a key is kept in clear to tell keys apart
+const apiKeyPrefixLength = len(domain.ApiKeyPrefix) + 8
+
+// ApiKeyService defines the interface for managing and checking API keys
+type ApiKeyService interface {
+	ApiKeys(ctx context.Context) ([]dto.ApiKeyResponse, *errors.AppError)
+	CreateApiKey(ctx context.Context, req dto.ApiKeyRequest) (*dto.ApiKeyCreateResponse, *errors.AppError)
+	RevokeApiKey(ctx context.Context, keyId string) *errors.AppError
+	// Authenticate resolves an API key to a principal, recording the use from ip
+	Authenticate(key, ip string) (*domain.Principal, *errors.AppError)
+}
+
+// DefaultApiKeyService is the default implementation of ApiKeyService
+type DefaultApiKeyService struct {
+	repo domain.ApiKeyRepository
+}
+
+func (s DefaultApiKeyService) ApiKeys(ctx context.Context) ([]dto.ApiKeyResponse, *errors.AppError) {
+	if err := authorize(ctx, domain.PermissionManageApiKeys, ""); err != nil {
+		return nil, err
+	}
+
+	k, err := s.repo.ApiKeys()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]dto.ApiKeyResponse, 0, len(k))
+	for _, key := range k {
+		keys = append(keys, key.ToDto())
+	}
+	return keys, nil
+}
+
+func (s DefaultApiKeyService) CreateApiKey(ctx context.Context, req dto.ApiKeyRequest) (*dto.ApiKeyCreateResponse, *errors.AppError) {
+	if err := authorize(ctx, domain.PermissionManageApiKeys, ""); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.NewValidationError("Name is required")
+	}
+
+	scopes := make(domain.ApiKeyScopes, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		scopes = append(scopes, domain.Permission(strings.TrimSpace(scope)))
+	}
+
+	// Validate the optional expiry
+	var expires sql.NullTime
+	if req.DateExpires != "" {
+		expiresAt, parseErr := time.Parse(time.RFC3339, req.DateExpires)
+		if parseErr != nil {
+			return nil, errors.NewValidationError("date_expires must be an RFC 3339 timestamp")
+		}
+		if !expiresAt.After(time.Now()) {
+			return nil, errors.NewValidationError("date_expires must be in the future")
+		}
+		expires = sql.NullTime{Time: expiresAt, Valid: true}
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	key := domain.ApiKeyPrefix + secret
+
+	apiKey := domain.ApiKey{
+		Name:        name,
+		Prefix:      key[:apiKeyPrefixLength],
+		KeyHash:     hashToken(key),
+		Scopes:      scopes,
+		Department:  nullString(strings.TrimSpace(req.Department)),
+		CreatedBy:   actor(ctx),
+		DateExpires: expires,
+	}
+	if err := apiKey.Validate(); err != nil {
+		return nil, err
+	}
+
+	created, err := s.repo.CreateApiKey(apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("API key %s (%s) created by %s", created.Name, created.Prefix, created.CreatedBy)
+	return &dto.ApiKeyCreateResponse{
+		ApiKeyResponse: created.ToDto(),
+		Key:            key,
+	}, nil
+}
+
+func (s DefaultApiKeyService) RevokeApiKey(ctx context.Context, keyId string) *errors.AppError {
+	if err := authorize(ctx, domain.PermissionManageApiKeys, ""); err != nil {
+		return err
+	}
+	id, convErr := strconv.ParseInt(keyId, 10, 64)
+	if convErr != nil {
+		return errors.NewBadRequestError("Invalid API key ID")
+	}
+
+	revoked, err := s.repo.RevokeApiKey(id, actor(ctx))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("API key %s (%s) revoked by %s", revoked.Name, revoked.Prefix, revoked.RevokedBy.String)
+	return nil
+}
+
+func (s DefaultApiKeyService) Authenticate(key, ip string) (*domain.Principal, *errors.AppError) {
+	if !strings.HasPrefix(key, domain.ApiKeyPrefix) {
+		return nil, errors.NewAuthenticationError("Invalid API key")
+	}
+
+	apiKey, err := s.repo.ApiKeyByHash(hashToken(key))
+	if err != nil {
+		if errors.IsNotFoundError(err) {
+			return nil, errors.NewAuthenticationError("Invalid API key")
+		}
+		return nil, err
+	}
+	if err := apiKey.Usable(time.Now()); err != nil {
+		return nil, err
+	}
+
+	// Usage is audit data; failing to record it must not lock automation out
+	if err := s.repo.RecordUsage(apiKey.Id, ip); err != nil {
+		log.Printf("Could not record use of API key %s: %s", apiKey.Prefix, err.Message)
+	}
+
+	principal := &domain.Principal{
+		IdNo:     apiKey.Actor(),
+		ApiKeyId: apiKey.Id,
+		Grants:   []domain.Grant{apiKey.Grant()},
+	}
+	if apiKey.DateExpires.Valid {
+		principal.ExpiresAt = apiKey.DateExpires.Time
+	}
+	return principal, nil
+}
+
+// NewApiKeyService creates a new instance of DefaultApiKeyService
+func NewApiKeyService(repository domain.ApiKeyRepository) DefaultApiKeyService {
+	return DefaultApiKeyService{repository}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+)
+
+// authorize checks that the caller in ctx holds permission over department.
+// Operations not tied to one department pass an empty department, which only
+// roles granted in every department cover.
+func authorize(ctx context.Context, permission domain.Permission, department string) *errors.AppError {
+	principal, ok := domain.PrincipalFrom(ctx)
+	if !ok {
+		return errors.NewAuthenticationError("Authentication required")
+	}
+	return principal.Authorize(permission, department)
+}
+
+// actor returns the id_no of the caller in ctx. Mutations record it in the
+// *_by columns and the history instead of any name supplied by the client.
+func actor(ctx context.Context) string {
+	principal, _ := domain.PrincipalFrom(ctx)
+	return principal.IdNo
+}
+
+// authorizeAnywhere checks that the caller in ctx holds permission in at least
+// one department, for reads of data that does not belong to a department
+func authorizeAnywhere(ctx context.Context, permission domain.Permission) *errors.AppError {
+	_, err := departmentScope(ctx, permission)
+	return err
+}
+
+// departmentScope returns the departments the caller in ctx may use permission
+// in, or nil when it is not limited to any
+func departmentScope(ctx context.Context, permission domain.Permission) ([]string, *errors.AppError) {
+	principal, ok := domain.PrincipalFrom(ctx)
+	if !ok {
+		return nil, errors.NewAuthenticationError("Authentication required")
+	}
+	departments, all := principal.Departments(permission)
+	if all {
+		return nil, nil
+	}
+	if len(departments) == 0 {
+		return nil, principal.Authorize(permission, "")
+	}
+	return departments, nil
+}
+
+// signedInUser returns the caller in ctx when it is a user acting for
+// themselves; API keys have no account of their own to manage
+func signedInUser(ctx context.Context) (domain.Principal, *errors.AppError) {
+	principal, ok := domain.PrincipalFrom(ctx)
+	if !ok || principal.ApiKeyId != 0 {
+		return domain.Principal{}, errors.NewAuthenticationError("Only a signed-in user can manage their own account")
+	}
+	return principal, nil
+}
+
+// authorizeTakeover checks that the caller in ctx holds every permission the
+// roles of user idNo grant. Operations that hand the caller a way into another
+// account, such as resetting its password or second factor, require it so
+// they cannot be used to gain privileges.
+func authorizeTakeover(ctx context.Context, roles domain.RoleRepository, idNo string) *errors.AppError {
+	principal, ok := domain.PrincipalFrom(ctx)
+	if !ok {
+		return errors.NewAuthenticationError("Authentication required")
+	}
+	assignments, err := roles.Roles(idNo)
+	if err != nil {
+		return err
+	}
+	for _, assignment := range assignments {
+		if !principal.Covers(assignment.Grant()) {
+			return errors.NewAuthorizationError(fmt.Sprintf("Not allowed to manage the credentials of a user with the %s role", assignment))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+// scopedCtx signs in idNo with role limited to department
+func scopedCtx(idNo, role, department string) context.Context {
+	grant := domain.RoleAssignment{IdNo: idNo, Role: role, Department: sql.NullString{String: department, Valid: true}}.Grant()
+	return domain.WithPrincipal(context.Background(), domain.Principal{IdNo: idNo, Grants: []domain.Grant{grant}})
+}
+
+func TestCredentialResetsCannotEscalatePrivileges(t *testing.T) {
+	itOnly := sql.NullString{String: "IT", Valid: true}
+	roles := fakeRoles{
+		{IdNo: "ADM", Role: domain.RoleAdmin},
+		{IdNo: "HR1", Role: domain.RoleHR, Department: itOnly},
+		{IdNo: "HD1", Role: domain.RoleHelpdesk},
+		{IdNo: "VW1", Role: domain.RoleViewer, Department: itOnly},
+	}
+
+	cases := []struct {
+		name    string
+		ctx     context.Context
+		target  string
+		allowed bool
+	}{
+		{"helpdesk resets an admin", principalCtx("HD2", domain.RoleHelpdesk), "ADM", false},
+		{"helpdesk resets hr", principalCtx("HD2", domain.RoleHelpdesk), "HR1", false},
+		{"department helpdesk resets a global helpdesk", scopedCtx("HD2", domain.RoleHelpdesk, "IT"), "HD1", false},
+		{"helpdesk resets a global helpdesk", principalCtx("HD2", domain.RoleHelpdesk), "HD1", true},
+		{"department helpdesk resets a viewer", scopedCtx("HD2", domain.RoleHelpdesk, "IT"), "VW1", true},
+		{"helpdesk resets a user without roles", principalCtx("HD2", domain.RoleHelpdesk), "E100", true},
+		{"admin resets an admin", adminCtx("ADM2"), "ADM", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			users := newFakeUserRepository(activeUser(c.target))
+			auth := newFakeUserAuthRepository()
+			service := NewUserAuthService(auth, users, &fakeSessions{}, roles, TokenSigner{}, time.Hour, time.Hour,
+				LogPasswordResetNotifier{}, PasswordPolicy{}, LoginThrottle{}, nil, TOTP{}, nil)
+
+			_, err := service.ResetPassword(c.ctx, c.target)
+			checkTakeover(t, "ResetPassword", err, c.allowed)
+			if !c.allowed && len(auth.writes) != 0 {
+				t.Errorf("ResetPassword wrote %d passwords, want none", len(auth.writes))
+			}
+
+			mfa := newFakeMfaRepository(domain.MfaEnrollment{IdNo: c.target})
+			err = NewMfaService(mfa, users, roles, TOTP{}, fakeSealer{}).ResetMfa(c.ctx, c.target)
+			checkTakeover(t, "ResetMfa", err, c.allowed)
+			if _, enrolled := mfa.enrollments[c.target]; enrolled == c.allowed {
+				t.Errorf("enrollment kept = %v after ResetMfa, want %v", enrolled, !c.allowed)
+			}
+		})
+	}
+}
+
+func TestFirstPasswordOfAnOperatorNeedsItsPermissions(t *testing.T) {
+	pending := activeUser("ADM")
+	pending.Status = domain.StatusPending
+	roles := fakeRoles{{IdNo: "ADM", Role: domain.RoleAdmin}}
+	auth := newFakeUserAuthRepository()
+	service := NewUserAuthService(auth, newFakeUserRepository(pending), &fakeSessions{}, roles, TokenSigner{}, time.Hour, time.Hour,
+		LogPasswordResetNotifier{}, PasswordPolicy{}, LoginThrottle{}, nil, TOTP{}, nil)
+
+	req := dto.UserPassCreateRequest{IdNo: "ADM", Password: "First-Passw0rd!"}
+	_, err := service.CreatePassword(principalCtx("HD1", domain.RoleHelpdesk), req)
+	checkTakeover(t, "CreatePassword", err, false)
+	if len(auth.writes) != 0 {
+		t.Errorf("CreatePassword wrote %d passwords, want none", len(auth.writes))
+	}
+}
+
+func checkTakeover(t *testing.T, operation string, err *errors.AppError, allowed bool) {
+	t.Helper()
+	if allowed && err != nil {
+		t.Errorf("%s: %s, want it allowed", operation, err.Message)
+	}
+	if !allowed && (err == nil || !errors.IsAuthorizationError(err)) {
+		t.Errorf("%s = %v, want an authorization error", operation, err)
+	}
+}
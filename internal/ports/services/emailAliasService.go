@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+// EmailAliasService defines the interface for managing a user's email aliases
+type EmailAliasService interface {
+	Aliases(ctx context.Context, idNo string) ([]dto.EmailAliasResponse, *errors.AppError)
+	CreateAlias(ctx context.Context, req dto.EmailAliasRequest) (*dto.EmailAliasResponse, *errors.AppError)
+	DeleteAlias(ctx context.Context, idNo, aliasId string) *errors.AppError
+}
+
+// DefaultEmailAliasService is the default implementation of EmailAliasService
+type DefaultEmailAliasService struct {
+	repo    domain.EmailAliasRepository
+	urepo   domain.UserRepository       // Repository for user data
+	domains domain.MailDomainRepository // Aliases must live under a registered domain
+}
+
+func (s DefaultEmailAliasService) Aliases(ctx context.Context, idNo string) ([]dto.EmailAliasResponse, *errors.AppError) {
+	// Make sure the user exists so an unknown ID is not reported as "no aliases"
+	user, err := s.urepo.IdNo(idNo)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, domain.PermissionReadUsers, user.Department); err != nil {
+		return nil, err
+	}
+
+	a, err := s.repo.Aliases(idNo)
+	if err != nil {
+		return nil, err
+	}
+	aliases := make([]dto.EmailAliasResponse, 0, len(a))
+	for _, alias := range a {
+		aliases = append(aliases, alias.ToDto())
+	}
+	shape(ctx, user.Department, &aliases)
+	return aliases, nil
+}
+
+func (s DefaultEmailAliasService) CreateAlias(ctx context.Context, req dto.EmailAliasRequest) (*dto.EmailAliasResponse, *errors.AppError) {
+	user, err := s.urepo.IdNo(req.IdNo)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, domain.PermissionManageAliases, user.Department); err != nil {
+		return nil, err
+	}
+
+	// Validate the address and its domain
+	address := strings.ToLower(strings.TrimSpace(req.Alias))
+	localPart, domainName, found := strings.Cut(address, "@")
+	if !found || !validEmailAddress(localPart, domainName) {
+		return nil, errors.NewValidationError("Invalid alias address")
+	}
+	if _, err := s.domains.Domain(domainName); err != nil {
+		if errors.IsNotFoundError(err) {
+			return nil, errors.NewValidationError("Alias domain is not a registered mail domain")
+		}
+		return nil, err
+	}
+
+	// Validate the optional expiry
+	var expires sql.NullString
+	if req.DateExpires != "" {
+		expiresAt, parseErr := time.Parse(time.RFC3339, req.DateExpires)
+		if parseErr != nil {
+			return nil, errors.NewValidationError("date_expires must be an RFC 3339 timestamp")
+		}
+		if !expiresAt.After(time.Now()) {
+			return nil, errors.NewValidationError("date_expires must be in the future")
+		}
+		expires = sql.NullString{String: expiresAt.Format(time.RFC3339), Valid: true}
+	}
+
+	// The address must not belong to anyone, the user itself included
+	exists, err := s.urepo.EmailExists(address, "")
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, errors.NewConflictError("Email address is already in use")
+	}
+
+	created, err := s.repo.CreateAlias(domain.EmailAlias{
+		IdNo:        user.IdNo,
+		Alias:       address,
+		Reason:      sql.NullString{String: req.Reason, Valid: req.Reason != ""},
+		TicketNo:    sql.NullString{String: req.TicketNo, Valid: req.TicketNo != ""},
+		DateExpires: expires,
+		CreatedBy:   actor(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Alias %s created for user with ID %s", created.Alias, created.IdNo)
+	response := created.ToDto()
+	shape(ctx, user.Department, &response)
+	return &response, nil
+}
+
+func (s DefaultEmailAliasService) DeleteAlias(ctx context.Context, idNo, aliasId string) *errors.AppError {
+	id, convErr := strconv.Atoi(aliasId)
+	if convErr != nil {
+		return errors.NewBadRequestError("Invalid alias ID")
+	}
+
+	user, err := s.urepo.IdNo(idNo)
+	if err != nil {
+		return err
+	}
+	if err := authorize(ctx, domain.PermissionManageAliases, user.Department); err != nil {
+		return err
+	}
+	return s.repo.DeleteAlias(idNo, id)
+}
+
+// NewEmailAliasService creates a new instance of DefaultEmailAliasService
+func NewEmailAliasService(
+	aliasRepo domain.EmailAliasRepository,
+	userRepo domain.UserRepository,
+	domainRepo domain.MailDomainRepository,
+) DefaultEmailAliasService {
+	return DefaultEmailAliasService{
+		repo:    aliasRepo,
+		urepo:   userRepo,
+		domains: domainRepo,
+	}
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+)
+
+// maxNumberedCandidates bounds how many numbered variants are tried
+const maxNumberedCandidates = 99
+
+// Names of the built-in email strategies
+const (
+	StrategyFirstLast         = "first.last"
+	StrategyFirstMiddleLast   = "first.m.last"
+	StrategyInitialLast       = "f.last"
+	StrategyNumberedFirstLast = "first.lastN"
+)
+
+// DefaultEmailStrategies is the order strategies are tried when none is configured
+var DefaultEmailStrategies = []string{
+	StrategyFirstLast,
+	StrategyFirstMiddleLast,
+	StrategyInitialLast,
+	StrategyNumberedFirstLast,
+}
+
+// emailName holds the normalized parts of a user's name used to build addresses
+type emailName struct {
+	First       string   // Full first name with word breaks removed
+	FirstTokens []string // First name split into words
+	Last        string
+	Suffix      string
+}
+
+// EmailStrategy builds candidate local parts for a name, in order of preference
+type EmailStrategy struct {
+	Name       string
+	Candidates func(name emailName) []string
+}
+
+// generatedEmail is the outcome of generateEmail
+type generatedEmail struct {
+	Address  string   // The chosen email address
+	Strategy string   // Name of the strategy that produced the address
+	Skipped  []string // Candidates that were already taken
+}
+
+var emailStrategies = map[string]EmailStrategy{
+	StrategyFirstLast: {
+		Name: StrategyFirstLast,
+		Candidates: func(n emailName) []string {
+			return []string{fmt.Sprintf("%s.%s%s", n.First, n.Last, n.Suffix)}
+		},
+	},
+	StrategyFirstMiddleLast: {
+		Name: StrategyFirstMiddleLast,
+		Candidates: func(n emailName) []string {
+			// Only applies when the first name carries a middle name
+			if len(n.FirstTokens) < 2 {
+				return nil
+			}
+			return []string{fmt.Sprintf("%s.%s.%s%s", n.FirstTokens[0], initial(n.FirstTokens[1]), n.Last, n.Suffix)}
+		},
+	},
+	StrategyInitialLast: {
+		Name: StrategyInitialLast,
+		Candidates: func(n emailName) []string {
+			return []string{fmt.Sprintf("%s.%s%s", initial(n.First), n.Last, n.Suffix)}
+		},
+	},
+	StrategyNumberedFirstLast: {
+		Name: StrategyNumberedFirstLast,
+		Candidates: func(n emailName) []string {
+			candidates := make([]string, 0, maxNumberedCandidates-1)
+			for i := 2; i <= maxNumberedCandidates; i++ {
+				candidates = append(candidates, fmt.Sprintf("%s.%s%s%d", n.First, n.Last, n.Suffix, i))
+			}
+			return candidates
+		},
+	},
+}
+
+// initial returns the first letter of word. Names reaching the strategies are
+// already ASCII, but a whole rune keeps a multi-byte letter from being split
+func initial(word string) string {
+	_, size := utf8.DecodeRuneInString(word)
+	return word[:size]
+}
+
+// EmailStrategiesByName resolves strategy names into strategies, keeping their order
+func EmailStrategiesByName(names []string) ([]EmailStrategy, *errors.AppError) {
+	if len(names) == 0 {
+		names = DefaultEmailStrategies
+	}
+
+	strategies := make([]EmailStrategy, 0, len(names))
+	for _, name := range names {
+		strategy, ok := emailStrategies[name]
+		if !ok {
+			return nil, errors.NewValidationError(fmt.Sprintf("Unknown email strategy %q", name))
+		}
+		strategies = append(strategies, strategy)
+	}
+	return strategies, nil
+}
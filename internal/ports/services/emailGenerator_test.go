@@ -0,0 +1,55 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestEmailStrategyCandidates(t *testing.T) {
+	name, err := newEmailName("Mary Ann", "de la Cruz", "Jr.")
+	if err != nil {
+		t.Fatalf("newEmailName: %s", err.Message)
+	}
+
+	tests := map[string][]string{
+		StrategyFirstLast:       {"maryann.delacruzjr"},
+		StrategyFirstMiddleLast: {"mary.a.delacruzjr"},
+		StrategyInitialLast:     {"m.delacruzjr"},
+	}
+	for strategy, want := range tests {
+		if got := emailStrategies[strategy].Candidates(name); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s candidates = %q, want %q", strategy, got, want)
+		}
+	}
+
+	numbered := emailStrategies[StrategyNumberedFirstLast].Candidates(name)
+	if len(numbered) != maxNumberedCandidates-1 || numbered[0] != "maryann.delacruzjr2" || numbered[len(numbered)-1] != "maryann.delacruzjr99" {
+		t.Errorf("numbered candidates run from %q to %q, want maryann.delacruzjr2 to maryann.delacruzjr99", numbered[0], numbered[len(numbered)-1])
+	}
+
+	single, _ := newEmailName("Ana", "Reyes", "")
+	if got := emailStrategies[StrategyFirstMiddleLast].Candidates(single); got != nil {
+		t.Errorf("first.m.last candidates without a middle name = %q, want none", got)
+	}
+}
+
+func TestInitialsKeepWholeLetters(t *testing.T) {
+	// Initials are taken by rune, so a name that skipped normalization yields
+	// a letter the address check refuses rather than half of one
+	name := emailName{First: "émile", FirstTokens: []string{"ana", "łucja"}, Last: "reyes"}
+
+	for _, strategy := range []string{StrategyFirstMiddleLast, StrategyInitialLast} {
+		for _, candidate := range emailStrategies[strategy].Candidates(name) {
+			if !utf8.ValidString(candidate) {
+				t.Errorf("%s candidate %q is not valid UTF-8", strategy, candidate)
+			}
+			if validEmailAddress(candidate, "example.com") {
+				t.Errorf("%s candidate %q passed the address check", strategy, candidate)
+			}
+		}
+	}
+	if got := initial("łucja"); got != "ł" {
+		t.Errorf("initial(%q) = %q, want %q", "łucja", got, "ł")
+	}
+}
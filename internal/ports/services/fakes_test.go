@@ -0,0 +1,528 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+)
+
+// adminCtx signs in idNo as an admin of every department
+func adminCtx(idNo string) context.Context {
+	return principalCtx(idNo, domain.RoleAdmin)
+}
+
+// principalCtx signs in idNo with role in every department; only admin and
+// department-wide roles are needed by the tests
+func principalCtx(idNo, role string) context.Context {
+	grant := domain.RoleAssignment{IdNo: idNo, Role: role}.Grant()
+	return domain.WithPrincipal(context.Background(), domain.Principal{IdNo: idNo, Grants: []domain.Grant{grant}})
+}
+
+// fakeUserRepository keeps users in memory and remembers every write
+type fakeUserRepository struct {
+	users  map[string]domain.User
+	writes []domain.User
+	events []domain.UserEvent
+}
+
+func newFakeUserRepository(users ...domain.User) *fakeUserRepository {
+	repo := &fakeUserRepository{users: map[string]domain.User{}}
+	for _, user := range users {
+		repo.users[user.IdNo] = user
+	}
+	return repo
+}
+
+func (r *fakeUserRepository) write(user domain.User, event domain.UserEvent) *domain.User {
+	r.writes = append(r.writes, user)
+	r.events = append(r.events, event)
+	r.users[user.IdNo] = user
+	return &user
+}
+
+func (r *fakeUserRepository) Users(domain.UserFilter) (*domain.UserPage, *errors.AppError) {
+	return &domain.UserPage{}, nil
+}
+
+func (r *fakeUserRepository) IdNo(idNo string) (*domain.User, *errors.AppError) {
+	user, ok := r.users[idNo]
+	if !ok {
+		return nil, errors.NewNotFoundError("User not found")
+	}
+	return &user, nil
+}
+
+func (r *fakeUserRepository) Email(email string) (*domain.User, *errors.AppError) {
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, email) {
+			return &user, nil
+		}
+	}
+	return nil, errors.NewNotFoundError("User not found")
+}
+
+func (r *fakeUserRepository) CreateUser(user domain.User, event domain.UserEvent) (*domain.UserCreateReturn, *errors.AppError) {
+	created := r.write(user, event).ToUserCreateReturn()
+	return &created, nil
+}
+
+func (r *fakeUserRepository) DeleteUser(user domain.User, event domain.UserEvent) (*domain.UserDeleteReturn, *errors.AppError) {
+	r.write(user, event)
+	return &domain.UserDeleteReturn{IdNo: user.IdNo, Status: domain.StatusDeleted, EmailStatus: domain.EmailStatusDeleted}, nil
+}
+
+func (r *fakeUserRepository) UpdateUser(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	return r.write(user, event), nil
+}
+
+func (r *fakeUserRepository) UpdateSurname(user domain.User, alias *domain.EmailAlias, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	return r.write(user, event), nil
+}
+
+func (r *fakeUserRepository) RestoreUser(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	return r.write(user, event), nil
+}
+
+func (r *fakeUserRepository) SuspendUser(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	return r.write(user, event), nil
+}
+
+func (r *fakeUserRepository) ReactivateUser(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	return r.write(user, event), nil
+}
+
+func (r *fakeUserRepository) ExpiredSuspensions(time.Time) ([]domain.User, *errors.AppError) {
+	return nil, nil
+}
+
+func (r *fakeUserRepository) EmailExists(email, excludeIdNo string) (bool, *errors.AppError) {
+	for _, user := range r.users {
+		if user.Email == email && user.IdNo != excludeIdNo {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// fakeMailDomains routes every department to example.com
+type fakeMailDomains struct{}
+
+func (fakeMailDomains) Domains() ([]domain.MailDomain, *errors.AppError) { return nil, nil }
+func (fakeMailDomains) Domain(string) (*domain.MailDomain, *errors.AppError) {
+	return nil, errors.NewNotFoundError("Mail domain not found")
+}
+func (fakeMailDomains) CreateDomain(d domain.MailDomain) (*domain.MailDomain, *errors.AppError) {
+	return &d, nil
+}
+func (fakeMailDomains) UpdateDomain(d domain.MailDomain) (*domain.MailDomain, *errors.AppError) {
+	return &d, nil
+}
+func (fakeMailDomains) DeleteDomain(string) *errors.AppError { return nil }
+func (fakeMailDomains) DepartmentRules() ([]domain.DepartmentDomain, *errors.AppError) {
+	return nil, nil
+}
+func (fakeMailDomains) SetDepartmentRule(d domain.DepartmentDomain) (*domain.DepartmentDomain, *errors.AppError) {
+	return &d, nil
+}
+func (fakeMailDomains) DeleteDepartmentRule(string) *errors.AppError { return nil }
+func (fakeMailDomains) DomainForDepartment(string) (*domain.MailDomain, *errors.AppError) {
+	return &domain.MailDomain{Name: "example.com", IsDefault: true}, nil
+}
+
+// silentNotifier drops every notification
+type silentNotifier struct{}
+
+func (silentNotifier) UserCreated(domain.User)                    {}
+func (silentNotifier) AddressChanged(domain.User, string, string) {}
+
+// fakeUserAuthRepository remembers every password write
+type fakeUserAuthRepository struct {
+	writes []domain.User
+	events []domain.UserEvent
+	tokens map[string]domain.PasswordResetToken
+}
+
+func newFakeUserAuthRepository() *fakeUserAuthRepository {
+	return &fakeUserAuthRepository{tokens: map[string]domain.PasswordResetToken{}}
+}
+
+func (r *fakeUserAuthRepository) CreatePassword(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	r.writes = append(r.writes, user)
+	r.events = append(r.events, event)
+	return &user, nil
+}
+
+func (r *fakeUserAuthRepository) SetPassword(user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	return r.CreatePassword(user, event)
+}
+
+func (r *fakeUserAuthRepository) CreateResetToken(token domain.PasswordResetToken) *errors.AppError {
+	r.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (r *fakeUserAuthRepository) ResetToken(tokenHash string) (*domain.PasswordResetToken, *errors.AppError) {
+	token, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, errors.NewNotFoundError("Reset token not found")
+	}
+	return &token, nil
+}
+
+func (r *fakeUserAuthRepository) ResetPassword(token domain.PasswordResetToken, user domain.User, event domain.UserEvent) (*domain.User, *errors.AppError) {
+	if token.DateUsed.Valid {
+		return nil, errors.NewConflictError("Reset token already used")
+	}
+	token.DateUsed.Valid = true
+	r.tokens[token.TokenHash] = token
+	return r.CreatePassword(user, event)
+}
+
+func (r *fakeUserAuthRepository) PasswordHistory(string, int) ([]string, *errors.AppError) {
+	return nil, nil
+}
+
+// fakeSessions accepts every session change
+type fakeSessions struct {
+	revokedUsers []string
+}
+
+func (s *fakeSessions) CreateRefreshToken(domain.RefreshToken) *errors.AppError { return nil }
+func (s *fakeSessions) RefreshToken(string) (*domain.RefreshToken, *errors.AppError) {
+	return nil, errors.NewNotFoundError("Refresh token not found")
+}
+func (s *fakeSessions) RotateRefreshToken(domain.RefreshToken, domain.RefreshToken) *errors.AppError {
+	return nil
+}
+func (s *fakeSessions) RevokeTokenFamily(string) *errors.AppError { return nil }
+func (s *fakeSessions) RevokeUserTokens(idNo string) *errors.AppError {
+	s.revokedUsers = append(s.revokedUsers, idNo)
+	return nil
+}
+func (s *fakeSessions) RevokeAccessToken(string, time.Time) *errors.AppError { return nil }
+func (s *fakeSessions) IsAccessTokenRevoked(string) (bool, *errors.AppError) {
+	return false, nil
+}
+
+// fakeRoles holds a fixed set of assignments; fakeRoles{} grants nothing
+type fakeRoles []domain.RoleAssignment
+
+func (r fakeRoles) Roles(idNo string) ([]domain.RoleAssignment, *errors.AppError) {
+	var roles []domain.RoleAssignment
+	for _, role := range r {
+		if role.IdNo == idNo {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+func (fakeRoles) GrantRole(role domain.RoleAssignment, _ domain.UserEvent) (*domain.RoleAssignment, *errors.AppError) {
+	return &role, nil
+}
+func (fakeRoles) RevokeRole(string, int64, domain.UserEvent) (*domain.RoleAssignment, *errors.AppError) {
+	return nil, errors.NewNotFoundError("Role not found")
+}
+
+// fakeLoginAttempts counts failures in memory
+type fakeLoginAttempts struct {
+	attempts map[string]domain.LoginAttempt
+	resets   []string
+}
+
+func newFakeLoginAttempts() *fakeLoginAttempts {
+	return &fakeLoginAttempts{attempts: map[string]domain.LoginAttempt{}}
+}
+
+func (s *fakeLoginAttempts) LoginAttempt(key string) (domain.LoginAttempt, *errors.AppError) {
+	return s.attempts[key], nil
+}
+
+func (s *fakeLoginAttempts) RecordLoginFailure(key string, _ time.Duration) (domain.LoginAttempt, *errors.AppError) {
+	attempt := s.attempts[key]
+	attempt.Key = key
+	attempt.Failures++
+	attempt.DateLastFailure = time.Now()
+	s.attempts[key] = attempt
+	return attempt, nil
+}
+
+func (s *fakeLoginAttempts) ResetLoginAttempts(key string) *errors.AppError {
+	delete(s.attempts, key)
+	s.resets = append(s.resets, key)
+	return nil
+}
+
+// fakeClock is a Clock stopped at now
+type fakeClock struct {
+	now time.Time
+}
+
+func (c fakeClock) Now() time.Time { return c.now }
+
+// fakeSealer "encrypts" with base64 and keeps the associated data as the data
+// key, so opening with the wrong owner fails like the real keyring does
+type fakeSealer struct {
+	keyId string
+}
+
+func (s fakeSealer) ActiveKeyId() string { return s.keyId }
+
+func (s fakeSealer) Seal(plaintext []byte, associated string) (*domain.SealedSecret, *errors.AppError) {
+	if s.keyId == "" {
+		return nil, errors.NewUnExpectedError("No credential encryption key is configured")
+	}
+	return &domain.SealedSecret{
+		KeyId:      s.keyId,
+		DataKey:    associated,
+		Ciphertext: base64.StdEncoding.EncodeToString(plaintext),
+	}, nil
+}
+
+func (s fakeSealer) Open(secret domain.SealedSecret, associated string) ([]byte, *errors.AppError) {
+	plaintext, err := base64.StdEncoding.DecodeString(secret.Ciphertext)
+	if err != nil || secret.DataKey != associated {
+		return nil, errors.NewUnExpectedError("Error decrypting credentials")
+	}
+	return plaintext, nil
+}
+
+func (s fakeSealer) Rewrap(secret domain.SealedSecret) (*domain.SealedSecret, *errors.AppError) {
+	secret.KeyId = s.keyId
+	return &secret, nil
+}
+
+// fakeMfaRepository keeps enrollments and recovery codes in memory
+type fakeMfaRepository struct {
+	enrollments map[string]domain.MfaEnrollment
+	codes       []domain.RecoveryCode
+	challenges  map[string]domain.MfaChallenge
+	events      []domain.UserEvent
+}
+
+func newFakeMfaRepository(enrollments ...domain.MfaEnrollment) *fakeMfaRepository {
+	repo := &fakeMfaRepository{
+		enrollments: map[string]domain.MfaEnrollment{},
+		challenges:  map[string]domain.MfaChallenge{},
+	}
+	for _, enrollment := range enrollments {
+		repo.enrollments[enrollment.IdNo] = enrollment
+	}
+	return repo
+}
+
+func (r *fakeMfaRepository) Enrollment(idNo string) (*domain.MfaEnrollment, *errors.AppError) {
+	enrollment, ok := r.enrollments[idNo]
+	if !ok {
+		return nil, errors.NewNotFoundError("MFA is not enrolled")
+	}
+	return &enrollment, nil
+}
+
+func (r *fakeMfaRepository) StartEnrollment(enrollment domain.MfaEnrollment) *errors.AppError {
+	if current, ok := r.enrollments[enrollment.IdNo]; ok && current.Active() {
+		return errors.NewConflictError("MFA is already enabled")
+	}
+	r.enrollments[enrollment.IdNo] = enrollment
+	return nil
+}
+
+func (r *fakeMfaRepository) ConfirmEnrollment(idNo string, step int64, codeHashes []string, event domain.UserEvent) *errors.AppError {
+	enrollment := r.enrollments[idNo]
+	enrollment.DateConfirmed = sql.NullTime{Time: time.Now(), Valid: true}
+	enrollment.LastUsedStep = step
+	r.enrollments[idNo] = enrollment
+	return r.ReplaceRecoveryCodes(idNo, codeHashes, event)
+}
+
+func (r *fakeMfaRepository) DeleteEnrollment(idNo string, event domain.UserEvent) *errors.AppError {
+	delete(r.enrollments, idNo)
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *fakeMfaRepository) StaleEnrollments(activeKeyId, afterIdNo string, limit int) ([]domain.MfaEnrollment, *errors.AppError) {
+	stale := []domain.MfaEnrollment{}
+	for _, enrollment := range r.enrollments {
+		if enrollment.KeyId.String != activeKeyId && enrollment.IdNo > afterIdNo && len(stale) < limit {
+			stale = append(stale, enrollment)
+		}
+	}
+	return stale, nil
+}
+
+func (r *fakeMfaRepository) ReplaceSecret(current, next domain.MfaEnrollment) *errors.AppError {
+	if r.enrollments[current.IdNo].Secret != current.Secret {
+		return errors.NewConflictError("MFA secret changed in the meantime")
+	}
+	r.enrollments[current.IdNo] = next
+	return nil
+}
+
+func (r *fakeMfaRepository) UseStep(idNo string, step int64) *errors.AppError {
+	enrollment := r.enrollments[idNo]
+	if step <= enrollment.LastUsedStep {
+		return errors.NewConflictError("MFA code already used")
+	}
+	enrollment.LastUsedStep = step
+	r.enrollments[idNo] = enrollment
+	return nil
+}
+
+func (r *fakeMfaRepository) RecoveryCodes(idNo string) ([]domain.RecoveryCode, *errors.AppError) {
+	unused := []domain.RecoveryCode{}
+	for _, code := range r.codes {
+		if code.IdNo == idNo && !code.DateUsed.Valid {
+			unused = append(unused, code)
+		}
+	}
+	return unused, nil
+}
+
+func (r *fakeMfaRepository) UseRecoveryCode(id int64) *errors.AppError {
+	for i, code := range r.codes {
+		if code.Id == id {
+			if code.DateUsed.Valid {
+				return errors.NewConflictError("Recovery code already used")
+			}
+			r.codes[i].DateUsed = sql.NullTime{Time: time.Now(), Valid: true}
+			return nil
+		}
+	}
+	return errors.NewNotFoundError("Recovery code not found")
+}
+
+func (r *fakeMfaRepository) ReplaceRecoveryCodes(idNo string, codeHashes []string, event domain.UserEvent) *errors.AppError {
+	kept := []domain.RecoveryCode{}
+	for _, code := range r.codes {
+		if code.IdNo != idNo {
+			kept = append(kept, code)
+		}
+	}
+	for _, hash := range codeHashes {
+		kept = append(kept, domain.RecoveryCode{Id: int64(len(kept) + 1), IdNo: idNo, CodeHash: hash})
+	}
+	r.codes = kept
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *fakeMfaRepository) CreateChallenge(challenge domain.MfaChallenge) *errors.AppError {
+	r.challenges[challenge.TokenHash] = challenge
+	return nil
+}
+
+func (r *fakeMfaRepository) Challenge(tokenHash string) (*domain.MfaChallenge, *errors.AppError) {
+	challenge, ok := r.challenges[tokenHash]
+	if !ok {
+		return nil, errors.NewNotFoundError("MFA challenge not found")
+	}
+	return &challenge, nil
+}
+
+func (r *fakeMfaRepository) UseChallenge(id int64) *errors.AppError {
+	for hash, challenge := range r.challenges {
+		if challenge.Id == id {
+			if challenge.DateUsed.Valid {
+				return errors.NewConflictError("MFA challenge already used")
+			}
+			challenge.DateUsed = sql.NullTime{Time: time.Now(), Valid: true}
+			r.challenges[hash] = challenge
+			return nil
+		}
+	}
+	return errors.NewNotFoundError("MFA challenge not found")
+}
+
+// fakeRenderer renders every event as a message naming the event and the user
+type fakeRenderer struct{}
+
+func (fakeRenderer) Render(event string, data domain.NotificationData) (*domain.Message, *errors.AppError) {
+	return &domain.Message{Event: event, Subject: event, Text: data.IdNo + " " + data.ResetToken}, nil
+}
+
+// recordingSender keeps every message handed to it
+type recordingSender struct {
+	sent []domain.Message
+}
+
+func (s *recordingSender) Send(message domain.Message) *errors.AppError {
+	s.sent = append(s.sent, message)
+	return nil
+}
+
+// fakeOutboxRepository keeps outbox events in memory; events are due until
+// they are delivered or their retry is in the future of now
+type fakeOutboxRepository struct {
+	events []domain.DomainEvent
+	now    time.Time
+}
+
+func (r *fakeOutboxRepository) ClaimEvents(limit int, lease time.Duration) ([]domain.DomainEvent, *errors.AppError) {
+	claimed := []domain.DomainEvent{}
+	for i, event := range r.events {
+		if len(claimed) == limit {
+			break
+		}
+		if event.DateDelivered.Valid || event.DateNextAttempt.After(r.now) {
+			continue
+		}
+		r.events[i].DateNextAttempt = r.now.Add(lease)
+		claimed = append(claimed, r.events[i])
+	}
+	return claimed, nil
+}
+
+func (r *fakeOutboxRepository) MarkDelivered(id int64) *errors.AppError {
+	for i := range r.events {
+		if r.events[i].Id == id {
+			r.events[i].Attempts++
+			r.events[i].DateDelivered = sql.NullTime{Time: r.now, Valid: true}
+		}
+	}
+	return nil
+}
+
+func (r *fakeOutboxRepository) MarkFailed(id int64, reason string, retryAt time.Time) *errors.AppError {
+	for i := range r.events {
+		if r.events[i].Id == id {
+			r.events[i].Attempts++
+			r.events[i].LastError = sql.NullString{String: reason, Valid: true}
+			r.events[i].DateNextAttempt = retryAt
+		}
+	}
+	return nil
+}
+
+func (r *fakeOutboxRepository) PruneDelivered(before time.Time) (int64, *errors.AppError) {
+	kept := r.events[:0]
+	for _, event := range r.events {
+		if !event.DateDelivered.Valid || !event.DateDelivered.Time.Before(before) {
+			kept = append(kept, event)
+		}
+	}
+	pruned := int64(len(r.events) - len(kept))
+	r.events = kept
+	return pruned, nil
+}
+
+// recordingSink remembers the events published to it and refuses them while
+// failing is set
+type recordingSink struct {
+	published []domain.DomainEvent
+	failing   bool
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) Publish(event domain.DomainEvent) *errors.AppError {
+	if s.failing {
+		return errors.NewUnExpectedError("sink unavailable")
+	}
+	s.published = append(s.published, event)
+	return nil
+}
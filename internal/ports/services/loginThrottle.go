@@ -0,0 +1,143 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+)
+
+// LoginThrottle slows down and then locks out repeated failed logins, both for
+// a login identity and for the client address trying it. After each failure the
+// next attempt must wait twice as long as the last, up to a lockout once the
+// failure limit is reached. Failures older than the lockout are forgotten.
+type LoginThrottle struct {
+	store         domain.LoginAttemptStore
+	maxFailures   int           // Failures of one identity before it is locked out
+	maxIpFailures int           // Failures from one address before it is locked out
+	lockout       time.Duration // How long a lockout lasts after the last failure
+	delay         time.Duration // Wait after the first failure, doubled after each one
+}
+
+// Allow refuses a login for identity from ip that comes too soon after failures
+func (t LoginThrottle) Allow(ip, identity string) *errors.AppError {
+	return t.check(t.limits(ip, identity), "Too many failed login attempts, try again later")
+}
+
+// Failed counts a failed login for identity from ip
+func (t LoginThrottle) Failed(ip, identity string) *errors.AppError {
+	return t.record(t.limits(ip, identity))
+}
+
+// AllowResetRequest refuses a password reset request for identity from ip
+// that comes too soon after earlier ones, and counts it otherwise. Every
+// request counts, under keys of its own, so reset requests neither lock out
+// logins nor are cleared by them.
+func (t LoginThrottle) AllowResetRequest(ip, identity string) *errors.AppError {
+	limits := map[string]int{}
+	for key, limit := range t.limits(ip, identity) {
+		limits["reset:"+key] = limit
+	}
+	if err := t.check(limits, "Too many password reset requests, try again later"); err != nil {
+		return err
+	}
+	return t.record(limits)
+}
+
+// check refuses with message while any of the counters in limits holds the
+// next attempt back
+func (t LoginThrottle) check(limits map[string]int, message string) *errors.AppError {
+	now := time.Now()
+	var retryAt time.Time
+
+	for key, limit := range limits {
+		attempt, err := t.store.LoginAttempt(key)
+		if err != nil {
+			return err
+		}
+		if next := t.nextAttempt(attempt, limit); next.After(retryAt) {
+			retryAt = next
+		}
+	}
+
+	if retryAt.After(now) {
+		return errors.NewTooManyRequestsErrorRetryAfter(message, retryAt.Sub(now))
+	}
+	return nil
+}
+
+// record counts a failure on every counter in limits
+func (t LoginThrottle) record(limits map[string]int) *errors.AppError {
+	for key := range limits {
+		if _, err := t.store.RecordLoginFailure(key, t.lockout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Succeeded clears the failures of identity. The address keeps its failures so
+// signing into one account does not help guessing the password of another.
+func (t LoginThrottle) Succeeded(identity string) *errors.AppError {
+	return t.store.ResetLoginAttempts(identity)
+}
+
+// Unlock clears the failures of user
+func (t LoginThrottle) Unlock(user domain.User) *errors.AppError {
+	return t.store.ResetLoginAttempts(userIdentity(user.IdNo))
+}
+
+// limits pairs each counter key of a login with its failure limit
+func (t LoginThrottle) limits(ip, identity string) map[string]int {
+	limits := map[string]int{identity: t.maxFailures}
+	if ip != "" {
+		limits["ip:"+ip] = t.maxIpFailures
+	}
+	return limits
+}
+
+// nextAttempt is the earliest time another login is allowed after attempt
+func (t LoginThrottle) nextAttempt(attempt domain.LoginAttempt, limit int) time.Time {
+	if attempt.Failures == 0 {
+		return time.Time{}
+	}
+	if attempt.Failures >= limit {
+		return attempt.DateLastFailure.Add(t.lockout)
+	}
+
+	wait := t.delay
+	for i := 1; i < attempt.Failures && wait < t.lockout; i++ {
+		wait *= 2
+	}
+	if wait > t.lockout {
+		wait = t.lockout
+	}
+	return attempt.DateLastFailure.Add(wait)
+}
+
+// userIdentity is the counter key of a known user, shared by logins with their
+// id_no and with their address so neither doubles the failure limit
+func userIdentity(idNo string) string {
+	return "user:" + idNo
+}
+
+// unknownIdentity is the counter key of a login naming no user. These are
+// counted too, so lockouts do not reveal which users exist.
+func unknownIdentity(idNo, email string) string {
+	if idNo != "" {
+		return "id:" + idNo
+	}
+	return "email:" + strings.ToLower(email)
+}
+
+// NewLoginThrottle creates a LoginThrottle over store
+func NewLoginThrottle(store domain.LoginAttemptStore, maxFailures, maxIpFailures int, lockout, delay time.Duration) LoginThrottle {
+	return LoginThrottle{
+		store:         store,
+		maxFailures:   maxFailures,
+		maxIpFailures: maxIpFailures,
+		lockout:       lockout,
+		delay:         delay,
+	}
+}
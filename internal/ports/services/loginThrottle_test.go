@@ -0,0 +1,131 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newThrottledAuthService(t *testing.T, attempts *fakeLoginAttempts) DefaultUserAuthService {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("Right-Passw0rd!"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := activeUser("E100")
+	user.HashedPassword = string(hash)
+	user.Salt = "salt"
+
+	// Two failures lock an identity out; the first one barely delays the next try
+	throttle := NewLoginThrottle(attempts, 2, 100, time.Hour, time.Nanosecond)
+	return NewUserAuthService(newFakeUserAuthRepository(), newFakeUserRepository(user), &fakeSessions{}, fakeRoles{},
+		TokenSigner{}, time.Hour, time.Hour, LogPasswordResetNotifier{}, PasswordPolicy{}, throttle, nil, TOTP{}, nil)
+}
+
+func isThrottled(err *errors.AppError) bool {
+	return err != nil && err.Code == http.StatusTooManyRequests
+}
+
+func TestLoginFailuresCountPerUser(t *testing.T) {
+	attempts := newFakeLoginAttempts()
+	service := newThrottledAuthService(t, attempts)
+
+	// One failure by id_no and one by address, in any case, exhaust the same limit
+	for _, req := range []dto.LoginRequest{
+		{IdNo: "E100", Password: "wrong"},
+		{Email: "ANA.REYES@example.com", Password: "wrong"},
+	} {
+		time.Sleep(time.Millisecond)
+		if _, err := service.Login(req); !errors.IsAuthenticationError(err) {
+			t.Fatalf("Login(%+v) = %v, want invalid credentials", req, err)
+		}
+	}
+	if got := attempts.attempts[userIdentity("E100")].Failures; got != 2 {
+		t.Fatalf("user counter has %d failures, want 2", got)
+	}
+
+	if _, err := service.Login(dto.LoginRequest{IdNo: "E100", Password: "Right-Passw0rd!"}); !isThrottled(err) {
+		t.Fatalf("login after two failures = %v, want a lockout", err)
+	}
+
+	// An operator unlock clears the one counter the user has
+	if err := service.throttle.Unlock(activeUser("E100")); err != nil {
+		t.Fatal(err.Message)
+	}
+	if len(attempts.resets) != 1 || attempts.resets[0] != userIdentity("E100") {
+		t.Fatalf("Unlock reset %v, want only %s", attempts.resets, userIdentity("E100"))
+	}
+	if _, err := service.Login(dto.LoginRequest{Email: "ana.reyes@example.com", Password: "wrong"}); !errors.IsAuthenticationError(err) {
+		t.Fatalf("login after unlock = %v, want invalid credentials", err)
+	}
+}
+
+func TestLoginFailuresOfUnknownIdentitiesAreCounted(t *testing.T) {
+	attempts := newFakeLoginAttempts()
+	service := newThrottledAuthService(t, attempts)
+
+	for i := 0; i < 2; i++ {
+		time.Sleep(time.Millisecond)
+		if _, err := service.Login(dto.LoginRequest{Email: "Nobody@example.com", Password: "wrong"}); !errors.IsAuthenticationError(err) {
+			t.Fatalf("failure %d = %v, want invalid credentials", i+1, err)
+		}
+	}
+	if got := attempts.attempts[unknownIdentity("", "nobody@example.com")].Failures; got != 2 {
+		t.Fatalf("unknown identity has %d failures, want 2", got)
+	}
+	if _, err := service.Login(dto.LoginRequest{Email: "nobody@example.com", Password: "wrong"}); !isThrottled(err) {
+		t.Fatalf("third login = %v, want a lockout like a known user gets", err)
+	}
+	if _, ok := attempts.attempts[userIdentity("E100")]; ok {
+		t.Error("failures of an unknown identity were counted against a user")
+	}
+}
+
+func TestPasswordResetRequestsAreThrottled(t *testing.T) {
+	attempts := newFakeLoginAttempts()
+	service := newThrottledAuthService(t, attempts)
+	tokens := service.repo.(*fakeUserAuthRepository).tokens
+
+	// Requests by id_no and by address count against the same user
+	for _, req := range []dto.PasswordResetRequest{
+		{IdNo: "E100", IpAddress: "192.0.2.1"},
+		{Email: "ANA.REYES@example.com", IpAddress: "192.0.2.1"},
+	} {
+		time.Sleep(time.Millisecond)
+		if err := service.RequestPasswordReset(req); err != nil {
+			t.Fatalf("RequestPasswordReset(%+v) = %s", req, err.Message)
+		}
+	}
+	if err := service.RequestPasswordReset(dto.PasswordResetRequest{IdNo: "E100", IpAddress: "198.51.100.7"}); !isThrottled(err) {
+		t.Fatalf("third request = %v, want it throttled from any address", err)
+	}
+	if len(tokens) != 2 {
+		t.Errorf("%d reset tokens issued, want 2", len(tokens))
+	}
+	if got := attempts.attempts["reset:ip:192.0.2.1"].Failures; got != 2 {
+		t.Errorf("address counter has %d requests, want 2", got)
+	}
+
+	// Reset requests stay apart from the login counters
+	if _, ok := attempts.attempts[userIdentity("E100")]; ok {
+		t.Error("reset requests were counted as failed logins")
+	}
+}
+
+func TestPasswordResetRequestsForUnknownUsersAreThrottled(t *testing.T) {
+	service := newThrottledAuthService(t, newFakeLoginAttempts())
+
+	for i := 0; i < 2; i++ {
+		time.Sleep(time.Millisecond)
+		if err := service.RequestPasswordReset(dto.PasswordResetRequest{Email: "nobody@example.com"}); err != nil {
+			t.Fatalf("request %d = %s, want it accepted like a known user's", i+1, err.Message)
+		}
+	}
+	if err := service.RequestPasswordReset(dto.PasswordResetRequest{Email: "nobody@example.com"}); !isThrottled(err) {
+		t.Fatalf("third request = %v, want it throttled like a known user's", err)
+	}
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+// domainNamePattern accepts dot separated DNS labels such as corp.example.com
+var domainNamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// MailDomainService defines the interface for managing mail domains and department routing
+type MailDomainService interface {
+	Domains(ctx context.Context) ([]dto.MailDomainResponse, *errors.AppError)
+	Domain(ctx context.Context, name string) (*dto.MailDomainResponse, *errors.AppError)
+	CreateDomain(ctx context.Context, req dto.MailDomainRequest) (*dto.MailDomainResponse, *errors.AppError)
+	UpdateDomain(ctx context.Context, req dto.MailDomainRequest) (*dto.MailDomainResponse, *errors.AppError)
+	DeleteDomain(ctx context.Context, name string) *errors.AppError
+	DepartmentRules(ctx context.Context) ([]dto.DepartmentDomainResponse, *errors.AppError)
+	SetDepartmentRule(ctx context.Context, req dto.DepartmentDomainRequest) (*dto.DepartmentDomainResponse, *errors.AppError)
+	DeleteDepartmentRule(ctx context.Context, department string) *errors.AppError
+}
+
+// DefaultMailDomainService is the default implementation of MailDomainService
+type DefaultMailDomainService struct {
+	repo domain.MailDomainRepository
+}
+
+func (s DefaultMailDomainService) Domains(ctx context.Context) ([]dto.MailDomainResponse, *errors.AppError) {
+	if err := authorizeAnywhere(ctx, domain.PermissionReadDomains); err != nil {
+		return nil, err
+	}
+
+	d, err := s.repo.Domains()
+	if err != nil {
+		return nil, err
+	}
+	domains := make([]dto.MailDomainResponse, 0, len(d))
+	for _, mailDomain := range d {
+		domains = append(domains, mailDomain.ToDto())
+	}
+	return domains, nil
+}
+
+func (s DefaultMailDomainService) Domain(ctx context.Context, name string) (*dto.MailDomainResponse, *errors.AppError) {
+	if err := authorizeAnywhere(ctx, domain.PermissionReadDomains); err != nil {
+		return nil, err
+	}
+
+	d, err := s.repo.Domain(normalizeDomainName(name))
+	if err != nil {
+		return nil, err
+	}
+	response := d.ToDto()
+	return &response, nil
+}
+
+func (s DefaultMailDomainService) CreateDomain(ctx context.Context, req dto.MailDomainRequest) (*dto.MailDomainResponse, *errors.AppError) {
+	if err := authorize(ctx, domain.PermissionManageDomains, ""); err != nil {
+		return nil, err
+	}
+
+	name := normalizeDomainName(req.Name)
+	if !domainNamePattern.MatchString(name) {
+		return nil, errors.NewValidationError("Invalid mail domain name")
+	}
+
+	mailDomain := domain.MailDomain{
+		Name:        name,
+		Description: nullString(req.Description),
+		IsDefault:   req.IsDefault != nil && *req.IsDefault,
+	}
+
+	created, err := s.repo.CreateDomain(mailDomain)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Mail domain %s created successfully", created.Name)
+	response := created.ToDto()
+	return &response, nil
+}
+
+func (s DefaultMailDomainService) UpdateDomain(ctx context.Context, req dto.MailDomainRequest) (*dto.MailDomainResponse, *errors.AppError) {
+	if err := authorize(ctx, domain.PermissionManageDomains, ""); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.Domain(normalizeDomainName(req.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	// Only update fields that are provided
+	if req.Description != "" {
+		existing.Description = nullString(req.Description)
+	}
+	if req.IsDefault != nil {
+		// The default can only be moved, never removed, so there is always a fallback domain
+		if existing.IsDefault && !*req.IsDefault {
+			return nil, errors.NewConflictError("Mark another domain as default instead")
+		}
+		existing.IsDefault = *req.IsDefault
+	}
+
+	updated, err := s.repo.UpdateDomain(*existing)
+	if err != nil {
+		return nil, err
+	}
+	response := updated.ToDto()
+	return &response, nil
+}
+
+func (s DefaultMailDomainService) DeleteDomain(ctx context.Context, name string) *errors.AppError {
+	if err := authorize(ctx, domain.PermissionManageDomains, ""); err != nil {
+		return err
+	}
+	return s.repo.DeleteDomain(normalizeDomainName(name))
+}
+
+func (s DefaultMailDomainService) DepartmentRules(ctx context.Context) ([]dto.DepartmentDomainResponse, *errors.AppError) {
+	if err := authorizeAnywhere(ctx, domain.PermissionReadDomains); err != nil {
+		return nil, err
+	}
+
+	r, err := s.repo.DepartmentRules()
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]dto.DepartmentDomainResponse, 0, len(r))
+	for _, rule := range r {
+		rules = append(rules, rule.ToDto())
+	}
+	return rules, nil
+}
+
+func (s DefaultMailDomainService) SetDepartmentRule(ctx context.Context, req dto.DepartmentDomainRequest) (*dto.DepartmentDomainResponse, *errors.AppError) {
+	if err := authorize(ctx, domain.PermissionManageDomains, ""); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(req.Department) == "" {
+		return nil, errors.NewValidationError("Department is required")
+	}
+	if req.DomainName == "" {
+		return nil, errors.NewValidationError("Domain name is required")
+	}
+
+	rule, err := s.repo.SetDepartmentRule(domain.DepartmentDomain{
+		Department: normalizeDepartment(req.Department),
+		DomainName: normalizeDomainName(req.DomainName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	response := rule.ToDto()
+	return &response, nil
+}
+
+func (s DefaultMailDomainService) DeleteDepartmentRule(ctx context.Context, department string) *errors.AppError {
+	if err := authorize(ctx, domain.PermissionManageDomains, ""); err != nil {
+		return err
+	}
+	return s.repo.DeleteDepartmentRule(normalizeDepartment(department))
+}
+
+// normalizeDomainName lowercases a domain and strips surrounding whitespace and a leading @
+func normalizeDomainName(name string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "@")
+}
+
+// normalizeDepartment lowercases a department and strips surrounding
+// whitespace, so departments that differ only in case share one rule
+func normalizeDepartment(department string) string {
+	return strings.ToLower(strings.TrimSpace(department))
+}
+
+// nullString wraps a string as a sql.NullString that is valid when non-empty
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// NewMailDomainService creates a new instance of DefaultMailDomainService
+func NewMailDomainService(repository domain.MailDomainRepository) DefaultMailDomainService {
+	return DefaultMailDomainService{repository}
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+// recordingMailDomains remembers the departments rules are set and deleted for
+type recordingMailDomains struct {
+	fakeMailDomains
+	set, deleted []string
+}
+
+func (r *recordingMailDomains) SetDepartmentRule(rule domain.DepartmentDomain) (*domain.DepartmentDomain, *errors.AppError) {
+	r.set = append(r.set, rule.Department)
+	return &rule, nil
+}
+
+func (r *recordingMailDomains) DeleteDepartmentRule(department string) *errors.AppError {
+	r.deleted = append(r.deleted, department)
+	return nil
+}
+
+func TestDepartmentRulesIgnoreCase(t *testing.T) {
+	repo := &recordingMailDomains{}
+	service := NewMailDomainService(repo)
+
+	for _, department := range []string{"Sales", " SALES ", "sales"} {
+		rule, err := service.SetDepartmentRule(adminCtx(operatorIdNo), dto.DepartmentDomainRequest{Department: department, DomainName: "Sales.Example.com"})
+		if err != nil {
+			t.Fatalf("SetDepartmentRule(%q): %s", department, err.Message)
+		}
+		if rule.Department != "sales" || rule.DomainName != "sales.example.com" {
+			t.Errorf("rule = %+v, want department and domain in lower case", rule)
+		}
+	}
+	if err := service.DeleteDepartmentRule(adminCtx(operatorIdNo), "  Sales"); err != nil {
+		t.Fatal(err.Message)
+	}
+
+	for _, department := range append(repo.set, repo.deleted...) {
+		if department != "sales" {
+			t.Errorf("repository was given department %q, want %q", department, "sales")
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// recoveryCodeCount is how many recovery codes a user gets at a time
+const recoveryCodeCount = 10
+
+// recoveryCodeAlphabet avoids characters that are easy to misread
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// MfaService manages the TOTP second factor of signed-in users
+type MfaService interface {
+	// Enroll starts enrollment with a new secret for the caller
+	Enroll(ctx context.Context) (*dto.MfaEnrollmentResponse, *errors.AppError)
+	// ConfirmEnrollment enables MFA given a code from the new secret and returns the recovery codes
+	ConfirmEnrollment(ctx context.Context, req dto.MfaCodeRequest) (*dto.RecoveryCodesResponse, *errors.AppError)
+	// Disable turns MFA off for the caller given a code or recovery code
+	Disable(ctx context.Context, req dto.MfaCodeRequest) *errors.AppError
+	// RegenerateRecoveryCodes replaces every recovery code of the caller
+	RegenerateRecoveryCodes(ctx context.Context, req dto.MfaCodeRequest) (*dto.RecoveryCodesResponse, *errors.AppError)
+	// ResetMfa turns MFA off for a user who lost both their authenticator and recovery codes
+	ResetMfa(ctx context.Context, idNo string) *errors.AppError
+	// Reencrypt seals plaintext TOTP secrets and moves sealed ones to the
+	// active key, reading batchSize enrollments at a time
+	Reencrypt(batchSize int) (*ReencryptionReport, *errors.AppError)
+}
+
+// DefaultMfaService is the default implementation of MfaService
+type DefaultMfaService struct {
+	repo     domain.MfaRepository  // TOTP secrets, recovery codes and challenges
+	urepo    domain.UserRepository // Repository for user data
+	roles    domain.RoleRepository // Roles of users whose second factor is reset
+	verifier mfaVerifier           // Checks codes and recovery codes
+}
+
+func (s DefaultMfaService) Enroll(ctx context.Context) (*dto.MfaEnrollmentResponse, *errors.AppError) {
+	principal, err := signedInUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.urepo.IdNo(principal.IdNo)
+	if err != nil {
+		return nil, err
+	}
+
+	totp := s.verifier.totp
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	enrollment, err := s.verifier.seal(user.IdNo, secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.StartEnrollment(*enrollment); err != nil {
+		return nil, err
+	}
+
+	account := user.Email
+	if account == "" {
+		account = user.IdNo
+	}
+
+	log.Printf("User with ID %s started MFA enrollment", user.IdNo)
+	return &dto.MfaEnrollmentResponse{
+		Secret:     secret,
+		OtpauthUri: totp.URI(secret, account),
+		Issuer:     totp.Issuer,
+		Account:    account,
+		Algorithm:  "SHA1",
+		Digits:     totp.Digits,
+		Period:     int(totp.Period.Seconds()),
+	}, nil
+}
+
+func (s DefaultMfaService) ConfirmEnrollment(ctx context.Context, req dto.MfaCodeRequest) (*dto.RecoveryCodesResponse, *errors.AppError) {
+	principal, err := signedInUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Code == "" {
+		return nil, errors.NewValidationError("code is required")
+	}
+
+	enrollment, err := s.repo.Enrollment(principal.IdNo)
+	if err != nil {
+		if errors.IsNotFoundError(err) {
+			return nil, errors.NewConflictError("Start MFA enrollment first")
+		}
+		return nil, err
+	}
+	if enrollment.Active() {
+		return nil, errors.NewConflictError("MFA is already enabled")
+	}
+
+	secret, err := s.verifier.secret(*enrollment)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := s.verifier.totp.Verify(secret, req.Code)
+	if !ok {
+		return nil, errors.NewAuthenticationError("Invalid MFA code")
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	event := domain.NewUserEvent(principal.IdNo, domain.UserEventMfaEnabled, actor(ctx), "")
+	if err := s.repo.ConfirmEnrollment(principal.IdNo, step, hashes, event); err != nil {
+		return nil, err
+	}
+
+	log.Printf("User with ID %s enabled MFA", principal.IdNo)
+	return &dto.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+func (s DefaultMfaService) Disable(ctx context.Context, req dto.MfaCodeRequest) *errors.AppError {
+	principal, err := signedInUser(ctx)
+	if err != nil {
+		return err
+	}
+	enrollment, err := s.activeEnrollment(principal.IdNo)
+	if err != nil {
+		return err
+	}
+	if err := s.verifier.Verify(*enrollment, req.Code, req.RecoveryCode); err != nil {
+		return err
+	}
+
+	event := domain.NewUserEvent(principal.IdNo, domain.UserEventMfaDisabled, actor(ctx), "")
+	if err := s.repo.DeleteEnrollment(principal.IdNo, event); err != nil {
+		return err
+	}
+
+	log.Printf("User with ID %s disabled MFA", principal.IdNo)
+	return nil
+}
+
+func (s DefaultMfaService) RegenerateRecoveryCodes(ctx context.Context, req dto.MfaCodeRequest) (*dto.RecoveryCodesResponse, *errors.AppError) {
+	principal, err := signedInUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	enrollment, err := s.activeEnrollment(principal.IdNo)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifier.Verify(*enrollment, req.Code, req.RecoveryCode); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	event := domain.NewUserEvent(principal.IdNo, domain.UserEventRecoveryCodes, actor(ctx), "")
+	if err := s.repo.ReplaceRecoveryCodes(principal.IdNo, hashes, event); err != nil {
+		return nil, err
+	}
+
+	log.Printf("User with ID %s regenerated their recovery codes", principal.IdNo)
+	return &dto.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+func (s DefaultMfaService) ResetMfa(ctx context.Context, idNo string) *errors.AppError {
+	user, err := s.urepo.IdNo(idNo)
+	if err != nil {
+		return err
+	}
+	if err := authorize(ctx, domain.PermissionSetPasswords, user.Department); err != nil {
+		return err
+	}
+	if err := authorizeTakeover(ctx, s.roles, user.IdNo); err != nil {
+		return err
+	}
+
+	event := domain.NewUserEvent(user.IdNo, domain.UserEventMfaDisabled, actor(ctx), "")
+	if err := s.repo.DeleteEnrollment(user.IdNo, event); err != nil {
+		return err
+	}
+
+	log.Printf("MFA of user with ID %s reset by %s", user.IdNo, actor(ctx))
+	return nil
+}
+
+func (s DefaultMfaService) Reencrypt(batchSize int) (*ReencryptionReport, *errors.AppError) {
+	activeKeyId := s.verifier.sealer.ActiveKeyId()
+	if activeKeyId == "" {
+		return nil, errors.NewUnExpectedError("No credential encryption key is configured")
+	}
+	if batchSize < 1 {
+		return nil, errors.NewValidationError("Batch size must be at least 1")
+	}
+
+	report := &ReencryptionReport{}
+	after := ""
+	for {
+		batch, err := s.repo.StaleEnrollments(activeKeyId, after, batchSize)
+		if err != nil {
+			return report, err
+		}
+
+		for _, enrollment := range batch {
+			after = enrollment.IdNo
+			if err := s.reencrypt(enrollment); err != nil {
+				log.Printf("Could not re-encrypt the MFA secret of user with ID %s: %s", enrollment.IdNo, err.Message)
+				report.Failed++
+				continue
+			}
+			if enrollment.Sealed() {
+				report.Rewrapped++
+			} else {
+				report.Sealed++
+			}
+		}
+
+		if len(batch) < batchSize {
+			break
+		}
+	}
+
+	log.Printf("MFA secret re-encryption to key %s: %d sealed, %d rewrapped, %d failed",
+		activeKeyId, report.Sealed, report.Rewrapped, report.Failed)
+	return report, nil
+}
+
+// reencrypt brings one TOTP secret under the active key
+func (s DefaultMfaService) reencrypt(enrollment domain.MfaEnrollment) *errors.AppError {
+	var next *domain.MfaEnrollment
+	if enrollment.Sealed() {
+		secret, err := s.verifier.sealer.Rewrap(enrollment.SealedSecret())
+		if err != nil {
+			return err
+		}
+		rewrapped := enrollment.WithSecret(*secret)
+		next = &rewrapped
+	} else {
+		var err *errors.AppError
+		if next, err = s.verifier.seal(enrollment.IdNo, enrollment.Secret); err != nil {
+			return err
+		}
+	}
+	return s.repo.ReplaceSecret(enrollment, *next)
+}
+
+// activeEnrollment returns the enrollment of a user who has MFA enabled
+func (s DefaultMfaService) activeEnrollment(idNo string) (*domain.MfaEnrollment, *errors.AppError) {
+	enrollment, err := s.repo.Enrollment(idNo)
+	if err != nil {
+		if errors.IsNotFoundError(err) {
+			return nil, errors.NewConflictError("MFA is not enabled")
+		}
+		return nil, err
+	}
+	if !enrollment.Active() {
+		return nil, errors.NewConflictError("MFA is not enabled")
+	}
+	return enrollment, nil
+}
+
+// mfaVerifier checks the second factor for both logins and MFA management
+type mfaVerifier struct {
+	repo   domain.MfaRepository
+	totp   TOTP
+	sealer domain.SecretSealer // Encrypts TOTP secrets at rest
+}
+
+// mfaAssociatedData binds a sealed TOTP secret to its purpose as well as its
+// owner, so it cannot be swapped with a sealed SMTP password of the same user
+func mfaAssociatedData(idNo string) string {
+	return "mfa:" + idNo
+}
+
+// seal encrypts a new TOTP secret of idNo under the active key
+func (v mfaVerifier) seal(idNo, secret string) (*domain.MfaEnrollment, *errors.AppError) {
+	sealed, err := v.sealer.Seal([]byte(secret), mfaAssociatedData(idNo))
+	if err != nil {
+		return nil, err
+	}
+	enrollment := domain.MfaEnrollment{IdNo: idNo}.WithSecret(*sealed)
+	return &enrollment, nil
+}
+
+// secret decrypts the TOTP secret of enrollment
+func (v mfaVerifier) secret(enrollment domain.MfaEnrollment) (string, *errors.AppError) {
+	if !enrollment.Sealed() {
+		log.Printf("MFA secret of user with ID %s is stored in plaintext; run reencrypt", enrollment.IdNo)
+		return enrollment.Secret, nil
+	}
+	secret, err := v.sealer.Open(enrollment.SealedSecret(), mfaAssociatedData(enrollment.IdNo))
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// Verify accepts a TOTP code of enrollment, or a recovery code when no code is
+// given, using either up so it cannot be presented again
+func (v mfaVerifier) Verify(enrollment domain.MfaEnrollment, code, recoveryCode string) *errors.AppError {
+	invalidCode := errors.NewAuthenticationError("Invalid MFA code")
+
+	switch {
+	case code != "":
+		secret, err := v.secret(enrollment)
+		if err != nil {
+			return err
+		}
+		step, ok := v.totp.Verify(secret, code)
+		if !ok {
+			return invalidCode
+		}
+		if err := v.repo.UseStep(enrollment.IdNo, step); err != nil {
+			if errors.IsConflictError(err) {
+				return invalidCode
+			}
+			return err
+		}
+		return nil
+
+	case recoveryCode != "":
+		codes, err := v.repo.RecoveryCodes(enrollment.IdNo)
+		if err != nil {
+			return err
+		}
+		normalized := normalizeRecoveryCode(recoveryCode)
+		for _, stored := range codes {
+			if bcrypt.CompareHashAndPassword([]byte(stored.CodeHash), []byte(normalized)) != nil {
+				continue
+			}
+			if err := v.repo.UseRecoveryCode(stored.Id); err != nil {
+				if errors.IsConflictError(err) {
+					return invalidCode
+				}
+				return err
+			}
+			log.Printf("User with ID %s used a recovery code, %d left", enrollment.IdNo, len(codes)-1)
+			return nil
+		}
+		return invalidCode
+	}
+
+	return errors.NewValidationError("code or recovery_code is required")
+}
+
+// generateRecoveryCodes returns new recovery codes as shown to the user, and
+// their bcrypt hashes as stored
+func generateRecoveryCodes() ([]string, []string, *errors.AppError) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		var code strings.Builder
+		for j := 0; j < 10; j++ {
+			if j == 5 {
+				code.WriteByte('-')
+			}
+			n, randErr := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeAlphabet))))
+			if randErr != nil {
+				return nil, nil, errors.NewUnExpectedError("Error generating recovery code")
+			}
+			code.WriteByte(recoveryCodeAlphabet[n.Int64()])
+		}
+
+		hash, hashErr := bcrypt.GenerateFromPassword([]byte(normalizeRecoveryCode(code.String())), bcrypt.DefaultCost)
+		if hashErr != nil {
+			return nil, nil, errors.NewUnExpectedError("Error hashing recovery code")
+		}
+		codes = append(codes, code.String())
+		hashes = append(hashes, string(hash))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and the separator a user may retype
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// NewMfaService creates a new instance of DefaultMfaService
+func NewMfaService(mfaRepo domain.MfaRepository, userRepo domain.UserRepository, roleRepo domain.RoleRepository, totp TOTP, sealer domain.SecretSealer) DefaultMfaService {
+	return DefaultMfaService{
+		repo:     mfaRepo,
+		urepo:    userRepo,
+		roles:    roleRepo,
+		verifier: mfaVerifier{repo: mfaRepo, totp: totp, sealer: sealer},
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newMfaVerifier returns a verifier stopped at now for an enrolled E100 whose
+// secret is sealed
+func newMfaVerifier(t *testing.T, now time.Time) (mfaVerifier, *fakeMfaRepository, domain.MfaEnrollment) {
+	t.Helper()
+	repo := newFakeMfaRepository()
+	verifier := mfaVerifier{repo: repo, totp: NewTOTP("Tracker", fakeClock{now}), sealer: fakeSealer{keyId: "k1"}}
+	enrollment, err := verifier.seal("E100", rfc6238Secret)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	repo.enrollments["E100"] = *enrollment
+	return verifier, repo, *enrollment
+}
+
+func TestMfaCodesCannotBeReplayed(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	verifier, repo, enrollment := newMfaVerifier(t, now)
+	current := verifier.totp.Step(now)
+	code, _ := verifier.totp.Code(rfc6238Secret, current)
+	previous, _ := verifier.totp.Code(rfc6238Secret, current-1)
+
+	if err := verifier.Verify(enrollment, code, ""); err != nil {
+		t.Fatalf("first use = %s, want accepted", err.Message)
+	}
+	if got := repo.enrollments["E100"].LastUsedStep; got != current {
+		t.Fatalf("last used step = %d, want %d", got, current)
+	}
+	if err := verifier.Verify(enrollment, code, ""); !errors.IsAuthenticationError(err) {
+		t.Errorf("replayed code = %v, want invalid", err)
+	}
+	// A code of an earlier step inside the skew window is stale too
+	if err := verifier.Verify(enrollment, previous, ""); !errors.IsAuthenticationError(err) {
+		t.Errorf("code of an earlier step = %v, want invalid", err)
+	}
+}
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	verifier, repo, enrollment := newMfaVerifier(t, time.Unix(1111111111, 0))
+	for i, code := range []string{"abcde-fghjk", "mnpqr-stuvw"} {
+		hash, err := bcrypt.GenerateFromPassword([]byte(normalizeRecoveryCode(code)), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo.codes = append(repo.codes, domain.RecoveryCode{Id: int64(i + 1), IdNo: "E100", CodeHash: string(hash)})
+	}
+
+	// Retyped in another case and without the separator
+	if err := verifier.Verify(enrollment, "", "ABCDE FGHJK"); err != nil {
+		t.Fatalf("first use = %s, want accepted", err.Message)
+	}
+	if err := verifier.Verify(enrollment, "", "abcde-fghjk"); !errors.IsAuthenticationError(err) {
+		t.Errorf("reused recovery code = %v, want invalid", err)
+	}
+	if err := verifier.Verify(enrollment, "", "mnpqr-stuvw"); err != nil {
+		t.Errorf("other recovery code = %s, want accepted", err.Message)
+	}
+	if err := verifier.Verify(enrollment, "", ""); !errors.IsValidationError(err) {
+		t.Errorf("no code = %v, want a validation error", err)
+	}
+}
+
+func TestMfaSecretsAreSealedAtRest(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	repo := newFakeMfaRepository()
+	service := NewMfaService(repo, newFakeUserRepository(activeUser("E100")), fakeRoles{}, NewTOTP("Tracker", fakeClock{now}), fakeSealer{keyId: "k1"})
+	ctx := domain.WithPrincipal(context.Background(), domain.Principal{IdNo: "E100"})
+
+	enrolled, err := service.Enroll(ctx)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	stored := repo.enrollments["E100"]
+	if !stored.Sealed() || stored.KeyId.String != "k1" || stored.Secret == enrolled.Secret {
+		t.Fatalf("stored enrollment %+v keeps the secret in plaintext", stored)
+	}
+
+	// The sealed secret is bound to its owner
+	moved := stored
+	moved.IdNo = "E200"
+	if _, err := service.verifier.secret(moved); err == nil {
+		t.Error("secret sealed for E100 opened for E200")
+	}
+
+	code, _ := service.verifier.totp.Code(enrolled.Secret, service.verifier.totp.Step(now))
+	if _, err := service.ConfirmEnrollment(ctx, dto.MfaCodeRequest{Code: code}); err != nil {
+		t.Fatalf("confirming with a code of the sealed secret = %s", err.Message)
+	}
+}
+
+func TestMfaEnrollmentNeedsAnEncryptionKey(t *testing.T) {
+	repo := newFakeMfaRepository()
+	service := NewMfaService(repo, newFakeUserRepository(activeUser("E100")), fakeRoles{}, NewTOTP("Tracker", SystemClock{}), fakeSealer{})
+	ctx := domain.WithPrincipal(context.Background(), domain.Principal{IdNo: "E100"})
+
+	if _, err := service.Enroll(ctx); err == nil {
+		t.Fatal("enrolled without an encryption key")
+	}
+	if len(repo.enrollments) != 0 {
+		t.Errorf("stored %d enrollments without an encryption key", len(repo.enrollments))
+	}
+}
+
+func TestMfaReencryptSealsPlaintextSecrets(t *testing.T) {
+	repo := newFakeMfaRepository(domain.MfaEnrollment{IdNo: "E100", Secret: rfc6238Secret})
+	service := NewMfaService(repo, newFakeUserRepository(), fakeRoles{}, NewTOTP("Tracker", SystemClock{}), fakeSealer{keyId: "k2"})
+
+	report, err := service.Reencrypt(10)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if report.Sealed != 1 || report.Failed != 0 {
+		t.Fatalf("report = %+v, want one secret sealed", report)
+	}
+	stored := repo.enrollments["E100"]
+	if !stored.Sealed() || stored.KeyId.String != "k2" {
+		t.Fatalf("stored enrollment %+v was not sealed with the active key", stored)
+	}
+	if secret, err := service.verifier.secret(stored); err != nil || secret != rfc6238Secret {
+		t.Errorf("reencrypted secret opens to %q, %v", secret, err)
+	}
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+)
+
+// RFC 5321 length limits
+const (
+	maxLocalPartLength = 64
+	maxAddressLength   = 254
+)
+
+// localPartPattern is the conservative dot-atom subset generated addresses must match:
+// lowercase ASCII words joined by single dots or hyphens, never leading or trailing
+var localPartPattern = regexp.MustCompile(`^[a-z0-9]+([.-][a-z0-9]+)*$`)
+
+// nameRule is a single step of the name normalization pipeline
+type nameRule struct {
+	Name  string
+	Apply func(string) string
+}
+
+// nameRules run in order over every name part before it is split into words
+var nameRules = []nameRule{
+	{Name: "lowercase", Apply: strings.ToLower},
+	{Name: "transliterate", Apply: transliterate},
+	{Name: "apostrophes", Apply: removeApostrophes},
+	{Name: "hyphens", Apply: normalizeHyphens},
+	{Name: "ascii", Apply: stripInvalidRunes},
+}
+
+// transliterations maps non-ASCII letters to their ASCII spelling
+var transliterations = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'ä': "ae", 'æ': "ae",
+	'ç': "c", 'ć': "c", 'ĉ': "c", 'ċ': "c", 'č': "c",
+	'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ĕ': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ĝ': "g", 'ğ': "g", 'ġ': "g", 'ģ': "g",
+	'ĥ': "h", 'ħ': "h",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ĩ': "i", 'ī': "i", 'ĭ': "i", 'į': "i", 'ı': "i",
+	'ĵ': "j",
+	'ķ': "k",
+	'ĺ': "l", 'ļ': "l", 'ľ': "l", 'ŀ': "l", 'ł': "l",
+	'ñ': "n", 'ń': "n", 'ņ': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ō': "o", 'ŏ': "o", 'ő': "o", 'ø': "o",
+	'ö': "oe", 'œ': "oe",
+	'ŕ': "r", 'ŗ': "r", 'ř': "r",
+	'ś': "s", 'ŝ': "s", 'ş': "s", 'š': "s", 'ș': "s",
+	'ß': "ss",
+	'ţ': "t", 'ť': "t", 'ŧ': "t", 'ț': "t",
+	'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ũ': "u", 'ū': "u", 'ŭ': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ü': "ue",
+	'ŵ': "w",
+	'ý': "y", 'ÿ': "y", 'ŷ': "y",
+	'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+// apostrophes are removed so O'Brien becomes obrien
+var apostrophes = map[rune]bool{'\'': true, '’': true, '‘': true, '`': true, '´': true, 'ʼ': true}
+
+// hyphens are unified to an ASCII hyphen so Anne‐Marie keeps its hyphen
+var hyphens = map[rune]bool{'-': true, '‐': true, '‑': true, '‒': true, '–': true, '—': true}
+
+// surnameParticles are joined with the word that follows them (de la Cruz becomes delacruz)
+var surnameParticles = map[string]bool{
+	"da": true, "das": true, "de": true, "del": true, "dela": true, "della": true,
+	"der": true, "di": true, "do": true, "dos": true, "du": true, "la": true,
+	"le": true, "van": true, "von": true, "ten": true, "ter": true, "den": true,
+}
+
+func transliterate(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		if ascii, ok := transliterations[r]; ok {
+			b.WriteString(ascii)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func removeApostrophes(value string) string {
+	return strings.Map(func(r rune) rune {
+		if apostrophes[r] {
+			return -1
+		}
+		return r
+	}, value)
+}
+
+func normalizeHyphens(value string) string {
+	return strings.Map(func(r rune) rune {
+		if hyphens[r] {
+			return '-'
+		}
+		return r
+	}, value)
+}
+
+// stripInvalidRunes keeps ASCII letters, digits, hyphens and word separators only
+func stripInvalidRunes(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			return r
+		case r == ' ', r == '\t':
+			return ' '
+		}
+		return -1
+	}, value)
+}
+
+// normalizeNameWords runs the pipeline over a name part and splits it into words,
+// trimming stray hyphens so no word starts or ends with one
+func normalizeNameWords(value string) []string {
+	for _, rule := range nameRules {
+		value = rule.Apply(value)
+	}
+
+	var words []string
+	for _, word := range strings.Fields(value) {
+		word = strings.Trim(word, "-")
+		for strings.Contains(word, "--") {
+			word = strings.ReplaceAll(word, "--", "-")
+		}
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// joinSurnameParticles merges particles with the following word
+func joinSurnameParticles(words []string) []string {
+	var joined []string
+	prefix := ""
+	for i, word := range words {
+		if surnameParticles[word] && i < len(words)-1 {
+			prefix += word
+			continue
+		}
+		joined = append(joined, prefix+word)
+		prefix = ""
+	}
+	return joined
+}
+
+// newEmailName normalizes the name parts into ASCII words usable in a local part
+func newEmailName(firstName, lastName, suffix string) (emailName, *errors.AppError) {
+	firstWords := normalizeNameWords(firstName)
+	lastWords := joinSurnameParticles(normalizeNameWords(lastName))
+
+	name := emailName{
+		First:       strings.Join(firstWords, ""),
+		FirstTokens: firstWords,
+		Last:        strings.Join(lastWords, ""),
+		Suffix:      strings.Join(normalizeNameWords(suffix), ""),
+	}
+	if name.First == "" || name.Last == "" {
+		return name, errors.NewValidationError("First name and last name must contain letters or digits to generate an email")
+	}
+	return name, nil
+}
+
+// validEmailAddress checks a generated local part and domain against RFC 5321 limits
+func validEmailAddress(localPart, domainName string) bool {
+	if len(localPart) > maxLocalPartLength || len(localPart)+1+len(domainName) > maxAddressLength {
+		return false
+	}
+	return localPartPattern.MatchString(localPart)
+}
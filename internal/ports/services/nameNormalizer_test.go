@@ -0,0 +1,134 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+)
+
+func TestNewEmailName(t *testing.T) {
+	tests := []struct {
+		name      string
+		firstName string
+		lastName  string
+		suffix    string
+		wantFirst string
+		wantLast  string
+		wantSuf   string
+	}{
+		{name: "accents", firstName: "José", lastName: "Núñez", wantFirst: "jose", wantLast: "nunez"},
+		{name: "apostrophe", firstName: "Conan", lastName: "O'Brien", wantFirst: "conan", wantLast: "obrien"},
+		{name: "typographic apostrophe", firstName: "Conan", lastName: "O’Brien", wantFirst: "conan", wantLast: "obrien"},
+		{name: "hyphenated first name", firstName: "Anne-Marie", lastName: "Smith", wantFirst: "anne-marie", wantLast: "smith"},
+		{name: "unicode hyphen", firstName: "Anne‐Marie", lastName: "Smith", wantFirst: "anne-marie", wantLast: "smith"},
+		{name: "umlaut", firstName: "Jürgen", lastName: "Müller", wantFirst: "juergen", wantLast: "mueller"},
+		{name: "particle de", firstName: "Juan", lastName: "de la Cruz", wantFirst: "juan", wantLast: "delacruz"},
+		{name: "particle van", firstName: "Pieter", lastName: "van der Berg", wantFirst: "pieter", wantLast: "vanderberg"},
+		{name: "particle dela", firstName: "Maria", lastName: "Dela Cruz", wantFirst: "maria", wantLast: "delacruz"},
+		{name: "particle alone is kept", firstName: "Ana", lastName: "De", wantFirst: "ana", wantLast: "de"},
+		{name: "middle name", firstName: "Mary Ann", lastName: "Lee", wantFirst: "maryann", wantLast: "lee"},
+		{name: "suffix", firstName: "John", lastName: "Smith", suffix: "Jr.", wantFirst: "john", wantLast: "smith", wantSuf: "jr"},
+		{name: "stray hyphens", firstName: "-Ana--Lou-", lastName: "Reyes", wantFirst: "ana-lou", wantLast: "reyes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, err := newEmailName(tt.firstName, tt.lastName, tt.suffix)
+			if err != nil {
+				t.Fatalf("newEmailName(%q, %q, %q) failed: %s", tt.firstName, tt.lastName, tt.suffix, err.Message)
+			}
+			if name.First != tt.wantFirst || name.Last != tt.wantLast || name.Suffix != tt.wantSuf {
+				t.Errorf("newEmailName(%q, %q, %q) = %q %q %q, want %q %q %q",
+					tt.firstName, tt.lastName, tt.suffix, name.First, name.Last, name.Suffix,
+					tt.wantFirst, tt.wantLast, tt.wantSuf)
+			}
+		})
+	}
+}
+
+func TestNewEmailNameRejectsEmptyLocalPart(t *testing.T) {
+	tests := []struct {
+		name      string
+		firstName string
+		lastName  string
+	}{
+		{name: "punctuation only first name", firstName: "!!!", lastName: "Smith"},
+		{name: "unsupported script last name", firstName: "Ana", lastName: "李"},
+		{name: "empty", firstName: "", lastName: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newEmailName(tt.firstName, tt.lastName, "")
+			if !errors.IsValidationError(err) {
+				t.Fatalf("newEmailName(%q, %q) = %v, want a validation error", tt.firstName, tt.lastName, err)
+			}
+		})
+	}
+}
+
+func TestNameRulesRunInOrder(t *testing.T) {
+	// Each input only normalizes correctly when its rules run in pipeline order:
+	// É has no transliteration until it is lowercased, and the ascii rule drops
+	// typographic hyphens that were not unified first
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "ÉMILE", want: "emile"},
+		{value: "ÖZTÜRK", want: "oeztuerk"},
+		{value: "Jean‐Luc", want: "jean-luc"},
+		{value: "D’ANGELO—RUIZ", want: "dangelo-ruiz"},
+	}
+
+	reversed := make([]nameRule, len(nameRules))
+	for i, rule := range nameRules {
+		reversed[len(nameRules)-1-i] = rule
+	}
+	apply := func(rules []nameRule, value string) string {
+		for _, rule := range rules {
+			value = rule.Apply(value)
+		}
+		return value
+	}
+
+	for _, tt := range tests {
+		if got := strings.Join(normalizeNameWords(tt.value), " "); got != tt.want {
+			t.Errorf("normalizeNameWords(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+		if got := apply(reversed, tt.value); got == tt.want {
+			t.Errorf("reversed rules also gave %q for %q, want an input that depends on rule order", got, tt.value)
+		}
+	}
+}
+
+func TestValidEmailAddress(t *testing.T) {
+	domain := "example.com"
+	tests := []struct {
+		name       string
+		localPart  string
+		domainName string
+		want       bool
+	}{
+		{name: "simple", localPart: "jose.nunez", domainName: domain, want: true},
+		{name: "hyphen", localPart: "anne-marie.smith", domainName: domain, want: true},
+		{name: "local part at limit", localPart: strings.Repeat("a", maxLocalPartLength), domainName: domain, want: true},
+		{name: "local part over limit", localPart: strings.Repeat("a", maxLocalPartLength+1), domainName: domain, want: false},
+		{name: "address at limit", localPart: "a", domainName: strings.Repeat("d", maxAddressLength-2), want: true},
+		{name: "address over limit", localPart: "a", domainName: strings.Repeat("d", maxAddressLength-1), want: false},
+		{name: "empty", localPart: "", domainName: domain, want: false},
+		{name: "leading dot", localPart: ".ana", domainName: domain, want: false},
+		{name: "double dot", localPart: "ana..reyes", domainName: domain, want: false},
+		{name: "uppercase", localPart: "Ana", domainName: domain, want: false},
+		{name: "non-ascii", localPart: "josé", domainName: domain, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validEmailAddress(tt.localPart, tt.domainName); got != tt.want {
+				t.Errorf("validEmailAddress(%q, %d-byte domain) = %v, want %v", tt.localPart, len(tt.domainName), got, tt.want)
+			}
+		})
+	}
+}
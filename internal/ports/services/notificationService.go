@@ -0,0 +1,121 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+)
+
+// UserNotifier tells users and their managers about changes to their mailbox.
+// Notifications are best effort: a failure is logged and never undoes the change.
+type UserNotifier interface {
+	// UserCreated welcomes a user whose mailbox was just provisioned
+	UserCreated(user domain.User)
+	// AddressChanged tells a user their address replaced previousEmail, which
+	// keeps receiving mail until aliasExpires
+	AddressChanged(user domain.User, previousEmail, aliasExpires string)
+}
+
+// DefaultNotificationService is the default implementation of UserNotifier and
+// PasswordResetNotifier
+type DefaultNotificationService struct {
+	urepo    domain.UserRepository  // Resolves managers
+	renderer domain.MessageRenderer // Message templates
+	sender   domain.MessageSender   // Delivery, usually through a queue
+	enabled  map[string]bool        // Events that are sent
+}
+
+func (s DefaultNotificationService) UserCreated(user domain.User) {
+	s.notify(domain.NotificationWelcome, user, domain.NewNotificationData(user))
+}
+
+func (s DefaultNotificationService) AddressChanged(user domain.User, previousEmail, aliasExpires string) {
+	data := domain.NewNotificationData(user)
+	data.PreviousEmail = previousEmail
+	data.AliasExpires = aliasExpires
+	s.notify(domain.NotificationAddressChanged, user, data)
+}
+
+func (s DefaultNotificationService) SendPasswordReset(user domain.User, token string, expires time.Time) *errors.AppError {
+	if !s.enabled[domain.NotificationPasswordReset] {
+		return LogPasswordResetNotifier{}.SendPasswordReset(user, token, expires)
+	}
+
+	data := domain.NewNotificationData(user)
+	data.ResetToken = token
+	data.ResetExpires = expires.Format(time.RFC3339)
+	return s.send(domain.NotificationPasswordReset, user.Email, data)
+}
+
+// notify sends event to user and, when they have one, to their manager
+func (s DefaultNotificationService) notify(event string, user domain.User, data domain.NotificationData) {
+	if !s.enabled[event] {
+		return
+	}
+
+	if err := s.send(event, user.Email, data); err != nil {
+		log.Printf("Could not send %s notification to user with ID %s: %s", event, user.IdNo, err.Message)
+	}
+
+	if !user.ManagerIdNo.Valid {
+		return
+	}
+	manager, err := s.urepo.IdNo(user.ManagerIdNo.String)
+	if err != nil {
+		log.Printf("Could not find manager %s of user with ID %s: %s", user.ManagerIdNo.String, user.IdNo, err.Message)
+		return
+	}
+	if manager.Status == domain.StatusDeleted || manager.Email == "" {
+		return
+	}
+
+	data.Manager = manager
+	if err := s.send(event, manager.Email, data); err != nil {
+		log.Printf("Could not send %s notification about user with ID %s to manager %s: %s", event, user.IdNo, manager.IdNo, err.Message)
+	}
+}
+
+// send renders event for one recipient and hands it to the sender
+func (s DefaultNotificationService) send(event, to string, data domain.NotificationData) *errors.AppError {
+	if to == "" {
+		return errors.NewValidationError("Recipient has no email address")
+	}
+	message, err := s.renderer.Render(event, data)
+	if err != nil {
+		return err
+	}
+	message.To = []string{to}
+	return s.sender.Send(*message)
+}
+
+// NewNotificationService creates a new instance of DefaultNotificationService
+// sending only the given events
+func NewNotificationService(
+	userRepo domain.UserRepository,
+	renderer domain.MessageRenderer,
+	sender domain.MessageSender,
+	events []string,
+) (DefaultNotificationService, *errors.AppError) {
+	known := make(map[string]bool, len(domain.NotificationEvents))
+	for _, event := range domain.NotificationEvents {
+		known[event] = true
+	}
+
+	enabled := make(map[string]bool, len(events))
+	for _, event := range events {
+		if !known[event] {
+			return DefaultNotificationService{}, errors.NewValidationError(fmt.Sprintf("Unknown notification event %q", event))
+		}
+		enabled[event] = true
+	}
+
+	return DefaultNotificationService{
+		urepo:    userRepo,
+		renderer: renderer,
+		sender:   sender,
+		enabled:  enabled,
+	}, nil
+}
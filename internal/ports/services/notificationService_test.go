@@ -0,0 +1,75 @@
+package services
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+)
+
+func newNotifier(t *testing.T, events ...string) (DefaultNotificationService, *recordingSender) {
+	t.Helper()
+	manager := activeUser("M100")
+	manager.Email = "maria.santos@example.com"
+	sender := &recordingSender{}
+	notifier, err := NewNotificationService(newFakeUserRepository(manager), fakeRenderer{}, sender, events)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	return notifier, sender
+}
+
+func TestNotificationServiceRejectsUnknownEvents(t *testing.T) {
+	_, err := NewNotificationService(newFakeUserRepository(), fakeRenderer{}, &recordingSender{},
+		[]string{domain.NotificationWelcome, "birthday"})
+	if !errors.IsValidationError(err) || !strings.Contains(err.Message, "birthday") {
+		t.Errorf("NewNotificationService = %v, want a validation error naming the event", err)
+	}
+}
+
+func TestNotificationServiceSendsOnlyEnabledEvents(t *testing.T) {
+	user := activeUser("E100")
+	user.ManagerIdNo = sql.NullString{String: "M100", Valid: true}
+
+	notifier, sender := newNotifier(t, domain.NotificationAddressChanged)
+
+	notifier.UserCreated(user)
+	if len(sender.sent) != 0 {
+		t.Fatalf("disabled welcome sent %d messages", len(sender.sent))
+	}
+
+	// An enabled event reaches the user and the manager
+	notifier.AddressChanged(user, "ana.r@example.com", "2026-11-01")
+	if len(sender.sent) != 2 {
+		t.Fatalf("address change sent %d messages, want 2", len(sender.sent))
+	}
+	for i, want := range []string{user.Email, "maria.santos@example.com"} {
+		message := sender.sent[i]
+		if message.Event != domain.NotificationAddressChanged || len(message.To) != 1 || message.To[0] != want {
+			t.Errorf("message %d = %s to %v, want %s to %s", i, message.Event, message.To, domain.NotificationAddressChanged, want)
+		}
+	}
+}
+
+func TestNotificationServiceKeepsDisabledResetTokensOutOfMail(t *testing.T) {
+	user := activeUser("E100")
+
+	notifier, sender := newNotifier(t, domain.NotificationWelcome)
+	if err := notifier.SendPasswordReset(user, "reset-token", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("SendPasswordReset: %s", err.Message)
+	}
+	if len(sender.sent) != 0 {
+		t.Fatalf("disabled password reset sent %d messages", len(sender.sent))
+	}
+
+	notifier, sender = newNotifier(t, domain.NotificationPasswordReset)
+	if err := notifier.SendPasswordReset(user, "reset-token", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("SendPasswordReset: %s", err.Message)
+	}
+	if len(sender.sent) != 1 || !strings.Contains(sender.sent[0].Text, "reset-token") {
+		t.Errorf("enabled password reset sent %+v, want one message with the token", sender.sent)
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+)
+
+// outboxLease is how long claimed events are held back from other
+// dispatchers; events still undelivered after it are claimed again
+const outboxLease = 5 * time.Minute
+
+// outboxPruneInterval is how often delivered events are pruned
+const outboxPruneInterval = time.Hour
+
+// maxOutboxRetryDelay caps the wait between attempts of a failing event
+const maxOutboxRetryDelay = time.Hour
+
+// OutboxDispatcher publishes the domain events in the outbox to every sink.
+// An event is marked delivered only once all sinks accepted it; after any
+// failure it is tried again on every sink, so sinks may see it more than once.
+type OutboxDispatcher struct {
+	repo       domain.OutboxRepository
+	sinks      []domain.EventSink
+	batchSize  int
+	retryDelay time.Duration    // Wait after a first failure, doubled after each further one
+	retention  time.Duration    // How long delivered events are kept; zero keeps them
+	now        func() time.Time // Clock, replaceable for tests
+}
+
+// Dispatch publishes every event that is due and returns how many were delivered
+func (d OutboxDispatcher) Dispatch() (int, *errors.AppError) {
+	delivered := 0
+	for {
+		events, err := d.repo.ClaimEvents(d.batchSize, outboxLease)
+		if err != nil {
+			return delivered, err
+		}
+
+		for _, event := range events {
+			if d.publish(event) {
+				delivered++
+			}
+		}
+
+		if len(events) < d.batchSize {
+			return delivered, nil
+		}
+	}
+}
+
+// Prune deletes the events delivered longer than the retention ago and
+// returns how many were deleted
+func (d OutboxDispatcher) Prune() (int64, *errors.AppError) {
+	if d.retention <= 0 {
+		return 0, nil
+	}
+	return d.repo.PruneDelivered(d.now().Add(-d.retention))
+}
+
+// Start dispatches the outbox every interval, and prunes it every
+// outboxPruneInterval, until the process exits
+func (d OutboxDispatcher) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var lastPruned time.Time
+		for range ticker.C {
+			if _, err := d.Dispatch(); err != nil {
+				log.Printf("Outbox dispatch failed: %s", err.Message)
+			}
+			if d.now().Sub(lastPruned) < outboxPruneInterval {
+				continue
+			}
+			lastPruned = d.now()
+			if pruned, err := d.Prune(); err != nil {
+				log.Printf("Outbox prune failed: %s", err.Message)
+			} else if pruned > 0 {
+				log.Printf("Pruned %d delivered outbox events", pruned)
+			}
+		}
+	}()
+}
+
+// publish hands event to every sink and records the outcome
+func (d OutboxDispatcher) publish(event domain.DomainEvent) bool {
+	var failures []string
+	for _, sink := range d.sinks {
+		if err := sink.Publish(event); err != nil {
+			failures = append(failures, sink.Name()+": "+err.Message)
+		}
+	}
+
+	if len(failures) == 0 {
+		if err := d.repo.MarkDelivered(event.Id); err != nil {
+			log.Printf("Outbox event %d was published but could not be marked delivered: %s", event.Id, err.Message)
+			return false
+		}
+		return true
+	}
+
+	retryAt := d.now().Add(d.backoff(event.Attempts + 1))
+	reason := strings.Join(failures, "; ")
+	log.Printf("Outbox event %d (%s) failed on attempt %d, retrying at %s: %s",
+		event.Id, event.Type, event.Attempts+1, retryAt.Format(time.RFC3339), reason)
+	if err := d.repo.MarkFailed(event.Id, reason, retryAt); err != nil {
+		log.Printf("Could not record the failure of outbox event %d: %s", event.Id, err.Message)
+	}
+	return false
+}
+
+// backoff returns the wait before the attempt after the given failed one
+func (d OutboxDispatcher) backoff(failures int) time.Duration {
+	delay := d.retryDelay
+	for i := 1; i < failures && delay < maxOutboxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxOutboxRetryDelay {
+		delay = maxOutboxRetryDelay
+	}
+	return delay
+}
+
+// NewOutboxDispatcher creates a new instance of OutboxDispatcher
+func NewOutboxDispatcher(repo domain.OutboxRepository, sinks []domain.EventSink, batchSize int, retryDelay, retention time.Duration) OutboxDispatcher {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return OutboxDispatcher{
+		repo:       repo,
+		sinks:      sinks,
+		batchSize:  batchSize,
+		retryDelay: retryDelay,
+		retention:  retention,
+		now:        time.Now,
+	}
+}
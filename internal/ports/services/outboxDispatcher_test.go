@@ -0,0 +1,111 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+)
+
+func newTestDispatcher(repo *fakeOutboxRepository, sink *recordingSink, retention time.Duration) OutboxDispatcher {
+	dispatcher := NewOutboxDispatcher(repo, []domain.EventSink{sink}, 2, time.Minute, retention)
+	dispatcher.now = func() time.Time { return repo.now }
+	return dispatcher
+}
+
+func TestOutboxDispatchRetriesFailedEvents(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	repo := &fakeOutboxRepository{now: now}
+	for id := int64(1); id <= 3; id++ {
+		repo.events = append(repo.events, domain.DomainEvent{Id: id, Type: domain.DomainEventUserUpdated, DateNextAttempt: now})
+	}
+	sink := &recordingSink{failing: true}
+	dispatcher := newTestDispatcher(repo, sink, 0)
+
+	if delivered, err := dispatcher.Dispatch(); err != nil || delivered != 0 {
+		t.Fatalf("Dispatch = %d, %v, want nothing delivered while the sink fails", delivered, err)
+	}
+	for _, event := range repo.events {
+		if event.Attempts != 1 || !strings.Contains(event.LastError.String, "sink unavailable") ||
+			!event.DateNextAttempt.Equal(now.Add(time.Minute)) {
+			t.Errorf("event %d = %+v, want one failed attempt retried after the retry delay", event.Id, event)
+		}
+	}
+
+	sink.failing = false
+	repo.now = now.Add(time.Minute)
+	if delivered, err := dispatcher.Dispatch(); err != nil || delivered != 3 {
+		t.Fatalf("Dispatch = %d, %v, want all three delivered once due", delivered, err)
+	}
+	if len(sink.published) != 3 {
+		t.Errorf("sink was sent %d events, want 3", len(sink.published))
+	}
+	if delivered, _ := dispatcher.Dispatch(); delivered != 0 {
+		t.Errorf("Dispatch delivered %d events again, want none", delivered)
+	}
+}
+
+func TestOutboxBackoffIsCapped(t *testing.T) {
+	dispatcher := newTestDispatcher(&fakeOutboxRepository{}, &recordingSink{}, 0)
+	for failures, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 3: 4 * time.Minute, 20: maxOutboxRetryDelay} {
+		if got := dispatcher.backoff(failures); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
+
+func TestOutboxPruneDeletesOldDeliveredEvents(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	delivered := func(age time.Duration) sql.NullTime { return sql.NullTime{Time: now.Add(-age), Valid: true} }
+	repo := &fakeOutboxRepository{now: now, events: []domain.DomainEvent{
+		{Id: 1, DateDelivered: delivered(8 * 24 * time.Hour)},
+		{Id: 2, DateDelivered: delivered(6 * 24 * time.Hour)},
+		{Id: 3, DateNextAttempt: now.Add(-30 * 24 * time.Hour)}, // Never delivered
+	}}
+
+	if pruned, err := newTestDispatcher(repo, &recordingSink{}, 0).Prune(); err != nil || pruned != 0 || len(repo.events) != 3 {
+		t.Fatalf("Prune without a retention = %d, %v, want every event kept", pruned, err)
+	}
+
+	pruned, err := newTestDispatcher(repo, &recordingSink{}, 7*24*time.Hour).Prune()
+	if err != nil || pruned != 1 {
+		t.Fatalf("Prune = %d, %v, want 1", pruned, err)
+	}
+	if len(repo.events) != 2 || repo.events[0].Id != 2 || repo.events[1].Id != 3 {
+		t.Errorf("kept %+v, want the recent delivery and the undelivered event", repo.events)
+	}
+}
+
+func TestDomainEventsCarryNoPersonalData(t *testing.T) {
+	before := domain.User{IdNo: "E100", FirstName: "Ana", LastName: "Reyes", Email: "ana.reyes@example.com", Department: "IT"}
+	after := before
+	after.LastName, after.Email = "Santos", "ana.santos@example.com"
+	event := domain.NewUserEvent("E100", domain.UserEventSurnameChanged, "OP-1", "TCK-1")
+	event.Changes = domain.DiffUsers(before, after)
+
+	published, ok, err := domain.NewDomainEvent(event)
+	if err != nil || !ok {
+		t.Fatalf("NewDomainEvent = %v, %v, want the surname change published", ok, err)
+	}
+	for _, value := range []string{"Ana", "Reyes", "Santos", "example.com"} {
+		if strings.Contains(string(published.Payload), value) {
+			t.Errorf("payload %s contains %q", published.Payload, value)
+		}
+	}
+
+	var payload domain.UserEventPayload
+	if err := json.Unmarshal(published.Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.IdNo != "E100" || payload.Actor != "OP-1" || payload.TicketNo != "TCK-1" ||
+		strings.Join(payload.Fields, ",") != "last_name,email" {
+		t.Errorf("payload = %+v, want the identifiers and the changed last_name and email", payload)
+	}
+
+	if _, ok, _ := domain.NewDomainEvent(domain.NewUserEvent("E100", domain.UserEventSmtpRotated, "OP-1", "")); ok {
+		t.Error("an SMTP change was published, want only the published actions")
+	}
+}
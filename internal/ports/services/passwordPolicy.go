@@ -0,0 +1,157 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+)
+
+// Character classes a password policy can require
+const (
+	PasswordClassUpper  = "upper"
+	PasswordClassLower  = "lower"
+	PasswordClassDigit  = "digit"
+	PasswordClassSymbol = "symbol"
+)
+
+// maxPasswordBytes is the most bcrypt hashes; anything after it would be ignored
+const maxPasswordBytes = 72
+
+// minPersonalTokenLength keeps short names like "li" from rejecting most passwords
+const minPersonalTokenLength = 3
+
+// passwordClasses tells whether a rune belongs to each character class
+var passwordClasses = map[string]func(rune) bool{
+	PasswordClassUpper:  unicode.IsUpper,
+	PasswordClassLower:  unicode.IsLower,
+	PasswordClassDigit:  unicode.IsDigit,
+	PasswordClassSymbol: func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) },
+}
+
+// PasswordPolicy holds the rules every new password must satisfy
+type PasswordPolicy struct {
+	MinLength       int             // Minimum number of characters
+	RequiredClasses []string        // Character classes that must each appear at least once
+	Banned          map[string]bool // Lowercased passwords that are refused outright
+	HistorySize     int             // Number of previous passwords that cannot be reused
+	MaxAge          time.Duration   // Age after which a password must be changed; zero never expires
+}
+
+// Violations lists every rule password breaks for user, empty when it is acceptable.
+// Reuse of previous passwords is checked by the caller against the stored history.
+func (p PasswordPolicy) Violations(password string, user domain.User) []string {
+	var violations []string
+
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("Password must be at least %d characters long", p.MinLength))
+	}
+	if len(password) > maxPasswordBytes {
+		violations = append(violations, fmt.Sprintf("Password must be at most %d bytes long", maxPasswordBytes))
+	}
+
+	for _, class := range p.RequiredClasses {
+		if !strings.ContainsFunc(password, passwordClasses[class]) {
+			violations = append(violations, fmt.Sprintf("Password must contain at least one %s character", class))
+		}
+	}
+
+	lowered := strings.ToLower(password)
+	if p.Banned[lowered] {
+		violations = append(violations, "Password is too common")
+	}
+	for _, token := range personalTokens(user) {
+		if strings.Contains(lowered, token) {
+			violations = append(violations, "Password must not contain the user's name or email address")
+			break
+		}
+	}
+
+	return violations
+}
+
+// Expired reports whether the password of user is older than the maximum age
+func (p PasswordPolicy) Expired(user domain.User, now time.Time) bool {
+	if p.MaxAge <= 0 || !user.DatePasswordChanged.Valid {
+		return false
+	}
+	return now.Sub(user.DatePasswordChanged.Time) > p.MaxAge
+}
+
+// personalTokens are the lowercased name parts and email local part of user
+// that a password may not contain
+func personalTokens(user domain.User) []string {
+	local, _, _ := strings.Cut(user.Email, "@")
+
+	var tokens []string
+	for _, value := range []string{user.FirstName, user.LastName, local} {
+		value = strings.ToLower(value)
+		if len([]rune(value)) >= minPersonalTokenLength {
+			tokens = append(tokens, value)
+		}
+		parts := strings.FieldsFunc(value, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+		for _, part := range parts {
+			if part != value && len([]rune(part)) >= minPersonalTokenLength {
+				tokens = append(tokens, part)
+			}
+		}
+	}
+	return tokens
+}
+
+// LoadBannedPasswords reads a list of refused passwords, one per line. Blank
+// lines and lines starting with # are skipped; an empty path bans nothing.
+func LoadBannedPasswords(path string) (map[string]bool, error) {
+	banned := map[string]bool{}
+	if path == "" {
+		return banned, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		banned[strings.ToLower(line)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return banned, nil
+}
+
+// NewPasswordPolicy creates a PasswordPolicy, refusing unknown character classes
+func NewPasswordPolicy(minLength int, classes []string, banned map[string]bool, historySize int, maxAge time.Duration) (PasswordPolicy, *errors.AppError) {
+	if minLength < 1 {
+		return PasswordPolicy{}, errors.NewValidationError("Password minimum length must be at least 1")
+	}
+
+	required := make([]string, 0, len(classes))
+	for _, class := range classes {
+		class = strings.ToLower(strings.TrimSpace(class))
+		if _, known := passwordClasses[class]; !known {
+			return PasswordPolicy{}, errors.NewValidationError(fmt.Sprintf("Unknown password character class %q", class))
+		}
+		required = append(required, class)
+	}
+
+	return PasswordPolicy{
+		MinLength:       minLength,
+		RequiredClasses: required,
+		Banned:          banned,
+		HistorySize:     historySize,
+		MaxAge:          maxAge,
+	}, nil
+}
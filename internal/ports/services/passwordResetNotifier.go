@@ -0,0 +1,25 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+)
+
+// PasswordResetNotifier delivers a self-service reset token to its user
+type PasswordResetNotifier interface {
+	SendPasswordReset(user domain.User, token string, expires time.Time) *errors.AppError
+}
+
+// LogPasswordResetNotifier stands in until a delivery channel is configured.
+// It records that a reset was requested, never the token itself, so the
+// token cannot be used.
+type LogPasswordResetNotifier struct{}
+
+func (LogPasswordResetNotifier) SendPasswordReset(user domain.User, _ string, expires time.Time) *errors.AppError {
+	log.Printf("Password reset requested for user with ID %s, valid until %s; no delivery channel is configured",
+		user.IdNo, expires.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,23 @@
+package services
+
+import (
+	"context"
+
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+// canSeePersonalData reports whether the caller in ctx may see the names and
+// addresses of users in department
+func canSeePersonalData(ctx context.Context, department string) bool {
+	return authorize(ctx, domain.PermissionReadPersonal, department) == nil
+}
+
+// shape applies the field visibility rules of the caller in ctx to response, a
+// pointer to a DTO about a user in department. Every response describing a user
+// goes through it before leaving the service.
+func shape(ctx context.Context, department string, response interface{}) {
+	if !canSeePersonalData(ctx, department) {
+		dto.RedactPersonalData(response)
+	}
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+// retentionActor is recorded as the actor of every retention event
+const retentionActor = "retention-job"
+
+// RetentionService defines the interface for the deleted-user retention policy
+type RetentionService interface {
+	// Report lists what a run would do right now without changing anything
+	Report(ctx context.Context) (*dto.RetentionReportResponse, *errors.AppError)
+	// Run anonymizes and purges the users that are due
+	Run() (*dto.RetentionReportResponse, *errors.AppError)
+}
+
+// DefaultRetentionService is the default implementation of RetentionService
+type DefaultRetentionService struct {
+	repo            domain.RetentionRepository
+	retentionPeriod time.Duration    // Time after deletion before a user is anonymized
+	purgePeriod     time.Duration    // Time after deletion before a user is hard-deleted
+	now             func() time.Time // Clock, replaceable for tests
+}
+
+func (s DefaultRetentionService) Report(ctx context.Context) (*dto.RetentionReportResponse, *errors.AppError) {
+	if err := authorize(ctx, domain.PermissionReadRetention, ""); err != nil {
+		return nil, err
+	}
+
+	report, _, err := s.plan()
+	if err != nil {
+		return nil, err
+	}
+	report.DryRun = true
+	return report, nil
+}
+
+func (s DefaultRetentionService) Run() (*dto.RetentionReportResponse, *errors.AppError) {
+	report, cutoffs, err := s.plan()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, candidate := range report.Candidates {
+		var applyErr *errors.AppError
+		switch candidate.Action {
+		case domain.RetentionPurge:
+			event := domain.NewUserEvent(candidate.IdNo, domain.UserEventPurged, retentionActor, "")
+			applyErr = s.repo.PurgeUser(candidate.IdNo, cutoffs.purge, event)
+			if applyErr == nil {
+				report.Purged++
+			}
+		case domain.RetentionAnonymize:
+			event := domain.NewUserEvent(candidate.IdNo, domain.UserEventAnonymized, retentionActor, "")
+			applyErr = s.repo.AnonymizeUser(candidate.IdNo, cutoffs.anonymize, event)
+			if applyErr == nil {
+				report.Anonymized++
+			}
+		}
+
+		// One failing user must not stop the rest of the run
+		if applyErr != nil {
+			log.Printf("Retention %s of user with ID %s failed: %s", candidate.Action, candidate.IdNo, applyErr.Message)
+			report.Failed++
+		}
+	}
+
+	log.Printf("Retention run finished: %d anonymized, %d purged, %d failed", report.Anonymized, report.Purged, report.Failed)
+	return report, nil
+}
+
+// Start runs the retention policy every interval in a background goroutine
+func (s DefaultRetentionService) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := s.Run(); err != nil {
+				log.Printf("Retention run failed: %s", err.Message)
+			}
+		}
+	}()
+}
+
+type retentionCutoffs struct {
+	anonymize time.Time
+	purge     time.Time
+}
+
+// plan computes the cutoffs and the users due at this moment
+func (s DefaultRetentionService) plan() (*dto.RetentionReportResponse, retentionCutoffs, *errors.AppError) {
+	now := s.now()
+	cutoffs := retentionCutoffs{
+		anonymize: now.Add(-s.retentionPeriod),
+		purge:     now.Add(-s.purgePeriod),
+	}
+
+	c, err := s.repo.RetentionCandidates(cutoffs.anonymize, cutoffs.purge)
+	if err != nil {
+		return nil, cutoffs, err
+	}
+
+	candidates := make([]dto.RetentionCandidateResponse, 0, len(c))
+	for _, candidate := range c {
+		candidates = append(candidates, candidate.ToDto())
+	}
+	return &dto.RetentionReportResponse{
+		GeneratedAt:     now.Format(time.RFC3339),
+		AnonymizeBefore: cutoffs.anonymize.Format(time.RFC3339),
+		PurgeBefore:     cutoffs.purge.Format(time.RFC3339),
+		Candidates:      candidates,
+	}, cutoffs, nil
+}
+
+// NewRetentionService creates a new instance of DefaultRetentionService. The purge
+// period never ends before the retention period, so users are scrubbed first.
+func NewRetentionService(
+	repository domain.RetentionRepository,
+	retentionPeriod time.Duration,
+	purgePeriod time.Duration,
+) DefaultRetentionService {
+	if purgePeriod < retentionPeriod {
+		purgePeriod = retentionPeriod
+	}
+	return DefaultRetentionService{
+		repo:            repository,
+		retentionPeriod: retentionPeriod,
+		purgePeriod:     purgePeriod,
+		now:             time.Now,
+	}
+}
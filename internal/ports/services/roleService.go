@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+// RoleService defines the interface for assigning operator roles
+type RoleService interface {
+	Roles(ctx context.Context, idNo string) ([]dto.RoleAssignmentResponse, *errors.AppError)
+	GrantRole(ctx context.Context, req dto.RoleAssignmentRequest) (*dto.RoleAssignmentResponse, *errors.AppError)
+	RevokeRole(ctx context.Context, idNo, roleId string) *errors.AppError
+}
+
+// DefaultRoleService is the default implementation of RoleService
+type DefaultRoleService struct {
+	repo  domain.RoleRepository
+	urepo domain.UserRepository // Repository for user data
+}
+
+func (s DefaultRoleService) Roles(ctx context.Context, idNo string) ([]dto.RoleAssignmentResponse, *errors.AppError) {
+	if err := authorize(ctx, domain.PermissionManageRoles, ""); err != nil {
+		return nil, err
+	}
+	if _, err := s.urepo.IdNo(idNo); err != nil {
+		return nil, err
+	}
+
+	r, err := s.repo.Roles(idNo)
+	if err != nil {
+		return nil, err
+	}
+	roles := make([]dto.RoleAssignmentResponse, 0, len(r))
+	for _, role := range r {
+		roles = append(roles, role.ToDto())
+	}
+	return roles, nil
+}
+
+func (s DefaultRoleService) GrantRole(ctx context.Context, req dto.RoleAssignmentRequest) (*dto.RoleAssignmentResponse, *errors.AppError) {
+	if err := authorize(ctx, domain.PermissionManageRoles, ""); err != nil {
+		return nil, err
+	}
+	department := strings.TrimSpace(req.Department)
+	role := domain.RoleAssignment{
+		IdNo:       req.IdNo,
+		Role:       strings.ToLower(strings.TrimSpace(req.Role)),
+		Department: sql.NullString{String: department, Valid: department != ""},
+		CreatedBy:  actor(ctx),
+	}
+	if err := role.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Only accounts that can sign in can act on a role
+	user, err := s.urepo.IdNo(req.IdNo)
+	if err != nil {
+		return nil, err
+	}
+	if err := user.CanAuthenticate(); err != nil {
+		return nil, errors.NewConflictError("Cannot grant a role to an account that is not active")
+	}
+
+	event := domain.NewUserEvent(role.IdNo, domain.UserEventRoleGranted, actor(ctx), "")
+	granted, err := s.repo.GrantRole(role, event)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Role %s granted to user with ID %s", granted, granted.IdNo)
+	response := granted.ToDto()
+	return &response, nil
+}
+
+func (s DefaultRoleService) RevokeRole(ctx context.Context, idNo, roleId string) *errors.AppError {
+	if err := authorize(ctx, domain.PermissionManageRoles, ""); err != nil {
+		return err
+	}
+	id, convErr := strconv.ParseInt(roleId, 10, 64)
+	if convErr != nil {
+		return errors.NewBadRequestError("Invalid role assignment ID")
+	}
+
+	event := domain.NewUserEvent(idNo, domain.UserEventRoleRevoked, actor(ctx), "")
+	revoked, err := s.repo.RevokeRole(idNo, id, event)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Role %s revoked from user with ID %s", revoked, idNo)
+	return nil
+}
+
+// NewRoleService creates a new instance of DefaultRoleService
+func NewRoleService(roleRepo domain.RoleRepository, userRepo domain.UserRepository) DefaultRoleService {
+	return DefaultRoleService{
+		repo:  roleRepo,
+		urepo: userRepo,
+	}
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+// maxSmtpPasswordLength bounds what is sealed and sent in an AUTH command
+const maxSmtpPasswordLength = 256
+
+// SmtpCredentialService guards the SMTP passwords of users. They are only ever
+// decrypted for a component that sends mail or to verify them against the SMTP
+// server, never for an API response.
+type SmtpCredentialService interface {
+	// SmtpCredentials describes the SMTP login of a user without its password
+	SmtpCredentials(ctx context.Context, idNo string) (*dto.SmtpCredentialResponse, *errors.AppError)
+	// SetSmtpCredentials replaces the SMTP login of a user
+	SetSmtpCredentials(ctx context.Context, req dto.SmtpCredentialRequest) (*dto.SmtpCredentialResponse, *errors.AppError)
+	// RotateSmtpPassword replaces the SMTP password of a user who already has a login
+	RotateSmtpPassword(ctx context.Context, req dto.SmtpPasswordRequest) (*dto.SmtpCredentialResponse, *errors.AppError)
+	// ClearSmtpCredentials removes the SMTP login of a user
+	ClearSmtpCredentials(ctx context.Context, idNo, ticketNo string) *errors.AppError
+	// VerifySmtpCredentials tries the SMTP login of a user against the SMTP
+	// server and records the outcome
+	VerifySmtpCredentials(ctx context.Context, idNo string) (*dto.SmtpCredentialResponse, *errors.AppError)
+	// Login decrypts the SMTP login of a user for component, which must be one
+	// of the components allowed to send mail
+	Login(component, idNo string) (*domain.SmtpLogin, *errors.AppError)
+	// Reencrypt seals plaintext passwords and moves sealed ones to the active
+	// key, reading batchSize users at a time
+	Reencrypt(batchSize int) (*ReencryptionReport, *errors.AppError)
+}
+
+// ReencryptionReport counts the outcome of a Reencrypt run
+type ReencryptionReport struct {
+	Sealed    int // Plaintext passwords encrypted for the first time
+	Rewrapped int // Passwords moved from an older key to the active one
+	Failed    int // Passwords left as they were
+}
+
+// DefaultSmtpCredentialService is the default implementation of SmtpCredentialService
+type DefaultSmtpCredentialService struct {
+	repo      domain.SmtpCredentialRepository
+	sealer    domain.SecretSealer      // Encrypts passwords at rest
+	server    domain.SmtpAuthenticator // Mail server the logins are verified against
+	consumers map[string]bool          // Components allowed to decrypt passwords
+}
+
+func (s DefaultSmtpCredentialService) SmtpCredentials(ctx context.Context, idNo string) (*dto.SmtpCredentialResponse, *errors.AppError) {
+	credentials, err := s.repo.SmtpCredentials(idNo)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, domain.PermissionReadUsers, credentials.Department); err != nil {
+		return nil, err
+	}
+
+	response := credentials.ToDto()
+	shape(ctx, credentials.Department, &response)
+	return &response, nil
+}
+
+func (s DefaultSmtpCredentialService) SetSmtpCredentials(ctx context.Context, req dto.SmtpCredentialRequest) (*dto.SmtpCredentialResponse, *errors.AppError) {
+	current, err := s.manageable(ctx, req.IdNo)
+	if err != nil {
+		return nil, err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.SmtpEmail))
+	localPart, domainName, found := strings.Cut(email, "@")
+	if !found || domainName == "" || !validEmailAddress(localPart, domainName) {
+		return nil, errors.NewValidationError("Invalid smtp_email address")
+	}
+
+	next := *current
+	next.Email = email
+	return s.save(ctx, next, req.SmtpPassword, domain.UserEventSmtpSet, req.TicketNo)
+}
+
+func (s DefaultSmtpCredentialService) RotateSmtpPassword(ctx context.Context, req dto.SmtpPasswordRequest) (*dto.SmtpCredentialResponse, *errors.AppError) {
+	current, err := s.manageable(ctx, req.IdNo)
+	if err != nil {
+		return nil, err
+	}
+	if !current.Configured() {
+		return nil, errors.NewConflictError("User has no SMTP credentials to rotate")
+	}
+	return s.save(ctx, *current, req.SmtpPassword, domain.UserEventSmtpRotated, req.TicketNo)
+}
+
+func (s DefaultSmtpCredentialService) ClearSmtpCredentials(ctx context.Context, idNo, ticketNo string) *errors.AppError {
+	current, err := s.manageable(ctx, idNo)
+	if err != nil {
+		return err
+	}
+	if !current.Configured() && current.Email == "" {
+		return nil
+	}
+
+	event := domain.NewUserEvent(idNo, domain.UserEventSmtpCleared, actor(ctx), ticketNo)
+	if _, err := s.repo.SaveSmtpCredentials(domain.SmtpCredentials{IdNo: idNo}, event); err != nil {
+		return err
+	}
+
+	log.Printf("SMTP credentials of user with ID %s cleared by %s", idNo, actor(ctx))
+	return nil
+}
+
+func (s DefaultSmtpCredentialService) VerifySmtpCredentials(ctx context.Context, idNo string) (*dto.SmtpCredentialResponse, *errors.AppError) {
+	current, err := s.manageable(ctx, idNo)
+	if err != nil {
+		return nil, err
+	}
+	login, err := s.open(*current)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only a refusal from the server says the credentials are wrong; when the
+	// server cannot be reached nothing is recorded
+	status, message := domain.SmtpVerified, ""
+	if err := s.server.Authenticate(*login); err != nil {
+		if !errors.IsAuthenticationError(err) {
+			return nil, err
+		}
+		status, message = domain.SmtpRejected, err.Message
+	}
+
+	event := domain.NewUserEvent(idNo, domain.UserEventSmtpVerified, actor(ctx), "")
+	verified, err := s.repo.RecordSmtpVerification(idNo, status, message, event)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("SMTP credentials of user with ID %s verified by %s: %s", idNo, actor(ctx), status)
+	response := verified.ToDto()
+	shape(ctx, verified.Department, &response)
+	return &response, nil
+}
+
+func (s DefaultSmtpCredentialService) Login(component, idNo string) (*domain.SmtpLogin, *errors.AppError) {
+	if !s.consumers[component] {
+		log.Printf("Component %q refused the SMTP credentials of user with ID %s", component, idNo)
+		return nil, errors.NewAuthorizationError(fmt.Sprintf("Component %q may not read SMTP credentials", component))
+	}
+
+	credentials, err := s.repo.SmtpCredentials(idNo)
+	if err != nil {
+		return nil, err
+	}
+	login, err := s.open(*credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("SMTP credentials of user with ID %s decrypted for %s", idNo, component)
+	return login, nil
+}
+
+// manageable returns the SMTP login of a user the caller in ctx may manage
+func (s DefaultSmtpCredentialService) manageable(ctx context.Context, idNo string) (*domain.SmtpCredentials, *errors.AppError) {
+	credentials, err := s.repo.SmtpCredentials(idNo)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, domain.PermissionManageSmtp, credentials.Department); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// save seals password under the active key and stores it with the login of next
+func (s DefaultSmtpCredentialService) save(ctx context.Context, next domain.SmtpCredentials, password, action, ticketNo string) (*dto.SmtpCredentialResponse, *errors.AppError) {
+	if password == "" {
+		return nil, errors.NewValidationError("smtp_password is required")
+	}
+	if len(password) > maxSmtpPasswordLength {
+		return nil, errors.NewValidationError(fmt.Sprintf("smtp_password must be at most %d bytes", maxSmtpPasswordLength))
+	}
+
+	secret, err := s.sealer.Seal([]byte(password), next.IdNo)
+	if err != nil {
+		return nil, err
+	}
+
+	event := domain.NewUserEvent(next.IdNo, action, actor(ctx), ticketNo)
+	saved, err := s.repo.SaveSmtpCredentials(next.WithSecret(*secret), event)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("SMTP credentials of user with ID %s saved by %s (%s)", saved.IdNo, actor(ctx), action)
+	response := saved.ToDto()
+	shape(ctx, saved.Department, &response)
+	return &response, nil
+}
+
+// open decrypts a stored SMTP login
+func (s DefaultSmtpCredentialService) open(credentials domain.SmtpCredentials) (*domain.SmtpLogin, *errors.AppError) {
+	if !credentials.Configured() {
+		return nil, errors.NewNotFoundError("User has no SMTP credentials")
+	}
+
+	password := []byte(credentials.Password)
+	if credentials.Sealed() {
+		var err *errors.AppError
+		password, err = s.sealer.Open(credentials.Secret(), credentials.IdNo)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		log.Printf("SMTP password of user with ID %s is stored in plaintext; run reencrypt", credentials.IdNo)
+	}
+	return &domain.SmtpLogin{Email: credentials.Email, Password: string(password)}, nil
+}
+
+func (s DefaultSmtpCredentialService) Reencrypt(batchSize int) (*ReencryptionReport, *errors.AppError) {
+	activeKeyId := s.sealer.ActiveKeyId()
+	if activeKeyId == "" {
+		return nil, errors.NewUnExpectedError("No credential encryption key is configured")
+	}
+	if batchSize < 1 {
+		return nil, errors.NewValidationError("Batch size must be at least 1")
+	}
+
+	report := &ReencryptionReport{}
+	after := ""
+	for {
+		batch, err := s.repo.StaleSmtpCredentials(activeKeyId, after, batchSize)
+		if err != nil {
+			return report, err
+		}
+
+		for _, credentials := range batch {
+			after = credentials.IdNo
+			sealed, err := s.reencrypt(credentials)
+			if err != nil {
+				log.Printf("Could not re-encrypt the SMTP password of user with ID %s: %s", credentials.IdNo, err.Message)
+				report.Failed++
+				continue
+			}
+			if sealed {
+				report.Sealed++
+			} else {
+				report.Rewrapped++
+			}
+		}
+
+		if len(batch) < batchSize {
+			break
+		}
+	}
+
+	log.Printf("Re-encryption to key %s: %d sealed, %d rewrapped, %d failed",
+		activeKeyId, report.Sealed, report.Rewrapped, report.Failed)
+	return report, nil
+}
+
+// reencrypt brings one password under the active key and reports whether it
+// was plaintext before
+func (s DefaultSmtpCredentialService) reencrypt(credentials domain.SmtpCredentials) (bool, *errors.AppError) {
+	var secret *domain.SealedSecret
+	var err *errors.AppError
+	if credentials.Sealed() {
+		secret, err = s.sealer.Rewrap(credentials.Secret())
+	} else {
+		secret, err = s.sealer.Seal([]byte(credentials.Password), credentials.IdNo)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := s.repo.ReplaceSmtpPassword(credentials, credentials.WithSecret(*secret)); err != nil {
+		return false, err
+	}
+	return !credentials.Sealed(), nil
+}
+
+// NewSmtpCredentialService creates a new instance of DefaultSmtpCredentialService
+func NewSmtpCredentialService(repo domain.SmtpCredentialRepository, sealer domain.SecretSealer, server domain.SmtpAuthenticator, consumers []string) DefaultSmtpCredentialService {
+	allowed := make(map[string]bool, len(consumers))
+	for _, component := range consumers {
+		allowed[component] = true
+	}
+	return DefaultSmtpCredentialService{
+		repo:      repo,
+		sealer:    sealer,
+		server:    server,
+		consumers: allowed,
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+)
+
+// accessTokenType tells access tokens apart from any other JWT signed with the same key
+const accessTokenType = "access"
+
+// jwtHeader is the only header this service issues or accepts
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// AccessClaims are the claims carried by an access token
+type AccessClaims struct {
+	Subject   string `json:"sub"` // User id_no
+	Issuer    string `json:"iss"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	Id        string `json:"jti"`
+	Type      string `json:"typ"`
+}
+
+// Expires returns the expiry of the token as a time
+func (c AccessClaims) Expires() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// TokenSigner issues and verifies HS256 signed access tokens
+type TokenSigner struct {
+	key    []byte
+	issuer string
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// Issue signs a new access token for the user with the given id_no
+func (t TokenSigner) Issue(subject string) (string, AccessClaims, *errors.AppError) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", AccessClaims{}, err
+	}
+
+	now := t.now()
+	claims := AccessClaims{
+		Subject:   subject,
+		Issuer:    t.issuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(t.ttl).Unix(),
+		Id:        jti,
+		Type:      accessTokenType,
+	}
+	payload, jsonErr := json.Marshal(claims)
+	if jsonErr != nil {
+		return "", AccessClaims{}, errors.NewUnExpectedError("Error encoding access token")
+	}
+
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + t.sign(unsigned), claims, nil
+}
+
+// Verify checks the signature, issuer and expiry of an access token
+func (t TokenSigner) Verify(token string) (*AccessClaims, *errors.AppError) {
+	invalid := errors.NewAuthenticationError("Invalid access token")
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		// Comparing the header verbatim also rules out alg "none" and key confusion
+		return nil, invalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalid
+	}
+	expected, _ := base64.RawURLEncoding.DecodeString(t.sign(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, expected) {
+		return nil, invalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, invalid
+	}
+	var claims AccessClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, invalid
+	}
+	if claims.Type != accessTokenType || claims.Issuer != t.issuer || claims.Subject == "" || claims.Id == "" {
+		return nil, invalid
+	}
+	if !t.now().Before(claims.Expires()) {
+		return nil, errors.NewAuthenticationError("Access token has expired")
+	}
+	return &claims, nil
+}
+
+// TTL is how long issued access tokens stay valid
+func (t TokenSigner) TTL() time.Duration {
+	return t.ttl
+}
+
+func (t TokenSigner) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// randomToken returns n random bytes encoded for use in URLs and headers
+func randomToken(n int) (string, *errors.AppError) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.NewUnExpectedError("Error generating token")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the form of an opaque token that is stored server-side
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewTokenSigner creates a TokenSigner; key must be kept secret and stable
+// across restarts for issued tokens to remain valid
+func NewTokenSigner(key []byte, issuer string, ttl time.Duration) TokenSigner {
+	return TokenSigner{
+		key:    key,
+		issuer: issuer,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
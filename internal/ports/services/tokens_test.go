@@ -0,0 +1,154 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+var tokenTime = time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+// testSigner returns a signer whose clock reads the time held by now
+func testSigner(key, issuer string, now *time.Time) TokenSigner {
+	signer := NewTokenSigner([]byte(key), issuer, 15*time.Minute)
+	signer.now = func() time.Time { return *now }
+	return signer
+}
+
+// encodedClaims returns the payload segment of a token carrying claims
+func encodedClaims(t *testing.T, claims AccessClaims) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+// resignedToken encodes header and claims and signs them with key
+func resignedToken(t *testing.T, key, header string, claims AccessClaims) string {
+	t.Helper()
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + encodedClaims(t, claims)
+	return unsigned + "." + TokenSigner{key: []byte(key)}.sign(unsigned)
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	now := tokenTime
+	signer := testSigner("signing-key", "tracker", &now)
+
+	token, issued, err := signer.Issue("E100")
+	if err != nil {
+		t.Fatalf("Issue: %s", err.Message)
+	}
+	claims, err := signer.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify: %s", err.Message)
+	}
+	if *claims != issued || claims.Subject != "E100" || claims.IssuedAt != tokenTime.Unix() {
+		t.Errorf("claims = %+v, want %+v", *claims, issued)
+	}
+	if !claims.Expires().Equal(tokenTime.Add(15 * time.Minute)) {
+		t.Errorf("expires = %v, want 15 minutes after issue", claims.Expires())
+	}
+}
+
+func TestVerifyRefusesForgedTokens(t *testing.T) {
+	now := tokenTime
+	signer := testSigner("signing-key", "tracker", &now)
+	token, issued, _ := signer.Issue("E100")
+	parts := strings.Split(token, ".")
+
+	escalated := issued
+	escalated.Subject = "ADM"
+	otherType := issued
+	otherType.Type = "refresh"
+	noId := issued
+	noId.Id = ""
+
+	tests := map[string]string{
+		"payload swapped":       parts[0] + "." + encodedClaims(t, escalated) + "." + parts[2],
+		"signature changed":     parts[0] + "." + parts[1] + "." + flipFirstChar(parts[2]),
+		"signature missing":     parts[0] + "." + parts[1] + ".",
+		"signed with other key": resignedToken(t, "other-key", `{"alg":"HS256","typ":"JWT"}`, issued),
+		"alg none":              base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + parts[1] + ".",
+		"alg HS512":             resignedToken(t, "signing-key", `{"alg":"HS512","typ":"JWT"}`, issued),
+		"reordered header":      resignedToken(t, "signing-key", `{"typ":"JWT","alg":"HS256"}`, issued),
+		"other token type":      resignedToken(t, "signing-key", `{"alg":"HS256","typ":"JWT"}`, otherType),
+		"without token id":      resignedToken(t, "signing-key", `{"alg":"HS256","typ":"JWT"}`, noId),
+		"too few parts":         parts[0] + "." + parts[1],
+		"signature not base64":  parts[0] + "." + parts[1] + ".%%%",
+		"payload not json":      jwtHeader + ".bm90IGpzb24." + signer.sign(jwtHeader+".bm90IGpzb24"),
+		"empty":                 "",
+	}
+	for name, forged := range tests {
+		if claims, err := signer.Verify(forged); err == nil {
+			t.Errorf("%s: Verify = %+v, want it refused", name, *claims)
+		}
+	}
+}
+
+func TestVerifyChecksIssuerAndExpiry(t *testing.T) {
+	now := tokenTime
+	signer := testSigner("signing-key", "tracker", &now)
+	token, _, _ := signer.Issue("E100")
+
+	// The same key under another issuer name does not accept the token
+	other := testSigner("signing-key", "other-service", &now)
+	if _, err := other.Verify(token); err == nil {
+		t.Error("a token from another issuer was accepted")
+	}
+
+	now = tokenTime.Add(15*time.Minute - time.Second)
+	if _, err := signer.Verify(token); err != nil {
+		t.Errorf("Verify just before expiry: %s", err.Message)
+	}
+	now = tokenTime.Add(15 * time.Minute)
+	if _, err := signer.Verify(token); err == nil || !strings.Contains(err.Message, "expired") {
+		t.Errorf("Verify at expiry = %v, want it reported expired", err)
+	}
+}
+
+func TestPasswordChangeEndsTokensFromTheSameSecond(t *testing.T) {
+	now := tokenTime.Add(300 * time.Millisecond)
+	signer := testSigner("signing-key", "tracker", &now)
+
+	cases := []struct {
+		name    string
+		changed time.Time
+		valid   bool
+	}{
+		{"issued before the change", tokenTime.Add(time.Second), false},
+		{"issued in the second of the change", tokenTime.Add(700 * time.Millisecond), false},
+		{"issued earlier in the second of the change", tokenTime.Add(100 * time.Millisecond), false},
+		{"issued after the change", tokenTime.Add(-time.Second), true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			user := activeUser("E100")
+			user.DatePasswordChanged = sql.NullTime{Time: c.changed, Valid: true}
+			service := NewUserAuthService(newFakeUserAuthRepository(), newFakeUserRepository(user), &fakeSessions{}, fakeRoles{},
+				signer, time.Hour, time.Hour, LogPasswordResetNotifier{}, PasswordPolicy{}, LoginThrottle{}, nil, TOTP{}, nil)
+
+			token, _, _ := signer.Issue("E100")
+			_, err := service.Authenticate(token)
+			if c.valid && err != nil {
+				t.Errorf("Authenticate: %s, want the token accepted", err.Message)
+			}
+			if !c.valid && err == nil {
+				t.Error("Authenticate accepted a token the password change should have ended")
+			}
+		})
+	}
+}
+
+// flipFirstChar changes the first character of a base64url string, which
+// unlike the last one never holds only padding bits
+func flipFirstChar(s string) string {
+	if strings.HasPrefix(s, "A") {
+		return "B" + s[1:]
+	}
+	return "A" + s[1:]
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+)
+
+// Clock tells the current time, so time-based codes can be checked against a
+// fixed instant offline
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the wall clock
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// totpSecretBytes is the HMAC-SHA1 key length recommended by RFC 4226
+const totpSecretBytes = 20
+
+// totpEncoding is the unpadded base32 authenticator apps expect for secrets
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTP generates and checks RFC 6238 time-based one-time passwords with
+// HMAC-SHA1, the only algorithm every authenticator app supports
+type TOTP struct {
+	Issuer string        // Shown by authenticator apps next to the account
+	Digits int           // Length of a code
+	Period time.Duration // Time step a code is valid for
+	Skew   int           // Steps before and after the current one that are accepted
+	clock  Clock
+}
+
+// GenerateSecret returns a new random base32 secret
+func (t TOTP) GenerateSecret() (string, *errors.AppError) {
+	key := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(key); err != nil {
+		return "", errors.NewUnExpectedError("Error generating MFA secret")
+	}
+	return totpEncoding.EncodeToString(key), nil
+}
+
+// Step is the RFC 6238 time step at instant at
+func (t TOTP) Step(at time.Time) int64 {
+	return at.Unix() / int64(t.Period/time.Second)
+}
+
+// Code is the RFC 4226 one-time password of secret for step
+func (t TOTP) Code(secret string, step int64) (string, *errors.AppError) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", errors.NewUnExpectedError("Invalid MFA secret")
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulus := uint32(1)
+	for i := 0; i < t.Digits; i++ {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", t.Digits, value%modulus), nil
+}
+
+// Verify checks code against the steps around the current time and returns the
+// step it matched, so the caller can refuse it when it is used again
+func (t TOTP) Verify(secret, code string) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != t.Digits {
+		return 0, false
+	}
+	if _, err := strconv.Atoi(code); err != nil {
+		return 0, false
+	}
+
+	current := t.Step(t.clock.Now())
+	for step := current - int64(t.Skew); step <= current+int64(t.Skew); step++ {
+		expected, err := t.Code(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// URI is the otpauth:// key URI authenticator apps import, usually from a QR code
+func (t TOTP) URI(secret, account string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", t.Issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(t.Digits))
+	query.Set("period", strconv.Itoa(int(t.Period/time.Second)))
+
+	label := url.PathEscape(t.Issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// NewTOTP creates a TOTP with the usual six digits every thirty seconds,
+// accepting one step of clock drift either way
+func NewTOTP(issuer string, clock Clock) TOTP {
+	return TOTP{
+		Issuer: issuer,
+		Digits: 6,
+		Period: 30 * time.Second,
+		Skew:   1,
+		clock:  clock,
+	}
+}
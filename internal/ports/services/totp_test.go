@@ -0,0 +1,75 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 seed of the RFC 6238 appendix B test vectors
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPMatchesRFC6238Vectors(t *testing.T) {
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, v := range vectors {
+		now := time.Unix(v.unix, 0)
+		totp := TOTP{Digits: 8, Period: 30 * time.Second, Skew: 0, clock: fakeClock{now}}
+
+		got, err := totp.Code(rfc6238Secret, totp.Step(now))
+		if err != nil {
+			t.Fatalf("Code at %d: %s", v.unix, err.Message)
+		}
+		if got != v.code {
+			t.Errorf("Code at %d = %s, want %s", v.unix, got, v.code)
+		}
+		if step, ok := totp.Verify(rfc6238Secret, v.code); !ok || step != totp.Step(now) {
+			t.Errorf("Verify(%s) at %d = %d, %v, want step %d", v.code, v.unix, step, ok, totp.Step(now))
+		}
+	}
+}
+
+func TestTOTPAcceptsOnlyTheSkewWindow(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	totp := NewTOTP("Tracker", fakeClock{now})
+	current := totp.Step(now)
+
+	for offset := int64(-3); offset <= 3; offset++ {
+		code, err := totp.Code(rfc6238Secret, current+offset)
+		if err != nil {
+			t.Fatal(err.Message)
+		}
+		step, ok := totp.Verify(rfc6238Secret, code)
+		want := offset >= -1 && offset <= 1
+		if ok != want {
+			t.Errorf("code %+d steps away accepted = %v, want %v", offset, ok, want)
+		}
+		if ok && step != current+offset {
+			t.Errorf("code %+d steps away matched step %d, want %d", offset, step, current+offset)
+		}
+	}
+}
+
+func TestTOTPRejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	totp := NewTOTP("Tracker", fakeClock{now})
+	code, _ := totp.Code(rfc6238Secret, totp.Step(now))
+
+	if _, ok := totp.Verify(rfc6238Secret, code[:3]+" "+code[3:]); !ok {
+		t.Error("code typed with a space was refused")
+	}
+	for _, bad := range []string{"", code[:5], code + "0", "12345a"} {
+		if _, ok := totp.Verify(rfc6238Secret, bad); ok {
+			t.Errorf("Verify(%q) accepted a malformed code", bad)
+		}
+	}
+}
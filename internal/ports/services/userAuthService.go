@@ -1,9 +1,13 @@
 package services
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/jmechavez/email-account-tracker/errors"
 	"github.com/jmechavez/email-account-tracker/internal/domain"
@@ -14,35 +18,82 @@ import (
 // UserAuthService defines the interface for user authentication services
 type UserAuthService interface {
 	// CreatePassword creates a hashed password for a user
-	CreatePassword(user dto.UserPassCreateRequest) (*dto.UserPassCreateResponse, *errors.AppError)
+	CreatePassword(ctx context.Context, user dto.UserPassCreateRequest) (*dto.UserPassCreateResponse, *errors.AppError)
+	// Login checks a password and starts a session, or asks for the second factor
+	Login(req dto.LoginRequest) (*dto.TokenResponse, *errors.AppError)
+	// VerifyMfa completes a login that needs the second factor
+	VerifyMfa(req dto.MfaLoginRequest) (*dto.TokenResponse, *errors.AppError)
+	// Refresh exchanges a refresh token for a new token pair, rotating it
+	Refresh(req dto.RefreshTokenRequest) (*dto.TokenResponse, *errors.AppError)
+	// Logout revokes the session of a refresh token and the given access token
+	Logout(req dto.LogoutRequest) *errors.AppError
+	// Authenticate resolves a bearer access token to the caller it was issued to
+	Authenticate(accessToken string) (*domain.Principal, *errors.AppError)
+	// ChangePassword replaces the caller's own password given the current one
+	ChangePassword(ctx context.Context, req dto.ChangePasswordRequest) *errors.AppError
+	// ResetPassword sets a temporary password that must be changed at next login
+	ResetPassword(ctx context.Context, idNo string) (*dto.TemporaryPasswordResponse, *errors.AppError)
+	// RequestPasswordReset sends a single-use reset token to the user, if it exists
+	RequestPasswordReset(req dto.PasswordResetRequest) *errors.AppError
+	// ConfirmPasswordReset sets a new password with a reset token
+	ConfirmPasswordReset(req dto.PasswordResetConfirmRequest) *errors.AppError
+	// UnlockUser lifts a lockout caused by failed logins
+	UnlockUser(ctx context.Context, idNo string) *errors.AppError
 }
 
 // DefaultUserAuthService is the default implementation of UserAuthService
 type DefaultUserAuthService struct {
-	repo  domain.UserAuthRepository // Repository for user authentication
-	urepo domain.UserRepository     // Repository for user data
+	repo       domain.UserAuthRepository // Repository for user authentication
+	urepo      domain.UserRepository     // Repository for user data
+	sessions   domain.SessionRepository  // Server-side refresh tokens and revocations
+	roles      domain.RoleRepository     // Roles attached to the authenticated principal
+	tokens     TokenSigner               // Signs access tokens
+	refreshTTL time.Duration             // Lifetime of a refresh token
+	resetTTL   time.Duration             // Lifetime of a password reset token
+	notifier   PasswordResetNotifier     // Delivers password reset tokens
+	policy     PasswordPolicy            // Rules for new passwords
+	throttle   LoginThrottle             // Delays and lockouts after failed logins
+	mfa        mfaVerifier               // Second factor of enrolled users
 }
 
+// mfaChallengeTTL is how long the second factor can be given after the password
+const mfaChallengeTTL = 5 * time.Minute
+
+// dummyPasswordHash is compared against when a login names an unknown user, so
+// the response time does not reveal which users exist
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
 // CreatePassword creates a hashed password for a user
-func (s DefaultUserAuthService) CreatePassword(req dto.UserPassCreateRequest) (*dto.UserPassCreateResponse, *errors.AppError) {
+func (s DefaultUserAuthService) CreatePassword(ctx context.Context, req dto.UserPassCreateRequest) (*dto.UserPassCreateResponse, *errors.AppError) {
 
 	// Fetch the user by ID number
 	existingUser, err := s.urepo.IdNo(req.IdNo)
 	if err != nil {
 		return nil, errors.NewUnExpectedError("Error fetching user")
 	}
+	if err := authorize(ctx, domain.PermissionSetPasswords, existingUser.Department); err != nil {
+		return nil, err
+	}
+	if err := authorizeTakeover(ctx, s.roles, existingUser.IdNo); err != nil {
+		return nil, err
+	}
+
+	// Suspended, disabled and deleted accounts cannot authenticate; a pending
+	// one may get its first password ready for activation
+	if existingUser.Status != domain.StatusPending {
+		if err := existingUser.CanAuthenticate(); err != nil {
+			return nil, err
+		}
+	}
 
 	// Check if the user already has a password
 	if existingUser.HashedPassword != "" && existingUser.Salt != "" {
-		return nil, errors.NewBadRequestError("User already has a password")
+		return nil, errors.NewConflictError("User already has a password; change or reset it instead")
 	}
 
-	// Validate the password
-	if req.Password == "" {
-		return nil, errors.NewBadRequestError("Password cannot be empty")
-	}
-	if len(req.Password) < 8 {
-		return nil, errors.NewBadRequestError("Password must be at least 8 characters long")
+	// Validate the password against the policy
+	if err := s.checkPassword(*existingUser, req.Password); err != nil {
+		return nil, err
 	}
 
 	// Generate a hashed password
@@ -62,10 +113,12 @@ func (s DefaultUserAuthService) CreatePassword(req dto.UserPassCreateRequest) (*
 		IdNo:           req.IdNo,
 		HashedPassword: hashedPassword,
 		Salt:           salt,
+		UpdatedBy:      actor(ctx),
 	}
 
 	// Save the secure password in the repository
-	securePassword, err := s.repo.CreatePassword(user)
+	event := domain.NewUserEvent(user.IdNo, domain.UserEventPasswordCreated, actor(ctx), "")
+	securePassword, err := s.repo.CreatePassword(user, event)
 	if err != nil {
 		return nil, err
 	}
@@ -75,24 +128,636 @@ func (s DefaultUserAuthService) CreatePassword(req dto.UserPassCreateRequest) (*
 
 	// Create a response object
 	response := &dto.UserPassCreateResponse{
-		IdNo:           user.IdNo,
-		HashedPassword: user.HashedPassword,
-		Salt:           user.Salt,
+		IdNo:                securePassword.IdNo,
+		DatePasswordChanged: securePassword.DatePasswordChanged.Time.Format(time.RFC3339),
 	}
 
 	return response, nil
 }
 
-// GenerateHashedPassword generates a hashed password using bcrypt
-func (s DefaultUserAuthService) GenerateHashedPassword(password string) (string, *errors.AppError) {
+// Login checks the password against the stored bcrypt hash and issues a new
+// access token and refresh token
+func (s DefaultUserAuthService) Login(req dto.LoginRequest) (*dto.TokenResponse, *errors.AppError) {
+	idNo := strings.TrimSpace(req.IdNo)
+	email := strings.TrimSpace(req.Email)
+	if (idNo == "" && email == "") || req.Password == "" {
+		return nil, errors.NewValidationError("id_no or email, and password are required")
+	}
+
+	var user *domain.User
+	var err *errors.AppError
+	if idNo != "" {
+		user, err = s.urepo.IdNo(idNo)
+	} else {
+		user, err = s.urepo.Email(email)
+	}
+	if err != nil && !errors.IsNotFoundError(err) {
+		return nil, err
+	}
+
+	// Failures count against the user whichever way the login named them, and
+	// against what was typed when it names nobody
+	identity := unknownIdentity(idNo, email)
+	if user != nil {
+		identity = userIdentity(user.IdNo)
+	}
+
+	// Refuse before looking at the password while the identity or address is locked out
+	if err := s.throttle.Allow(req.IpAddress, identity); err != nil {
+		log.Printf("Throttled login for %s from %s", identity, req.IpAddress)
+		return nil, err
+	}
+
+	// Every credential failure gets the same answer
+	invalidCredentials := errors.NewAuthenticationError("Invalid credentials")
+	failed := func() (*dto.TokenResponse, *errors.AppError) {
+		if err := s.throttle.Failed(req.IpAddress, identity); err != nil {
+			return nil, err
+		}
+		return nil, invalidCredentials
+	}
+
+	if user == nil || user.HashedPassword == "" {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		return failed()
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(req.Password)) != nil {
+		log.Printf("Failed login for user with ID %s", user.IdNo)
+		return failed()
+	}
+	if err := s.throttle.Succeeded(identity); err != nil {
+		return nil, err
+	}
+
+	// Suspended, disabled and deleted accounts cannot authenticate
+	if err := user.CanAuthenticate(); err != nil {
+		return nil, err
+	}
+
+	// Enrolled users get a short-lived MFA token instead of a session
+	enrollment, err := s.mfa.repo.Enrollment(user.IdNo)
+	if err != nil && !errors.IsNotFoundError(err) {
+		return nil, err
+	}
+	if enrollment != nil && enrollment.Active() {
+		return s.startMfaChallenge(user.IdNo)
+	}
+
+	// Each login starts a new family of refresh tokens
+	familyId, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.issueTokens(user.IdNo, familyId, nil)
+	if err != nil {
+		return nil, err
+	}
+	response.PasswordChangeRequired = s.mustChangePassword(*user)
 
-	// Validate the password
+	log.Printf("User with ID %s logged in", user.IdNo)
+	return response, nil
+}
+
+// VerifyMfa checks the second factor against the MFA token of a login and
+// starts the session. Wrong codes count as failed logins of the user.
+func (s DefaultUserAuthService) VerifyMfa(req dto.MfaLoginRequest) (*dto.TokenResponse, *errors.AppError) {
+	if req.MfaToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		return nil, errors.NewValidationError("mfa_token, and code or recovery_code are required")
+	}
+	invalidToken := errors.NewAuthenticationError("Invalid or expired MFA token")
+
+	challenge, err := s.mfa.repo.Challenge(hashToken(req.MfaToken))
+	if err != nil {
+		if errors.IsNotFoundError(err) {
+			return nil, invalidToken
+		}
+		return nil, err
+	}
+	if err := challenge.Usable(time.Now()); err != nil {
+		return nil, err
+	}
+
+	identity := userIdentity(challenge.IdNo)
+	if err := s.throttle.Allow(req.IpAddress, identity); err != nil {
+		return nil, err
+	}
+
+	enrollment, err := s.mfa.repo.Enrollment(challenge.IdNo)
+	if err != nil {
+		if errors.IsNotFoundError(err) {
+			return nil, invalidToken
+		}
+		return nil, err
+	}
+	if err := s.mfa.Verify(*enrollment, req.Code, req.RecoveryCode); err != nil {
+		if errors.IsValidationError(err) {
+			return nil, err
+		}
+		log.Printf("Failed MFA for user with ID %s", challenge.IdNo)
+		if throttleErr := s.throttle.Failed(req.IpAddress, identity); throttleErr != nil {
+			return nil, throttleErr
+		}
+		return nil, err
+	}
+
+	if err := s.mfa.repo.UseChallenge(challenge.Id); err != nil {
+		if errors.IsConflictError(err) {
+			return nil, invalidToken
+		}
+		return nil, err
+	}
+	if err := s.throttle.Succeeded(identity); err != nil {
+		return nil, err
+	}
+
+	// The account may have been locked since the password was checked
+	user, err := s.urepo.IdNo(challenge.IdNo)
+	if err != nil {
+		return nil, err
+	}
+	if err := user.CanAuthenticate(); err != nil {
+		return nil, err
+	}
+
+	familyId, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.issueTokens(user.IdNo, familyId, nil)
+	if err != nil {
+		return nil, err
+	}
+	response.PasswordChangeRequired = s.mustChangePassword(*user)
+
+	log.Printf("User with ID %s logged in with MFA", user.IdNo)
+	return response, nil
+}
+
+// Refresh rotates a refresh token: the presented token is revoked and replaced.
+// Presenting an already rotated token ends the whole session, since it means
+// the token was copied.
+func (s DefaultUserAuthService) Refresh(req dto.RefreshTokenRequest) (*dto.TokenResponse, *errors.AppError) {
+	if req.RefreshToken == "" {
+		return nil, errors.NewValidationError("refresh_token is required")
+	}
+	invalidToken := errors.NewAuthenticationError("Invalid refresh token")
+
+	current, err := s.sessions.RefreshToken(hashToken(req.RefreshToken))
+	if err != nil {
+		if errors.IsNotFoundError(err) {
+			return nil, invalidToken
+		}
+		return nil, err
+	}
+	if current.DateRevoked.Valid {
+		log.Printf("Revoked refresh token reused for user with ID %s, ending session", current.IdNo)
+		if err := s.sessions.RevokeTokenFamily(current.FamilyId); err != nil {
+			return nil, err
+		}
+		return nil, invalidToken
+	}
+	if !time.Now().Before(current.DateExpires) {
+		return nil, errors.NewAuthenticationError("Refresh token has expired")
+	}
+
+	// The account may have been locked since the session started
+	user, err := s.urepo.IdNo(current.IdNo)
+	if err != nil {
+		return nil, err
+	}
+	if err := user.CanAuthenticate(); err != nil {
+		if revokeErr := s.sessions.RevokeTokenFamily(current.FamilyId); revokeErr != nil {
+			return nil, revokeErr
+		}
+		return nil, err
+	}
+
+	response, err := s.issueTokens(user.IdNo, current.FamilyId, current)
+	if err != nil {
+		if errors.IsConflictError(err) {
+			// Lost a race with another refresh of the same token
+			if revokeErr := s.sessions.RevokeTokenFamily(current.FamilyId); revokeErr != nil {
+				return nil, revokeErr
+			}
+			return nil, invalidToken
+		}
+		return nil, err
+	}
+	response.PasswordChangeRequired = s.mustChangePassword(*user)
+	return response, nil
+}
+
+// Logout revokes the session behind the refresh token and, when given, the
+// access token so it is refused before it expires
+func (s DefaultUserAuthService) Logout(req dto.LogoutRequest) *errors.AppError {
+	if req.RefreshToken == "" && req.AccessToken == "" {
+		return errors.NewValidationError("refresh_token or an access token is required")
+	}
+
+	if req.RefreshToken != "" {
+		current, err := s.sessions.RefreshToken(hashToken(req.RefreshToken))
+		if err != nil && !errors.IsNotFoundError(err) {
+			return err
+		}
+		// Logging out twice is not an error
+		if current != nil {
+			if err := s.sessions.RevokeTokenFamily(current.FamilyId); err != nil {
+				return err
+			}
+			log.Printf("User with ID %s logged out", current.IdNo)
+		}
+	}
+
+	if req.AccessToken != "" {
+		claims, err := s.tokens.Verify(req.AccessToken)
+		if err != nil {
+			// An expired or forged token needs no revoking
+			return nil
+		}
+		if err := s.sessions.RevokeAccessToken(claims.Id, claims.Expires()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Authenticate verifies an access token, refuses revoked tokens and checks the
+// account can still authenticate, so locking a user takes effect immediately
+func (s DefaultUserAuthService) Authenticate(accessToken string) (*domain.Principal, *errors.AppError) {
+	if accessToken == "" {
+		return nil, errors.NewAuthenticationError("Missing bearer token")
+	}
+	claims, err := s.tokens.Verify(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.sessions.IsAccessTokenRevoked(claims.Id)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errors.NewAuthenticationError("Access token has been revoked")
+	}
+
+	user, err := s.urepo.IdNo(claims.Subject)
+	if err != nil {
+		if errors.IsNotFoundError(err) {
+			return nil, errors.NewAuthenticationError("Invalid access token")
+		}
+		return nil, err
+	}
+	if err := user.CanAuthenticate(); err != nil {
+		return nil, errors.NewAuthenticationError(err.Message)
+	}
+	// Tokens issued before the password last changed belong to an ended session.
+	// iat only has whole seconds, so a token from the second of the change is
+	// refused too rather than outliving it
+	if user.DatePasswordChanged.Valid && claims.IssuedAt <= user.DatePasswordChanged.Time.Unix() {
+		return nil, errors.NewAuthenticationError("Session ended by a password change")
+	}
+
+	roles, err := s.roles.Roles(user.IdNo)
+	if err != nil {
+		return nil, err
+	}
+
+	grants := make([]domain.Grant, 0, len(roles))
+	for _, role := range roles {
+		grants = append(grants, role.Grant())
+	}
+
+	return &domain.Principal{
+		IdNo:      user.IdNo,
+		TokenId:   claims.Id,
+		ExpiresAt: claims.Expires(),
+		Grants:    grants,
+
+		MustChangePassword: s.mustChangePassword(*user),
+	}, nil
+}
+
+// ChangePassword checks the current password of the signed-in user, stores the
+// new one and ends every other session
+func (s DefaultUserAuthService) ChangePassword(ctx context.Context, req dto.ChangePasswordRequest) *errors.AppError {
+	principal, err := signedInUser(ctx)
+	if err != nil {
+		return err
+	}
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		return errors.NewValidationError("current_password and new_password are required")
+	}
+
+	user, err := s.urepo.IdNo(principal.IdNo)
+	if err != nil {
+		return err
+	}
+	if user.HashedPassword == "" ||
+		bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(req.CurrentPassword)) != nil {
+		return errors.NewAuthenticationError("Current password is incorrect")
+	}
+	if req.NewPassword == req.CurrentPassword {
+		return errors.NewValidationError("New password must differ from the current password")
+	}
+	if err := s.checkPassword(*user, req.NewPassword); err != nil {
+		return err
+	}
+
+	updated, err := s.passwordUpdate(user.IdNo, req.NewPassword, false, actor(ctx))
+	if err != nil {
+		return err
+	}
+	event := domain.NewUserEvent(user.IdNo, domain.UserEventPasswordChanged, actor(ctx), "")
+	if _, err := s.repo.SetPassword(*updated, event); err != nil {
+		return err
+	}
+
+	log.Printf("User with ID %s changed their password", user.IdNo)
+	return s.sessions.RevokeUserTokens(user.IdNo)
+}
+
+// ResetPassword replaces a user's password with a generated one that only
+// allows changing it, and ends the user's sessions
+func (s DefaultUserAuthService) ResetPassword(ctx context.Context, idNo string) (*dto.TemporaryPasswordResponse, *errors.AppError) {
+	user, err := s.urepo.IdNo(idNo)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, domain.PermissionSetPasswords, user.Department); err != nil {
+		return nil, err
+	}
+	if err := authorizeTakeover(ctx, s.roles, user.IdNo); err != nil {
+		return nil, err
+	}
+	if err := user.CanAuthenticate(); err != nil {
+		return nil, err
+	}
+
+	temporary, err := randomToken(12)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.passwordUpdate(user.IdNo, temporary, true, actor(ctx))
+	if err != nil {
+		return nil, err
+	}
+	event := domain.NewUserEvent(user.IdNo, domain.UserEventPasswordReset, actor(ctx), "")
+	if _, err := s.repo.SetPassword(*updated, event); err != nil {
+		return nil, err
+	}
+	if err := s.sessions.RevokeUserTokens(user.IdNo); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Password of user with ID %s reset by %s", user.IdNo, actor(ctx))
+	return &dto.TemporaryPasswordResponse{
+		IdNo:              user.IdNo,
+		TemporaryPassword: temporary,
+	}, nil
+}
+
+// RequestPasswordReset issues a reset token through the notifier. It answers
+// the same whether or not the user exists so it cannot be used to probe accounts.
+func (s DefaultUserAuthService) RequestPasswordReset(req dto.PasswordResetRequest) *errors.AppError {
+	idNo := strings.TrimSpace(req.IdNo)
+	email := strings.TrimSpace(req.Email)
+	if idNo == "" && email == "" {
+		return errors.NewValidationError("id_no or email is required")
+	}
+
+	var user *domain.User
+	var err *errors.AppError
+	if idNo != "" {
+		user, err = s.urepo.IdNo(idNo)
+	} else {
+		user, err = s.urepo.Email(email)
+	}
+	if err != nil && !errors.IsNotFoundError(err) {
+		return err
+	}
+
+	// Requests are limited per user and per address, and those naming nobody
+	// count too, so a throttled answer does not reveal which users exist
+	identity := unknownIdentity(idNo, email)
+	if user != nil {
+		identity = userIdentity(user.IdNo)
+	}
+	if err := s.throttle.AllowResetRequest(req.IpAddress, identity); err != nil {
+		log.Printf("Throttled password reset request for %s from %s", identity, req.IpAddress)
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+	if user.CanAuthenticate() != nil {
+		log.Printf("Password reset refused for locked user with ID %s", user.IdNo)
+		return nil
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	resetToken := domain.PasswordResetToken{
+		IdNo:        user.IdNo,
+		TokenHash:   hashToken(token),
+		DateExpires: time.Now().Add(s.resetTTL),
+	}
+	if err := s.repo.CreateResetToken(resetToken); err != nil {
+		return err
+	}
+
+	if err := s.notifier.SendPasswordReset(*user, token, resetToken.DateExpires); err != nil {
+		log.Printf("Could not deliver password reset for user with ID %s: %s", user.IdNo, err.Message)
+	}
+	return nil
+}
+
+// ConfirmPasswordReset uses up a reset token to set a new password and ends
+// every session of the user
+func (s DefaultUserAuthService) ConfirmPasswordReset(req dto.PasswordResetConfirmRequest) *errors.AppError {
+	if req.Token == "" || req.NewPassword == "" {
+		return errors.NewValidationError("token and new_password are required")
+	}
+	invalidToken := errors.NewAuthenticationError("Invalid or expired reset token")
+
+	token, err := s.repo.ResetToken(hashToken(req.Token))
+	if err != nil {
+		if errors.IsNotFoundError(err) {
+			return invalidToken
+		}
+		return err
+	}
+	if err := token.Usable(time.Now()); err != nil {
+		return err
+	}
+
+	user, err := s.urepo.IdNo(token.IdNo)
+	if err != nil {
+		return err
+	}
+	if err := user.CanAuthenticate(); err != nil {
+		return err
+	}
+	if err := s.checkPassword(*user, req.NewPassword); err != nil {
+		return err
+	}
+
+	updated, err := s.passwordUpdate(user.IdNo, req.NewPassword, false, user.IdNo)
+	if err != nil {
+		return err
+	}
+	event := domain.NewUserEvent(user.IdNo, domain.UserEventPasswordReset, user.IdNo, "")
+	if _, err := s.repo.ResetPassword(*token, *updated, event); err != nil {
+		if errors.IsConflictError(err) {
+			return invalidToken
+		}
+		return err
+	}
+
+	log.Printf("User with ID %s reset their password", user.IdNo)
+	return s.sessions.RevokeUserTokens(user.IdNo)
+}
+
+// UnlockUser clears the failed login counters of a user so they can log in
+// again before the lockout expires
+func (s DefaultUserAuthService) UnlockUser(ctx context.Context, idNo string) *errors.AppError {
+	user, err := s.urepo.IdNo(idNo)
+	if err != nil {
+		return err
+	}
+	if err := authorize(ctx, domain.PermissionSetPasswords, user.Department); err != nil {
+		return err
+	}
+	if err := s.throttle.Unlock(*user); err != nil {
+		return err
+	}
+
+	log.Printf("Login lockout of user with ID %s lifted by %s", user.IdNo, actor(ctx))
+	return nil
+}
+
+// checkPassword applies the password policy to a new password for user,
+// including reuse of the current and recent passwords
+func (s DefaultUserAuthService) checkPassword(user domain.User, password string) *errors.AppError {
+	violations := s.policy.Violations(password, user)
+
+	if s.policy.HistorySize > 0 {
+		previous, err := s.repo.PasswordHistory(user.IdNo, s.policy.HistorySize)
+		if err != nil {
+			return err
+		}
+		// Passwords set before the history was kept only exist on the user
+		if user.HashedPassword != "" {
+			previous = append(previous, user.HashedPassword)
+		}
+		for _, hash := range previous {
+			if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+				violations = append(violations, fmt.Sprintf("Password must differ from the last %d passwords", s.policy.HistorySize))
+				break
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return errors.NewValidationErrorWithDetails("Password does not meet the password policy", violations)
+	}
+	return nil
+}
+
+// mustChangePassword reports whether user may do nothing but change their
+// password, after an operator reset or once it is older than the policy allows
+func (s DefaultUserAuthService) mustChangePassword(user domain.User) bool {
+	return user.MustChangePassword || s.policy.Expired(user, time.Now())
+}
+
+// passwordUpdate hashes password into the user fields written by SetPassword
+// and ResetPassword
+func (s DefaultUserAuthService) passwordUpdate(idNo, password string, mustChange bool, updatedBy string) (*domain.User, *errors.AppError) {
+	hashedPassword, err := s.GenerateHashedPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	salt, err := s.GenerateSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.User{
+		IdNo:               idNo,
+		HashedPassword:     hashedPassword,
+		Salt:               salt,
+		MustChangePassword: mustChange,
+		UpdatedBy:          updatedBy,
+	}, nil
+}
+
+// startMfaChallenge stores a pending login for idNo and returns its MFA token
+func (s DefaultUserAuthService) startMfaChallenge(idNo string) (*dto.TokenResponse, *errors.AppError) {
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	challenge := domain.MfaChallenge{
+		IdNo:        idNo,
+		TokenHash:   hashToken(token),
+		DateExpires: time.Now().Add(mfaChallengeTTL),
+	}
+	if err := s.mfa.repo.CreateChallenge(challenge); err != nil {
+		return nil, err
+	}
+
+	log.Printf("User with ID %s passed the password check, waiting for MFA", idNo)
+	return &dto.TokenResponse{
+		MfaRequired:  true,
+		MfaToken:     token,
+		MfaExpiresIn: int(mfaChallengeTTL.Seconds()),
+	}, nil
+}
+
+// issueTokens signs an access token and stores a new refresh token in family,
+// rotating current out when it is not nil
+func (s DefaultUserAuthService) issueTokens(idNo, familyId string, current *domain.RefreshToken) (*dto.TokenResponse, *errors.AppError) {
+	accessToken, _, err := s.tokens.Issue(idNo)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	next := domain.RefreshToken{
+		IdNo:        idNo,
+		TokenHash:   hashToken(refreshToken),
+		FamilyId:    familyId,
+		DateExpires: time.Now().Add(s.refreshTTL),
+	}
+	if current == nil {
+		err = s.sessions.CreateRefreshToken(next)
+	} else {
+		err = s.sessions.RotateRefreshToken(*current, next)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.TokenResponse{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int(s.tokens.TTL().Seconds()),
+		RefreshToken:     refreshToken,
+		RefreshExpiresIn: int(s.refreshTTL.Seconds()),
+	}, nil
+}
+
+// GenerateHashedPassword generates a hashed password using bcrypt. Passwords
+// chosen by users are checked against the policy before they get here.
+func (s DefaultUserAuthService) GenerateHashedPassword(password string) (string, *errors.AppError) {
 	if password == "" {
 		return "", errors.NewBadRequestError("Password cannot be empty")
 	}
-	if len(password) < 8 {
-		return "", errors.NewBadRequestError("Password must be at least 8 characters long")
-	}
 
 	// Generate the hashed password
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -121,9 +786,29 @@ func (s DefaultUserAuthService) GenerateSalt() (string, *errors.AppError) {
 func NewUserAuthService(
 	authRepo domain.UserAuthRepository,
 	userRepo domain.UserRepository,
+	sessionRepo domain.SessionRepository,
+	roleRepo domain.RoleRepository,
+	tokens TokenSigner,
+	refreshTTL time.Duration,
+	resetTTL time.Duration,
+	notifier PasswordResetNotifier,
+	policy PasswordPolicy,
+	throttle LoginThrottle,
+	mfaRepo domain.MfaRepository,
+	totp TOTP,
+	sealer domain.SecretSealer,
 ) DefaultUserAuthService {
 	return DefaultUserAuthService{
-		repo:  authRepo,
-		urepo: userRepo,
+		repo:       authRepo,
+		urepo:      userRepo,
+		sessions:   sessionRepo,
+		roles:      roleRepo,
+		tokens:     tokens,
+		refreshTTL: refreshTTL,
+		resetTTL:   resetTTL,
+		notifier:   notifier,
+		policy:     policy,
+		throttle:   throttle,
+		mfa:        mfaVerifier{repo: mfaRepo, totp: totp, sealer: sealer},
 	}
 }
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+// filterDayLayout is the date-only form accepted by the listing filters
+const filterDayLayout = "2006-01-02"
+
+// newUserFilter converts and validates the raw listing request
+func newUserFilter(req dto.UserListRequest) (*domain.UserFilter, *errors.AppError) {
+	filter := domain.UserFilter{
+		Department:  strings.TrimSpace(req.Department),
+		Status:      strings.TrimSpace(req.Status),
+		EmailStatus: strings.TrimSpace(req.EmailStatus),
+		TicketNo:    strings.TrimSpace(req.TicketNo),
+		Search:      strings.TrimSpace(req.Search),
+		SortBy:      req.Sort,
+		Limit:       req.Limit,
+		Offset:      req.Offset,
+	}
+
+	switch strings.ToLower(req.Order) {
+	case "", "asc":
+	case "desc":
+		filter.SortDesc = true
+	default:
+		return nil, errors.NewValidationError("order must be asc or desc")
+	}
+
+	// A cursor carries the sort it was issued for, so pages stay consistent
+	if req.Cursor != "" {
+		token, err := decodeUserCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.SortBy = token.Sort
+		filter.SortDesc = token.Desc
+		filter.Cursor = &domain.UserCursor{Key: token.Key, IdNo: token.IdNo, Backward: token.Backward}
+	}
+
+	dates := []struct {
+		value    string
+		target   **time.Time
+		endOfDay bool
+	}{
+		{req.CreatedFrom, &filter.CreatedFrom, false},
+		{req.CreatedTo, &filter.CreatedTo, true},
+		{req.UpdatedFrom, &filter.UpdatedFrom, false},
+		{req.UpdatedTo, &filter.UpdatedTo, true},
+		{req.DeletedFrom, &filter.DeletedFrom, false},
+		{req.DeletedTo, &filter.DeletedTo, true},
+	}
+	for _, date := range dates {
+		if date.value == "" {
+			continue
+		}
+		parsed, err := parseFilterDate(date.value, date.endOfDay)
+		if err != nil {
+			return nil, err
+		}
+		*date.target = &parsed
+	}
+
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	return &filter, nil
+}
+
+// parseFilterDate accepts an RFC 3339 timestamp or a day. As an exclusive upper
+// bound a day moves to the next midnight so the whole day is included.
+func parseFilterDate(value string, endOfDay bool) (time.Time, *errors.AppError) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse(filterDayLayout, value)
+	if err != nil {
+		return time.Time{}, errors.NewValidationError("Invalid date " + value + ", use YYYY-MM-DD or RFC 3339")
+	}
+	if endOfDay {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+// userCursorToken is the JSON behind an opaque page cursor
+type userCursorToken struct {
+	Sort     string `json:"s"`
+	Desc     bool   `json:"d,omitempty"`
+	Key      string `json:"k"`
+	IdNo     string `json:"i"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// encodeUserCursor builds the cursor for the page next to user in the given direction
+func encodeUserCursor(filter domain.UserFilter, user domain.User, backward bool) string {
+	token := userCursorToken{
+		Sort:     filter.SortColumn(),
+		Desc:     filter.SortDesc,
+		Key:      user.IdNo,
+		IdNo:     user.IdNo,
+		Backward: backward,
+	}
+	if token.Sort == "date_created" {
+		token.Key = user.DateCreated.String
+	}
+	raw, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeUserCursor(cursor string) (*userCursorToken, *errors.AppError) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.NewValidationError("Invalid cursor")
+	}
+	var token userCursorToken
+	if err := json.Unmarshal(raw, &token); err != nil || token.IdNo == "" {
+		return nil, errors.NewValidationError("Invalid cursor")
+	}
+	return &token, nil
+}
+
+// pageCursors works out the cursors around a page. Offset pages get a next
+// cursor too when their sort supports keyset pagination.
+func pageCursors(filter domain.UserFilter, page domain.UserPage) (next, prev string) {
+	if len(page.Users) == 0 || !domain.KeysetSortFields[filter.SortColumn()] {
+		return "", ""
+	}
+	first, last := page.Users[0], page.Users[len(page.Users)-1]
+
+	if filter.Cursor != nil && filter.Cursor.Backward {
+		// Read backwards: the page we came from always follows
+		next = encodeUserCursor(filter, last, false)
+		if page.HasMore {
+			prev = encodeUserCursor(filter, first, true)
+		}
+		return next, prev
+	}
+
+	if page.HasMore {
+		next = encodeUserCursor(filter, last, false)
+	}
+	if filter.Cursor != nil || filter.Offset > 0 {
+		prev = encodeUserCursor(filter, first, true)
+	}
+	return next, prev
+}
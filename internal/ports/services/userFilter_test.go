@@ -0,0 +1,128 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"testing"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+// createdUser returns a user created at the given time
+func createdUser(idNo, created string) domain.User {
+	user := activeUser(idNo)
+	user.DateCreated = sql.NullString{String: created, Valid: true}
+	return user
+}
+
+func TestUserCursorRoundTrip(t *testing.T) {
+	// E200 and E300 were created in the same second
+	const created = "2026-03-01T09:00:00Z"
+	tests := []struct {
+		name     string
+		filter   domain.UserFilter
+		user     domain.User
+		backward bool
+		want     domain.UserCursor
+	}{
+		{"id_no", domain.UserFilter{}, createdUser("E200", created), false, domain.UserCursor{Key: "E200", IdNo: "E200"}},
+		{"id_no backward", domain.UserFilter{SortDesc: true}, createdUser("E200", created), true, domain.UserCursor{Key: "E200", IdNo: "E200", Backward: true}},
+		{"date_created tie E200", domain.UserFilter{SortBy: "date_created"}, createdUser("E200", created), false, domain.UserCursor{Key: created, IdNo: "E200"}},
+		{"date_created tie E300", domain.UserFilter{SortBy: "date_created", SortDesc: true}, createdUser("E300", created), true, domain.UserCursor{Key: created, IdNo: "E300", Backward: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor := encodeUserCursor(tt.filter, tt.user, tt.backward)
+
+			// The cursor brings back its sort whatever the next request asks for
+			filter, err := newUserFilter(dto.UserListRequest{Cursor: cursor, Sort: "last_name", Order: "asc", Limit: 10})
+			if err != nil {
+				t.Fatalf("newUserFilter: %s", err.Message)
+			}
+			if filter.SortColumn() != tt.filter.SortColumn() || filter.SortDesc != tt.filter.SortDesc {
+				t.Errorf("sort = %s desc %v, want %s desc %v", filter.SortColumn(), filter.SortDesc, tt.filter.SortColumn(), tt.filter.SortDesc)
+			}
+			if filter.Cursor == nil || *filter.Cursor != tt.want {
+				t.Errorf("cursor = %+v, want %+v", filter.Cursor, tt.want)
+			}
+		})
+	}
+
+	tied := domain.UserFilter{SortBy: "date_created"}
+	if encodeUserCursor(tied, createdUser("E200", created), false) == encodeUserCursor(tied, createdUser("E300", created), false) {
+		t.Error("users created in the same second got the same cursor")
+	}
+}
+
+func TestInvalidUserCursors(t *testing.T) {
+	for _, cursor := range []string{
+		"not base64!",
+		base64.RawURLEncoding.EncodeToString([]byte("not json")),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"s":"id_no","k":"E200"}`)), // No id_no
+		base64.RawURLEncoding.EncodeToString([]byte(`{"s":"last_name","k":"Cruz","i":"E200"}`)),
+	} {
+		if _, err := newUserFilter(dto.UserListRequest{Cursor: cursor, Limit: 10}); !errors.IsValidationError(err) {
+			t.Errorf("cursor %q = %v, want a validation error", cursor, err)
+		}
+	}
+	if _, err := newUserFilter(dto.UserListRequest{Cursor: encodeUserCursor(domain.UserFilter{}, activeUser("E200"), false), Limit: 10, Offset: 5}); !errors.IsValidationError(err) {
+		t.Errorf("cursor with an offset = %v, want a validation error", err)
+	}
+}
+
+func TestPageCursors(t *testing.T) {
+	users := []domain.User{createdUser("E200", "2026-03-01"), createdUser("E300", "2026-03-01")}
+	forward := &domain.UserCursor{Key: "E100", IdNo: "E100"}
+	backward := &domain.UserCursor{Key: "E400", IdNo: "E400", Backward: true}
+	tests := []struct {
+		name       string
+		filter     domain.UserFilter
+		page       domain.UserPage
+		next, prev *domain.UserCursor
+	}{
+		{"first page with more", domain.UserFilter{}, domain.UserPage{Users: users, HasMore: true},
+			&domain.UserCursor{Key: "E300", IdNo: "E300"}, nil},
+		{"only page", domain.UserFilter{}, domain.UserPage{Users: users}, nil, nil},
+		{"offset page", domain.UserFilter{Offset: 2}, domain.UserPage{Users: users},
+			nil, &domain.UserCursor{Key: "E200", IdNo: "E200", Backward: true}},
+		{"middle page", domain.UserFilter{Cursor: forward}, domain.UserPage{Users: users, HasMore: true},
+			&domain.UserCursor{Key: "E300", IdNo: "E300"}, &domain.UserCursor{Key: "E200", IdNo: "E200", Backward: true}},
+		{"last page", domain.UserFilter{Cursor: forward}, domain.UserPage{Users: users},
+			nil, &domain.UserCursor{Key: "E200", IdNo: "E200", Backward: true}},
+		{"backward page with more before", domain.UserFilter{Cursor: backward}, domain.UserPage{Users: users, HasMore: true},
+			&domain.UserCursor{Key: "E300", IdNo: "E300"}, &domain.UserCursor{Key: "E200", IdNo: "E200", Backward: true}},
+		{"backward page reaching the start", domain.UserFilter{Cursor: backward}, domain.UserPage{Users: users},
+			&domain.UserCursor{Key: "E300", IdNo: "E300"}, nil},
+		{"date_created keys", domain.UserFilter{SortBy: "date_created"}, domain.UserPage{Users: users, HasMore: true},
+			&domain.UserCursor{Key: "2026-03-01", IdNo: "E300"}, nil},
+		{"sort without keyset support", domain.UserFilter{SortBy: "last_name"}, domain.UserPage{Users: users, HasMore: true}, nil, nil},
+		{"empty page", domain.UserFilter{Cursor: forward}, domain.UserPage{}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, prev := pageCursors(tt.filter, tt.page)
+			checkCursor(t, "next", next, tt.next)
+			checkCursor(t, "prev", prev, tt.prev)
+		})
+	}
+}
+
+// checkCursor decodes cursor and compares it with want, where nil wants no cursor
+func checkCursor(t *testing.T, name, cursor string, want *domain.UserCursor) {
+	t.Helper()
+	if want == nil {
+		if cursor != "" {
+			t.Errorf("%s cursor = %q, want none", name, cursor)
+		}
+		return
+	}
+	token, err := decodeUserCursor(cursor)
+	if err != nil {
+		t.Fatalf("%s cursor %q: %s", name, cursor, err.Message)
+	}
+	if got := (domain.UserCursor{Key: token.Key, IdNo: token.IdNo, Backward: token.Backward}); got != *want {
+		t.Errorf("%s cursor = %+v, want %+v", name, got, *want)
+	}
+}
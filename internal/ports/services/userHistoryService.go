@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+// UserHistoryService defines the interface for reading the audit trail of a user
+type UserHistoryService interface {
+	History(ctx context.Context, idNo string, limit, offset int) (*dto.UserHistoryResponse, *errors.AppError)
+}
+
+// DefaultUserHistoryService is the default implementation of UserHistoryService
+type DefaultUserHistoryService struct {
+	repo  domain.UserEventRepository
+	urepo domain.UserRepository // Resolves the department the history belongs to
+}
+
+func (s DefaultUserHistoryService) History(ctx context.Context, idNo string, limit, offset int) (*dto.UserHistoryResponse, *errors.AppError) {
+	// A purged user has no department left, so only unscoped roles can read its history
+	var department string
+	user, err := s.urepo.IdNo(idNo)
+	if err != nil && !errors.IsNotFoundError(err) {
+		return nil, err
+	}
+	if user != nil {
+		department = user.Department
+	}
+	if err := authorize(ctx, domain.PermissionReadHistory, department); err != nil {
+		return nil, err
+	}
+
+	e, total, err := s.repo.History(idNo, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	// Purged users keep their history, so an empty trail is the only "not found"
+	if total == 0 {
+		return nil, errors.NewNotFoundError("No history for user")
+	}
+
+	personal := canSeePersonalData(ctx, department)
+	events := make([]dto.UserEventResponse, 0, len(e))
+	for _, event := range e {
+		if !personal {
+			event = event.WithoutPersonalData()
+		}
+		events = append(events, event.ToDto())
+	}
+	return &dto.UserHistoryResponse{
+		IdNo:   idNo,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+		Events: events,
+	}, nil
+}
+
+// NewUserHistoryService creates a new instance of DefaultUserHistoryService
+func NewUserHistoryService(repository domain.UserEventRepository, userRepo domain.UserRepository) DefaultUserHistoryService {
+	return DefaultUserHistoryService{
+		repo:  repository,
+		urepo: userRepo,
+	}
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -14,16 +15,26 @@ import (
 
 type UserService interface {
 	//UserNoDto() ([]domain.User, *errors.AppError)
-	Users(limit, offset int) ([]dto.UserEmailResponse, *errors.AppError)
-	IdNo(idNo string) (*dto.UserIdNoEmailResponse, *errors.AppError)
-	CreateUser(user dto.UserEmailRequest) (*dto.UserCreateResponse, *errors.AppError)
-	DeleteUser(user dto.UserEmailDeleteRequest) (*dto.UserEmailDeleteResponse, *errors.AppError)
-	UpdateUser(user dto.UserUpdateRequest) (*dto.UserUpdateResponse, *errors.AppError)
-	UpdateSurname(user dto.UserUpdateSurnameRequest) (*dto.UserUpdateSurnameResponse, *errors.AppError)
+	Users(ctx context.Context, req dto.UserListRequest) (*dto.UserPageResponse, *errors.AppError)
+	IdNo(ctx context.Context, idNo string) (*dto.UserIdNoEmailResponse, *errors.AppError)
+	CreateUser(ctx context.Context, user dto.UserEmailRequest) (*dto.UserCreateResponse, *errors.AppError)
+	DeleteUser(ctx context.Context, user dto.UserEmailDeleteRequest) (*dto.UserEmailDeleteResponse, *errors.AppError)
+	UpdateUser(ctx context.Context, user dto.UserUpdateRequest) (*dto.UserUpdateResponse, *errors.AppError)
+	UpdateSurname(ctx context.Context, user dto.UserUpdateSurnameRequest) (*dto.UserUpdateSurnameResponse, *errors.AppError)
+	RestoreUser(ctx context.Context, user dto.UserRestoreRequest) (*dto.UserUpdateResponse, *errors.AppError)
+	SuspendUser(ctx context.Context, user dto.UserSuspendRequest) (*dto.UserSuspensionResponse, *errors.AppError)
+	ReactivateUser(ctx context.Context, user dto.UserReactivateRequest) (*dto.UserSuspensionResponse, *errors.AppError)
 }
 
+// autoReactivationActor is recorded when a suspension ends at its suspended_until date
+const autoReactivationActor = "auto-reactivation"
+
 type DefaultUserService struct {
-	repo domain.UserRepository
+	repo        domain.UserRepository
+	domains     domain.MailDomainRepository // Resolves the domain a department mints under
+	strategies  []EmailStrategy             // Ordered strategies used by generateEmail
+	aliasPeriod time.Duration               // How long a replaced address stays as an alias
+	notifier    UserNotifier                // Tells users and managers about new addresses
 }
 
 // NoDto is used to return the User struct without the dto
@@ -36,32 +47,85 @@ type DefaultUserService struct {
 // }
 
 // User is used to return the User struct with the dto
-func (s DefaultUserService) Users(limit, offset int) ([]dto.UserEmailResponse, *errors.AppError) {
-	u, err := s.repo.Users(limit, offset)
+func (s DefaultUserService) Users(ctx context.Context, req dto.UserListRequest) (*dto.UserPageResponse, *errors.AppError) {
+	filter, err := newUserFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Department-scoped operators only ever see their own departments
+	departments, err := departmentScope(ctx, domain.PermissionReadUsers)
 	if err != nil {
 		return nil, err
 	}
-	var users []dto.UserEmailResponse
-	for _, user := range u {
-		users = append(users, user.ToDto())
+	filter.Departments = departments
+
+	page, err := s.repo.Users(*filter)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]dto.UserEmailResponse, 0, len(page.Users))
+	for _, user := range page.Users {
+		response := user.ToDto()
+		shape(ctx, user.Department, &response)
+		users = append(users, response)
 	}
-	return users, nil
+
+	next, prev := pageCursors(*filter, *page)
+	return &dto.UserPageResponse{
+		Items:      users,
+		Total:      page.Total,
+		Limit:      filter.Limit,
+		Offset:     filter.Offset,
+		NextCursor: next,
+		PrevCursor: prev,
+	}, nil
 }
 
-func (s DefaultUserService) IdNo(idNo string) (*dto.UserIdNoEmailResponse, *errors.AppError) {
+func (s DefaultUserService) IdNo(ctx context.Context, idNo string) (*dto.UserIdNoEmailResponse, *errors.AppError) {
 	u, err := s.repo.IdNo(idNo)
 	if err != nil {
 		return nil, err
 	}
+	if err := authorize(ctx, domain.PermissionReadUsers, u.Department); err != nil {
+		return nil, err
+	}
 
 	response := u.ToIdDto()
+	shape(ctx, u.Department, &response)
 	return &response, nil
 }
 
-func (s DefaultUserService) CreateUser(req dto.UserEmailRequest) (*dto.UserCreateResponse, *errors.AppError) {
-	email, err := s.generateEmail(req.FirstName, req.LastName, req.Suffix)
+func (s DefaultUserService) CreateUser(ctx context.Context, req dto.UserEmailRequest) (*dto.UserCreateResponse, *errors.AppError) {
+	if err := authorize(ctx, domain.PermissionCreateUsers, req.Department); err != nil {
+		return nil, err
+	}
+
+	// New accounts start active with their mailbox unless they are explicitly
+	// staged as pending, in which case the mailbox is still being provisioned
+	status := req.Status
+	if status == "" {
+		status = domain.StatusActive
+	}
+	emailStatus := req.EmailStatus
+	if emailStatus == "" {
+		emailStatus = domain.EmailStatusActive
+		if status == domain.StatusPending {
+			emailStatus = domain.EmailStatusProvisioning
+		}
+	}
+	if err := domain.ValidateInitialStates(status, emailStatus); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateManager(req.IdNo, req.ManagerIdNo); err != nil {
+		return nil, err
+	}
+
+	email, err := s.generateEmail(req.FirstName, req.LastName, req.Suffix, req.Department, "")
 	if err != nil {
-		return nil, err // Assuming generateEmail returns *errors.AppError, adjust if needed.
+		return nil, err
 	}
 
 	user := domain.User{
@@ -70,24 +134,29 @@ func (s DefaultUserService) CreateUser(req dto.UserEmailRequest) (*dto.UserCreat
 		FirstName:      req.FirstName,
 		LastName:       req.LastName,
 		Suffix:         req.Suffix,
-		Email:          email,
-		EmailStatus:    "active",
-		Status:         req.Status,
+		Email:          email.Address,
+		EmailStatus:    emailStatus,
+		Status:         status,
 		TicketNo:       sql.NullString{String: req.TicketNo, Valid: req.TicketNo != ""},
+		ManagerIdNo:    sql.NullString{String: req.ManagerIdNo, Valid: req.ManagerIdNo != ""},
 		ProfilePicture: "n/a",
 		DateCreated:    sql.NullString{String: time.Now().Format("2006-01-02 15:04:05"), Valid: true},
 		DateUpdated:    sql.NullString{String: time.Now().Format("2006-01-02 15:04:05"), Valid: true},
-		CreatedBy:      "admin",
-		UpdatedBy:      "admin",
+		CreatedBy:      actor(ctx),
+		UpdatedBy:      actor(ctx),
 	}
 
-	newUser, err := s.repo.CreateUser(user)
+	event := domain.NewUserEvent(user.IdNo, domain.UserEventCreated, user.CreatedBy, req.TicketNo)
+	newUser, err := s.repo.CreateUser(user, event)
 	if err != nil {
 		return nil, err
 	}
 
 	log.Printf("User with ID %s created successfully", newUser.IdNo)
 
+	user.Email = newUser.Email
+	s.notifier.UserCreated(user)
+
 	// Create a response using the data from newUser and original user
 	response := dto.UserCreateResponse{
 		IdNo:        newUser.IdNo,
@@ -101,24 +170,46 @@ func (s DefaultUserService) CreateUser(req dto.UserEmailRequest) (*dto.UserCreat
 		TicketNo:    user.TicketNo.String,
 		DateCreated: user.DateCreated.String,
 		CreatedBy:   user.CreatedBy,
+		ManagerIdNo: user.ManagerIdNo.String,
+		// Explain how the address was chosen
+		EmailStrategy: email.Strategy,
+		SkippedEmails: email.Skipped,
 	}
+	shape(ctx, user.Department, &response)
 
 	return &response, nil
 }
 
-func (s DefaultUserService) DeleteUser(req dto.UserEmailDeleteRequest) (*dto.UserEmailDeleteResponse, *errors.AppError) {
+func (s DefaultUserService) DeleteUser(ctx context.Context, req dto.UserEmailDeleteRequest) (*dto.UserEmailDeleteResponse, *errors.AppError) {
+	existingUser, err := s.repo.IdNo(req.IdNo)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, domain.PermissionDeleteUsers, existingUser.Department); err != nil {
+		return nil, err
+	}
+
+	// Both the account and its mailbox move to deleted
+	deleted := *existingUser
+	deleted.Status = domain.StatusDeleted
+	deleted.EmailStatus = domain.EmailStatusDeleted
+	if err := s.validateLifecycle(*existingUser, deleted, req.DeletedTicketNo); err != nil {
+		return nil, err
+	}
+
 	user := domain.User{
 		IdNo:      req.IdNo,
-		DeletedBy: sql.NullString{String: "admin", Valid: true},
+		DeletedBy: sql.NullString{String: actor(ctx), Valid: true},
 		DateDeleted: sql.NullString{
 			String: time.Now().Format(time.RFC3339),
 			Valid:  true,
 		},
 		DeletedTicketNo: sql.NullString{String: req.DeletedTicketNo, Valid: req.DeletedTicketNo != ""},
-		EmailStatus:     "deleted",
+		EmailStatus:     domain.EmailStatusDeleted,
 	}
 
-	deletedUser, err := s.repo.DeleteUser(user)
+	event := domain.NewUserEvent(user.IdNo, domain.UserEventDeleted, user.DeletedBy.String, req.DeletedTicketNo)
+	deletedUser, err := s.repo.DeleteUser(user, event)
 	if err != nil {
 		return nil, err
 	}
@@ -131,42 +222,252 @@ func (s DefaultUserService) DeleteUser(req dto.UserEmailDeleteRequest) (*dto.Use
 	return &response, nil
 }
 
-func (s DefaultUserService) UpdateSurname(req dto.UserUpdateSurnameRequest) (*dto.UserUpdateSurnameResponse, *errors.AppError) {
-	email, err := s.generateEmail(req.FirstName, req.LastName, req.Suffix)
+func (s DefaultUserService) RestoreUser(ctx context.Context, req dto.UserRestoreRequest) (*dto.UserUpdateResponse, *errors.AppError) {
+	// A restore is always traceable to a ticket
+	if req.RestoredTicketNo == "" {
+		return nil, errors.NewValidationError("Restore ticket number is required")
+	}
+
+	existingUser, err := s.repo.IdNo(req.IdNo)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, domain.PermissionRestoreUsers, existingUser.Department); err != nil {
+		return nil, err
+	}
+
+	// Both the account and its mailbox come back as active
+	restored := *existingUser
+	restored.Status = domain.StatusActive
+	restored.EmailStatus = domain.EmailStatusActive
+	if err := s.validateLifecycle(*existingUser, restored, req.RestoredTicketNo); err != nil {
+		return nil, err
+	}
+
+	user := domain.User{
+		IdNo:            req.IdNo,
+		UpdatedTicketNo: sql.NullString{String: req.RestoredTicketNo, Valid: true},
+		UpdatedBy:       actor(ctx),
+	}
+
+	event := domain.NewUserEvent(user.IdNo, domain.UserEventRestored, actor(ctx), req.RestoredTicketNo)
+	restoredUser, err := s.repo.RestoreUser(user, event)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("User with ID %s restored successfully", restoredUser.IdNo)
+	response := restoredUser.ToUpdateDto()
+	shape(ctx, restoredUser.Department, &response)
+	return &response, nil
+}
+
+func (s DefaultUserService) SuspendUser(ctx context.Context, req dto.UserSuspendRequest) (*dto.UserSuspensionResponse, *errors.AppError) {
+	if req.Reason == "" {
+		return nil, errors.NewValidationError("Suspension reason is required")
+	}
+
+	// Validate the optional auto-reactivation date
+	var suspendedUntil sql.NullString
+	if req.SuspendedUntil != "" {
+		until, parseErr := time.Parse(time.RFC3339, req.SuspendedUntil)
+		if parseErr != nil {
+			return nil, errors.NewValidationError("suspended_until must be an RFC 3339 timestamp")
+		}
+		if !until.After(time.Now()) {
+			return nil, errors.NewValidationError("suspended_until must be in the future")
+		}
+		suspendedUntil = sql.NullString{String: until.Format(time.RFC3339), Valid: true}
+	}
+
+	existingUser, err := s.repo.IdNo(req.IdNo)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, domain.PermissionSuspendUsers, existingUser.Department); err != nil {
+		return nil, err
+	}
+
+	user := *existingUser
+	user.Status = domain.StatusSuspended
+	if err := s.validateLifecycle(*existingUser, user, req.TicketNo); err != nil {
+		return nil, err
+	}
+
+	user.SuspensionReason = sql.NullString{String: req.Reason, Valid: true}
+	user.SuspendedUntil = suspendedUntil
+	user.UpdatedTicketNo = sql.NullString{String: req.TicketNo, Valid: true}
+	user.UpdatedBy = actor(ctx)
+
+	event := domain.NewUserEvent(user.IdNo, domain.UserEventSuspended, actor(ctx), req.TicketNo)
+	suspendedUser, err := s.repo.SuspendUser(user, event)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("User with ID %s suspended", suspendedUser.IdNo)
+	response := suspendedUser.ToSuspensionDto()
+	shape(ctx, suspendedUser.Department, &response)
+	return &response, nil
+}
+
+func (s DefaultUserService) ReactivateUser(ctx context.Context, req dto.UserReactivateRequest) (*dto.UserSuspensionResponse, *errors.AppError) {
+	existingUser, err := s.repo.IdNo(req.IdNo)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, domain.PermissionSuspendUsers, existingUser.Department); err != nil {
+		return nil, err
+	}
+	response, err := s.reactivate(*existingUser, actor(ctx), req.TicketNo)
+	if err != nil {
+		return nil, err
+	}
+	shape(ctx, existingUser.Department, response)
+	return response, nil
+}
+
+// reactivate lifts the suspension of user on behalf of actor
+func (s DefaultUserService) reactivate(existingUser domain.User, actor, ticketNo string) (*dto.UserSuspensionResponse, *errors.AppError) {
+	// Only a suspension can be lifted here; disabled accounts go through UpdateUser
+	if existingUser.Status != domain.StatusSuspended {
+		return nil, errors.NewConflictError("User is not suspended")
+	}
+
+	user := existingUser
+	user.Status = domain.StatusActive
+	if err := s.validateLifecycle(existingUser, user, ticketNo); err != nil {
+		return nil, err
+	}
+
+	user.UpdatedTicketNo = sql.NullString{String: ticketNo, Valid: true}
+	user.UpdatedBy = actor
+
+	event := domain.NewUserEvent(user.IdNo, domain.UserEventReactivated, actor, ticketNo)
+	reactivatedUser, err := s.repo.ReactivateUser(user, event)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("User with ID %s reactivated", reactivatedUser.IdNo)
+	response := reactivatedUser.ToSuspensionDto()
+	return &response, nil
+}
+
+// ReactivateExpiredSuspensions lifts every suspension whose suspended_until has
+// passed, under the ticket the suspension was made with
+func (s DefaultUserService) ReactivateExpiredSuspensions() *errors.AppError {
+	users, err := s.repo.ExpiredSuspensions(time.Now())
 	if err != nil {
-		return nil, err // Assuming generateEmail returns *errors.AppError, adjust if needed.
+		return err
 	}
 
+	for _, user := range users {
+		if _, err := s.reactivate(user, autoReactivationActor, user.UpdatedTicketNo.String); err != nil {
+			log.Printf("Auto-reactivation of user with ID %s failed: %s", user.IdNo, err.Message)
+		}
+	}
+	return nil
+}
+
+// StartAutoReactivation checks for expired suspensions every interval in a background goroutine
+func (s DefaultUserService) StartAutoReactivation(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := s.ReactivateExpiredSuspensions(); err != nil {
+				log.Printf("Auto-reactivation failed: %s", err.Message)
+			}
+		}
+	}()
+}
+
+func (s DefaultUserService) UpdateSurname(ctx context.Context, req dto.UserUpdateSurnameRequest) (*dto.UserUpdateSurnameResponse, *errors.AppError) {
 	// First, get the existing user
 	existingUser, err := s.repo.IdNo(req.IdNo)
 	if err != nil {
 		return nil, err
 	}
+	if err := authorize(ctx, domain.PermissionChangeSurname, existingUser.Department); err != nil {
+		return nil, err
+	}
+
+	// Deleted, suspended and pending users keep their address until restored,
+	// reactivated or activated
+	if err := existingUser.CanChangeAddress(); err != nil {
+		return nil, err
+	}
+	before := *existingUser
+
+	// Fall back to the stored name parts when the request leaves them out
+	firstName := req.FirstName
+	if firstName == "" {
+		firstName = existingUser.FirstName
+	}
+	suffix := req.Suffix
+	if suffix == "" {
+		suffix = existingUser.Suffix
+	}
+
+	// The user's own current address does not count as taken
+	email, err := s.generateEmail(firstName, req.LastName, suffix, existingUser.Department, existingUser.IdNo)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the previous address as an alias for the grace period
+	var alias *domain.EmailAlias
+	previousEmail := existingUser.Email
+	if !strings.EqualFold(previousEmail, email.Address) {
+		alias = &domain.EmailAlias{
+			IdNo:        existingUser.IdNo,
+			Alias:       previousEmail,
+			Reason:      sql.NullString{String: "Surname change", Valid: true},
+			TicketNo:    sql.NullString{String: req.UpdatedTicketNo, Valid: req.UpdatedTicketNo != ""},
+			DateExpires: sql.NullString{String: time.Now().Add(s.aliasPeriod).Format(time.RFC3339), Valid: true},
+			CreatedBy:   actor(ctx),
+		}
+	}
 
 	// Update the surname
 	existingUser.LastName = req.LastName
-	existingUser.Email = email
+	existingUser.Email = email.Address
 	existingUser.UpdatedTicketNo = sql.NullString{String: req.UpdatedTicketNo, Valid: req.UpdatedTicketNo != ""}
-	existingUser.UpdatedBy = req.UpdatedBy
+	existingUser.UpdatedBy = actor(ctx)
 	existingUser.DateUpdated = sql.NullString{String: time.Now().Format("2006-01-02 15:04:05"), Valid: true}
 
+	if err := s.validateLifecycle(before, *existingUser, req.UpdatedTicketNo); err != nil {
+		return nil, err
+	}
+
 	// Call the repository
-	updatedUser, err := s.repo.UpdateSurname(*existingUser)
+	event := domain.NewUserEvent(existingUser.IdNo, domain.UserEventSurnameChanged, actor(ctx), req.UpdatedTicketNo)
+	updatedUser, err := s.repo.UpdateSurname(*existingUser, alias, event)
 	if err != nil {
 		return nil, err
 	}
 
 	response := updatedUser.ToUpdateSurnameDto()
+	if alias != nil {
+		response.PreviousEmail = alias.Alias
+		response.AliasExpires = alias.DateExpires.String
+		s.notifier.AddressChanged(*updatedUser, alias.Alias, alias.DateExpires.String)
+	}
+	shape(ctx, updatedUser.Department, &response)
 
 	return &response, nil
 }
 
-func (s DefaultUserService) UpdateUser(req dto.UserUpdateRequest) (*dto.UserUpdateResponse, *errors.AppError) {
+func (s DefaultUserService) UpdateUser(ctx context.Context, req dto.UserUpdateRequest) (*dto.UserUpdateResponse, *errors.AppError) {
 	// First, get the existing user
 	existingUser, err := s.repo.IdNo(req.IdNo)
 	if err != nil {
 		return nil, err
 	}
+	if err := authorize(ctx, domain.PermissionUpdateUsers, existingUser.Department); err != nil {
+		return nil, err
+	}
 
 	// Start with the existing user data
 	user := *existingUser
@@ -184,8 +485,11 @@ func (s DefaultUserService) UpdateUser(req dto.UserUpdateRequest) (*dto.UserUpda
 	if req.Suffix != "" {
 		user.Suffix = req.Suffix
 	}
-	if req.Email != "" {
-		user.Email = req.Email
+	// The address is only ever generated, by create and surname changes, so
+	// that it is validated, unique across aliases and the old one kept as an
+	// alias; echoing the current address back is harmless
+	if req.Email != "" && !strings.EqualFold(strings.TrimSpace(req.Email), existingUser.Email) {
+		return nil, errors.NewValidationError("Email cannot be changed here; use the surname endpoint to generate a new address")
 	}
 	if req.EmailStatus != "" {
 		user.EmailStatus = req.EmailStatus
@@ -199,43 +503,153 @@ func (s DefaultUserService) UpdateUser(req dto.UserUpdateRequest) (*dto.UserUpda
 	if req.ProfilePicture != "" {
 		user.ProfilePicture = req.ProfilePicture
 	}
+	if req.ManagerIdNo != "" {
+		if err := s.validateManager(user.IdNo, req.ManagerIdNo); err != nil {
+			return nil, err
+		}
+		user.ManagerIdNo = sql.NullString{String: req.ManagerIdNo, Valid: true}
+	}
+
+	// Moving a user needs the permission in the target department as well
+	if user.Department != existingUser.Department {
+		if err := authorize(ctx, domain.PermissionUpdateUsers, user.Department); err != nil {
+			return nil, err
+		}
+	}
+
+	// Deletion and restore have their own endpoints and side effects
+	if user.Status != existingUser.Status &&
+		(user.Status == domain.StatusDeleted || existingUser.Status == domain.StatusDeleted) {
+		return nil, errors.NewConflictError("Use the delete and restore endpoints to delete or restore a user")
+	}
+
+	// Suspensions record a reason and an end date, and lifting one needs its own permission
+	if user.Status != existingUser.Status &&
+		(user.Status == domain.StatusSuspended || existingUser.Status == domain.StatusSuspended) {
+		return nil, errors.NewConflictError("Use the suspend and reactivate endpoints to suspend or reactivate a user")
+	}
+
+	// Status changes must follow the account and mailbox lifecycles
+	if err := s.validateLifecycle(*existingUser, user, req.UpdatedTicketNo); err != nil {
+		return nil, err
+	}
 
 	// These fields are always updated
-	user.UpdatedBy = req.UpdatedBy
+	user.UpdatedBy = actor(ctx)
 
 	// Call the repository
-	updatedUser, err := s.repo.UpdateUser(user)
+	event := domain.NewUserEvent(user.IdNo, domain.UserEventUpdated, actor(ctx), req.UpdatedTicketNo)
+	updatedUser, err := s.repo.UpdateUser(user, event)
 	if err != nil {
 		return nil, err
 	}
 
 	response := updatedUser.ToUpdateDto()
+	shape(ctx, updatedUser.Department, &response)
 
 	return &response, nil
 
 }
 
-func (s DefaultUserService) generateEmail(firstName, lastName, suffix string) (string, *errors.AppError) {
-	// 1. Normalize the names (lowercase, remove spaces, remove dots)
-	normalizedFirstName := strings.ToLower(strings.ReplaceAll(firstName, " ", ""))
-	normalizedLastName := strings.ToLower(strings.ReplaceAll(lastName, " ", ""))
+// validateManager checks that managerIdNo, when given, names another user who
+// has not been deleted
+func (s DefaultUserService) validateManager(idNo, managerIdNo string) *errors.AppError {
+	if managerIdNo == "" {
+		return nil
+	}
+	if managerIdNo == idNo {
+		return errors.NewValidationError("A user cannot be their own manager")
+	}
+	manager, err := s.repo.IdNo(managerIdNo)
+	if err != nil {
+		if errors.IsNotFoundError(err) {
+			return errors.NewValidationError("Manager not found")
+		}
+		return err
+	}
+	if manager.Status == domain.StatusDeleted {
+		return errors.NewValidationError("Manager has been deleted")
+	}
+	return nil
+}
+
+// validateLifecycle checks the status and email_status changes between two versions of a user
+func (s DefaultUserService) validateLifecycle(before, after domain.User, ticketNo string) *errors.AppError {
+	if err := domain.AccountLifecycle.ValidateTransition(after, before.Status, after.Status, ticketNo); err != nil {
+		return err
+	}
+	return domain.EmailLifecycle.ValidateTransition(after, before.EmailStatus, after.EmailStatus, ticketNo)
+}
+
+func (s DefaultUserService) generateEmail(firstName, lastName, suffix, department, excludeIdNo string) (*generatedEmail, *errors.AppError) {
+	// 1. Normalize the names (transliterate, lowercase, drop punctuation)
+	name, err := newEmailName(firstName, lastName, suffix)
+	if err != nil {
+		return nil, err
+	}
 
-	// 2. Handle the suffix (if any)
-	suffixPart := ""
-	if suffix != "" {
-		suffixPart = strings.ToLower(strings.ReplaceAll(strings.ReplaceAll(suffix, " ", ""), ".", ""))
+	// Resolve the domain routed to the department, or the default domain
+	mailDomain, err := s.domains.DomainForDepartment(department)
+	if err != nil {
+		if errors.IsNotFoundError(err) {
+			return nil, errors.NewValidationError("No mail domain configured for department " + department)
+		}
+		return nil, err
 	}
 
-	// 3. Construct the email address
-	email := fmt.Sprintf("%s.%s%s@test.com", normalizedFirstName, normalizedLastName, suffixPart)
+	// 2. Walk the configured strategies and pick the first free address
+	result := &generatedEmail{}
+	valid := 0
+	for _, strategy := range s.strategies {
+		for _, localPart := range strategy.Candidates(name) {
+			// Candidates breaking RFC 5321 rules are never offered
+			if !validEmailAddress(localPart, mailDomain.Name) {
+				continue
+			}
+			valid++
+			email := fmt.Sprintf("%s@%s", localPart, mailDomain.Name)
+
+			// 3. Consult the repository, soft-deleted users included
+			exists, err := s.repo.EmailExists(email, excludeIdNo)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				result.Skipped = append(result.Skipped, email)
+				continue
+			}
+
+			result.Address = email
+			result.Strategy = strategy.Name
+			return result, nil
+		}
+	}
 
-	// 4. Validate the email (optional, but recommended)
-	// Add email validation logic here if needed.
+	if valid == 0 {
+		return nil, errors.NewValidationError("Name is too long to produce a valid email address")
+	}
 
-	return email, nil
+	log.Printf("No free email address for %s %s, skipped %d candidates", firstName, lastName, len(result.Skipped))
+	return nil, errors.NewConflictError("No available email address for this user")
 }
 
-
-func NewUserService(repository domain.UserRepository) DefaultUserService {
-	return DefaultUserService{repository}
+// NewUserService creates a new instance of DefaultUserService, falling back to
+// DefaultEmailStrategies when no strategies are given
+func NewUserService(
+	repository domain.UserRepository,
+	domainRepo domain.MailDomainRepository,
+	strategies []EmailStrategy,
+	aliasPeriod time.Duration,
+	notifier UserNotifier,
+) DefaultUserService {
+	if len(strategies) == 0 {
+		strategies, _ = EmailStrategiesByName(DefaultEmailStrategies)
+	}
+	return DefaultUserService{
+		repo:        repository,
+		domains:     domainRepo,
+		strategies:  strategies,
+		aliasPeriod: aliasPeriod,
+		notifier:    notifier,
+	}
 }
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jmechavez/email-account-tracker/errors"
+	"github.com/jmechavez/email-account-tracker/internal/domain"
+	"github.com/jmechavez/email-account-tracker/internal/dto"
+)
+
+func TestUpdateSurnameNeedsAnActiveAccount(t *testing.T) {
+	tests := []struct {
+		status, emailStatus string
+	}{
+		{domain.StatusDeleted, domain.EmailStatusDeleted},
+		{domain.StatusSuspended, domain.EmailStatusActive},
+		{domain.StatusPending, domain.EmailStatusProvisioning},
+		{domain.StatusDisabled, domain.EmailStatusForwarding},
+	}
+	for _, tt := range tests {
+		user := activeUser("E100")
+		user.Status, user.EmailStatus = tt.status, tt.emailStatus
+		repo := newFakeUserRepository(user)
+		service := NewUserService(repo, fakeMailDomains{}, nil, 30*24*time.Hour, silentNotifier{})
+
+		req := dto.UserUpdateSurnameRequest{IdNo: "E100", LastName: "Cruz", UpdatedTicketNo: "T-3"}
+		if _, err := service.UpdateSurname(adminCtx(operatorIdNo), req); !errors.IsConflictError(err) {
+			t.Errorf("surname change of a %s user = %v, want a conflict", tt.status, err)
+		}
+		if len(repo.writes) != 0 {
+			t.Errorf("surname change of a %s user wrote %+v, want nothing", tt.status, repo.writes)
+		}
+	}
+}
@@ -11,11 +11,13 @@ window.userApp = function() {
         },
 
         fetchUsers() {
-            fetch('http://localhost:8000/users')
+            fetch('http://localhost:8000/users', {
+                headers: { 'Authorization': `Bearer ${localStorage.getItem('access_token') || ''}` }
+            })
                 .then(response => response.json())
-                .then(data => {
-                    console.log('Users data:', data);
-                    this.users = data;
+                .then(page => {
+                    console.log('Users page:', page);
+                    this.users = page.items;
                 })
                 .catch(error => {
                     console.error('Error fetching users:', error);